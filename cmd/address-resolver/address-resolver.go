@@ -0,0 +1,9 @@
+package main
+
+import (
+	"github.com/SkycoinProject/skywire-mainnet/cmd/address-resolver/commands"
+)
+
+func main() {
+	commands.Execute()
+}
@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"context"
+	"log"
+	"log/syslog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+	logrussyslog "github.com/sirupsen/logrus/hooks/syslog"
+	"github.com/spf13/cobra"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/address-resolver/arserver"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/util/buildinfo"
+)
+
+const gcInterval = time.Minute
+
+var (
+	addr       string
+	udpAddr    string
+	entryTTL   time.Duration
+	syslogAddr string
+	tag        string
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "address-resolver",
+	Short: "Address Resolver Server for skywire",
+	Long:  "Resolves public keys of visors to addresses of their stcp and sudp listeners, and serves as sudph rendezvous.",
+	Run: func(_ *cobra.Command, _ []string) {
+		if _, err := buildinfo.Get().WriteTo(log.Writer()); err != nil {
+			log.Printf("Failed to output build info: %v", err)
+		}
+
+		logger := logging.MustGetLogger(tag)
+		if syslogAddr != "" {
+			hook, err := logrussyslog.NewSyslogHook("udp", syslogAddr, syslog.LOG_INFO, tag)
+			if err != nil {
+				logger.Fatalf("Unable to connect to syslog daemon on %v", syslogAddr)
+			}
+			logging.AddHook(hook)
+		}
+
+		srv := arserver.New(logger, entryTTL)
+		go srv.ServeGC(context.Background(), gcInterval)
+
+		if udpAddr != "" {
+			conn, err := net.ListenPacket("udp", udpAddr)
+			if err != nil {
+				logger.Fatalf("Failed to listen on UDP address %s: %v", udpAddr, err)
+			}
+
+			logger.Infof("Serving sudph rendezvous on %s", conn.LocalAddr())
+
+			go func() {
+				logger.Fatal(srv.ServeUDP(conn))
+			}()
+		}
+
+		logger.Infof("Listening on %s", addr)
+		logger.Fatal(http.ListenAndServe(addr, srv))
+	},
+}
+
+func init() {
+	rootCmd.Flags().StringVarP(&addr, "addr", "a", ":9093", "address to bind to")
+	rootCmd.Flags().StringVarP(&udpAddr, "udp-addr", "u", ":9094", "UDP address to serve sudph rendezvous on (leave blank to disable)")
+	rootCmd.Flags().DurationVar(&entryTTL, "entry-ttl", arserver.DefaultEntryTTL, "time entries are kept for after they were last bound")
+	rootCmd.Flags().StringVar(&syslogAddr, "syslog", "", "syslog server address. E.g. localhost:514")
+	rootCmd.Flags().StringVar(&tag, "tag", "address-resolver", "logging tag")
+}
+
+// Execute executes root CLI command.
+func Execute() {
+	if err := rootCmd.Execute(); err != nil {
+		log.Fatal(err)
+	}
+}
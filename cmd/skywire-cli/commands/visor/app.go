@@ -33,7 +33,7 @@ var lsAppsCmd = &cobra.Command{
 		internal.Catch(err)
 
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
-		_, err = fmt.Fprintln(w, "app\tports\tauto_start\tstatus")
+		_, err = fmt.Fprintln(w, "app\tports\tauto_start\tstatus\trestarts\tlast_exit_code\tmemory\tcpu_time")
 		internal.Catch(err)
 
 		for _, state := range states {
@@ -41,7 +41,17 @@ var lsAppsCmd = &cobra.Command{
 			if state.Status == visor.AppStatusRunning {
 				status = "running"
 			}
-			_, err = fmt.Fprintf(w, "%s\t%s\t%t\t%s\n", state.Name, strconv.Itoa(int(state.Port)), state.AutoStart, status)
+			exitCode := "-"
+			if state.LastExitCode != nil {
+				exitCode = strconv.Itoa(*state.LastExitCode)
+			}
+			memory, cpuTime := "-", "-"
+			if state.Usage != nil {
+				memory = fmt.Sprintf("%.1fMiB", float64(state.Usage.Memory)/(1<<20))
+				cpuTime = state.Usage.CPUTime.Round(time.Millisecond).String()
+			}
+			_, err = fmt.Fprintf(w, "%s\t%s\t%t\t%s\t%d\t%s\t%s\t%s\n", state.Name, strconv.Itoa(int(state.Port)), state.AutoStart, status,
+				state.Restarts, exitCode, memory, cpuTime)
 			internal.Catch(err)
 		}
 		internal.Catch(w.Flush())
@@ -0,0 +1,58 @@
+package visor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/SkycoinProject/skywire-mainnet/cmd/skywire-cli/internal"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/visor"
+)
+
+// eventsPollTimeout is how long a single poll for events waits, it should be shorter than rpcConnDuration.
+const eventsPollTimeout = 30 * time.Second
+
+var (
+	followEvents bool
+	eventTypes   []string
+)
+
+func init() {
+	RootCmd.AddCommand(eventsCmd)
+	eventsCmd.Flags().BoolVarP(&followEvents, "follow", "f", false, "keep waiting for new events")
+	eventsCmd.Flags().StringSliceVar(&eventTypes, "type", nil, "comma-separated; if specified, only shows events of given types")
+}
+
+var eventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "Lists the latest events of the visor",
+	Run: func(_ *cobra.Command, _ []string) {
+		types := make([]visor.EventType, 0, len(eventTypes))
+		for _, t := range eventTypes {
+			types = append(types, visor.EventType(t))
+		}
+
+		var since uint64
+
+		for {
+			var timeout time.Duration
+			if followEvents {
+				timeout = eventsPollTimeout
+			}
+
+			// The connection of the RPC client has a deadline, so a new one is used for every poll.
+			events, err := rpcClient().Events(since, types, timeout)
+			internal.Catch(err)
+
+			for _, e := range events {
+				fmt.Printf("%s %s\n", e.Time.Local().Format(time.RFC3339), e)
+				since = e.Seq
+			}
+
+			if !followEvents {
+				return
+			}
+		}
+	},
+}
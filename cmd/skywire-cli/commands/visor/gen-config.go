@@ -95,6 +95,7 @@ func homeConfig() *visor.Config {
 	c := defaultConfig()
 	c.AppsPath = filepath.Join(pathutil.HomeDir(), ".skycoin/skywire/apps")
 	c.Transport.LogStore.Location = filepath.Join(pathutil.HomeDir(), ".skycoin/skywire/transport_logs")
+	c.Routing.Table.Location = filepath.Join(pathutil.HomeDir(), ".skycoin/skywire/routing.db")
 	return c
 }
 
@@ -102,6 +103,7 @@ func localConfig() *visor.Config {
 	c := defaultConfig()
 	c.AppsPath = "/usr/local/skycoin/skywire/apps"
 	c.Transport.LogStore.Location = "/usr/local/skycoin/skywire/transport_logs"
+	c.Routing.Table.Location = "/usr/local/skycoin/skywire/routing.db"
 	return c
 }
 
@@ -121,6 +123,7 @@ func defaultConfig() *visor.Config {
 		conf.STCP = stcp
 	}
 
+	conf.SUDPH = visor.DefaultSUDPHConfig()
 	conf.Dmsg = visor.DefaultDmsgConfig()
 
 	ptyConf := defaultDmsgPtyConfig()
@@ -144,6 +147,13 @@ func defaultConfig() *visor.Config {
 		conf.Transport.Discovery = skyenv.TestTpDiscAddr
 		conf.Routing.RouteFinder = skyenv.TestRouteFinderAddr
 		conf.Routing.SetupNodes = []cipher.PubKey{skyenv.MustPK(skyenv.TestSetupPK)}
+
+		if conf.STCP != nil {
+			conf.STCP.AddressResolver = skyenv.TestAddressResolverAddr
+		}
+
+		conf.SUDPH.AddressResolver = skyenv.TestAddressResolverAddr
+		conf.SUDPH.Rendezvous = skyenv.TestRendezvousAddr
 	}
 
 	conf.Hypervisors = []visor.HypervisorConfig{}
@@ -0,0 +1,46 @@
+package visor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/SkycoinProject/skywire-mainnet/cmd/skywire-cli/internal"
+)
+
+func init() {
+	RootCmd.AddCommand(reloadConfigCmd)
+}
+
+var reloadConfigCmd = &cobra.Command{
+	Use:   "reload-config",
+	Short: "Reloads the config of the visor and applies changes which don't require a restart",
+	Run: func(_ *cobra.Command, _ []string) {
+		res, err := rpcClient().ReloadConfig()
+		internal.Catch(err)
+
+		lines := []struct {
+			name   string
+			values []string
+		}{
+			{"applied", res.Applied},
+			{"restart required", res.RestartRequired},
+			{"started apps", res.StartedApps},
+			{"stopped apps", res.StoppedApps},
+			{"restarted apps", res.RestartedApps},
+		}
+
+		for _, l := range lines {
+			if len(l.values) > 0 {
+				fmt.Printf("%s: %s\n", l.name, strings.Join(l.values, ", "))
+			}
+		}
+
+		for _, e := range res.Errors {
+			fmt.Println("error:", e)
+		}
+
+		fmt.Println("OK")
+	},
+}
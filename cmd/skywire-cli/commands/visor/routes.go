@@ -22,6 +22,12 @@ func init() {
 		ruleCmd,
 		rmRuleCmd,
 		addRuleCmd,
+		routeCmd,
+	)
+
+	routeCmd.AddCommand(
+		traceRouteCmd,
+		pingCmd,
 	)
 }
 
@@ -118,6 +124,55 @@ var addRuleCmd = &cobra.Command{
 	},
 }
 
+var routeCmd = &cobra.Command{
+	Use:   "route",
+	Short: "Probes routes of the local visor's route groups",
+}
+
+var traceRouteCmd = &cobra.Command{
+	Use:   "trace <route-id>",
+	Short: "Returns round trip times to the visors of a route group's route",
+	Long: `Sends a probe via the route group with the edge route of the given route ID.
+Round trip times of intermediary visors are only known if they are on both forward and reverse routes.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		id := routing.RouteID(parseUint("route-id", args[0], 32))
+
+		hops, err := rpcClient().TraceRoute(id)
+		internal.Catch(err)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
+		_, err = fmt.Fprintln(w, "hop\tpk\trtt")
+		internal.Catch(err)
+
+		for i, hop := range hops {
+			rtt := "unknown"
+			if hop.RTT != nil {
+				rtt = hop.RTT.String()
+			}
+
+			_, err = fmt.Fprintf(w, "%d\t%s\t%s\n", i+1, hop.PK, rtt)
+			internal.Catch(err)
+		}
+
+		internal.Catch(w.Flush())
+	},
+}
+
+var pingCmd = &cobra.Command{
+	Use:   "ping <remote-pk>",
+	Short: "Returns the round trip time to a remote visor via an established route group",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		pk := internal.ParsePK("remote-pk", args[0])
+
+		rtt, err := rpcClient().Ping(pk)
+		internal.Catch(err)
+
+		fmt.Printf("Reply from %s: rtt=%s\n", pk, rtt)
+	},
+}
+
 func printRoutingRules(rules ...routing.Rule) {
 	printConsumeRule := func(w io.Writer, id routing.RouteID, s *routing.RuleSummary) {
 		_, err := fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\n", id, s.Type,
@@ -13,6 +13,7 @@ import (
 
 	"github.com/SkycoinProject/skywire-mainnet/cmd/skywire-cli/internal"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/stcp"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/sudph"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/visor"
 )
 
@@ -80,7 +81,7 @@ var (
 
 func init() {
 	const (
-		typeFlagUsage    = "type of transport to add; if unspecified, cli will attempt to establish a transport in the following order: stcp, dmsg"
+		typeFlagUsage    = "type of transport to add (dmsg, stcp, sudp or sudph); if unspecified, cli will attempt to establish a transport in the following order: stcp, sudph, dmsg"
 		publicFlagUsage  = "whether to make the transport public"
 		timeoutFlagUsage = "if specified, sets an operation timeout"
 	)
@@ -108,19 +109,17 @@ var addTpCmd = &cobra.Command{
 
 			logger.Infof("Established %v transport to %v", transportType, pk)
 		} else {
-			transportType = stcp.Type
-
-			tp, err = rpcClient().AddTransport(pk, transportType, public, timeout)
-			if err != nil {
-				logger.WithError(err).
-					Warnf("Failed to establish stcp transport. Trying to establish dmsg transport")
-
-				transportType = dmsg.Type
-
+			for _, transportType = range []string{stcp.Type, sudph.Type, dmsg.Type} {
 				tp, err = rpcClient().AddTransport(pk, transportType, public, timeout)
-				if err != nil {
-					logger.WithError(err).Fatalf("Failed to establish dmsg transport")
+				if err == nil {
+					break
 				}
+
+				logger.WithError(err).Warnf("Failed to establish %v transport", transportType)
+			}
+
+			if err != nil {
+				logger.Fatalf("Failed to establish a transport to %v", pk)
 			}
 
 			logger.Infof("Established %v transport to %v", transportType, pk)
@@ -144,7 +143,7 @@ var rmTpCmd = &cobra.Command{
 func printTransports(tps ...*visor.TransportSummary) {
 	sortTransports(tps...)
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
-	_, err := fmt.Fprintln(w, "type\tid\tremote\tmode")
+	_, err := fmt.Fprintln(w, "type\tid\tremote\tmode\trtt\tjitter\tloss")
 	internal.Catch(err)
 	for _, tp := range tps {
 		tpMode := "regular"
@@ -152,7 +151,12 @@ func printTransports(tps ...*visor.TransportSummary) {
 			tpMode = "setup"
 		}
 
-		_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", tp.Type, tp.ID, tp.Remote, tpMode)
+		rtt, jitter, loss := "-", "-", "-"
+		if s := tp.LinkStats; s != nil {
+			rtt, jitter, loss = s.RTT.String(), s.Jitter.String(), fmt.Sprintf("%.0f%%", s.Loss*100)
+		}
+
+		_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", tp.Type, tp.ID, tp.Remote, tpMode, rtt, jitter, loss)
 		internal.Catch(err)
 	}
 	internal.Catch(w.Flush())
@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/app/appserver"
+)
+
+func init() {
+	rootCmd.AddCommand(appShimCmd)
+}
+
+// appShimCmd executes an app once its resource limits are applied, the visor starts apps with limits with it.
+var appShimCmd = &cobra.Command{
+	Use:                appserver.AppShimCommand + " <memory> <app-path> [app-args...]",
+	Short:              "Execute an app once its resource limits are applied",
+	Hidden:             true,
+	DisableFlagParsing: true,
+	Run: func(_ *cobra.Command, args []string) {
+		err := appserver.RunAppShim(args)
+		fmt.Fprintf(os.Stderr, "app shim: %v\n", err)
+		os.Exit(1)
+	},
+}
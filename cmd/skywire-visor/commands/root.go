@@ -59,6 +59,8 @@ var cfg *runCfg
 var rootCmd = &cobra.Command{
 	Use:   "skywire-visor [config-path]",
 	Short: "Visor for skywire",
+	// The config path isn't a subcommand.
+	Args: cobra.ArbitraryArgs,
 	Run: func(_ *cobra.Command, args []string) {
 		if _, err := buildinfo.Get().WriteTo(log.Writer()); err != nil {
 			log.Printf("Failed to output build info: %v", err)
@@ -258,9 +260,22 @@ func (cfg *runCfg) stopVisor() *runCfg {
 }
 
 func (cfg *runCfg) waitOsSignals() *runCfg {
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+
 	ch := make(chan os.Signal, 2)
 	signal.Notify(ch, []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT}...)
-	<-ch
+
+	for waiting := true; waiting; {
+		select {
+		case <-hupCh:
+			cfg.reloadConfig()
+		case <-ch:
+			waiting = false
+		}
+	}
+
+	signal.Stop(hupCh)
 
 	go func() {
 		select {
@@ -273,3 +288,17 @@ func (cfg *runCfg) waitOsSignals() *runCfg {
 
 	return cfg
 }
+
+func (cfg *runCfg) reloadConfig() {
+	cfg.logger.Info("Received SIGHUP: reloading config")
+
+	res, err := cfg.visor.ReloadConfig()
+	if err != nil {
+		cfg.logger.WithError(err).Error("Failed to reload config")
+		return
+	}
+
+	if len(res.RestartRequired) > 0 {
+		cfg.logger.Warnf("Config changes of %v take effect after a restart", res.RestartRequired)
+	}
+}
@@ -19,7 +19,8 @@ import (
 )
 
 const (
-	invalidNonceErrorMessage = "SW-Nonce does not match"
+	// InvalidNonceErrorMessage is the error message of responses to requests signed with an unexpected nonce.
+	InvalidNonceErrorMessage = "SW-Nonce does not match"
 )
 
 var log = logging.MustGetLogger("httpauth")
@@ -75,6 +76,18 @@ func NewClient(ctx context.Context, addr string, key cipher.PubKey, sec cipher.S
 	return c, nil
 }
 
+// NewLazyClient creates a new client like NewClient, but doesn't request the server for a nonce.
+// The nonce is requested once the server rejects a request signed with an outdated one,
+// so the client may be created while the server is unreachable.
+func NewLazyClient(addr string, key cipher.PubKey, sec cipher.SecKey) *Client {
+	return &Client{
+		client: http.Client{},
+		key:    key,
+		sec:    sec,
+		addr:   sanitizedAddr(addr),
+	}
+}
+
 // Do performs a new authenticated Request and returns the response. Internally, if the request was
 // successful nonce is incremented
 func (c *Client) Do(req *http.Request) (*http.Response, error) {
@@ -190,7 +203,7 @@ func (c *Client) incrementNonce() {
 
 // isNonceValid checks if `res` contains an invalid nonce error.
 // The error is occurred if status code equals to `http.StatusUnauthorized`
-// and body contains `invalidNonceErrorMessage`.
+// and body contains `InvalidNonceErrorMessage`.
 func isNonceValid(res *http.Response) (bool, error) {
 	var serverResponse HTTPResponse
 
@@ -208,7 +221,7 @@ func isNonceValid(res *http.Response) (bool, error) {
 	}
 
 	isAuthorized := serverResponse.Error.Code != http.StatusUnauthorized
-	hasValidNonce := serverResponse.Error.Message != invalidNonceErrorMessage
+	hasValidNonce := serverResponse.Error.Message != InvalidNonceErrorMessage
 
 	return isAuthorized && hasValidNonce, nil
 }
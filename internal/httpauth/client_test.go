@@ -90,6 +90,31 @@ func TestClient_BadNonce(t *testing.T) {
 	checkResp(t, headers, b, pk, 1)
 }
 
+// TestNewLazyClient tests if `Client` created without a nonce requests it with the first request.
+func TestNewLazyClient(t *testing.T) {
+	pk, sk := cipher.GenerateKeyPair()
+
+	headerCh := make(chan http.Header, 1)
+	ts := newTestServer(t, pk, headerCh)
+	defer ts.Close()
+
+	c := NewLazyClient(ts.URL, pk, sk)
+	assert.Equal(t, uint64(0), c.nonce)
+
+	req, err := http.NewRequest("GET", ts.URL+"/foo", bytes.NewBufferString(payload))
+	require.NoError(t, err)
+	res, err := c.Do(req)
+	require.NoError(t, err)
+
+	b, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	assert.Equal(t, uint64(2), c.nonce)
+
+	headers := <-headerCh
+	checkResp(t, headers, b, pk, 1)
+}
+
 func checkResp(t *testing.T, headers http.Header, body []byte, pk cipher.PubKey, nonce int) {
 	require.Equal(t, strconv.Itoa(nonce), headers.Get("Sw-Nonce"))
 	require.Equal(t, pk.Hex(), headers.Get("Sw-Public"))
@@ -0,0 +1,157 @@
+// Package arclient implements address resolver client
+package arclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/httputil"
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+
+	"github.com/SkycoinProject/skywire-mainnet/internal/httpauth"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/address-resolver/arserver"
+)
+
+var log = logging.MustGetLogger("arclient")
+
+// ErrNoEntry is returned if the address resolver has no entry of the requested visor.
+var ErrNoEntry = errors.New("no entry of the visor in address resolver")
+
+// APIClient implements address resolver API client.
+type APIClient interface {
+	// Bind registers public address of the local visor in the given network.
+	Bind(ctx context.Context, network, addr string) (string, error)
+	// Unbind removes the entry of the local visor in the given network.
+	Unbind(ctx context.Context, network string) error
+	// Resolve obtains the address of the visor in the given network.
+	Resolve(ctx context.Context, network string, pk cipher.PubKey) (string, error)
+}
+
+// httpClient implements Client for address resolver API.
+type httpClient struct {
+	addr string
+	pk   cipher.PubKey
+	sk   cipher.SecKey
+
+	mu     sync.Mutex
+	client *httpauth.Client // created on the first request
+}
+
+// NewHTTP creates a new client setting a public key to the client to be used for auth.
+// Unlike other httpauth-based clients, it doesn't contact the address resolver until the first request,
+// so that an unreachable address resolver doesn't prevent the visor from starting.
+// The signature information is transmitted in the header using:
+// * SW-Public: The specified public key
+// * SW-Nonce:  The nonce for that public key
+// * SW-Sig:    The signature of the payload + the nonce
+func NewHTTP(addr string, pk cipher.PubKey, sk cipher.SecKey) APIClient {
+	return &httpClient{addr: addr, pk: pk, sk: sk}
+}
+
+func (c *httpClient) authClient(ctx context.Context) (*httpauth.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client == nil {
+		client, err := httpauth.NewClient(ctx, c.addr, c.pk, c.sk)
+		if err != nil {
+			return nil, fmt.Errorf("httpauth: %s", err)
+		}
+
+		c.client = client
+	}
+
+	return c.client, nil
+}
+
+// do performs a new request, `payload` is encoded to JSON if it's not nil.
+func (c *httpClient) do(ctx context.Context, method, path string, payload interface{}) (*http.Response, error) {
+	client, err := c.authClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	body := bytes.NewBuffer(nil)
+	if payload != nil {
+		if err := json.NewEncoder(body).Encode(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequest(method, client.Addr()+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Do(req.WithContext(ctx))
+}
+
+// Bind registers public address of the local visor and returns the address as seen by the address resolver.
+func (c *httpClient) Bind(ctx context.Context, network, addr string) (string, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/bind/"+network, arserver.BindRequest{Addr: addr})
+	if err != nil {
+		return "", err
+	}
+
+	defer closeBody(resp)
+
+	if err := httputil.ErrorFromResp(resp); err != nil {
+		return "", err
+	}
+
+	var entry arserver.Entry
+	if err := json.NewDecoder(resp.Body).Decode(&entry); err != nil {
+		return "", err
+	}
+
+	return entry.Addr, nil
+}
+
+// Unbind removes the entry of the local visor.
+func (c *httpClient) Unbind(ctx context.Context, network string) error {
+	resp, err := c.do(ctx, http.MethodDelete, "/bind/"+network, nil)
+	if err != nil {
+		return err
+	}
+
+	defer closeBody(resp)
+
+	return httputil.ErrorFromResp(resp)
+}
+
+// Resolve obtains the address of the visor, ErrNoEntry is returned if the visor is not bound.
+func (c *httpClient) Resolve(ctx context.Context, network string, pk cipher.PubKey) (string, error) {
+	resp, err := c.do(ctx, http.MethodGet, fmt.Sprintf("/resolve/%s/%s", network, pk), nil)
+	if err != nil {
+		return "", err
+	}
+
+	defer closeBody(resp)
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", ErrNoEntry
+	}
+
+	if err := httputil.ErrorFromResp(resp); err != nil {
+		return "", err
+	}
+
+	var entry arserver.Entry
+	if err := json.NewDecoder(resp.Body).Decode(&entry); err != nil {
+		return "", err
+	}
+
+	return entry.Addr, nil
+}
+
+func closeBody(resp *http.Response) {
+	if err := resp.Body.Close(); err != nil {
+		log.WithError(err).Warn("Failed to close HTTP response body")
+	}
+}
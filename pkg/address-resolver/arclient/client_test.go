@@ -0,0 +1,53 @@
+package arclient
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/address-resolver/arserver"
+)
+
+func TestHTTPClient(t *testing.T) {
+	srv := httptest.NewServer(arserver.New(nil, arserver.DefaultEntryTTL))
+	defer srv.Close()
+
+	pkA, skA := cipher.GenerateKeyPair()
+	pkB, skB := cipher.GenerateKeyPair()
+
+	cA := NewHTTP(srv.URL, pkA, skA)
+	cB := NewHTTP(srv.URL, pkB, skB)
+
+	ctx := context.TODO()
+
+	_, err := cB.Resolve(ctx, "stcp", pkA)
+	require.Equal(t, ErrNoEntry, err)
+
+	addr, err := cA.Bind(ctx, "stcp", ":7777")
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:7777", addr)
+
+	addr, err = cA.Bind(ctx, "sudp", "1.2.3.4:7778")
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.3.4:7778", addr)
+
+	addr, err = cB.Resolve(ctx, "stcp", pkA)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:7777", addr)
+
+	addr, err = cB.Resolve(ctx, "sudp", pkA)
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.3.4:7778", addr)
+
+	_, err = cB.Resolve(ctx, "unknown", pkA)
+	require.Error(t, err)
+
+	require.NoError(t, cA.Unbind(ctx, "stcp"))
+
+	_, err = cB.Resolve(ctx, "stcp", pkA)
+	require.Equal(t, ErrNoEntry, err)
+}
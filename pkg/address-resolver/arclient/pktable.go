@@ -0,0 +1,120 @@
+package arclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/stcp"
+)
+
+const (
+	// DefaultCacheTTL is the time resolved addresses are cached for.
+	DefaultCacheTTL = 5 * time.Minute
+	// ResolveTimeout is the timeout of a single lookup.
+	ResolveTimeout = 10 * time.Second
+)
+
+type cacheEntry struct {
+	addr    string
+	expires time.Time
+}
+
+// pkTable is a stcp.PKTable which looks up addresses of visors with the address resolver.
+type pkTable struct {
+	c        APIClient
+	network  string
+	static   stcp.PKTable
+	cacheTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[cipher.PubKey]cacheEntry
+}
+
+// NewPKTable creates a stcp.PKTable which resolves addresses in `network` with the address resolver
+// and caches them for `cacheTTL`. Entries of `static` override the resolved ones.
+// If a lookup fails, an expired cached address is used if there is one.
+func NewPKTable(c APIClient, network string, static map[cipher.PubKey]string, cacheTTL time.Duration) stcp.PKTable {
+	if cacheTTL <= 0 {
+		cacheTTL = DefaultCacheTTL
+	}
+
+	return &pkTable{
+		c:        c,
+		network:  network,
+		static:   stcp.NewTable(static),
+		cacheTTL: cacheTTL,
+		cache:    make(map[cipher.PubKey]cacheEntry),
+	}
+}
+
+// Addr obtains the address associated with the given public key.
+func (t *pkTable) Addr(pk cipher.PubKey) (string, bool) {
+	if addr, ok := t.static.Addr(pk); ok {
+		return addr, true
+	}
+
+	t.mu.Lock()
+	cached, ok := t.cache[pk]
+	t.mu.Unlock()
+
+	if ok && time.Now().Before(cached.expires) {
+		return cached.addr, true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ResolveTimeout)
+	defer cancel()
+
+	addr, err := t.c.Resolve(ctx, t.network, pk)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch err {
+	case nil:
+		t.cache[pk] = cacheEntry{addr: addr, expires: time.Now().Add(t.cacheTTL)}
+		return addr, true
+	case ErrNoEntry:
+		delete(t.cache, pk)
+		return "", false
+	default:
+		log.WithError(err).Warnf("Failed to resolve %s address of %s", t.network, pk)
+		return cached.addr, ok
+	}
+}
+
+// PubKey obtains the public key associated with the given address.
+func (t *pkTable) PubKey(addr string) (cipher.PubKey, bool) {
+	if pk, ok := t.static.PubKey(addr); ok {
+		return pk, true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for pk, cached := range t.cache {
+		if cached.addr == addr {
+			return pk, true
+		}
+	}
+
+	return cipher.PubKey{}, false
+}
+
+// Count returns the number of static and cached entries.
+func (t *pkTable) Count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := t.static.Count()
+
+	for pk := range t.cache {
+		if _, ok := t.static.Addr(pk); !ok {
+			n++
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,107 @@
+package arclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/stretchr/testify/assert"
+)
+
+// testResolver is an APIClient which resolves addresses from a map.
+type testResolver struct {
+	mu      sync.Mutex
+	entries map[cipher.PubKey]string
+	err     error
+	lookups int
+}
+
+func (r *testResolver) Bind(context.Context, string, string) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+func (r *testResolver) Unbind(context.Context, string) error {
+	return errors.New("not implemented")
+}
+
+func (r *testResolver) Resolve(_ context.Context, _ string, pk cipher.PubKey) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lookups++
+
+	if r.err != nil {
+		return "", r.err
+	}
+
+	addr, ok := r.entries[pk]
+	if !ok {
+		return "", ErrNoEntry
+	}
+
+	return addr, nil
+}
+
+func TestPKTable(t *testing.T) {
+	pkA, _ := cipher.GenerateKeyPair()
+	pkB, _ := cipher.GenerateKeyPair()
+	pkC, _ := cipher.GenerateKeyPair()
+
+	r := &testResolver{
+		entries: map[cipher.PubKey]string{
+			pkA: "1.1.1.1:7777",
+			pkB: "2.2.2.2:7777",
+		},
+	}
+
+	static := map[cipher.PubKey]string{pkB: "3.3.3.3:7777"}
+	table := NewPKTable(r, "stcp", static, time.Hour).(*pkTable)
+
+	t.Run("resolved entries are cached", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			addr, ok := table.Addr(pkA)
+			assert.True(t, ok)
+			assert.Equal(t, "1.1.1.1:7777", addr)
+		}
+
+		assert.Equal(t, 1, r.lookups)
+
+		pk, ok := table.PubKey("1.1.1.1:7777")
+		assert.True(t, ok)
+		assert.Equal(t, pkA, pk)
+	})
+
+	t.Run("static entries override resolved ones", func(t *testing.T) {
+		addr, ok := table.Addr(pkB)
+		assert.True(t, ok)
+		assert.Equal(t, "3.3.3.3:7777", addr)
+		assert.Equal(t, 1, r.lookups)
+	})
+
+	t.Run("missing entries", func(t *testing.T) {
+		_, ok := table.Addr(pkC)
+		assert.False(t, ok)
+		assert.Equal(t, 2, table.Count())
+	})
+
+	t.Run("expired entries are used if resolver fails", func(t *testing.T) {
+		table.cache[pkA] = cacheEntry{addr: "1.1.1.1:7777", expires: time.Now().Add(-time.Second)}
+		r.err = errors.New("resolver is down")
+
+		addr, ok := table.Addr(pkA)
+		assert.True(t, ok)
+		assert.Equal(t, "1.1.1.1:7777", addr)
+	})
+
+	t.Run("expired entries are removed if visor is unbound", func(t *testing.T) {
+		r.err = nil
+		delete(r.entries, pkA)
+
+		_, ok := table.Addr(pkA)
+		assert.False(t, ok)
+		assert.Equal(t, 1, table.Count())
+	})
+}
@@ -0,0 +1,439 @@
+// Package arserver implements address resolver server
+package arserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+
+	"github.com/SkycoinProject/skywire-mainnet/internal/httpauth"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/stcp"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/sudp"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/sudph"
+)
+
+const (
+	// DefaultEntryTTL is the default time an entry is kept for after it was last bound.
+	DefaultEntryTTL = 15 * time.Minute
+	// UDPEntryTTL is the time entries bound over UDP are kept for. These are NAT mappings, which are short-lived,
+	// so visors bind them frequently.
+	UDPEntryTTL = time.Minute
+	// maxBindPacketAge is the maximum difference between the time of bind packets and the time of the server.
+	maxBindPacketAge = time.Minute
+
+	httpTimeout = 30 * time.Second
+)
+
+var log = logging.MustGetLogger("arserver") // nolint: gochecknoglobals
+
+var (
+	// ErrUnknownNetwork is returned for networks which addresses are not resolved.
+	ErrUnknownNetwork = errors.New("unknown network type")
+	// ErrNoEntry is returned if there is no entry of the requested visor.
+	ErrNoEntry = errors.New("no entry of the given visor")
+	// ErrBoundOverUDP is returned on attempt to bind addresses of networks which addresses are bound over UDP.
+	ErrBoundOverUDP = errors.New("addresses of the network are bound over UDP")
+)
+
+// BindRequest is the body of bind requests.
+type BindRequest struct {
+	// Addr is the public address of the visor. If the host is empty or unspecified,
+	// it is taken from the address the request comes from.
+	Addr string `json:"addr"`
+}
+
+// Entry is a resolved address of a visor.
+type Entry struct {
+	PK   cipher.PubKey `json:"pk"`
+	Addr string        `json:"addr"`
+}
+
+type entryKey struct {
+	network string
+	pk      cipher.PubKey
+}
+
+type entry struct {
+	addr    string
+	updated time.Time
+}
+
+type authCtxKey struct{}
+
+// Server associates public keys of visors with addresses of their stcp and sudp listeners.
+// Visors bind their own addresses with requests authenticated by httpauth.
+//
+// The server also serves as a rendezvous for sudph: visors send signed bind packets over UDP (see ServeUDP),
+// and the addresses the packets come from are recorded.
+type Server struct {
+	log      *logging.Logger
+	entryTTL time.Duration
+	handler  http.Handler
+
+	mu      sync.Mutex
+	nonces  map[cipher.PubKey]httpauth.Nonce
+	entries map[entryKey]entry
+	stamps  map[cipher.PubKey]time.Time // last bind packet times, against replays
+}
+
+// New creates a Server. Entries expire if not bound again within `entryTTL`.
+func New(log *logging.Logger, entryTTL time.Duration) *Server {
+	if log == nil {
+		log = logging.MustGetLogger("address-resolver")
+	}
+
+	if entryTTL <= 0 {
+		entryTTL = DefaultEntryTTL
+	}
+
+	s := &Server{
+		log:      log,
+		entryTTL: entryTTL,
+		nonces:   make(map[cipher.PubKey]httpauth.Nonce),
+		entries:  make(map[entryKey]entry),
+		stamps:   make(map[cipher.PubKey]time.Time),
+	}
+
+	r := chi.NewRouter()
+	r.Use(middleware.RealIP)
+	r.Use(middleware.Timeout(httpTimeout))
+
+	r.Get("/security/nonces/{pk}", s.getNonce())
+
+	r.Group(func(r chi.Router) {
+		r.Use(s.authenticate)
+		r.Post("/bind/{network}", s.bind())
+		r.Delete("/bind/{network}", s.unbind())
+		r.Get("/resolve/{network}/{pk}", s.resolve())
+	})
+
+	s.handler = r
+
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+func (s *Server) getNonce() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pk, err := pkFromParam(r, "pk")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		s.mu.Lock()
+		nonce := s.nonces[pk]
+		s.mu.Unlock()
+
+		writeJSON(w, http.StatusOK, httpauth.NextNonceResponse{Edge: pk, NextNonce: nonce})
+	}
+}
+
+func (s *Server) bind() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		network, err := networkFromParam(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if network == sudph.Type {
+			writeError(w, http.StatusBadRequest, ErrBoundOverUDP)
+			return
+		}
+
+		var req BindRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		addr, err := publicAddr(req.Addr, r.RemoteAddr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		pk := authFromContext(r.Context()).Key
+
+		s.mu.Lock()
+		s.entries[entryKey{network: network, pk: pk}] = entry{addr: addr, updated: time.Now()}
+		s.mu.Unlock()
+
+		s.log.Debugf("Bound %s address of %s to %s", network, pk, addr)
+		writeJSON(w, http.StatusOK, Entry{PK: pk, Addr: addr})
+	}
+}
+
+func (s *Server) unbind() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		network, err := networkFromParam(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		pk := authFromContext(r.Context()).Key
+
+		s.mu.Lock()
+		delete(s.entries, entryKey{network: network, pk: pk})
+		s.mu.Unlock()
+
+		s.log.Debugf("Unbound %s address of %s", network, pk)
+		writeJSON(w, http.StatusOK, struct{}{})
+	}
+}
+
+func (s *Server) resolve() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		network, err := networkFromParam(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		pk, err := pkFromParam(r, "pk")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		key := entryKey{network: network, pk: pk}
+
+		s.mu.Lock()
+		e, ok := s.entries[key]
+		if ok && time.Since(e.updated) > s.ttl(network) {
+			delete(s.entries, key)
+			ok = false
+		}
+		s.mu.Unlock()
+
+		if !ok {
+			writeError(w, http.StatusNotFound, ErrNoEntry)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Entry{PK: pk, Addr: e.addr})
+	}
+}
+
+// CollectGarbage removes expired entries.
+func (s *Server) CollectGarbage() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int
+
+	for key, e := range s.entries {
+		if time.Since(e.updated) > s.ttl(key.network) {
+			delete(s.entries, key)
+			n++
+		}
+	}
+
+	for pk, t := range s.stamps {
+		if time.Since(t) > maxBindPacketAge {
+			delete(s.stamps, pk)
+		}
+	}
+
+	return n
+}
+
+func (s *Server) ttl(network string) time.Duration {
+	if network == sudph.Type {
+		return UDPEntryTTL
+	}
+
+	return s.entryTTL
+}
+
+// ServeUDP records sudph addresses of visors from bind packets received on `conn`.
+// It returns when reading from `conn` fails.
+func (s *Server) ServeUDP(conn net.PacketConn) error {
+	buf := make([]byte, sudph.BindPacketSize+1)
+
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if nErr, ok := err.(net.Error); ok && nErr.Temporary() {
+				continue
+			}
+
+			return err
+		}
+
+		if err := s.bindUDP(buf[:n], addr); err != nil {
+			s.log.WithError(err).Debugf("Rejected bind packet from %s", addr)
+		}
+	}
+}
+
+func (s *Server) bindUDP(p []byte, addr net.Addr) error {
+	pk, t, err := sudph.ParseBindPacket(p)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if t.Before(now.Add(-maxBindPacketAge)) || t.After(now.Add(maxBindPacketAge)) {
+		return errors.New("bind packet is expired")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !t.After(s.stamps[pk]) {
+		return errors.New("bind packet is replayed")
+	}
+
+	s.stamps[pk] = t
+	s.entries[entryKey{network: sudph.Type, pk: pk}] = entry{addr: addr.String(), updated: now}
+
+	return nil
+}
+
+// ServeGC periodically removes expired entries until `ctx` is canceled.
+func (s *Server) ServeGC(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n := s.CollectGarbage(); n > 0 {
+				s.log.Infof("Removed %d expired entries", n)
+			}
+		}
+	}
+}
+
+// authenticate checks httpauth headers of requests. Nonce of the visor is incremented
+// only if the request succeeds, which is what httpauth.Client expects.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, err := httpauth.AuthFromHeaders(r.Header)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+		s.mu.Lock()
+		nonce := s.nonces[auth.Key]
+		s.mu.Unlock()
+
+		if auth.Nonce != nonce {
+			writeError(w, http.StatusUnauthorized, errors.New(httpauth.InvalidNonceErrorMessage))
+			return
+		}
+
+		if err := auth.Verify(body); err != nil {
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), authCtxKey{}, auth)))
+
+		if sw.status == http.StatusOK {
+			s.mu.Lock()
+			if s.nonces[auth.Key] == auth.Nonce {
+				s.nonces[auth.Key]++
+			}
+			s.mu.Unlock()
+		}
+	})
+}
+
+// statusWriter records status code of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func authFromContext(ctx context.Context) *httpauth.Auth {
+	return ctx.Value(authCtxKey{}).(*httpauth.Auth)
+}
+
+// publicAddr validates `addr` and fills in its host from `remoteAddr` if it is missing.
+func publicAddr(addr, remoteAddr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid address: %v", err)
+	}
+
+	if p, err := strconv.ParseUint(port, 10, 16); err != nil || p == 0 {
+		return "", fmt.Errorf("invalid port: %s", port)
+	}
+
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		if host, _, err = net.SplitHostPort(remoteAddr); err != nil {
+			// middleware.RealIP sets remote address without a port
+			host = remoteAddr
+		}
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
+func networkFromParam(r *http.Request) (string, error) {
+	switch network := chi.URLParam(r, "network"); network {
+	case stcp.Type, sudp.Type, sudph.Type:
+		return network, nil
+	default:
+		return "", ErrUnknownNetwork
+	}
+}
+
+func pkFromParam(r *http.Request, key string) (cipher.PubKey, error) {
+	pk := cipher.PubKey{}
+	err := pk.UnmarshalText([]byte(chi.URLParam(r, key)))
+
+	return pk, err
+}
+
+// writeJSON writes responses the way httpauth.Client expects them.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithError(err).Warn("Failed to write response")
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, httpauth.HTTPResponse{Error: &httpauth.HTTPError{Message: err.Error(), Code: code}})
+}
@@ -0,0 +1,152 @@
+package arserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/skywire-mainnet/internal/httpauth"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/sudph"
+)
+
+func TestServer_Authentication(t *testing.T) {
+	pk, sk := cipher.GenerateKeyPair()
+
+	srv := httptest.NewServer(New(nil, DefaultEntryTTL))
+	defer srv.Close()
+
+	c, err := httpauth.NewClient(context.TODO(), srv.URL, pk, sk)
+	require.NoError(t, err)
+
+	bind := func(c *httpauth.Client) *http.Response {
+		body, err := json.Marshal(BindRequest{Addr: ":7777"})
+		require.NoError(t, err)
+
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/bind/stcp", bytes.NewReader(body))
+		require.NoError(t, err)
+
+		resp, err := c.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+
+		return resp
+	}
+
+	t.Run("nonce is incremented on success", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			require.Equal(t, http.StatusOK, bind(c).StatusCode)
+		}
+
+		nonce, err := c.Nonce(context.TODO(), pk)
+		require.NoError(t, err)
+		assert.Equal(t, httpauth.Nonce(3), nonce)
+	})
+
+	t.Run("client recovers from invalid nonce", func(t *testing.T) {
+		c.SetNonce(100)
+		assert.Equal(t, http.StatusOK, bind(c).StatusCode)
+	})
+
+	t.Run("invalid signature", func(t *testing.T) {
+		_, otherSK := cipher.GenerateKeyPair()
+
+		c, err := httpauth.NewClient(context.TODO(), srv.URL, pk, otherSK)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, bind(c).StatusCode)
+	})
+
+	t.Run("missing auth headers", func(t *testing.T) {
+		resp, err := http.Get(srv.URL + "/resolve/stcp/" + pk.Hex())
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+}
+
+func TestServer_CollectGarbage(t *testing.T) {
+	s := New(nil, DefaultEntryTTL)
+
+	pk, _ := cipher.GenerateKeyPair()
+	s.entries[entryKey{network: "stcp", pk: pk}] = entry{addr: "1.2.3.4:7777"}
+
+	assert.Equal(t, 1, s.CollectGarbage())
+	assert.Empty(t, s.entries)
+}
+
+func TestServer_BindUDP(t *testing.T) {
+	s := New(nil, DefaultEntryTTL)
+
+	pk, sk := cipher.GenerateKeyPair()
+	addr := &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 1234}
+	now := time.Now()
+
+	p, err := sudph.MakeBindPacket(pk, sk, now)
+	require.NoError(t, err)
+	require.NoError(t, s.bindUDP(p, addr))
+	assert.Equal(t, "1.2.3.4:1234", s.entries[entryKey{network: sudph.Type, pk: pk}].addr)
+
+	// replayed packets are rejected
+	require.Error(t, s.bindUDP(p, &net.UDPAddr{IP: net.IPv4(5, 6, 7, 8), Port: 1234}))
+	assert.Equal(t, "1.2.3.4:1234", s.entries[entryKey{network: sudph.Type, pk: pk}].addr)
+
+	// expired packets are rejected
+	p, err = sudph.MakeBindPacket(pk, sk, now.Add(-2*maxBindPacketAge))
+	require.NoError(t, err)
+	require.Error(t, s.bindUDP(p, addr))
+
+	// sudph addresses can't be bound over HTTP
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	c, err := httpauth.NewClient(context.TODO(), srv.URL, pk, sk)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/bind/sudph", bytes.NewBufferString(`{"addr":"1.2.3.4:1234"}`))
+	require.NoError(t, err)
+
+	resp, err := c.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr       string
+		remoteAddr string
+		want       string
+		wantErr    bool
+	}{
+		{addr: "1.2.3.4:7777", remoteAddr: "5.6.7.8:1234", want: "1.2.3.4:7777"},
+		{addr: ":7777", remoteAddr: "5.6.7.8:1234", want: "5.6.7.8:7777"},
+		{addr: "0.0.0.0:7777", remoteAddr: "5.6.7.8:1234", want: "5.6.7.8:7777"},
+		{addr: "[::]:7777", remoteAddr: "5.6.7.8", want: "5.6.7.8:7777"},
+		{addr: "example.com:7777", remoteAddr: "5.6.7.8:1234", want: "example.com:7777"},
+		{addr: "1.2.3.4", remoteAddr: "5.6.7.8:1234", wantErr: true},
+		{addr: "1.2.3.4:0", remoteAddr: "5.6.7.8:1234", wantErr: true},
+		{addr: "1.2.3.4:70000", remoteAddr: "5.6.7.8:1234", wantErr: true},
+	}
+
+	for i, tc := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			addr, err := publicAddr(tc.addr, tc.remoteAddr)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, addr)
+		})
+	}
+}
@@ -5,9 +5,14 @@ const DefaultServerAddr = "localhost:5505"
 
 // Config defines configuration parameters for `Proc`.
 type Config struct {
-	Name       string `json:"name"`
-	ServerAddr string `json:"server_addr"`
-	VisorPK    string `json:"visor_pk"`
-	BinaryDir  string `json:"binary_dir"`
-	WorkDir    string `json:"work_dir"`
+	Name       string            `json:"name"`
+	ServerAddr string            `json:"server_addr"`
+	VisorPK    string            `json:"visor_pk"`
+	BinaryDir  string            `json:"binary_dir"`
+	WorkDir    string            `json:"work_dir"`
+	User       string            `json:"user,omitempty"`        // user to run the app as, the visor's user if empty
+	Env        map[string]string `json:"env,omitempty"`         // environment variables of the app besides the ones set by the visor
+	IsolateEnv bool              `json:"isolate_env,omitempty"` // whether the app doesn't inherit the environment of the visor
+	Limits     ResourceLimits    `json:"limits"`
+	Cgroup     string            `json:"cgroup,omitempty"` // cgroup v2 cgroups of apps are created in, rlimits are used if empty
 }
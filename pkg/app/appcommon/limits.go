@@ -0,0 +1,20 @@
+package appcommon
+
+import "time"
+
+// ResourceLimits defines limits of resources used by an app. Zero values mean no limit.
+type ResourceLimits struct {
+	MemoryMB uint64  `json:"memory_mb,omitempty"` // memory in MiB
+	CPUs     float64 `json:"cpus,omitempty"`      // number of CPUs the app may use, may be fractional
+}
+
+// MemoryBytes returns the memory limit in bytes.
+func (l ResourceLimits) MemoryBytes() uint64 {
+	return l.MemoryMB << 20
+}
+
+// ResourceUsage describes resources used by a running app.
+type ResourceUsage struct {
+	Memory  uint64        `json:"memory"`   // memory in use in bytes
+	CPUTime time.Duration `json:"cpu_time"` // user and system CPU time
+}
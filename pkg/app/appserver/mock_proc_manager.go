@@ -76,6 +76,27 @@ func (_m *MockProcManager) StopAll() {
 	_m.Called()
 }
 
+// Usage provides a mock function with given fields: name
+func (_m *MockProcManager) Usage(name string) (appcommon.ResourceUsage, error) {
+	ret := _m.Called(name)
+
+	var r0 appcommon.ResourceUsage
+	if rf, ok := ret.Get(0).(func(string) appcommon.ResourceUsage); ok {
+		r0 = rf(name)
+	} else {
+		r0 = ret.Get(0).(appcommon.ResourceUsage)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Wait provides a mock function with given fields: name
 func (_m *MockProcManager) Wait(name string) error {
 	ret := _m.Called(name)
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"sync"
 	"sync/atomic"
 
@@ -15,6 +16,10 @@ import (
 	"github.com/SkycoinProject/skywire-mainnet/pkg/app/appcommon"
 )
 
+// AppShimCommand is the first argument of the visor binary executed in the process of an app with
+// resource limits. The binary has to run the app shim with RunAppShim when it's started with it.
+const AppShimCommand = "app-shim"
+
 var (
 	errProcAlreadyRunning = errors.New("process already running")
 	errProcNotStarted     = errors.New("process is not started")
@@ -31,6 +36,8 @@ type Proc struct {
 	isRunning int32
 	waitMx    sync.Mutex
 	waitErr   error
+	cgroup    string   // cgroup the app is limited by, if any
+	shim      *os.File // lets the app shim execute the app once resource limits are applied, if the shim is used
 }
 
 // NewProc constructs `Proc`.
@@ -45,7 +52,21 @@ func NewProc(log *logging.Logger, c appcommon.Config, args []string, stdout, std
 		visorPKEnvFormat    = appcommon.EnvVisorPK + "=%s"
 	)
 
-	env := make([]string, 0, 4)
+	// Configured variables take precedence over inherited ones, and variables set by the visor over both.
+	var env []string
+	if !c.IsolateEnv {
+		env = os.Environ()
+	}
+
+	vars := make([]string, 0, len(c.Env))
+	for k, v := range c.Env {
+		vars = append(vars, k+"="+v)
+	}
+
+	sort.Strings(vars)
+
+	env = append(env, vars...)
+
 	env = append(env, fmt.Sprintf(appKeyEnvFormat, key))
 	env = append(env, fmt.Sprintf(serverAddrEnvFormat, c.ServerAddr))
 	env = append(env, fmt.Sprintf(visorPKEnvFormat, c.VisorPK))
@@ -58,6 +79,10 @@ func NewProc(log *logging.Logger, c appcommon.Config, args []string, stdout, std
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
 
+	if err := setUser(cmd, c); err != nil {
+		return nil, err
+	}
+
 	return &Proc{
 		key:    key,
 		config: c,
@@ -72,17 +97,34 @@ func (p *Proc) Start() error {
 		return errProcAlreadyRunning
 	}
 
+	if err := p.prepareLimits(); err != nil {
+		return fmt.Errorf("failed to limit resources of app: %w", err)
+	}
+
 	if err := p.cmd.Start(); err != nil {
+		p.unlimit()
 		return err
 	}
 
+	limitErr := p.limit()
+	if limitErr != nil {
+		if killErr := p.cmd.Process.Kill(); killErr != nil {
+			p.log.WithError(killErr).Error("Failed to kill app.")
+		}
+	}
+
 	// acquire lock immediately
 	p.waitMx.Lock()
 	go func() {
 		defer p.waitMx.Unlock()
 		p.waitErr = p.cmd.Wait()
+		p.unlimit()
 	}()
 
+	if limitErr != nil {
+		return fmt.Errorf("failed to limit resources of app: %w", limitErr)
+	}
+
 	return nil
 }
 
@@ -117,6 +159,15 @@ func (p *Proc) Wait() error {
 	return p.waitErr
 }
 
+// Usage returns resources used by the running application.
+func (p *Proc) Usage() (appcommon.ResourceUsage, error) {
+	if atomic.LoadInt32(&p.isRunning) != 1 {
+		return appcommon.ResourceUsage{}, errProcNotStarted
+	}
+
+	return p.usage()
+}
+
 // IsRunning checks whether application cmd is running.
 func (p *Proc) IsRunning() bool {
 	return atomic.LoadInt32(&p.isRunning) == 1
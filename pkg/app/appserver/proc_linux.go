@@ -0,0 +1,414 @@
+package appserver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/app/appcommon"
+)
+
+const (
+	// cgroupRoot is the mount point of the cgroup v2 hierarchy.
+	cgroupRoot = "/sys/fs/cgroup"
+	// cpuPeriod is the period of the CPU bandwidth limit of cgroups in microseconds.
+	cpuPeriod = 100000
+	// clockTicks is the number of clock ticks per second CPU time in /proc is measured in (USER_HZ).
+	clockTicks = 100
+)
+
+// RunAppShim runs in the process of an app with resource limits, which is started as the visor binary
+// executed with AppShimCommand followed by `args`: the memory limit of the app in bytes (0 if the memory
+// is not limited with RLIMIT_AS), the path of the app and its arguments.
+// It waits until the visor moves the process to the cgroup of the app, sets RLIMIT_AS if the memory is limited
+// without cgroups, and executes the app. So the app never runs without its limits.
+// It only returns if the app can't be executed.
+func RunAppShim(args []string) error {
+	if len(args) < 2 {
+		return errors.New("memory limit and path of app are required")
+	}
+
+	memory, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid memory limit of app: %w", err)
+	}
+
+	limits := os.NewFile(3, "limits")
+
+	buf := make([]byte, 1)
+	_, err = io.ReadFull(limits, buf)
+
+	if closeErr := limits.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil || buf[0] != 1 {
+		return errors.New("resource limits of app were not applied")
+	}
+
+	// RLIMIT_AS is set right before the exec, as the shim itself may need more memory.
+	if memory > 0 {
+		if err := syscall.Setrlimit(syscall.RLIMIT_AS, &syscall.Rlimit{Cur: memory, Max: memory}); err != nil {
+			return fmt.Errorf("failed to limit memory of app: %w", err)
+		}
+	}
+
+	// The path of the app is its first argument as well.
+	err = syscall.Exec(args[1], args[1:], os.Environ()) // nolint:gosec
+
+	return fmt.Errorf("failed to execute app: %w", err)
+}
+
+// SetupAppsCgroup enables memory and CPU controllers for children of `dir`, a cgroup v2 delegated to the visor,
+// and returns its path. `dir` is either absolute or relative to the cgroup v2 mount point,
+// the cgroup of the visor is used if it's empty.
+// Only cgroups without processes may enable controllers for their children, so if the visor is in `dir`,
+// it's moved to a "visor" child cgroup if `moveVisor` is set, and the setup fails otherwise.
+// The visor is moved back if the setup fails.
+func SetupAppsCgroup(dir string, moveVisor bool) (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", err
+	}
+
+	data, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+
+	var rel string
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		if strings.HasPrefix(sc.Text(), "0::") {
+			rel = strings.TrimPrefix(sc.Text(), "0::")
+		}
+	}
+
+	if rel == "" {
+		return "", errors.New("visor is not in a cgroup v2 hierarchy")
+	}
+
+	visorDir := filepath.Join(cgroupRoot, rel)
+
+	switch {
+	case dir == "":
+		dir = visorDir
+	case !filepath.IsAbs(dir):
+		dir = filepath.Join(cgroupRoot, dir)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "cgroup.controllers")); err != nil {
+		return "", err
+	}
+
+	var leaf string
+
+	// The root cgroup may have both processes and child cgroups with controllers.
+	if dir == visorDir && rel != "/" {
+		if !moveVisor {
+			return "", fmt.Errorf("visor is in cgroup %s, it has to be moved out of it to create cgroups of apps", dir)
+		}
+
+		leaf = filepath.Join(dir, "visor")
+		if err := os.Mkdir(leaf, 0755); err != nil && !os.IsExist(err) {
+			return "", err
+		}
+
+		if err := writeCgroupFile(leaf, "cgroup.procs", strconv.Itoa(os.Getpid())); err != nil {
+			if rmErr := os.Remove(leaf); rmErr != nil {
+				return "", fmt.Errorf("%v (failed to remove cgroup %s: %v)", err, leaf, rmErr)
+			}
+
+			return "", err
+		}
+	}
+
+	if err := writeCgroupFile(dir, "cgroup.subtree_control", "+cpu +memory"); err != nil {
+		if leaf != "" {
+			if undoErr := writeCgroupFile(dir, "cgroup.procs", strconv.Itoa(os.Getpid())); undoErr != nil {
+				return "", fmt.Errorf("%v (failed to move visor back: %v)", err, undoErr)
+			}
+
+			if undoErr := os.Remove(leaf); undoErr != nil {
+				return "", fmt.Errorf("%v (failed to remove cgroup %s: %v)", err, leaf, undoErr)
+			}
+		}
+
+		return "", err
+	}
+
+	return dir, nil
+}
+
+func writeCgroupFile(dir, name, value string) error {
+	return ioutil.WriteFile(filepath.Join(dir, name), []byte(value), 0644)
+}
+
+// setUser makes `cmd` run as the user of `c`, which is given the work dir of the app.
+func setUser(cmd *exec.Cmd, c appcommon.Config) error {
+	if c.User == "" {
+		return nil
+	}
+
+	u, err := user.Lookup(c.User)
+	if err != nil {
+		return err
+	}
+
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid uid of user %s: %w", c.User, err)
+	}
+
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid gid of user %s: %w", c.User, err)
+	}
+
+	if c.WorkDir != "" {
+		if err := os.Chown(c.WorkDir, int(uid), int(gid)); err != nil {
+			return err
+		}
+
+		if err := os.Chmod(c.WorkDir, 0700); err != nil {
+			return err
+		}
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)},
+	}
+
+	return nil
+}
+
+// prepareLimits makes the app start with the app shim if it has resource limits.
+// The shim is run by the visor binary, see RunAppShim.
+// It also creates a cgroup for the app if the visor has a cgroup for apps.
+func (p *Proc) prepareLimits() error {
+	limits := p.config.Limits
+	if limits == (appcommon.ResourceLimits{}) {
+		return nil
+	}
+
+	if p.config.Cgroup != "" {
+		if err := p.prepareCgroup(); err != nil {
+			return err
+		}
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		p.unlimit()
+		return err
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		p.unlimit()
+		return err
+	}
+
+	var memory uint64
+	if p.cgroup == "" {
+		memory = limits.MemoryBytes()
+	}
+
+	p.cmd.Args = append([]string{self, AppShimCommand, strconv.FormatUint(memory, 10)}, p.cmd.Args...)
+	p.cmd.Path = self
+	p.cmd.ExtraFiles = []*os.File{r}
+	p.shim = w
+
+	return nil
+}
+
+// prepareCgroup creates a cgroup for the app.
+func (p *Proc) prepareCgroup() error {
+	limits := p.config.Limits
+
+	cgroup := filepath.Join(p.config.Cgroup, "app-"+p.config.Name)
+	if err := os.Mkdir(cgroup, 0755); err != nil && !os.IsExist(err) {
+		return err
+	}
+
+	memoryMax := "max"
+	if limits.MemoryMB > 0 {
+		memoryMax = strconv.FormatUint(limits.MemoryBytes(), 10)
+	}
+
+	cpuMax := fmt.Sprintf("max %d", cpuPeriod)
+	if limits.CPUs > 0 {
+		cpuMax = fmt.Sprintf("%d %d", int64(limits.CPUs*cpuPeriod), cpuPeriod)
+	}
+
+	if err := writeCgroupFile(cgroup, "memory.max", memoryMax); err != nil {
+		return err
+	}
+
+	if err := writeCgroupFile(cgroup, "cpu.max", cpuMax); err != nil {
+		return err
+	}
+
+	p.cgroup = cgroup
+
+	return nil
+}
+
+// limit applies resource limits to the started app shim and lets it execute the app.
+func (p *Proc) limit() error {
+	if p.shim == nil {
+		return nil
+	}
+
+	err := p.applyLimits()
+	if err == nil {
+		_, err = p.shim.Write([]byte{1})
+	}
+
+	p.closeShim()
+
+	return err
+}
+
+// applyLimits moves the app to its cgroup. Without cgroups, its memory is limited with RLIMIT_AS by the shim,
+// and its CPU usage is not limited.
+func (p *Proc) applyLimits() error {
+	if p.cgroup != "" {
+		return writeCgroupFile(p.cgroup, "cgroup.procs", strconv.Itoa(p.cmd.Process.Pid))
+	}
+
+	if p.config.Limits.CPUs > 0 {
+		p.log.Warn("CPU limit of app is not applied without cgroups v2.")
+	}
+
+	return nil
+}
+
+// closeShim closes the pipe to the app shim, the shim exits if it wasn't told to execute the app.
+func (p *Proc) closeShim() {
+	if p.shim == nil {
+		return
+	}
+
+	for _, f := range append(p.cmd.ExtraFiles, p.shim) {
+		if err := f.Close(); err != nil {
+			p.log.WithError(err).Warn("Failed to close pipe to app shim.")
+		}
+	}
+
+	p.shim = nil
+}
+
+// unlimit removes the cgroup of the exited app.
+func (p *Proc) unlimit() {
+	p.closeShim()
+
+	if p.cgroup == "" {
+		return
+	}
+
+	if err := os.Remove(p.cgroup); err != nil {
+		p.log.WithError(err).Warn("Failed to remove cgroup of app.")
+	}
+}
+
+// usage reads resources used by the app from its cgroup, or from /proc without cgroups.
+// Without cgroups, only the app process itself is accounted for.
+func (p *Proc) usage() (appcommon.ResourceUsage, error) {
+	if p.cgroup != "" {
+		return cgroupUsage(p.cgroup)
+	}
+
+	return procUsage(p.cmd.Process.Pid)
+}
+
+func cgroupUsage(cgroup string) (appcommon.ResourceUsage, error) {
+	var usage appcommon.ResourceUsage
+
+	data, err := ioutil.ReadFile(filepath.Join(cgroup, "memory.current"))
+	if err != nil {
+		return usage, err
+	}
+
+	if usage.Memory, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err != nil {
+		return usage, err
+	}
+
+	data, err = ioutil.ReadFile(filepath.Join(cgroup, "cpu.stat"))
+	if err != nil {
+		return usage, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "usage_usec" {
+			usec, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return usage, err
+			}
+
+			usage.CPUTime = time.Duration(usec) * time.Microsecond
+		}
+	}
+
+	return usage, nil
+}
+
+func procUsage(pid int) (appcommon.ResourceUsage, error) {
+	var usage appcommon.ResourceUsage
+
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/statm", pid))
+	if err != nil {
+		return usage, err
+	}
+
+	// The second field is the number of resident pages.
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return usage, fmt.Errorf("unexpected /proc/%d/statm: %q", pid, data)
+	}
+
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return usage, err
+	}
+
+	usage.Memory = pages * uint64(os.Getpagesize())
+
+	data, err = ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return usage, err
+	}
+
+	// The command name may contain spaces, utime and stime are the 12th and 13th fields after it.
+	fields = strings.Fields(string(data[bytes.LastIndexByte(data, ')')+1:]))
+	if len(fields) < 13 {
+		return usage, fmt.Errorf("unexpected /proc/%d/stat: %q", pid, data)
+	}
+
+	var ticks uint64
+
+	for _, f := range fields[11:13] {
+		v, err := strconv.ParseUint(f, 10, 64)
+		if err != nil {
+			return usage, err
+		}
+
+		ticks += v
+	}
+
+	usage.CPUTime = time.Duration(ticks) * time.Second / clockTicks
+
+	return usage, nil
+}
@@ -0,0 +1,119 @@
+package appserver
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/app/appcommon"
+)
+
+func TestMain(m *testing.M) {
+	// Apps with resource limits are started by the test binary, which runs the app shim like the visor does.
+	if len(os.Args) > 1 && os.Args[1] == AppShimCommand {
+		err := RunAppShim(os.Args[2:])
+		fmt.Fprintf(os.Stderr, "app shim: %v\n", err)
+		os.Exit(1)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestProc_Limits(t *testing.T) {
+	c := appcommon.Config{
+		Name:       "sleep",
+		BinaryDir:  "/bin",
+		Env:        map[string]string{"FOO": "bar", appcommon.EnvVisorPK: "overridden"},
+		IsolateEnv: true,
+		VisorPK:    "pk",
+		Limits:     appcommon.ResourceLimits{MemoryMB: 64},
+	}
+
+	p, err := NewProc(logging.MustGetLogger("proc"), c, []string{"10"}, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, p.Start())
+
+	defer func() {
+		require.NoError(t, p.Stop())
+	}()
+
+	pid := p.cmd.Process.Pid
+
+	// The app is executed by the app shim once limits are applied.
+	require.Eventually(t, func() bool {
+		exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+		if err != nil || filepath.Base(exe) != "sleep" {
+			return false
+		}
+
+		env, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/environ", pid))
+
+		return err == nil && len(env) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	t.Run("environment", func(t *testing.T) {
+		data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/environ", pid))
+		require.NoError(t, err)
+
+		env := strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+		assert.Contains(t, env, "FOO=bar")
+		assert.Contains(t, env, appcommon.EnvVisorPK+"=pk")
+		assert.NotContains(t, env, appcommon.EnvVisorPK+"=overridden")
+
+		for _, v := range env {
+			assert.False(t, strings.HasPrefix(v, "PATH="), "environment of the visor is inherited")
+		}
+	})
+
+	t.Run("memory limit", func(t *testing.T) {
+		if p.cgroup != "" {
+			data, err := ioutil.ReadFile(filepath.Join(p.cgroup, "memory.max"))
+			require.NoError(t, err)
+			assert.Equal(t, "67108864", strings.TrimSpace(string(data)))
+
+			return
+		}
+
+		data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/limits", pid))
+		require.NoError(t, err)
+		assert.Regexp(t, `Max address space\s+67108864\s+67108864\s+bytes`, string(data))
+	})
+
+	t.Run("usage", func(t *testing.T) {
+		usage, err := p.Usage()
+		require.NoError(t, err)
+		assert.NotZero(t, usage.Memory)
+	})
+}
+
+func TestProc_LimitsBeforeExec(t *testing.T) {
+	c := appcommon.Config{
+		Name:      "sh",
+		BinaryDir: "/bin",
+		Limits:    appcommon.ResourceLimits{MemoryMB: 64},
+	}
+
+	// The app reports the limits it was started with.
+	var stdout bytes.Buffer
+
+	p, err := NewProc(logging.MustGetLogger("proc"), c, []string{"-c", "cat /proc/$$/limits"}, &stdout, nil)
+	require.NoError(t, err)
+	require.NoError(t, p.Start())
+	require.NoError(t, p.Wait())
+
+	assert.Regexp(t, `Max address space\s+67108864\s+67108864\s+bytes`, stdout.String())
+}
+
+func TestSetupAppsCgroup(t *testing.T) {
+	_, err := SetupAppsCgroup("/nonexistent", true)
+	assert.Error(t, err)
+}
@@ -27,6 +27,7 @@ type ProcManager interface {
 	Exists(name string) bool
 	Stop(name string) error
 	Wait(name string) error
+	Usage(name string) (appcommon.ResourceUsage, error)
 	Range(next func(name string, proc *Proc) bool)
 	StopAll()
 }
@@ -70,6 +71,10 @@ func (m *procManager) Start(log *logging.Logger, c appcommon.Config, args []stri
 	m.mx.Unlock()
 
 	if err := p.Start(); err != nil {
+		if _, popErr := m.pop(c.Name); popErr != nil {
+			m.log.Debugf("Remove app <%v>: %v", c.Name, popErr)
+		}
+
 		return 0, err
 	}
 
@@ -122,6 +127,16 @@ func (m *procManager) Wait(name string) error {
 	return err
 }
 
+// Usage returns resources used by the running application.
+func (m *procManager) Usage(name string) (appcommon.ResourceUsage, error) {
+	p, err := m.get(name)
+	if err != nil {
+		return appcommon.ResourceUsage{}, err
+	}
+
+	return p.Usage()
+}
+
 // Range allows to iterate over running skywire apps. Calls `next` on
 // each iteration. If `next` returns falls - stops iteration.
 func (m *procManager) Range(next func(name string, proc *Proc) bool) {
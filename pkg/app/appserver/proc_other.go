@@ -0,0 +1,55 @@
+// +build !linux
+
+package appserver
+
+import (
+	"errors"
+	"os/exec"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/app/appcommon"
+)
+
+var (
+	errUsageUnsupported  = errors.New("resource usage is not supported on this platform")
+	errUserUnsupported   = errors.New("running apps as another user is not supported on this platform")
+	errCgroupUnsupported = errors.New("cgroups are not supported on this platform")
+	errShimUnsupported   = errors.New("app shim is not supported on this platform")
+)
+
+// RunAppShim fails, as apps are only started with the app shim on Linux.
+func RunAppShim(_ []string) error {
+	return errShimUnsupported
+}
+
+// SetupAppsCgroup fails, as cgroups are only available on Linux.
+func SetupAppsCgroup(_ string, _ bool) (string, error) {
+	return "", errCgroupUnsupported
+}
+
+// setUser fails if `c` has a user, as apps may only be run as another user on Linux.
+func setUser(_ *exec.Cmd, c appcommon.Config) error {
+	if c.User != "" {
+		return errUserUnsupported
+	}
+
+	return nil
+}
+
+func (p *Proc) prepareLimits() error {
+	return nil
+}
+
+// limit warns that resource limits of apps are only applied on Linux.
+func (p *Proc) limit() error {
+	if p.config.Limits != (appcommon.ResourceLimits{}) {
+		p.log.Warn("Resource limits of apps are not applied on this platform.")
+	}
+
+	return nil
+}
+
+func (p *Proc) unlimit() {}
+
+func (p *Proc) usage() (appcommon.ResourceUsage, error) {
+	return appcommon.ResourceUsage{}, errUsageUnsupported
+}
@@ -0,0 +1,46 @@
+package appserver
+
+import (
+	"os"
+	"testing"
+
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/app/appcommon"
+)
+
+func TestNewProc_Env(t *testing.T) {
+	require.NoError(t, os.Setenv("SKYWIRE_TEST_INHERITED", "visor"))
+
+	defer func() {
+		require.NoError(t, os.Unsetenv("SKYWIRE_TEST_INHERITED"))
+	}()
+
+	c := appcommon.Config{
+		Name:    "app",
+		VisorPK: "pk",
+		Env:     map[string]string{"FOO": "bar"},
+	}
+
+	t.Run("inherited", func(t *testing.T) {
+		p, err := NewProc(logging.MustGetLogger("proc"), c, nil, nil, nil)
+		require.NoError(t, err)
+
+		assert.Contains(t, p.cmd.Env, "SKYWIRE_TEST_INHERITED=visor")
+		assert.Contains(t, p.cmd.Env, "FOO=bar")
+		assert.Equal(t, appcommon.EnvVisorPK+"=pk", p.cmd.Env[len(p.cmd.Env)-1])
+	})
+
+	t.Run("isolated", func(t *testing.T) {
+		c := c
+		c.IsolateEnv = true
+
+		p, err := NewProc(logging.MustGetLogger("proc"), c, nil, nil, nil)
+		require.NoError(t, err)
+
+		assert.NotContains(t, p.cmd.Env, "SKYWIRE_TEST_INHERITED=visor")
+		assert.Contains(t, p.cmd.Env, "FOO=bar")
+	})
+}
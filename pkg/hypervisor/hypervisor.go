@@ -3,6 +3,7 @@ package hypervisor
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -26,13 +27,15 @@ import (
 	"github.com/SkycoinProject/skywire-mainnet/pkg/app"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/routing"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/skyenv"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/transport"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/util/buildinfo"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/visor"
 )
 
 const (
-	healthTimeout = 5 * time.Second
-	httpTimeout   = 30 * time.Second
+	healthTimeout     = 5 * time.Second
+	httpTimeout       = 30 * time.Second
+	eventsPollTimeout = 25 * time.Second
 )
 
 const (
@@ -142,12 +145,11 @@ func (hv *Hypervisor) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	r.Route("/", func(r chi.Router) {
 		r.Route("/api", func(r chi.Router) {
-			r.Use(middleware.Timeout(httpTimeout))
-
-			r.Get("/ping", hv.getPong())
+			r.With(middleware.Timeout(httpTimeout)).Get("/ping", hv.getPong())
 
 			if hv.c.EnableAuth {
 				r.Group(func(r chi.Router) {
+					r.Use(middleware.Timeout(httpTimeout))
 					r.Post("/create-account", hv.users.CreateAccount())
 					r.Post("/login", hv.users.Login())
 					r.Post("/logout", hv.users.Logout())
@@ -155,6 +157,7 @@ func (hv *Hypervisor) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			}
 
 			r.Group(func(r chi.Router) {
+				r.Use(middleware.Timeout(httpTimeout))
 				if hv.c.EnableAuth {
 					r.Use(hv.users.Authorize)
 				}
@@ -174,6 +177,8 @@ func (hv *Hypervisor) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 				r.Post("/visors/{pk}/transports", hv.postTransport())
 				r.Get("/visors/{pk}/transports/{tid}", hv.getTransport())
 				r.Delete("/visors/{pk}/transports/{tid}", hv.deleteTransport())
+				r.Get("/visors/{pk}/transports/{tid}/bandwidth", hv.getTransportBandwidth())
+				r.Get("/visors/{pk}/bandwidth/{remote}", hv.getRemoteBandwidth())
 				r.Get("/visors/{pk}/routes", hv.getRoutes())
 				r.Post("/visors/{pk}/routes", hv.postRoute())
 				r.Get("/visors/{pk}/routes/{rid}", hv.getRoute())
@@ -185,6 +190,14 @@ func (hv *Hypervisor) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 				r.Post("/visors/{pk}/update", hv.update())
 				r.Get("/visors/{pk}/update/available", hv.updateAvailable())
 			})
+
+			// Event streams are long-lived, so they aren't subject to httpTimeout.
+			r.Group(func(r chi.Router) {
+				if hv.c.EnableAuth {
+					r.Use(hv.users.Authorize)
+				}
+				r.Get("/visors/{pk}/events", hv.getEvents())
+			})
 		})
 
 		r.Route("/pty", func(r chi.Router) {
@@ -558,6 +571,56 @@ func (hv *Hypervisor) deleteTransport() http.HandlerFunc {
 	})
 }
 
+// getTransportBandwidth returns bandwidth history of a transport. Transports which no longer exist can be queried as well.
+func (hv *Hypervisor) getTransportBandwidth() http.HandlerFunc {
+	return hv.withCtx(hv.visorCtx, func(w http.ResponseWriter, r *http.Request, ctx *httpCtx) {
+		tid, err := uuidFromParam(r, "tid")
+		if err != nil {
+			httputil.WriteJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		from, to, g, err := bandwidthRangeFromQuery(r)
+		if err != nil {
+			httputil.WriteJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		records, err := ctx.RPC.TransportBandwidth(tid, from, to, g)
+		if err != nil {
+			httputil.WriteJSON(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		httputil.WriteJSON(w, r, http.StatusOK, records)
+	})
+}
+
+// getRemoteBandwidth returns bandwidth history of all transports to a remote visor.
+func (hv *Hypervisor) getRemoteBandwidth() http.HandlerFunc {
+	return hv.withCtx(hv.visorCtx, func(w http.ResponseWriter, r *http.Request, ctx *httpCtx) {
+		remote, err := pkFromParam(r, "remote")
+		if err != nil {
+			httputil.WriteJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		from, to, g, err := bandwidthRangeFromQuery(r)
+		if err != nil {
+			httputil.WriteJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		records, err := ctx.RPC.RemoteBandwidth(remote, from, to, g)
+		if err != nil {
+			httputil.WriteJSON(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		httputil.WriteJSON(w, r, http.StatusOK, records)
+	})
+}
+
 type routingRuleResp struct {
 	Key     routing.RouteID      `json:"key"`
 	Rule    string               `json:"rule"`
@@ -802,6 +865,73 @@ func (hv *Hypervisor) updateAvailable() http.HandlerFunc {
 	})
 }
 
+// getEvents streams events of a visor as server-sent events, filtered by `type` query parameters if any are given.
+// Streaming resumes after the event of sequence number in the `Last-Event-ID` header or the `since` query parameter.
+func (hv *Hypervisor) getEvents() http.HandlerFunc {
+	return hv.withCtx(hv.visorCtx, func(w http.ResponseWriter, r *http.Request, ctx *httpCtx) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			httputil.WriteJSON(w, r, http.StatusInternalServerError, errors.New("streaming is not supported"))
+			return
+		}
+
+		lastID := r.Header.Get("Last-Event-ID")
+		if lastID == "" {
+			lastID = r.URL.Query().Get("since")
+		}
+
+		var since uint64
+		if lastID != "" {
+			var err error
+			if since, err = strconv.ParseUint(lastID, 10, 64); err != nil {
+				httputil.WriteJSON(w, r, http.StatusBadRequest, fmt.Errorf("invalid last event ID: %w", err))
+				return
+			}
+		}
+
+		var types []visor.EventType
+		for _, t := range strSliceFromQuery(r, "type", nil) {
+			types = append(types, visor.EventType(t))
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		for r.Context().Err() == nil {
+			events, err := ctx.RPC.Events(since, types, eventsPollTimeout)
+			if err != nil {
+				log.WithError(err).Warn("Failed to get visor events.")
+				return
+			}
+
+			// comments keep the connection alive while there are no events
+			if len(events) == 0 {
+				if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			}
+
+			for _, e := range events {
+				data, err := json.Marshal(e)
+				if err != nil {
+					log.WithError(err).Warn("Failed to marshal visor event.")
+					return
+				}
+
+				if _, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", e.Seq, data); err != nil {
+					return
+				}
+
+				since = e.Seq
+			}
+
+			flusher.Flush()
+		}
+	})
+}
+
 /*
 	<<< Helper functions >>>
 */
@@ -955,6 +1085,37 @@ func ridFromParam(r *http.Request, key string) (routing.RouteID, error) {
 	return routing.RouteID(rid), nil
 }
 
+// bandwidthRangeFromQuery parses `from` and `to` (RFC 3339) and `granularity` query parameters.
+// History of the last day is queried by default.
+func bandwidthRangeFromQuery(r *http.Request) (from, to time.Time, g transport.Granularity, err error) {
+	q := r.URL.Query()
+
+	to = time.Now()
+	if v := q.Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			return from, to, g, fmt.Errorf("invalid 'to' query parameter: %w", err)
+		}
+	}
+
+	from = to.Add(-24 * time.Hour)
+	if v := q.Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			return from, to, g, fmt.Errorf("invalid 'from' query parameter: %w", err)
+		}
+	}
+
+	if !from.Before(to) {
+		return from, to, g, errors.New("'from' should be before 'to'")
+	}
+
+	g = transport.Granularity(q.Get("granularity"))
+	if g != "" && g.Interval() == 0 {
+		return from, to, g, transport.ErrUnknownGranularity
+	}
+
+	return from, to, g, nil
+}
+
 func strSliceFromQuery(r *http.Request, key string, defaultVal []string) []string {
 	slice, ok := r.URL.Query()[key]
 	if !ok {
@@ -1,6 +1,7 @@
 package hypervisor
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,11 +12,16 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/SkycoinProject/dmsg/cipher"
 	"github.com/SkycoinProject/skycoin/src/util/logging"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/visor"
 )
 
 func TestMain(m *testing.M) {
@@ -447,3 +453,73 @@ func decodeErrorBody(rb io.Reader) (*ErrorBody, error) {
 
 	return b, dec.Decode(b)
 }
+
+// eventsRPCClient serves events once, and waits for the timeout afterwards.
+type eventsRPCClient struct {
+	visor.RPCClient
+	events []visor.Event
+	since  chan uint64
+}
+
+func (rc *eventsRPCClient) Events(since uint64, _ []visor.EventType, timeout time.Duration) ([]visor.Event, error) {
+	rc.since <- since
+
+	if since == 0 {
+		return rc.events, nil
+	}
+
+	time.Sleep(timeout)
+
+	return nil, nil
+}
+
+func TestGetEvents(t *testing.T) {
+	pk, _ := cipher.GenerateKeyPair()
+
+	rc := &eventsRPCClient{
+		events: []visor.Event{
+			{Seq: 1, Type: visor.EventAppStarted, Params: map[string]string{"app": "skychat"}},
+			{Seq: 2, Type: visor.EventAppCrashed, Params: map[string]string{"app": "skychat", "error": "exit status 1"}},
+		},
+		since: make(chan uint64, 2),
+	}
+
+	hv := &Hypervisor{
+		visors: map[cipher.PubKey]VisorConn{pk: {RPC: rc}},
+		mu:     new(sync.RWMutex),
+	}
+
+	srv := httptest.NewServer(hv)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/visors/" + pk.Hex() + "/events")
+	require.NoError(t, err)
+
+	defer func() {
+		assert.NoError(t, resp.Body.Close())
+	}()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	sc := bufio.NewScanner(resp.Body)
+
+	for _, want := range rc.events {
+		require.True(t, sc.Scan())
+		assert.Equal(t, fmt.Sprintf("id: %d", want.Seq), sc.Text())
+
+		require.True(t, sc.Scan())
+
+		var got visor.Event
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(sc.Text(), "data: ")), &got))
+		assert.Equal(t, want.Type, got.Type)
+		assert.Equal(t, want.Params, got.Params)
+
+		require.True(t, sc.Scan())
+		assert.Empty(t, sc.Text())
+	}
+
+	// Polling resumes after the last streamed event.
+	assert.Equal(t, uint64(0), <-rc.since)
+	assert.Equal(t, uint64(2), <-rc.since)
+}
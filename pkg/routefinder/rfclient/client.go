@@ -5,7 +5,6 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"net/http"
 	"net/url"
 	"strings"
@@ -44,6 +43,12 @@ type HTTPError struct {
 	Code    int    `json:"code"`
 }
 
+// Error implements error. FindRoutes of the HTTP client returns *HTTPError
+// with the status code of the response on unsuccessful responses.
+func (e *HTTPError) Error() string {
+	return e.Message
+}
+
 // Client implements route finding operations.
 type Client interface {
 	FindRoutes(ctx context.Context, rts []routing.PathEdges, opts *RouteOptions) (map[routing.PathEdges][]routing.Path, error)
@@ -105,12 +110,12 @@ func (c *apiClient) FindRoutes(ctx context.Context, rts []routing.PathEdges, opt
 	if res.StatusCode != http.StatusOK {
 		var apiErr HTTPResponse
 
-		err = json.NewDecoder(res.Body).Decode(&apiErr)
-		if err != nil {
-			return nil, err
+		msg := http.StatusText(res.StatusCode)
+		if err := json.NewDecoder(res.Body).Decode(&apiErr); err == nil && apiErr.Error != nil {
+			msg = apiErr.Error.Message
 		}
 
-		return nil, errors.New(apiErr.Error.Message)
+		return nil, &HTTPError{Message: msg, Code: res.StatusCode}
 	}
 
 	var paths map[routing.PathEdges][]routing.Path
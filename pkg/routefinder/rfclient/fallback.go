@@ -0,0 +1,77 @@
+package rfclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/routing"
+)
+
+// fallbackClient implements Client by trying several clients in order.
+type fallbackClient struct {
+	clients []Client
+}
+
+// NewFallback constructs a Client which tries `clients` in order until one of them finds routes.
+// It's used to fall back to local route computation when the route finder service is unreachable.
+// The next client is only tried on network errors, timeouts and server errors. Other errors
+// (e.g. no routes found or a bad request) are returned as is.
+func NewFallback(clients ...Client) Client {
+	if len(clients) == 1 {
+		return clients[0]
+	}
+
+	return &fallbackClient{clients: clients}
+}
+
+// FindRoutes implements Client.
+func (c *fallbackClient) FindRoutes(ctx context.Context, rts []routing.PathEdges, opts *RouteOptions) (map[routing.PathEdges][]routing.Path, error) {
+	if len(c.clients) == 0 {
+		return nil, errors.New("no route finder clients")
+	}
+
+	errs := make([]string, 0, len(c.clients))
+
+	for i, client := range c.clients {
+		routes, err := client.FindRoutes(ctx, rts, opts)
+		if err == nil {
+			return routes, nil
+		}
+
+		errs = append(errs, err.Error())
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		if !isUnavailable(err) {
+			return nil, err
+		}
+
+		if i < len(c.clients)-1 {
+			log.WithError(err).Warn("Failed to find routes, falling back to the next route finder")
+		}
+	}
+
+	return nil, fmt.Errorf("all route finders failed: %s", strings.Join(errs, "; "))
+}
+
+// isUnavailable checks whether `err` means that the route finder could not answer the request.
+func isUnavailable(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code >= http.StatusInternalServerError
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,86 @@
+package rfclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/routing"
+)
+
+func TestFallbackClient(t *testing.T) {
+	pk1, _ := cipher.GenerateKeyPair()
+	pk2, _ := cipher.GenerateKeyPair()
+
+	edges := []routing.PathEdges{{pk1, pk2}}
+
+	serve := func(status int, delay time.Duration) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(delay)
+			w.WriteHeader(status)
+			require.NoError(t, json.NewEncoder(w).Encode(HTTPResponse{
+				Error: &HTTPError{Message: http.StatusText(status), Code: status},
+			}))
+		}))
+	}
+
+	unreachable := serve(http.StatusOK, 0)
+	unreachable.Close()
+
+	tests := []struct {
+		name     string
+		status   int
+		delay    time.Duration
+		addr     string
+		fallback bool
+	}{
+		{name: "network error", addr: unreachable.URL, fallback: true},
+		{name: "timeout", status: http.StatusOK, delay: 200 * time.Millisecond, fallback: true},
+		{name: "server error", status: http.StatusInternalServerError, fallback: true},
+		{name: "service unavailable", status: http.StatusServiceUnavailable, fallback: true},
+		{name: "no routes", status: http.StatusNotFound, fallback: false},
+		{name: "bad request", status: http.StatusBadRequest, fallback: false},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			addr := tc.addr
+			if addr == "" {
+				srv := serve(tc.status, tc.delay)
+				defer srv.Close()
+
+				addr = srv.URL
+			}
+
+			rfc := NewFallback(NewHTTP(addr, 100*time.Millisecond), NewMock())
+
+			routes, err := rfc.FindRoutes(context.TODO(), edges, nil)
+			if !tc.fallback {
+				require.Error(t, err)
+
+				httpErr, ok := err.(*HTTPError)
+				require.True(t, ok)
+				require.Equal(t, tc.status, httpErr.Code)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, routes[edges[0]], 1)
+		})
+	}
+
+	t.Run("all route finders fail", func(t *testing.T) {
+		rfc := NewFallback(NewHTTP(unreachable.URL, 100*time.Millisecond), NewHTTP(unreachable.URL, 100*time.Millisecond))
+
+		_, err := rfc.FindRoutes(context.TODO(), edges, nil)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,480 @@
+package rfclient
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/google/uuid"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/routing"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/transport"
+)
+
+const (
+	defaultLocalPaths      = 5
+	defaultLocalMaxLookups = 64
+
+	// defaultHopLatency is the estimated latency of transports of unknown latency.
+	defaultHopLatency = 100 * time.Millisecond
+
+	// maxCandidatePaths limits the number of paths examined per edges pair,
+	// as paths violating hop constraints are skipped.
+	maxCandidatePaths = 64
+)
+
+// ErrNoRoutes is returned when no routes are found between edges.
+var ErrNoRoutes = errors.New("no routes found")
+
+// LocalOptions configures the local route finder client.
+type LocalOptions struct {
+	// Paths is the maximum number of paths returned per edges pair.
+	Paths int
+	// MaxLookups is the maximum number of visors whose transports are looked up in the transport discovery per call.
+	MaxLookups int
+	// MaxLatency is the maximum estimated latency of a path, 0 means no limit.
+	MaxLatency time.Duration
+	// Latency returns latency of the transport of ID `id`, if known.
+	// Otherwise, latency is estimated from link statistics measured by the transport manager
+	// or reported to the transport discovery. Transports of unknown latency are assumed to have the latency of 100ms.
+	Latency func(id uuid.UUID) (time.Duration, bool)
+}
+
+// DefaultLocalOptions returns default options of the local route finder client.
+func DefaultLocalOptions() *LocalOptions {
+	return &LocalOptions{
+		Paths:      defaultLocalPaths,
+		MaxLookups: defaultLocalMaxLookups,
+	}
+}
+
+// localClient implements Client by computing routes locally.
+type localClient struct {
+	dc   transport.DiscoveryClient
+	tm   *transport.Manager
+	opts LocalOptions
+}
+
+// NewLocal constructs a Client which computes routes locally, without a route finder service.
+// The graph of visors is built from transports registered in the transport discovery `dc`
+// and transports of `tm` (both are optional). The k shortest paths by estimated latency are returned.
+func NewLocal(dc transport.DiscoveryClient, tm *transport.Manager, opts *LocalOptions) Client {
+	if opts == nil {
+		opts = DefaultLocalOptions()
+	}
+
+	c := &localClient{dc: dc, tm: tm, opts: *opts}
+
+	if c.opts.Paths <= 0 {
+		c.opts.Paths = defaultLocalPaths
+	}
+
+	if c.opts.MaxLookups <= 0 {
+		c.opts.MaxLookups = defaultLocalMaxLookups
+	}
+
+	return c
+}
+
+// FindRoutes implements Client.
+func (c *localClient) FindRoutes(ctx context.Context, rts []routing.PathEdges, opts *RouteOptions) (map[routing.PathEdges][]routing.Path, error) {
+	if len(rts) == 0 {
+		return nil, errors.New("no edges provided to find routes for")
+	}
+
+	if opts == nil {
+		opts = &RouteOptions{}
+	}
+
+	g := c.buildGraph(ctx, rts, opts.MaxHops)
+
+	routes := make(map[routing.PathEdges][]routing.Path, len(rts))
+
+	for _, edges := range rts {
+		paths := g.kShortestPaths(edges[0], edges[1], c.opts.Paths, func(p graphPath) bool {
+			hops := len(p.edges)
+			if hops < int(opts.MinHops) || (opts.MaxHops > 0 && hops > int(opts.MaxHops)) {
+				return false
+			}
+
+			return c.opts.MaxLatency <= 0 || p.cost <= c.opts.MaxLatency
+		})
+
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("%w: %s -> %s", ErrNoRoutes, edges[0], edges[1])
+		}
+
+		routes[edges] = paths
+	}
+
+	return routes, nil
+}
+
+// buildGraph builds a graph of transports around the edges of `rts`. Transports of visors are looked up
+// in the transport discovery in breadth-first order starting from the edges, so that paths of up to
+// `maxHops` hops are covered by lookups from both ends, unless `MaxLookups` is reached first.
+func (c *localClient) buildGraph(ctx context.Context, rts []routing.PathEdges, maxHops uint16) *graph {
+	g := newGraph()
+
+	if c.tm != nil {
+		c.tm.WalkTransports(func(tp *transport.ManagedTransport) bool {
+			if tp.IsUp() {
+				g.addTransport(tp.Entry, c.latency(tp.Entry.ID, nil))
+			}
+
+			return true
+		})
+	}
+
+	if c.dc == nil {
+		return g
+	}
+
+	depth := -1
+	if maxHops > 0 {
+		depth = (int(maxHops) + 1) / 2
+	}
+
+	visited := make(map[cipher.PubKey]struct{})
+
+	var frontier []cipher.PubKey
+
+	for _, edges := range rts {
+		for _, pk := range edges {
+			if _, ok := visited[pk]; !ok {
+				visited[pk] = struct{}{}
+				frontier = append(frontier, pk)
+			}
+		}
+	}
+
+	lookups := 0
+
+	for level := 0; len(frontier) > 0 && level != depth; level++ {
+		var next []cipher.PubKey
+
+		for _, pk := range frontier {
+			if lookups >= c.opts.MaxLookups || ctx.Err() != nil {
+				return g
+			}
+
+			lookups++
+
+			entries, err := c.dc.GetTransportsByEdge(ctx, pk)
+			if err != nil {
+				log.WithError(err).Debugf("Failed to get transports of %s", pk)
+				continue
+			}
+
+			for _, entry := range entries {
+				if entry.Entry == nil || !entry.IsUp {
+					continue
+				}
+
+				g.addTransport(*entry.Entry, c.latency(entry.Entry.ID, entry.LinkStats))
+
+				for _, edge := range entry.Entry.Edges {
+					if _, ok := visited[edge]; !ok {
+						visited[edge] = struct{}{}
+						next = append(next, edge)
+					}
+				}
+			}
+		}
+
+		frontier = next
+	}
+
+	return g
+}
+
+// latency estimates latency of the transport of ID `id`. Link statistics measured locally take precedence
+// over `reported` ones.
+func (c *localClient) latency(id uuid.UUID, reported *transport.LinkStats) time.Duration {
+	if c.opts.Latency != nil {
+		if latency, ok := c.opts.Latency(id); ok && latency > 0 {
+			return latency
+		}
+	}
+
+	if c.tm != nil {
+		if tp := c.tm.Transport(id); tp != nil {
+			if stats, ok := tp.LinkStats(); ok && stats.RTT > 0 {
+				return stats.Latency()
+			}
+		}
+	}
+
+	if reported != nil && reported.RTT > 0 {
+		return reported.Latency()
+	}
+
+	return defaultHopLatency
+}
+
+// graphEdge is a transport between two visors, transports are usable in both directions.
+type graphEdge struct {
+	id       uuid.UUID
+	from, to cipher.PubKey
+	cost     time.Duration
+}
+
+// graphPath is a path of a graph with its total cost.
+type graphPath struct {
+	edges []graphEdge
+	cost  time.Duration
+}
+
+func (p graphPath) node(i int) cipher.PubKey {
+	if i == 0 {
+		return p.edges[0].from
+	}
+
+	return p.edges[i-1].to
+}
+
+func (p graphPath) toRoutingPath() routing.Path {
+	path := make(routing.Path, 0, len(p.edges))
+	for _, e := range p.edges {
+		path = append(path, routing.Hop{TpID: e.id, From: e.from, To: e.to})
+	}
+
+	return path
+}
+
+type graph struct {
+	edges map[cipher.PubKey][]graphEdge
+	known map[uuid.UUID]struct{}
+}
+
+func newGraph() *graph {
+	return &graph{
+		edges: make(map[cipher.PubKey][]graphEdge),
+		known: make(map[uuid.UUID]struct{}),
+	}
+}
+
+func (g *graph) addTransport(entry transport.Entry, cost time.Duration) {
+	if _, ok := g.known[entry.ID]; ok {
+		return
+	}
+
+	g.known[entry.ID] = struct{}{}
+
+	a, b := entry.Edges[0], entry.Edges[1]
+	if a == b {
+		return
+	}
+
+	g.edges[a] = append(g.edges[a], graphEdge{id: entry.ID, from: a, to: b, cost: cost})
+	g.edges[b] = append(g.edges[b], graphEdge{id: entry.ID, from: b, to: a, cost: cost})
+}
+
+// kShortestPaths returns up to `k` loopless paths from `src` to `dst` accepted by `accept`,
+// in the order of increasing cost. It implements Yen's algorithm.
+func (g *graph) kShortestPaths(src, dst cipher.PubKey, k int, accept func(graphPath) bool) []routing.Path {
+	first, ok := g.shortestPath(src, dst, nil, nil)
+	if !ok {
+		return nil
+	}
+
+	var (
+		found      = []graphPath{first}
+		candidates []graphPath
+		paths      []routing.Path
+	)
+
+	if accept(first) {
+		paths = append(paths, first.toRoutingPath())
+	}
+
+	for len(paths) < k && len(found) < maxCandidatePaths {
+		prev := found[len(found)-1]
+
+		for i := range prev.edges {
+			spurNode := prev.node(i)
+			root := prev.edges[:i]
+
+			removedEdges := make(map[uuid.UUID]struct{})
+			for _, p := range found {
+				if len(p.edges) > i && samePrefix(p.edges, root) {
+					removedEdges[p.edges[i].id] = struct{}{}
+				}
+			}
+
+			removedNodes := make(map[cipher.PubKey]struct{}, i)
+			for j := 0; j < i; j++ {
+				removedNodes[prev.node(j)] = struct{}{}
+			}
+
+			spur, ok := g.shortestPath(spurNode, dst, removedEdges, removedNodes)
+			if !ok {
+				continue
+			}
+
+			candidate := graphPath{
+				edges: append(append([]graphEdge{}, root...), spur.edges...),
+				cost:  spur.cost,
+			}
+			for _, e := range root {
+				candidate.cost += e.cost
+			}
+
+			if !containsPath(candidates, candidate) && !containsPath(found, candidate) {
+				candidates = append(candidates, candidate)
+			}
+		}
+
+		if len(candidates) == 0 {
+			break
+		}
+
+		sort.SliceStable(candidates, func(i, j int) bool {
+			if candidates[i].cost != candidates[j].cost {
+				return candidates[i].cost < candidates[j].cost
+			}
+
+			return len(candidates[i].edges) < len(candidates[j].edges)
+		})
+
+		next := candidates[0]
+		candidates = candidates[1:]
+		found = append(found, next)
+
+		if accept(next) {
+			paths = append(paths, next.toRoutingPath())
+		}
+	}
+
+	return paths
+}
+
+// shortestPath returns the cheapest path from `src` to `dst` which doesn't use `removedEdges`
+// and `removedNodes`. It implements Dijkstra's algorithm, ties are broken by the number of hops.
+func (g *graph) shortestPath(src, dst cipher.PubKey, removedEdges map[uuid.UUID]struct{},
+	removedNodes map[cipher.PubKey]struct{}) (graphPath, bool) {
+	if src == dst {
+		return graphPath{}, false
+	}
+
+	type visit struct {
+		cost time.Duration
+		hops int
+		via  graphEdge
+	}
+
+	best := map[cipher.PubKey]visit{src: {}}
+	done := make(map[cipher.PubKey]struct{})
+
+	q := &nodeQueue{{pk: src}}
+
+	for q.Len() > 0 {
+		cur := heap.Pop(q).(queuedNode)
+
+		if _, ok := done[cur.pk]; ok {
+			continue
+		}
+
+		done[cur.pk] = struct{}{}
+
+		if cur.pk == dst {
+			break
+		}
+
+		for _, e := range g.edges[cur.pk] {
+			if _, ok := removedEdges[e.id]; ok {
+				continue
+			}
+
+			if _, ok := removedNodes[e.to]; ok {
+				continue
+			}
+
+			if _, ok := done[e.to]; ok {
+				continue
+			}
+
+			cost, hops := cur.cost+e.cost, cur.hops+1
+
+			if v, ok := best[e.to]; ok && (v.cost < cost || (v.cost == cost && v.hops <= hops)) {
+				continue
+			}
+
+			best[e.to] = visit{cost: cost, hops: hops, via: e}
+			heap.Push(q, queuedNode{pk: e.to, cost: cost, hops: hops})
+		}
+	}
+
+	if _, ok := done[dst]; !ok {
+		return graphPath{}, false
+	}
+
+	var edges []graphEdge
+	for pk := dst; pk != src; {
+		e := best[pk].via
+		edges = append(edges, e)
+		pk = e.from
+	}
+
+	for i, j := 0, len(edges)-1; i < j; i, j = i+1, j-1 {
+		edges[i], edges[j] = edges[j], edges[i]
+	}
+
+	return graphPath{edges: edges, cost: best[dst].cost}, true
+}
+
+func samePrefix(edges, prefix []graphEdge) bool {
+	for i := range prefix {
+		if edges[i].id != prefix[i].id || edges[i].from != prefix[i].from {
+			return false
+		}
+	}
+
+	return true
+}
+
+func containsPath(paths []graphPath, path graphPath) bool {
+	for _, p := range paths {
+		if len(p.edges) == len(path.edges) && samePrefix(p.edges, path.edges) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type queuedNode struct {
+	pk   cipher.PubKey
+	cost time.Duration
+	hops int
+}
+
+// nodeQueue is a priority queue of nodes ordered by cost, implements heap.Interface.
+type nodeQueue []queuedNode
+
+func (q nodeQueue) Len() int { return len(q) }
+
+func (q nodeQueue) Less(i, j int) bool {
+	if q[i].cost != q[j].cost {
+		return q[i].cost < q[j].cost
+	}
+
+	return q[i].hops < q[j].hops
+}
+
+func (q nodeQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *nodeQueue) Push(x interface{}) { *q = append(*q, x.(queuedNode)) }
+
+func (q *nodeQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	x := old[n-1]
+	*q = old[:n-1]
+
+	return x
+}
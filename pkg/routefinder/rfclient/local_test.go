@@ -0,0 +1,106 @@
+package rfclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/routing"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/transport"
+)
+
+func TestLocalClient_FindRoutes(t *testing.T) {
+	pks := make([]cipher.PubKey, 5)
+	for i := range pks {
+		pks[i], _ = cipher.GenerateKeyPair()
+	}
+
+	a, b, c, d, isolated := pks[0], pks[1], pks[2], pks[3], pks[4]
+
+	dc := transport.NewDiscoveryMock()
+
+	register := func(from, to cipher.PubKey) uuid.UUID {
+		entry := transport.NewEntry(from, to, "dmsg", true)
+		require.NoError(t, dc.RegisterTransports(context.TODO(), &transport.SignedEntry{Entry: entry}))
+
+		return entry.ID
+	}
+
+	ab, bd, ac, cd, ad := register(a, b), register(b, d), register(a, c), register(c, d), register(a, d)
+
+	ctx := context.TODO()
+	fwd := routing.PathEdges{a, d}
+	rev := routing.PathEdges{d, a}
+
+	t.Run("k shortest paths", func(t *testing.T) {
+		latency := map[uuid.UUID]time.Duration{ab: 10 * time.Millisecond, bd: 10 * time.Millisecond}
+		rfc := NewLocal(dc, nil, &LocalOptions{
+			Latency: func(id uuid.UUID) (time.Duration, bool) {
+				l, ok := latency[id]
+				return l, ok
+			},
+		})
+
+		routes, err := rfc.FindRoutes(ctx, []routing.PathEdges{fwd, rev}, &RouteOptions{MaxHops: 5})
+		require.NoError(t, err)
+
+		require.Equal(t, []routing.Path{
+			{{TpID: ab, From: a, To: b}, {TpID: bd, From: b, To: d}},
+			{{TpID: ad, From: a, To: d}},
+			{{TpID: ac, From: a, To: c}, {TpID: cd, From: c, To: d}},
+		}, routes[fwd])
+
+		require.Len(t, routes[rev], 3)
+		require.Equal(t, routing.Path{{TpID: bd, From: d, To: b}, {TpID: ab, From: b, To: a}}, routes[rev][0])
+	})
+
+	t.Run("hop constraints", func(t *testing.T) {
+		rfc := NewLocal(dc, nil, nil)
+
+		routes, err := rfc.FindRoutes(ctx, []routing.PathEdges{fwd}, &RouteOptions{MinHops: 2, MaxHops: 2})
+		require.NoError(t, err)
+		require.Len(t, routes[fwd], 2)
+
+		for _, path := range routes[fwd] {
+			require.Len(t, path, 2)
+		}
+
+		routes, err = rfc.FindRoutes(ctx, []routing.PathEdges{fwd}, &RouteOptions{MaxHops: 1})
+		require.NoError(t, err)
+		require.Equal(t, []routing.Path{{{TpID: ad, From: a, To: d}}}, routes[fwd])
+	})
+
+	t.Run("latency constraint", func(t *testing.T) {
+		rfc := NewLocal(dc, nil, &LocalOptions{MaxLatency: defaultHopLatency})
+
+		routes, err := rfc.FindRoutes(ctx, []routing.PathEdges{fwd}, nil)
+		require.NoError(t, err)
+		require.Equal(t, []routing.Path{{{TpID: ad, From: a, To: d}}}, routes[fwd])
+	})
+
+	t.Run("no routes", func(t *testing.T) {
+		rfc := NewLocal(dc, nil, nil)
+
+		_, err := rfc.FindRoutes(ctx, []routing.PathEdges{{a, isolated}}, nil)
+		require.True(t, errors.Is(err, ErrNoRoutes))
+	})
+
+	t.Run("reported link stats", func(t *testing.T) {
+		stats := &transport.LinkStats{RTT: 20 * time.Millisecond, Probes: 10}
+		_, err := dc.UpdateStatuses(ctx,
+			&transport.Status{ID: ac, IsUp: true, LinkStats: stats},
+			&transport.Status{ID: cd, IsUp: true, LinkStats: stats})
+		require.NoError(t, err)
+
+		rfc := NewLocal(dc, nil, nil)
+
+		routes, err := rfc.FindRoutes(ctx, []routing.PathEdges{fwd}, nil)
+		require.NoError(t, err)
+		require.Equal(t, routing.Path{{TpID: ac, From: a, To: c}, {TpID: cd, From: c, To: d}}, routes[fwd][0])
+	})
+}
@@ -0,0 +1,209 @@
+package router
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/routing"
+)
+
+// minBandwidthBurst is the minimum burst size of a rate limit, it fits the largest packet.
+const minBandwidthBurst = routing.PacketHeaderSize + math.MaxUint16
+
+// BandwidthLimits configures rate limits of traffic forwarded by the router, in bytes per second.
+// Packets exceeding any of the matching limits are delayed until they conform to all of them
+// (see forwardShaper). Zero rate means no limit.
+// Only data packets are limited, control packets (keep-alive, close, etc.) are always forwarded.
+type BandwidthLimits struct {
+	// Forwarded limits all the traffic forwarded for other visors (via intermediary forward rules).
+	Forwarded uint64 `json:"forwarded,omitempty"`
+	// PubKeys limits traffic forwarded to transports with the given remote visors.
+	PubKeys map[cipher.PubKey]uint64 `json:"pub_keys,omitempty"`
+	// Routes limits traffic forwarded by rules with the given route descriptors.
+	Routes []RouteBandwidthLimit `json:"routes,omitempty"`
+}
+
+// RouteBandwidthLimit is a rate limit of a route with the given route descriptor.
+type RouteBandwidthLimit struct {
+	Src  routing.Addr `json:"src"`
+	Dst  routing.Addr `json:"dst"`
+	Rate uint64       `json:"rate"`
+}
+
+// Desc returns route descriptor of the limited route.
+func (l RouteBandwidthLimit) Desc() routing.RouteDescriptor {
+	return routing.NewRouteDescriptor(l.Src.PubKey, l.Dst.PubKey, l.Src.Port, l.Dst.Port)
+}
+
+// tokenBucket limits rate of traffic. It holds up to one second worth of tokens.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate uint64, now time.Time) *tokenBucket {
+	burst := math.Max(float64(rate), minBandwidthBurst)
+
+	return &tokenBucket{
+		rate:   float64(rate),
+		burst:  burst,
+		tokens: burst,
+		last:   now,
+	}
+}
+
+// refill adds tokens accumulated since the last refill.
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// take refills the bucket and takes `n` tokens from it. The bucket may go into debt,
+// in which case it returns the time until the debt is paid off.
+func (b *tokenBucket) take(n int, now time.Time) time.Duration {
+	b.refill(now)
+	b.tokens -= float64(n)
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// bandwidthLimiter enforces BandwidthLimits.
+type bandwidthLimiter struct {
+	mu        sync.Mutex
+	limits    BandwidthLimits
+	forwarded *tokenBucket
+	pks       map[cipher.PubKey]*tokenBucket
+	routes    map[routing.RouteDescriptor]*tokenBucket
+}
+
+func newBandwidthLimiter(limits BandwidthLimits) *bandwidthLimiter {
+	l := &bandwidthLimiter{}
+	l.setLimits(limits)
+
+	return l
+}
+
+// Limits returns the current limits.
+func (l *bandwidthLimiter) Limits() BandwidthLimits {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.limits.copy()
+}
+
+// setLimits replaces the current limits, all the buckets are reset.
+func (l *bandwidthLimiter) setLimits(limits BandwidthLimits) {
+	limits = limits.copy()
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limits = limits
+	l.forwarded = nil
+	l.pks = make(map[cipher.PubKey]*tokenBucket)
+	l.routes = make(map[routing.RouteDescriptor]*tokenBucket)
+
+	if limits.Forwarded > 0 {
+		l.forwarded = newTokenBucket(limits.Forwarded, now)
+	}
+
+	for pk, rate := range limits.PubKeys {
+		if rate > 0 {
+			l.pks[pk] = newTokenBucket(rate, now)
+		}
+	}
+
+	for _, route := range limits.Routes {
+		if route.Rate > 0 {
+			l.routes[route.Desc()] = newTokenBucket(route.Rate, now)
+		}
+	}
+}
+
+// reserve takes tokens for a packet of `size` bytes forwarded by `rule` to the visor `remote`
+// from all the matching buckets. It returns how long the packet should be delayed for
+// to conform to all the matching limits.
+func (l *bandwidthLimiter) reserve(rule routing.Rule, remote cipher.PubKey, size int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	buckets := make([]*tokenBucket, 0, 3)
+
+	if rule.Type() == routing.RuleIntermediaryForward && l.forwarded != nil {
+		buckets = append(buckets, l.forwarded)
+	}
+
+	if b, ok := l.pks[remote]; ok {
+		buckets = append(buckets, b)
+	}
+
+	if desc, ok := ruleDescriptor(rule); ok {
+		if b, ok := l.routes[desc]; ok {
+			buckets = append(buckets, b)
+		}
+	}
+
+	now := time.Now()
+
+	var delay time.Duration
+
+	for _, b := range buckets {
+		if d := b.take(size, now); d > delay {
+			delay = d
+		}
+	}
+
+	return delay
+}
+
+func (limits BandwidthLimits) copy() BandwidthLimits {
+	out := BandwidthLimits{Forwarded: limits.Forwarded}
+
+	if limits.PubKeys != nil {
+		out.PubKeys = make(map[cipher.PubKey]uint64, len(limits.PubKeys))
+		for pk, rate := range limits.PubKeys {
+			out.PubKeys[pk] = rate
+		}
+	}
+
+	if limits.Routes != nil {
+		out.Routes = append([]RouteBandwidthLimit(nil), limits.Routes...)
+	}
+
+	return out
+}
+
+// ruleDescriptor returns route descriptor of the rule if it's known.
+// Intermediary forward rules carry route descriptors if the setup node included them.
+func ruleDescriptor(rule routing.Rule) (routing.RouteDescriptor, bool) {
+	switch rule.Type() {
+	case routing.RuleConsume, routing.RuleForward:
+		return rule.RouteDescriptor(), true
+	case routing.RuleIntermediaryForward:
+		return rule.IntermediaryRouteDescriptor()
+	default:
+		return routing.RouteDescriptor{}, false
+	}
+}
+
+// isDataPacket checks whether packets of type `t` carry data of route groups.
+func isDataPacket(t routing.PacketType) bool {
+	switch t {
+	case routing.DataPacket, routing.SequencedDataPacket, routing.FragmentPacket:
+		return true
+	default:
+		return false
+	}
+}
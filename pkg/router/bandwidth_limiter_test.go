@@ -0,0 +1,97 @@
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/routing"
+)
+
+func TestBandwidthLimiter(t *testing.T) {
+	pk1, _ := cipher.GenerateKeyPair()
+	pk2, _ := cipher.GenerateKeyPair()
+
+	forward := routing.ForwardRule(time.Hour, 3, 4, uuid.New(), pk1, pk2, 1, 2)
+	fwdDesc := forward.RouteDescriptor()
+	intermediary := routing.IntermediaryForwardRuleWithDesc(time.Hour, 1, 2, uuid.New(), fwdDesc)
+	otherIntermediary := routing.IntermediaryForwardRule(time.Hour, 5, 6, uuid.New())
+
+	const (
+		rate      = 1000
+		tolerance = float64(10 * time.Millisecond)
+	)
+
+	t.Run("forwarded", func(t *testing.T) {
+		l := newBandwidthLimiter(BandwidthLimits{Forwarded: rate})
+
+		require.Zero(t, l.reserve(intermediary, pk1, minBandwidthBurst))
+		require.InDelta(t, float64(500*time.Millisecond), float64(l.reserve(intermediary, pk1, rate/2)), tolerance)
+
+		// delays accumulate
+		require.InDelta(t, float64(time.Second), float64(l.reserve(otherIntermediary, pk1, rate/2)), tolerance)
+
+		// local traffic is not limited by the forwarded traffic limit
+		require.Zero(t, l.reserve(forward, pk1, minBandwidthBurst))
+	})
+
+	t.Run("per pk", func(t *testing.T) {
+		l := newBandwidthLimiter(BandwidthLimits{PubKeys: map[cipher.PubKey]uint64{pk1: rate}})
+
+		require.Zero(t, l.reserve(intermediary, pk1, minBandwidthBurst))
+		require.InDelta(t, float64(500*time.Millisecond), float64(l.reserve(forward, pk1, rate/2)), tolerance)
+		require.Zero(t, l.reserve(intermediary, pk2, minBandwidthBurst))
+	})
+
+	t.Run("per route", func(t *testing.T) {
+		l := newBandwidthLimiter(BandwidthLimits{Routes: []RouteBandwidthLimit{{
+			Src:  fwdDesc.Src(),
+			Dst:  fwdDesc.Dst(),
+			Rate: rate,
+		}}})
+
+		// intermediary rules of the route are limited as well
+		require.Zero(t, l.reserve(forward, pk1, minBandwidthBurst))
+		require.InDelta(t, float64(500*time.Millisecond), float64(l.reserve(intermediary, pk1, rate/2)), tolerance)
+
+		// intermediary rules of other routes and those without descriptors are not
+		require.Zero(t, l.reserve(otherIntermediary, pk1, minBandwidthBurst))
+	})
+
+	t.Run("longest delay", func(t *testing.T) {
+		l := newBandwidthLimiter(BandwidthLimits{
+			Forwarded: rate,
+			PubKeys:   map[cipher.PubKey]uint64{pk1: rate * 2},
+		})
+
+		require.Zero(t, l.reserve(intermediary, pk1, minBandwidthBurst))
+		require.InDelta(t, float64(time.Second), float64(l.reserve(intermediary, pk1, rate)), tolerance)
+	})
+
+	t.Run("refill", func(t *testing.T) {
+		b := newTokenBucket(1000, time.Now())
+		b.tokens = 0
+
+		require.Equal(t, 100*time.Millisecond, b.take(100, b.last))
+		require.Zero(t, b.take(100, b.last.Add(200*time.Millisecond)))
+
+		// tokens never exceed the burst
+		require.Equal(t, time.Second, b.take(minBandwidthBurst+1000, b.last.Add(time.Hour)))
+	})
+
+	t.Run("set limits", func(t *testing.T) {
+		limits := BandwidthLimits{Forwarded: rate, PubKeys: map[cipher.PubKey]uint64{pk1: rate * 2}}
+
+		l := newBandwidthLimiter(BandwidthLimits{})
+		require.Zero(t, l.reserve(intermediary, pk1, minBandwidthBurst*2))
+
+		l.setLimits(limits)
+		assert.Equal(t, limits, l.Limits())
+		require.Zero(t, l.reserve(intermediary, pk1, minBandwidthBurst))
+		require.NotZero(t, l.reserve(intermediary, pk1, 1))
+	})
+}
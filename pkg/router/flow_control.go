@@ -0,0 +1,182 @@
+package router
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPacketLossTimeout    = 5 * time.Second
+	defaultWindowUpdateInterval = time.Second
+)
+
+// flowControl implements a sliding window flow control of a route group.
+//
+// The receiving side advertises the cumulative number of data packets it received
+// and the cumulative number of data packets the remote is allowed to send (the limit).
+// The limit moves as the reader consumes data, so a sender backs off when the remote reader
+// is slow instead of blocking the read loop of the remote router (and every other route group
+// served by the same transport). The receiving side also advertises its window periodically
+// and as soon as the window gets closed, so a sender waiting for a slow reader keeps learning
+// that its packets were received.
+//
+// As counters are cumulative, window updates may be lost or arrive out of order.
+// The sending side is only limited once the first window update is received,
+// so remotes which don't support flow control are not affected.
+//
+// Packets lost on the way never reach the remote, so their share of the window would never be returned.
+// The sending side considers packets lost once the remote reports it still didn't receive them
+// at least the loss timeout after they were sent, and reclaims their share of the window.
+type flowControl struct {
+	mu sync.Mutex
+
+	window      uint32
+	lossTimeout time.Duration
+
+	// sending side
+	active         bool          // set on the first window update from the remote
+	sent           uint32        // data packets sent
+	lost           uint32        // data packets known to be lost
+	limit          uint32        // data packets the remote allows to send
+	remoteReceived uint32        // data packets the remote received
+	checkpoint     uint32        // data packets sent by 'checkpointTime'
+	checkpointTime time.Time     // time the packets sent before are checked for loss after
+	updated        chan struct{} // closed and replaced on every window update
+
+	// receiving side
+	received           uint32 // data packets received
+	advertised         uint32 // limit advertised to the remote
+	advertisedReceived uint32 // received data packets advertised to the remote
+	announced          bool   // whether the limit was ever advertised
+}
+
+func newFlowControl(window int, lossTimeout time.Duration) *flowControl {
+	if window <= 0 {
+		window = defaultReadChBufSize
+	}
+
+	if lossTimeout <= 0 {
+		lossTimeout = defaultPacketLossTimeout
+	}
+
+	return &flowControl{
+		window:      uint32(window),
+		lossTimeout: lossTimeout,
+		updated:     make(chan struct{}),
+	}
+}
+
+// acquire reserves the window for a single data packet, blocking while the window is exhausted.
+// A slow remote reader is waited for as long as it takes, the window only moves on window updates.
+func (fc *flowControl) acquire(deadline, closed <-chan struct{}) error {
+	for {
+		fc.mu.Lock()
+
+		if !fc.active || int32(fc.sent-fc.lost-fc.limit) < 0 {
+			fc.sent++
+			fc.mu.Unlock()
+
+			return nil
+		}
+
+		updated := fc.updated
+		fc.mu.Unlock()
+
+		select {
+		case <-updated:
+		case <-deadline:
+			return timeoutError{}
+		case <-closed:
+			return io.ErrClosedPipe
+		}
+	}
+}
+
+// release returns the window reserved for a data packet which was not sent.
+func (fc *flowControl) release() {
+	fc.mu.Lock()
+	fc.sent--
+	fc.mu.Unlock()
+}
+
+// update applies a window update received from the remote.
+func (fc *flowControl) update(received, limit uint32) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	now := time.Now()
+
+	if !fc.active {
+		fc.active = true
+		fc.limit = limit
+		fc.remoteReceived = received
+		fc.checkpoint = fc.sent
+		fc.checkpointTime = now
+	} else {
+		if int32(limit-fc.limit) > 0 {
+			fc.limit = limit
+		}
+
+		if int32(received-fc.remoteReceived) > 0 {
+			fc.remoteReceived = received
+		}
+	}
+
+	if now.Sub(fc.checkpointTime) >= fc.lossTimeout {
+		// packets sent before the checkpoint had enough time to reach the remote
+		if missing := int32(fc.checkpoint - fc.lost - fc.remoteReceived); missing > 0 {
+			fc.lost += uint32(missing)
+		}
+
+		fc.checkpoint = fc.sent
+		fc.checkpointTime = now
+	}
+
+	close(fc.updated)
+	fc.updated = make(chan struct{})
+}
+
+// onReceive counts a data packet received from the remote.
+func (fc *flowControl) onReceive() {
+	fc.mu.Lock()
+	fc.received++
+	fc.mu.Unlock()
+}
+
+// windowUpdate returns the window update which should be sent to the remote, given the number
+// of received data packets which are not consumed by the reader yet. Unless `force` is set,
+// it returns false if the advertised window did not move far enough to be worth an update
+// and was not closed since the last update. If `force` is set, the window is advertised
+// as long as there's something the remote may not know yet.
+func (fc *flowControl) windowUpdate(queued int, force bool) (received, limit uint32, ok bool) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	if fc.received == 0 {
+		return 0, 0, false
+	}
+
+	limit = fc.received - uint32(queued) + fc.window
+
+	switch {
+	case !fc.announced:
+	case force:
+		if fc.received == fc.advertisedReceived && limit == fc.advertised && queued == 0 {
+			return 0, 0, false
+		}
+	case limit == fc.received:
+		// the window is closed, let the remote know that all its packets are received
+		if fc.received == fc.advertisedReceived {
+			return 0, 0, false
+		}
+	case int32(limit-fc.advertised) < int32(fc.window/2):
+		return 0, 0, false
+	}
+
+	fc.advertised = limit
+	fc.advertisedReceived = fc.received
+	fc.announced = true
+
+	return fc.received, limit, true
+}
@@ -0,0 +1,147 @@
+package router
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlowControl_Acquire(t *testing.T) {
+	fc := newFlowControl(4, time.Hour)
+	closed := make(chan struct{})
+
+	// not limited until the remote advertises its window
+	for i := 0; i < 6; i++ {
+		require.NoError(t, fc.acquire(nil, closed))
+	}
+
+	fc.update(2, 6)
+
+	deadline := make(chan struct{})
+	close(deadline)
+	require.Equal(t, timeoutError{}, fc.acquire(deadline, closed))
+
+	// out of order update doesn't shrink the window
+	fc.update(6, 8)
+	fc.update(4, 7)
+
+	require.NoError(t, fc.acquire(nil, closed))
+	require.NoError(t, fc.acquire(nil, closed))
+
+	errCh := make(chan error)
+	go func() {
+		errCh <- fc.acquire(nil, closed)
+	}()
+
+	select {
+	case err := <-errCh:
+		t.Fatalf("acquire did not block: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	fc.update(8, 9)
+	require.NoError(t, <-errCh)
+
+	go func() {
+		errCh <- fc.acquire(nil, closed)
+	}()
+
+	close(closed)
+	require.Equal(t, io.ErrClosedPipe, <-errCh)
+
+	// released window may be acquired again
+	fc.release()
+	require.NoError(t, fc.acquire(nil, nil))
+}
+
+func TestFlowControl_Loss(t *testing.T) {
+	fc := newFlowControl(4, 50*time.Millisecond)
+
+	fc.update(0, 4)
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, fc.acquire(nil, nil))
+	}
+
+	deadline := make(chan struct{})
+	close(deadline)
+
+	// the reader is slow but all packets are received, the window stays closed
+	time.Sleep(60 * time.Millisecond)
+	fc.update(4, 4)
+	require.Equal(t, timeoutError{}, fc.acquire(deadline, nil))
+
+	fc.update(5, 6)
+	require.NoError(t, fc.acquire(nil, nil))
+	require.NoError(t, fc.acquire(nil, nil))
+
+	// one of the packets is lost, it's not considered lost until the loss timeout passes after it's sent
+	fc.update(5, 6)
+	require.Equal(t, timeoutError{}, fc.acquire(deadline, nil))
+
+	time.Sleep(60 * time.Millisecond)
+	fc.update(5, 6)
+	require.Equal(t, timeoutError{}, fc.acquire(deadline, nil))
+
+	// the remote still didn't receive it, its share of the window is reclaimed
+	time.Sleep(60 * time.Millisecond)
+	fc.update(5, 6)
+	require.NoError(t, fc.acquire(nil, nil))
+	require.Equal(t, timeoutError{}, fc.acquire(deadline, nil))
+}
+
+func TestFlowControl_WindowUpdate(t *testing.T) {
+	fc := newFlowControl(4, time.Hour)
+
+	_, _, ok := fc.windowUpdate(0, false)
+	require.False(t, ok)
+
+	// the first received packet is always announced
+	fc.onReceive()
+
+	received, limit, ok := fc.windowUpdate(1, false)
+	require.True(t, ok)
+	require.Equal(t, uint32(1), received)
+	require.Equal(t, uint32(4), limit)
+
+	fc.onReceive()
+	fc.onReceive()
+
+	// window moved by one packet only
+	_, _, ok = fc.windowUpdate(2, false)
+	require.False(t, ok)
+
+	received, limit, ok = fc.windowUpdate(1, false)
+	require.True(t, ok)
+	require.Equal(t, uint32(3), received)
+	require.Equal(t, uint32(6), limit)
+
+	// the window got closed
+	fc.onReceive()
+	fc.onReceive()
+	fc.onReceive()
+
+	received, limit, ok = fc.windowUpdate(4, false)
+	require.True(t, ok)
+	require.Equal(t, uint32(6), received)
+	require.Equal(t, uint32(6), limit)
+
+	_, _, ok = fc.windowUpdate(4, false)
+	require.False(t, ok)
+
+	// periodic updates are sent while the window is not fully open
+	received, limit, ok = fc.windowUpdate(4, true)
+	require.True(t, ok)
+	require.Equal(t, uint32(6), received)
+	require.Equal(t, uint32(6), limit)
+
+	received, limit, ok = fc.windowUpdate(0, true)
+	require.True(t, ok)
+	require.Equal(t, uint32(6), received)
+	require.Equal(t, uint32(10), limit)
+
+	_, _, ok = fc.windowUpdate(0, true)
+	require.False(t, ok)
+}
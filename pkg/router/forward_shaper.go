@@ -0,0 +1,126 @@
+package router
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/routing"
+)
+
+// forwardQueueSize is the maximum number of forwarded packets of a rule waiting to conform to bandwidth limits.
+const forwardQueueSize = 256
+
+// forwardShaper delays forwarded packets exceeding bandwidth limits instead of dropping them.
+// Delayed packets are queued per rule and sent in order once they conform to the limits.
+// Once the queue of a rule is full, forwarding blocks, so the backpressure reaches
+// the transport the packets are read from.
+type forwardShaper struct {
+	mu     sync.Mutex
+	queues map[routing.RouteID]*forwardQueue
+	done   <-chan struct{}
+	logger *logging.Logger
+}
+
+// forwardQueue holds delayed packets of a rule. It's served by a goroutine which exits once the queue is empty.
+type forwardQueue struct {
+	packets []shapedPacket
+	space   chan struct{} // closed and replaced whenever a packet leaves the queue
+}
+
+type shapedPacket struct {
+	due  time.Time
+	send func() error
+}
+
+func newForwardShaper(done <-chan struct{}, logger *logging.Logger) *forwardShaper {
+	return &forwardShaper{
+		queues: make(map[routing.RouteID]*forwardQueue),
+		done:   done,
+		logger: logger,
+	}
+}
+
+// forward sends a packet of the rule with the key route ID `id` with `send` once `delay` passes and
+// the packets of the rule queued before it are sent. Packets which don't have to be delayed are sent
+// right away unless the rule has queued packets. It blocks while the queue of the rule is full.
+func (s *forwardShaper) forward(ctx context.Context, id routing.RouteID, delay time.Duration, send func() error) error {
+	due := time.Now().Add(delay)
+
+	for {
+		s.mu.Lock()
+
+		q, ok := s.queues[id]
+		if !ok {
+			if delay <= 0 {
+				s.mu.Unlock()
+				return send()
+			}
+
+			q = &forwardQueue{space: make(chan struct{})}
+			s.queues[id] = q
+
+			go s.serve(id, q)
+		}
+
+		if len(q.packets) < forwardQueueSize {
+			q.packets = append(q.packets, shapedPacket{due: due, send: send})
+			s.mu.Unlock()
+
+			return nil
+		}
+
+		space := q.space
+		s.mu.Unlock()
+
+		select {
+		case <-space:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.done:
+			return io.ErrClosedPipe
+		}
+	}
+}
+
+// serve sends packets of `q` when they are due.
+func (s *forwardShaper) serve(id routing.RouteID, q *forwardQueue) {
+	for {
+		s.mu.Lock()
+
+		if len(q.packets) == 0 {
+			delete(s.queues, id)
+			s.mu.Unlock()
+
+			return
+		}
+
+		p := q.packets[0]
+		s.mu.Unlock()
+
+		if wait := time.Until(p.due); wait > 0 {
+			timer := time.NewTimer(wait)
+
+			select {
+			case <-timer.C:
+			case <-s.done:
+				timer.Stop()
+				return
+			}
+		}
+
+		if err := p.send(); err != nil {
+			s.logger.WithError(err).Debugf("Failed to forward delayed packet of rule %d", id)
+		}
+
+		s.mu.Lock()
+		q.packets[0] = shapedPacket{}
+		q.packets = q.packets[1:]
+		close(q.space)
+		q.space = make(chan struct{})
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,74 @@
+package router
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardShaper(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	s := newForwardShaper(done, logging.MustGetLogger("forward_shaper"))
+
+	var (
+		mu   sync.Mutex
+		sent []int
+	)
+
+	send := func(i int) func() error {
+		return func() error {
+			mu.Lock()
+			sent = append(sent, i)
+			mu.Unlock()
+
+			return nil
+		}
+	}
+
+	sentPackets := func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]int(nil), sent...)
+	}
+
+	ctx := context.Background()
+
+	// packets which don't have to be delayed are sent right away
+	require.NoError(t, s.forward(ctx, 1, 0, send(0)))
+	require.Equal(t, []int{0}, sentPackets())
+
+	// delayed packets are sent in order, including those queued after them without delays
+	start := time.Now()
+	require.NoError(t, s.forward(ctx, 1, 100*time.Millisecond, send(1)))
+	require.NoError(t, s.forward(ctx, 1, 0, send(2)))
+	require.Equal(t, []int{0}, sentPackets())
+
+	require.Eventually(t, func() bool {
+		return len(sentPackets()) == 3
+	}, time.Second, 5*time.Millisecond)
+	require.True(t, time.Since(start) >= 100*time.Millisecond)
+	require.Equal(t, []int{0, 1, 2}, sentPackets())
+
+	// queues of other rules are independent
+	require.NoError(t, s.forward(ctx, 1, time.Hour, send(3)))
+	require.NoError(t, s.forward(ctx, 2, 0, send(4)))
+	require.Equal(t, []int{0, 1, 2, 4}, sentPackets())
+
+	// forwarding blocks while the queue is full
+	for i := 1; i < forwardQueueSize; i++ {
+		require.NoError(t, s.forward(ctx, 1, time.Hour, send(5)))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	require.Equal(t, context.DeadlineExceeded, s.forward(ctx, 1, 0, send(6)))
+	require.Equal(t, []int{0, 1, 2, 4}, sentPackets())
+}
@@ -9,6 +9,8 @@ import (
 
 	mock "github.com/stretchr/testify/mock"
 
+	rfclient "github.com/SkycoinProject/skywire-mainnet/pkg/routefinder/rfclient"
+
 	routing "github.com/SkycoinProject/skywire-mainnet/pkg/routing"
 )
 
@@ -40,6 +42,20 @@ func (_m *MockRouter) AcceptRoutes(_a0 context.Context) (*RouteGroup, error) {
 	return r0, r1
 }
 
+// BandwidthLimits provides a mock function with given fields:
+func (_m *MockRouter) BandwidthLimits() BandwidthLimits {
+	ret := _m.Called()
+
+	var r0 BandwidthLimits
+	if rf, ok := ret.Get(0).(func() BandwidthLimits); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(BandwidthLimits)
+	}
+
+	return r0
+}
+
 // Close provides a mock function with given fields:
 func (_m *MockRouter) Close() error {
 	ret := _m.Called()
@@ -220,6 +236,21 @@ func (_m *MockRouter) Serve(_a0 context.Context) error {
 	return r0
 }
 
+// SetBandwidthLimits provides a mock function with given fields: _a0
+func (_m *MockRouter) SetBandwidthLimits(_a0 BandwidthLimits) {
+	_m.Called(_a0)
+}
+
+// SetRouteFinder provides a mock function with given fields: _a0
+func (_m *MockRouter) SetRouteFinder(_a0 rfclient.Client) {
+	_m.Called(_a0)
+}
+
+// SetSetupNodes provides a mock function with given fields: _a0
+func (_m *MockRouter) SetSetupNodes(_a0 []cipher.PubKey) {
+	_m.Called(_a0)
+}
+
 // SetupIsTrusted provides a mock function with given fields: _a0
 func (_m *MockRouter) SetupIsTrusted(_a0 cipher.PubKey) bool {
 	ret := _m.Called(_a0)
@@ -233,3 +264,26 @@ func (_m *MockRouter) SetupIsTrusted(_a0 cipher.PubKey) bool {
 
 	return r0
 }
+
+// TraceRoute provides a mock function with given fields: ctx, routeID
+func (_m *MockRouter) TraceRoute(ctx context.Context, routeID routing.RouteID) ([]HopRTT, error) {
+	ret := _m.Called(ctx, routeID)
+
+	var r0 []HopRTT
+	if rf, ok := ret.Get(0).(func(context.Context, routing.RouteID) []HopRTT); ok {
+		r0 = rf(ctx, routeID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]HopRTT)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, routing.RouteID) error); ok {
+		r1 = rf(ctx, routeID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
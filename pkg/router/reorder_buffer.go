@@ -0,0 +1,215 @@
+package router
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/routing"
+)
+
+const defaultReorderTimeout = time.Second
+
+// reorderBuffer restores the order of sequenced data packets (and fragments) which may arrive
+// out of order when a route group writes over several routes.
+// Packets are delivered strictly in sequence. Gaps (packets lost on a dead route)
+// are skipped once the buffer is full or the gap persists longer than the timeout.
+// Chunks are delivered without holding the lock, so a slow reader only blocks the pusher
+// which delivers at the moment, others just queue their chunks.
+type reorderBuffer struct {
+	mu         sync.Mutex
+	next       uint32
+	pending    map[uint32]readChunk
+	ready      []readChunk // chunks in order, waiting to be delivered
+	delivering bool        // whether some pusher is delivering ready chunks
+	limit      int
+	timeout    time.Duration
+	timer      *time.Timer
+	deliver    func(readChunk) error
+	closed     bool
+}
+
+func newReorderBuffer(limit int, timeout time.Duration, deliver func(readChunk) error) *reorderBuffer {
+	if limit <= 0 {
+		limit = defaultReadChBufSize
+	}
+
+	if timeout <= 0 {
+		timeout = defaultReorderTimeout
+	}
+
+	return &reorderBuffer{
+		pending: make(map[uint32]readChunk),
+		limit:   limit,
+		timeout: timeout,
+		deliver: deliver,
+	}
+}
+
+// push accepts a chunk with the sequence number `seq` and delivers all chunks
+// which are ready to be delivered in order.
+func (b *reorderBuffer) push(seq uint32, chunk readChunk) error {
+	b.mu.Lock()
+
+	if b.closed {
+		b.mu.Unlock()
+		routing.PutPacket(chunk.packet)
+
+		return nil
+	}
+
+	switch diff := int32(seq - b.next); {
+	case diff < 0:
+		// duplicate or late packet of an already skipped gap
+		b.mu.Unlock()
+		routing.PutPacket(chunk.packet)
+
+		return nil
+	case diff > 0:
+		if dup, ok := b.pending[seq]; ok {
+			routing.PutPacket(dup.packet)
+		}
+
+		b.pending[seq] = chunk
+
+		if len(b.pending) < b.limit {
+			b.armTimer()
+			b.mu.Unlock()
+
+			return nil
+		}
+
+		b.skipGap()
+	default:
+		b.next++
+		b.ready = append(b.ready, chunk)
+	}
+
+	b.drain()
+	b.mu.Unlock()
+
+	return b.flush()
+}
+
+// len returns the number of chunks waiting for missing ones or for delivery.
+func (b *reorderBuffer) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.pending) + len(b.ready)
+}
+
+func (b *reorderBuffer) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	b.pending = make(map[uint32]readChunk)
+	b.ready = nil
+
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+}
+
+// drain moves consecutive pending chunks starting from `next` to the ready ones.
+// NOTE: not thread-safe.
+func (b *reorderBuffer) drain() {
+	for {
+		chunk, ok := b.pending[b.next]
+		if !ok {
+			break
+		}
+
+		delete(b.pending, b.next)
+		b.next++
+
+		b.ready = append(b.ready, chunk)
+	}
+
+	if len(b.pending) == 0 && b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+}
+
+// flush delivers ready chunks unless another pusher is already delivering them.
+func (b *reorderBuffer) flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.delivering {
+		return nil
+	}
+
+	b.delivering = true
+	defer func() { b.delivering = false }()
+
+	for len(b.ready) > 0 && !b.closed {
+		chunk := b.ready[0]
+		b.ready[0] = readChunk{}
+		b.ready = b.ready[1:]
+
+		b.mu.Unlock()
+		err := b.deliver(chunk)
+		b.mu.Lock()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// skipGap moves `next` to the lowest pending sequence number.
+// NOTE: not thread-safe.
+func (b *reorderBuffer) skipGap() {
+	if len(b.pending) == 0 {
+		return
+	}
+
+	first := true
+	var lowest uint32
+
+	for seq := range b.pending {
+		if first || int32(seq-lowest) < 0 {
+			lowest = seq
+			first = false
+		}
+	}
+
+	b.next = lowest
+}
+
+// NOTE: not thread-safe.
+func (b *reorderBuffer) armTimer() {
+	if b.timer != nil {
+		return
+	}
+
+	b.timer = time.AfterFunc(b.timeout, b.onTimeout)
+}
+
+func (b *reorderBuffer) onTimeout() {
+	b.mu.Lock()
+
+	b.timer = nil
+
+	if b.closed || len(b.pending) == 0 {
+		b.mu.Unlock()
+		return
+	}
+
+	b.skipGap()
+	b.drain()
+
+	if len(b.pending) > 0 {
+		b.armTimer()
+	}
+
+	b.mu.Unlock()
+
+	// the error means that the route group is closed
+	_ = b.flush() //nolint:errcheck
+}
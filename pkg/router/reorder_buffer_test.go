@@ -0,0 +1,126 @@
+package router
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReorderBuffer(t *testing.T) {
+	t.Run("in order", func(t *testing.T) {
+		b, delivered := newTestReorderBuffer(10, time.Hour)
+
+		for i := uint32(0); i < 3; i++ {
+			require.NoError(t, b.push(i, readChunk{data: []byte{byte(i)}}))
+		}
+
+		require.Equal(t, [][]byte{{0}, {1}, {2}}, delivered())
+	})
+
+	t.Run("out of order", func(t *testing.T) {
+		b, delivered := newTestReorderBuffer(10, time.Hour)
+
+		require.NoError(t, b.push(2, readChunk{data: []byte{2}}))
+		require.NoError(t, b.push(1, readChunk{data: []byte{1}}))
+		require.Empty(t, delivered())
+
+		require.NoError(t, b.push(0, readChunk{data: []byte{0}}))
+		require.Equal(t, [][]byte{{0}, {1}, {2}}, delivered())
+
+		// duplicates are dropped
+		require.NoError(t, b.push(1, readChunk{data: []byte{1}}))
+		require.Len(t, delivered(), 3)
+	})
+
+	t.Run("gap skipped when full", func(t *testing.T) {
+		b, delivered := newTestReorderBuffer(2, time.Hour)
+
+		require.NoError(t, b.push(1, readChunk{data: []byte{1}}))
+		require.NoError(t, b.push(2, readChunk{data: []byte{2}}))
+		require.Equal(t, [][]byte{{1}, {2}}, delivered())
+
+		// late packet of the skipped gap is dropped
+		require.NoError(t, b.push(0, readChunk{data: []byte{0}}))
+		require.Len(t, delivered(), 2)
+	})
+
+	t.Run("gap skipped on timeout", func(t *testing.T) {
+		b, delivered := newTestReorderBuffer(10, 50*time.Millisecond)
+
+		require.NoError(t, b.push(1, readChunk{data: []byte{1}}))
+
+		require.Eventually(t, func() bool {
+			return len(delivered()) == 1
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("blocked reader", func(t *testing.T) {
+		unblock := make(chan struct{})
+		delivered := make(chan []byte, 3)
+
+		b := newReorderBuffer(10, time.Hour, func(chunk readChunk) error {
+			<-unblock
+			delivered <- chunk.data
+
+			return nil
+		})
+
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- b.push(0, readChunk{data: []byte{0}})
+		}()
+
+		require.Eventually(t, func() bool {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			return b.delivering
+		}, time.Second, 10*time.Millisecond)
+
+		// other pushers are not stalled by the reader
+		require.NoError(t, b.push(2, readChunk{data: []byte{2}}))
+		require.NoError(t, b.push(1, readChunk{data: []byte{1}}))
+		require.Equal(t, 2, b.len())
+
+		close(unblock)
+		require.NoError(t, <-errCh)
+
+		for i := byte(0); i < 3; i++ {
+			require.Equal(t, []byte{i}, <-delivered)
+		}
+	})
+
+	t.Run("sequence wrap", func(t *testing.T) {
+		b, delivered := newTestReorderBuffer(10, time.Hour)
+		b.next = ^uint32(0)
+
+		require.NoError(t, b.push(0, readChunk{data: []byte{1}}))
+		require.NoError(t, b.push(^uint32(0), readChunk{data: []byte{0}}))
+		require.Equal(t, [][]byte{{0}, {1}}, delivered())
+	})
+}
+
+func newTestReorderBuffer(limit int, timeout time.Duration) (*reorderBuffer, func() [][]byte) {
+	var (
+		mu        sync.Mutex
+		delivered [][]byte
+	)
+
+	b := newReorderBuffer(limit, timeout, func(chunk readChunk) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		delivered = append(delivered, chunk.data)
+
+		return nil
+	})
+
+	return b, func() [][]byte {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([][]byte(nil), delivered...)
+	}
+}
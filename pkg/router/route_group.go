@@ -15,6 +15,7 @@ import (
 	"github.com/SkycoinProject/skycoin/src/util/logging"
 
 	"github.com/SkycoinProject/skywire-mainnet/pkg/routing"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/snet"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/transport"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/util/deadline"
 )
@@ -23,6 +24,12 @@ const (
 	defaultRouteGroupKeepAliveInterval = DefaultRouteKeepAlive / 2
 	defaultReadChBufSize               = 1024
 	closeRoutineTimeout                = 2 * time.Second
+
+	// defaultRouteMTU is used for routes of unknown MTU.
+	defaultRouteMTU = snet.DefaultMTU - routing.PacketHeaderSize
+	// maxFragments is the maximum number of fragments of a single message.
+	// Larger writes are split into several messages.
+	maxFragments = 256
 )
 
 var (
@@ -34,8 +41,22 @@ var (
 	ErrBadTransport = errors.New("bad transport")
 	// ErrRuleTransportMismatch is returned when number of forward rules does not equal to number of transports.
 	ErrRuleTransportMismatch = errors.New("rule/transport mismatch")
+	// ErrMTUTooSmall is returned when the MTU of routes is too small to fit any data.
+	ErrMTUTooSmall = errors.New("route MTU is too small")
+
+	errMalformedFragment = errors.New("malformed fragment packet")
 )
 
+// readChunk is a piece of data received by a route group.
+// 'fragments' is the number of fragments of the message the chunk belongs to, it's 0 for unfragmented data.
+// 'packet' is the pooled packet 'data' points into, it's returned to the pool once the chunk is read.
+type readChunk struct {
+	data      []byte
+	fragment  uint16
+	fragments uint16
+	packet    routing.Packet
+}
+
 type timeoutError struct{}
 
 func (timeoutError) Error() string   { return "timeout" }
@@ -46,6 +67,7 @@ func (timeoutError) Temporary() bool { return true }
 type RouteGroupConfig struct {
 	ReadChBufSize     int
 	KeepAliveInterval time.Duration
+	HandshakeTimeout  time.Duration
 }
 
 // DefaultRouteGroupConfig returns default RouteGroup config.
@@ -54,6 +76,7 @@ func DefaultRouteGroupConfig() *RouteGroupConfig {
 	return &RouteGroupConfig{
 		KeepAliveInterval: defaultRouteGroupKeepAliveInterval,
 		ReadChBufSize:     defaultReadChBufSize,
+		HandshakeTimeout:  defaultHandshakeTimeout,
 	}
 }
 
@@ -81,13 +104,51 @@ type RouteGroup struct {
 	fwd []routing.Rule // forward rules (for writing)
 	rvs []routing.Rule // reverse rules (for reading)
 
+	// The following fields are used when the route group has several forward rules:
+	// - writes are spread over the forward rules in round-robin order starting with 'nextPath'.
+	// - every write is sent as a sequenced data packet with the sequence number 'nextSeq'.
+	nextPath int
+	nextSeq  uint32
+
+	// 'failed' holds key route IDs of forward rules whose last write failed.
+	// Router replaces such routes with fresh ones (see router.repairRouteGroups).
+	failed map[routing.RouteID]struct{}
+
+	// 'mtu' holds the largest packet payload of forward routes, keyed by key route IDs of forward rules.
+	// Writes which don't fit into the smallest MTU are fragmented.
+	mtu map[routing.RouteID]uint16
+
+	// 'wmu' serializes writes, so that fragments of a message get consecutive sequence numbers.
+	wmu sync.Mutex
+
 	// 'readCh' reads in incoming packets of this route group.
 	// - Router should serve call '(*transport.Manager).ReadPacket' in a loop,
 	//      and push to the appropriate '(RouteGroup).readCh'.
-	readCh   chan []byte // push reads from Router
+	readCh   chan readChunk // push reads from Router
 	readChMu sync.Mutex
 	readBuf  bytes.Buffer // for read overflow
 
+	// 'fragBuf' accumulates fragments of the message being reassembled, 'nextFragment' is the index
+	// of the fragment expected next. Both are guarded by 'mu'.
+	fragBuf      []byte
+	nextFragment uint16
+
+	// 'crypto' encrypts/decrypts payloads of data packets end-to-end. It's nil if encryption is disabled.
+	crypto *routeGroupCrypto
+	// 'replying' is set while a handshake reply is being written.
+	replying int32
+
+	// 'reorder' restores the order of sequenced data packets before they are pushed to 'readCh'.
+	reorder *reorderBuffer
+
+	// 'fc' limits the number of data packets in flight to what the remote reader is able to consume.
+	// The receive window equals to the size of 'readCh'.
+	fc *flowControl
+
+	// 'probes' holds channels of probes waiting for replies of the remote edge, keyed by probe IDs.
+	probes      map[uint32]chan []routing.ProbeHop
+	nextProbeID uint32
+
 	readDeadline  deadline.PipeDeadline
 	writeDeadline deadline.PipeDeadline
 
@@ -98,7 +159,9 @@ type RouteGroup struct {
 	closed           chan struct{}
 	// used to wait for all the `Close` packets to run through the loop and come back
 	closeDone sync.WaitGroup
-	once      sync.Once
+	// number of `Close` packets still expected by the close initiator
+	pendingCloses int32
+	once          sync.Once
 }
 
 // NewRouteGroup creates a new RouteGroup.
@@ -115,7 +178,10 @@ func NewRouteGroup(cfg *RouteGroupConfig, rt routing.Table, desc routing.RouteDe
 		tps:           make([]*transport.ManagedTransport, 0),
 		fwd:           make([]routing.Rule, 0),
 		rvs:           make([]routing.Rule, 0),
-		readCh:        make(chan []byte, cfg.ReadChBufSize),
+		failed:        make(map[routing.RouteID]struct{}),
+		mtu:           make(map[routing.RouteID]uint16),
+		probes:        make(map[uint32]chan []routing.ProbeHop),
+		readCh:        make(chan readChunk, cfg.ReadChBufSize),
 		readBuf:       bytes.Buffer{},
 		remoteClosed:  make(chan struct{}),
 		closed:        make(chan struct{}),
@@ -123,7 +189,11 @@ func NewRouteGroup(cfg *RouteGroupConfig, rt routing.Table, desc routing.RouteDe
 		writeDeadline: deadline.MakePipeDeadline(),
 	}
 
+	rg.reorder = newReorderBuffer(cfg.ReadChBufSize, defaultReorderTimeout, rg.pushChunk)
+	rg.fc = newFlowControl(cfg.ReadChBufSize, defaultPacketLossTimeout)
+
 	go rg.keepAliveLoop(cfg.KeepAliveInterval)
+	go rg.windowUpdateLoop(defaultWindowUpdateInterval)
 
 	return rg
 }
@@ -147,8 +217,11 @@ func (rg *RouteGroup) Read(p []byte) (n int, err error) {
 	return rg.read(p)
 }
 
-// Write writes payload to a RouteGroup
-// For the first version, only the first ForwardRule (fwd[0]) is used for writing.
+// Write writes payload to a RouteGroup.
+// If the route group has several forward rules, writes are spread over them in round-robin order.
+// Should a write via one route fail, the remaining routes are tried before returning an error.
+// Writes which don't fit into the MTU of the routes are sent as several fragments.
+// Write blocks while the remote's receive window is exhausted.
 func (rg *RouteGroup) Write(p []byte) (n int, err error) {
 	if rg.isClosed() {
 		return 0, io.ErrClosedPipe
@@ -162,22 +235,134 @@ func (rg *RouteGroup) Write(p []byte) (n int, err error) {
 		return 0, nil
 	}
 
-	rg.mu.Lock()
-	tp, err := rg.tp()
-	if err != nil {
-		rg.mu.Unlock()
+	if err := rg.waitHandshake(); err != nil {
 		return 0, err
 	}
 
-	rule, err := rg.rule()
+	rg.wmu.Lock()
+	defer rg.wmu.Unlock()
+
+	mtu := rg.payloadMTU()
+
+	var overhead int
+	if rg.crypto != nil {
+		overhead = cryptoNonceSize + cryptoAuthSize
+	}
+
+	if len(p)+routing.PacketSequenceSize+overhead <= mtu {
+		if err := rg.writeChunk(readChunk{data: p}); err != nil {
+			return 0, err
+		}
+
+		return len(p), nil
+	}
+
+	return rg.writeFragmented(p, mtu-routing.PacketFragmentHeaderSize-overhead)
+}
+
+// writeFragmented writes `p` as fragments of at most `size` bytes.
+// Data which doesn't fit into `maxFragments` fragments is written as several messages.
+func (rg *RouteGroup) writeFragmented(p []byte, size int) (n int, err error) {
+	if size <= 0 {
+		return 0, ErrMTUTooSmall
+	}
+
+	for n < len(p) {
+		msg := p[n:]
+		if len(msg) > size*maxFragments {
+			msg = msg[:size*maxFragments]
+		}
+
+		count := (len(msg) + size - 1) / size
+
+		for i := 0; i < count; i++ {
+			end := (i + 1) * size
+			if end > len(msg) {
+				end = len(msg)
+			}
+
+			chunk := readChunk{data: msg[i*size : end], fragment: uint16(i), fragments: uint16(count)}
+			if err := rg.writeChunk(chunk); err != nil {
+				return n, err
+			}
+		}
+
+		n += len(msg)
+	}
+
+	return n, nil
+}
+
+// writeChunk encrypts and writes a single chunk of data.
+// Fragments are always sequenced, as they are reassembled in order.
+func (rg *RouteGroup) writeChunk(chunk readChunk) (err error) {
+	data := chunk.data
+	if rg.crypto != nil {
+		if data, err = rg.crypto.encrypt(data); err != nil {
+			return err
+		}
+	}
+
+	if err := rg.fc.acquire(rg.writeDeadline.Wait(), rg.closed); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			rg.fc.release()
+		}
+	}()
+
+	rg.mu.Lock()
+	paths, err := rg.paths()
 	if err != nil {
 		rg.mu.Unlock()
-		return 0, err
+		return err
+	}
+
+	sequenced := len(rg.fwd) > 1 || chunk.fragments > 0
+
+	var seq uint32
+	if sequenced {
+		seq = rg.nextSeq
+		rg.nextSeq++
 	}
 	// we don't need to keep holding mutex from this point on
 	rg.mu.Unlock()
 
-	return rg.write(p, tp, rule)
+	for _, path := range paths {
+		var packet routing.Packet
+
+		if chunk.fragments > 0 {
+			packet, err = routing.MakeFragmentPacket(path.rule.NextRouteID(), seq, chunk.fragment, chunk.fragments, data)
+		} else {
+			packet, err = makeRouteGroupDataPacket(path.rule, sequenced, seq, data)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		err = rg.write(packet, path.tp, path.rule)
+		if err == nil {
+			rg.setPathFailed(path.rule.KeyRouteID(), false)
+			return nil
+		}
+
+		if _, ok := err.(timeoutError); ok {
+			return err
+		}
+
+		rg.setPathFailed(path.rule.KeyRouteID(), true)
+
+		if len(paths) == 1 {
+			return err
+		}
+
+		rg.logger.WithError(err).Warnf("Failed to write via transport %s, trying the next route", path.tp.Entry.ID)
+	}
+
+	return err
 }
 
 // Close closes a RouteGroup.
@@ -233,7 +418,7 @@ func (rg *RouteGroup) SetWriteDeadline(t time.Time) error {
 }
 
 // read reads incoming data. It tries to fetch the data from the internal buffer.
-// If buffer is empty it blocks on receiving from the data channel
+// If buffer is empty it blocks on receiving from the data channel until a complete message is received.
 func (rg *RouteGroup) read(p []byte) (int, error) {
 	// first try the buffer for any already received data
 	rg.mu.Lock()
@@ -245,32 +430,88 @@ func (rg *RouteGroup) read(p []byte) (int, error) {
 	}
 	rg.mu.Unlock()
 
-	select {
-	case <-rg.readDeadline.Wait():
-		return 0, timeoutError{}
-	case <-rg.closed:
-		return 0, io.ErrClosedPipe
-	case data, ok := <-rg.readCh:
-		if !ok || len(data) == 0 {
-			// route group got closed or empty data received. Behavior on the empty
-			// data is equivalent to the behavior of `read()` unix syscall as described here:
-			// https://www.ibm.com/support/knowledgecenter/en/SSLTBW_2.4.0/com.ibm.zos.v2r4.bpxbd00/rtrea.htm
-			return 0, io.EOF
+	for {
+		select {
+		case <-rg.readDeadline.Wait():
+			return 0, timeoutError{}
+		case <-rg.closed:
+			return 0, io.ErrClosedPipe
+		case chunk, ok := <-rg.readCh:
+			if !ok || (chunk.fragments == 0 && len(chunk.data) == 0) {
+				routing.PutPacket(chunk.packet)
+
+				// route group got closed or empty data received. Behavior on the empty
+				// data is equivalent to the behavior of `read()` unix syscall as described here:
+				// https://www.ibm.com/support/knowledgecenter/en/SSLTBW_2.4.0/com.ibm.zos.v2r4.bpxbd00/rtrea.htm
+				return 0, io.EOF
+			}
+
+			rg.updateWindow(false)
+
+			data, ok := rg.reassemble(chunk)
+			if !ok {
+				routing.PutPacket(chunk.packet)
+				continue
+			}
+
+			// the data is copied, so the packet can be reused right away
+			rg.mu.Lock()
+			n, err := ioutil.BufRead(&rg.readBuf, data, p)
+			rg.mu.Unlock()
+
+			routing.PutPacket(chunk.packet)
+
+			return n, err
 		}
+	}
+}
+
+// reassemble adds `chunk` to the message being reassembled. It returns the message once it's complete.
+// Incomplete messages (with fragments lost on the way) are dropped.
+func (rg *RouteGroup) reassemble(chunk readChunk) ([]byte, bool) {
+	if chunk.fragments == 0 {
+		return chunk.data, true
+	}
+
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+
+	if chunk.fragment == 0 {
+		rg.fragBuf = rg.fragBuf[:0]
+		rg.nextFragment = 0
+	}
 
-		rg.mu.Lock()
-		defer rg.mu.Unlock()
+	if chunk.fragment != rg.nextFragment {
+		// fragment of an incomplete message
+		rg.fragBuf = rg.fragBuf[:0]
+		rg.nextFragment = 0
 
-		return ioutil.BufRead(&rg.readBuf, data, p)
+		return nil, false
 	}
+
+	rg.fragBuf = append(rg.fragBuf, chunk.data...)
+	rg.nextFragment++
+
+	if rg.nextFragment < chunk.fragments {
+		return nil, false
+	}
+
+	data := rg.fragBuf
+	rg.fragBuf = nil
+	rg.nextFragment = 0
+
+	return data, true
 }
 
-func (rg *RouteGroup) write(data []byte, tp *transport.ManagedTransport, rule routing.Rule) (int, error) {
-	packet, err := routing.MakeDataPacket(rule.NextRouteID(), data)
-	if err != nil {
-		return 0, err
+func makeRouteGroupDataPacket(rule routing.Rule, sequenced bool, seq uint32, data []byte) (routing.Packet, error) {
+	if sequenced {
+		return routing.MakeSequencedDataPacket(rule.NextRouteID(), seq, data)
 	}
 
+	return routing.MakeDataPacket(rule.NextRouteID(), data)
+}
+
+func (rg *RouteGroup) write(packet routing.Packet, tp *transport.ManagedTransport, rule routing.Rule) error {
 	rg.logger.Debugf("Writing packet of type %s, route ID %d and next ID %d", packet.Type(),
 		rule.KeyRouteID(), rule.NextRouteID())
 
@@ -281,15 +522,15 @@ func (rg *RouteGroup) write(data []byte, tp *transport.ManagedTransport, rule ro
 
 	select {
 	case <-rg.writeDeadline.Wait():
-		return 0, timeoutError{}
+		return timeoutError{}
 	case err := <-errCh:
 		if err != nil {
-			return 0, err
+			return err
 		}
 
 		atomic.StoreInt64(&rg.lastSent, time.Now().UnixNano())
 
-		return len(data), nil
+		return nil
 	}
 }
 
@@ -312,7 +553,8 @@ func (rg *RouteGroup) writePacketAsync(ctx context.Context, tp *transport.Manage
 
 func (rg *RouteGroup) writePacket(ctx context.Context, tp *transport.ManagedTransport, packet routing.Packet,
 	ruleID routing.RouteID) error {
-	err := tp.WritePacket(ctx, packet)
+	// The write is waited for, so that a failed one is reported and the packet may be resent via another path.
+	err := tp.WritePacketSync(ctx, packet)
 	// note equality here. update activity only if there was NO error
 	if err == nil {
 		if err := rg.rt.UpdateActivity(ruleID); err != nil {
@@ -323,32 +565,310 @@ func (rg *RouteGroup) writePacket(ctx context.Context, tp *transport.ManagedTran
 	return err
 }
 
-// rule fetches first available forward rule.
+// routeGroupPath is a forward rule paired with the transport it writes to.
+type routeGroupPath struct {
+	tp   *transport.ManagedTransport
+	rule routing.Rule
+}
+
+// paths returns available forward paths in the order they should be tried for the next write.
+// Paths are rotated in round-robin order, paths with transports which are down are moved to the end.
 // NOTE: not thread-safe.
-func (rg *RouteGroup) rule() (routing.Rule, error) {
+func (rg *RouteGroup) paths() ([]routeGroupPath, error) {
+	if len(rg.tps) == 0 {
+		return nil, ErrNoTransports
+	}
+
 	if len(rg.fwd) == 0 {
 		return nil, ErrNoRules
 	}
 
-	rule := rg.fwd[0]
+	if len(rg.fwd) != len(rg.tps) {
+		return nil, ErrRuleTransportMismatch
+	}
+
+	count := len(rg.fwd)
+	start := rg.nextPath % count
+	rg.nextPath = (start + 1) % count
 
-	return rule, nil
+	up := make([]routeGroupPath, 0, count)
+	var down []routeGroupPath
+
+	for i := 0; i < count; i++ {
+		idx := (start + i) % count
+
+		tp := rg.tps[idx]
+		if tp == nil {
+			continue
+		}
+
+		path := routeGroupPath{tp: tp, rule: rg.fwd[idx]}
+
+		if count > 1 && !tp.IsUp() {
+			down = append(down, path)
+			continue
+		}
+
+		up = append(up, path)
+	}
+
+	paths := append(up, down...)
+	if len(paths) == 0 {
+		return nil, ErrBadTransport
+	}
+
+	return paths, nil
+}
+
+// addRules adds a forward rule with its transport and a reverse rule to the route group.
+// `mtu` is the MTU of the forward route, 0 if unknown.
+func (rg *RouteGroup) addRules(tp *transport.ManagedTransport, fwd, rvs routing.Rule, mtu uint16) {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+
+	rg.fwd = append(rg.fwd, fwd)
+	rg.rvs = append(rg.rvs, rvs)
+	rg.tps = append(rg.tps, tp)
+	rg.setMTU(fwd, mtu)
+}
+
+// replacePath atomically replaces the forward rule with the key route ID `oldID` (and its transport)
+// with `fwd`/`tp` and adds the reverse rule `rvs`. It returns false if there is no such forward rule.
+func (rg *RouteGroup) replacePath(oldID routing.RouteID, tp *transport.ManagedTransport, fwd, rvs routing.Rule,
+	mtu uint16) bool {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+
+	for i, rule := range rg.fwd {
+		if rule.KeyRouteID() != oldID || i >= len(rg.tps) {
+			continue
+		}
+
+		rg.fwd[i] = fwd
+		rg.tps[i] = tp
+		rg.rvs = append(rg.rvs, rvs)
+		delete(rg.failed, oldID)
+		delete(rg.mtu, oldID)
+		rg.setMTU(fwd, mtu)
+
+		return true
+	}
+
+	return false
 }
 
-// tp fetches first available transport.
+// setMTU sets the MTU of the forward route of `fwd`.
 // NOTE: not thread-safe.
-func (rg *RouteGroup) tp() (*transport.ManagedTransport, error) {
-	if len(rg.tps) == 0 {
-		return nil, ErrNoTransports
+func (rg *RouteGroup) setMTU(fwd routing.Rule, mtu uint16) {
+	if fwd == nil || mtu == 0 {
+		return
 	}
 
-	tp := rg.tps[0]
+	rg.mtu[fwd.KeyRouteID()] = mtu
+}
 
-	if tp == nil {
-		return nil, ErrBadTransport
+// payloadMTU returns the largest packet payload which fits into all forward routes.
+func (rg *RouteGroup) payloadMTU() int {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+
+	mtu := 0
+
+	for _, rule := range rg.fwd {
+		routeMTU := defaultRouteMTU
+		if v, ok := rg.mtu[rule.KeyRouteID()]; ok {
+			routeMTU = int(v)
+		}
+
+		if mtu == 0 || routeMTU < mtu {
+			mtu = routeMTU
+		}
 	}
 
-	return tp, nil
+	if mtu == 0 {
+		return defaultRouteMTU
+	}
+
+	return mtu
+}
+
+// brokenPaths returns forward rules which can't be used for writing: their transports
+// are missing or down, or the last write via them failed.
+func (rg *RouteGroup) brokenPaths() []routing.Rule {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+
+	var broken []routing.Rule
+
+	for i, rule := range rg.fwd {
+		if i >= len(rg.tps) {
+			break
+		}
+
+		_, failed := rg.failed[rule.KeyRouteID()]
+
+		if tp := rg.tps[i]; failed || tp == nil || !tp.IsUp() {
+			broken = append(broken, rule)
+		}
+	}
+
+	return broken
+}
+
+func (rg *RouteGroup) setPathFailed(id routing.RouteID, failed bool) {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+
+	if failed {
+		rg.failed[id] = struct{}{}
+	} else {
+		delete(rg.failed, id)
+	}
+}
+
+// removeReverseRule removes the reverse rule with the key route ID `id`
+// and returns the number of reverse rules left.
+func (rg *RouteGroup) removeReverseRule(id routing.RouteID) int {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+
+	for i, rule := range rg.rvs {
+		if rule.KeyRouteID() == id {
+			rg.rvs = append(rg.rvs[:i], rg.rvs[i+1:]...)
+			break
+		}
+	}
+
+	return len(rg.rvs)
+}
+
+// startHandshake enables end-to-end encryption of the route group with `crypto`
+// and starts the handshake with the remote edge.
+// NOTE: should be called before the route group is used.
+func (rg *RouteGroup) startHandshake(crypto *routeGroupCrypto) {
+	rg.crypto = crypto
+
+	timeout := rg.cfg.HandshakeTimeout
+	if timeout <= 0 {
+		timeout = defaultHandshakeTimeout
+	}
+
+	go rg.handshakeLoop(timeout)
+}
+
+// handshakeLoop drives the end-to-end handshake. The initiator (re)sends its handshake
+// message until the remote replies, as the remote may not be ready to handle it yet.
+// The responder just waits for the initiator's message. Both fail after `timeout`.
+// The route group is closed if the handshake fails, as it can't be used anymore.
+func (rg *RouteGroup) handshakeLoop(timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	ticker := time.NewTicker(handshakeRetryInterval)
+	defer ticker.Stop()
+
+	defer func() {
+		err := rg.crypto.failure()
+		if err == nil || err == io.ErrClosedPipe {
+			return
+		}
+
+		rg.logger.WithError(err).Warn("Handshake failed, closing route group")
+
+		if err := rg.Close(); err != nil && err != io.ErrClosedPipe {
+			rg.logger.WithError(err).Warn("Failed to close route group")
+		}
+	}()
+
+	for {
+		msg, err := rg.crypto.handshakeMessage()
+		if err != nil {
+			rg.logger.WithError(err).Error("Failed to make handshake message")
+			rg.crypto.fail(err)
+
+			return
+		}
+
+		if msg != nil {
+			if err := rg.writeHandshake(msg); err != nil {
+				rg.logger.WithError(err).Debug("Failed to send handshake message, retrying")
+			}
+		}
+
+		select {
+		case <-rg.crypto.wait():
+			return
+		case <-rg.remoteClosed:
+			rg.crypto.fail(io.ErrClosedPipe)
+			return
+		case <-rg.closed:
+			rg.crypto.fail(io.ErrClosedPipe)
+			return
+		case <-timer.C:
+			rg.crypto.fail(ErrHandshakeTimeout)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitHandshake blocks until the end-to-end handshake is over.
+func (rg *RouteGroup) waitHandshake() error {
+	if rg.crypto == nil {
+		return nil
+	}
+
+	select {
+	case <-rg.crypto.wait():
+		return rg.crypto.failure()
+	case <-rg.writeDeadline.Wait():
+		return timeoutError{}
+	case <-rg.closed:
+		return io.ErrClosedPipe
+	}
+}
+
+// writeHandshake sends a handshake message as a plain data packet via the next available route.
+func (rg *RouteGroup) writeHandshake(msg []byte) error {
+	return rg.writeNext(func(id routing.RouteID) (routing.Packet, error) {
+		return routing.MakeDataPacket(id, msg)
+	})
+}
+
+// replyHandshake writes the handshake reply `msg` asynchronously, so that the router's read loop
+// is not blocked by the write. Replies are skipped while the previous one is being written,
+// the remote retries the handshake until it gets one.
+func (rg *RouteGroup) replyHandshake(msg []byte) {
+	if !atomic.CompareAndSwapInt32(&rg.replying, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&rg.replying, 0)
+
+		if err := rg.writeHandshake(msg); err != nil {
+			rg.logger.WithError(err).Debug("Failed to send handshake reply")
+		}
+	}()
+}
+
+// writeNext writes a packet made by `makePacket` via the next available route.
+// `makePacket` is given the route ID of the next hop. Write deadline is not applied.
+func (rg *RouteGroup) writeNext(makePacket func(id routing.RouteID) (routing.Packet, error)) error {
+	rg.mu.Lock()
+	paths, err := rg.paths()
+	rg.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	packet, err := makePacket(paths[0].rule.NextRouteID())
+	if err != nil {
+		return err
+	}
+
+	return rg.writePacket(context.Background(), paths[0].tp, packet, paths[0].rule.KeyRouteID())
 }
 
 func (rg *RouteGroup) keepAliveLoop(interval time.Duration) {
@@ -418,7 +938,15 @@ func (rg *RouteGroup) close(code routing.CloseCode) error {
 
 	if closeInitiator {
 		// will wait for close response from all the transports
-		rg.closeDone.Add(len(rg.tps))
+		tps := 0
+		for _, tp := range rg.tps {
+			if tp != nil {
+				tps++
+			}
+		}
+
+		atomic.StoreInt32(&rg.pendingCloses, int32(tps))
+		rg.closeDone.Add(tps)
 	}
 
 	rg.broadcastClosePackets(code)
@@ -440,6 +968,8 @@ func (rg *RouteGroup) close(code routing.CloseCode) error {
 	rg.rt.DelRules(rules)
 
 	rg.once.Do(func() {
+		rg.reorder.close()
+
 		if closeInitiator {
 			close(rg.closed)
 		}
@@ -454,22 +984,178 @@ func (rg *RouteGroup) close(code routing.CloseCode) error {
 	return nil
 }
 
+// handlePacket handles a packet read by the router. Buffers of data packets are returned to
+// the packet pool once the data is read or dropped, buffers of other packets once handled.
+// Close packets are owned by the router, which returns them to the pool itself.
 func (rg *RouteGroup) handlePacket(packet routing.Packet) error {
 	switch packet.Type() {
 	case routing.ClosePacket:
 		return rg.handleClosePacket(routing.CloseCode(packet.Payload()[0]))
 	case routing.DataPacket:
 		return rg.handleDataPacket(packet)
+	case routing.SequencedDataPacket:
+		return rg.handleSequencedDataPacket(packet)
+	case routing.FragmentPacket:
+		return rg.handleFragmentPacket(packet)
+	case routing.WindowUpdatePacket:
+		defer routing.PutPacket(packet)
+		return rg.handleWindowUpdatePacket(packet)
+	case routing.ProbePacket:
+		defer routing.PutPacket(packet)
+		return rg.handleProbePacket(packet)
 	}
 
+	routing.PutPacket(packet)
+
 	return nil
 }
 
 func (rg *RouteGroup) handleDataPacket(packet routing.Packet) error {
+	if rg.crypto == nil {
+		return rg.handleData(readChunk{data: packet.Payload(), packet: packet})
+	}
+
+	// the payload is decrypted into a new buffer
+	defer routing.PutPacket(packet)
+
+	// handshake messages are sent as plain data packets
+	data, reply, err := rg.crypto.open(packet.Payload())
+	if err != nil {
+		return err
+	}
+
+	if reply != nil {
+		rg.replyHandshake(reply)
+		return nil
+	}
+
+	if data == nil {
+		return nil
+	}
+
+	return rg.handleData(readChunk{data: data})
+}
+
+func (rg *RouteGroup) handleData(chunk readChunk) error {
+	rg.fc.onReceive()
+
+	if err := rg.pushChunk(chunk); err != nil {
+		return err
+	}
+
+	rg.updateWindow(false)
+
+	return nil
+}
+
+func (rg *RouteGroup) handleSequencedDataPacket(packet routing.Packet) error {
+	if len(packet.Payload()) < routing.PacketSequenceSize {
+		routing.PutPacket(packet)
+		return errors.New("malformed sequenced data packet")
+	}
+
+	return rg.handleSequenced(packet.Sequence(), readChunk{data: packet.SequencedPayload(), packet: packet})
+}
+
+func (rg *RouteGroup) handleFragmentPacket(packet routing.Packet) error {
+	if len(packet.Payload()) < routing.PacketFragmentHeaderSize {
+		routing.PutPacket(packet)
+		return errMalformedFragment
+	}
+
+	index, count := packet.Fragment()
+	if count == 0 || count > maxFragments || index >= count {
+		routing.PutPacket(packet)
+		return errMalformedFragment
+	}
+
+	return rg.handleSequenced(packet.Sequence(), readChunk{
+		data:      packet.FragmentPayload(),
+		fragment:  index,
+		fragments: count,
+		packet:    packet,
+	})
+}
+
+// handleSequenced decrypts a sequenced chunk and passes it through the reorder buffer.
+func (rg *RouteGroup) handleSequenced(seq uint32, chunk readChunk) error {
+	if rg.crypto != nil {
+		// the data is decrypted into a new buffer
+		data, err := rg.crypto.decrypt(chunk.data)
+		routing.PutPacket(chunk.packet)
+
+		if err != nil {
+			return err
+		}
+
+		chunk.data, chunk.packet = data, nil
+	}
+
+	rg.fc.onReceive()
+
+	if err := rg.reorder.push(seq, chunk); err != nil {
+		return err
+	}
+
+	rg.updateWindow(false)
+
+	return nil
+}
+
+func (rg *RouteGroup) handleWindowUpdatePacket(packet routing.Packet) error {
+	if len(packet.Payload()) < routing.PacketWindowUpdateSize {
+		return errors.New("malformed window update packet")
+	}
+
+	rg.fc.update(packet.WindowUpdate())
+
+	return nil
+}
+
+// updateWindow advertises the receive window to the remote if it moved far enough or got closed.
+// If `force` is set, the window is advertised unless the remote knows it already.
+func (rg *RouteGroup) updateWindow(force bool) {
+	queued := len(rg.readCh) + rg.reorder.len()
+
+	received, limit, ok := rg.fc.windowUpdate(queued, force)
+	if !ok {
+		return
+	}
+
+	go func() {
+		err := rg.writeNext(func(id routing.RouteID) (routing.Packet, error) {
+			return routing.MakeWindowUpdatePacket(id, received, limit), nil
+		})
+		if err != nil {
+			rg.logger.WithError(err).Debug("Failed to send window update")
+		}
+	}()
+}
+
+// windowUpdateLoop periodically advertises the receive window, so that the remote keeps waiting
+// for a slow reader instead of considering its packets lost.
+func (rg *RouteGroup) windowUpdateLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rg.closed:
+			return
+		case <-rg.remoteClosed:
+			return
+		case <-ticker.C:
+			rg.updateWindow(true)
+		}
+	}
+}
+
+func (rg *RouteGroup) pushChunk(chunk readChunk) error {
 	select {
 	case <-rg.closed:
+		routing.PutPacket(chunk.packet)
 		return io.ErrClosedPipe
-	case rg.readCh <- packet.Payload():
+	case rg.readCh <- chunk:
 	}
 
 	return nil
@@ -482,7 +1168,17 @@ func (rg *RouteGroup) handleClosePacket(code routing.CloseCode) error {
 		// this route group initiated close loop and got response
 		rg.logger.Debugf("Handling response close packet with code %d", code)
 
-		rg.closeDone.Done()
+		// after a route repair the remote may have more routes than this group,
+		// extra responses are ignored
+		if atomic.AddInt32(&rg.pendingCloses, -1) >= 0 {
+			rg.closeDone.Done()
+		}
+
+		return nil
+	}
+
+	if rg.isRemoteClosed() {
+		// close packets arrive via every route of the group, only the first one closes it
 		return nil
 	}
 
@@ -492,6 +1188,10 @@ func (rg *RouteGroup) handleClosePacket(code routing.CloseCode) error {
 
 func (rg *RouteGroup) broadcastClosePackets(code routing.CloseCode) {
 	for i := 0; i < len(rg.tps); i++ {
+		if rg.tps[i] == nil {
+			continue
+		}
+
 		packet := routing.MakeClosePacket(rg.fwd[i].NextRouteID(), code)
 		if err := rg.writePacket(context.Background(), rg.tps[i], packet, rg.fwd[i].KeyRouteID()); err != nil {
 			rg.logger.WithError(err).Errorf("Failed to send close packet to %s", rg.tps[i].Remote())
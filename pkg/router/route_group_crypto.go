@@ -0,0 +1,291 @@
+package router
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/noise"
+)
+
+const (
+	defaultHandshakeTimeout = 10 * time.Second
+	handshakeRetryInterval  = 500 * time.Millisecond
+
+	cryptoNonceSize  = 8  // nonce prefixing every encrypted payload
+	cryptoAuthSize   = 16 // AEAD tag appended to every encrypted payload
+	replayWindowSize = 1024
+
+	// both KK handshake messages consist of an ephemeral public key and an empty encrypted payload
+	handshakeMessageSize = len(cipher.PubKey{}) + cryptoAuthSize
+)
+
+var (
+	// ErrHandshakeTimeout is returned when the end-to-end handshake of a route group is not completed in time.
+	ErrHandshakeTimeout = errors.New("route group handshake timed out")
+
+	errHandshakeNotFinished = errors.New("route group handshake is not finished")
+	errMalformedHandshake   = errors.New("malformed handshake message")
+	errMalformedCiphertext  = errors.New("malformed encrypted payload")
+	errReplayedPacket       = errors.New("replayed or too old encrypted payload")
+)
+
+// routeGroupCrypto holds the end-to-end encryption state of a route group.
+// Edges of a route group perform a Noise KK handshake (both edges know each other's static
+// public keys from the route descriptor) and then encrypt payloads of all data packets.
+// Handshake messages are sent as payloads of plain data packets, so intermediary visors
+// don't need to be aware of the encryption.
+// As route groups may spread packets over several routes, every encrypted payload carries
+// its nonce and replays are detected with a sliding window rather than a strict nonce order.
+type routeGroupCrypto struct {
+	mu        sync.Mutex
+	ns        *noise.Noise
+	initiator bool
+	sent      []byte // last handshake message sent to the remote, re-sent on retries
+	received  []byte // handshake message received from the remote, used to detect duplicates
+	window    replayWindow
+	err       error
+	done      chan struct{} // closed once the handshake is finished or failed
+}
+
+func newRouteGroupCrypto(localPK cipher.PubKey, localSK cipher.SecKey, remotePK cipher.PubKey,
+	initiator bool) (*routeGroupCrypto, error) {
+	// the underlying DH implementation panics on invalid public keys
+	if _, err := cipher.NewPubKey(remotePK[:]); err != nil {
+		return nil, fmt.Errorf("invalid remote public key: %v", err)
+	}
+
+	ns, err := noise.KKAndSecp256k1(noise.Config{
+		LocalPK:   localPK,
+		LocalSK:   localSK,
+		RemotePK:  remotePK,
+		Initiator: initiator,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &routeGroupCrypto{
+		ns:        ns,
+		initiator: initiator,
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// handshakeMessage returns the handshake message the initiator should (re)send to the remote.
+// It returns nil for the responder and once the handshake is over.
+func (c *routeGroupCrypto) handshakeMessage() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.initiator || chanClosed(c.done) {
+		return nil, nil
+	}
+
+	if c.sent == nil {
+		msg, err := c.ns.MakeHandshakeMessage()
+		if err != nil {
+			return nil, err
+		}
+
+		c.sent = msg
+	}
+
+	return c.sent, nil
+}
+
+// open processes the payload of an incoming data packet.
+// Until the handshake is finished, payloads are handshake messages. If the remote should be
+// answered with a handshake message, it is returned as `reply`. Otherwise, decrypted data is returned.
+func (c *routeGroupCrypto) open(payload []byte) (data, reply []byte, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !chanClosed(c.done) {
+		if err := c.processHandshakeMessage(payload); err != nil {
+			return nil, nil, err
+		}
+
+		c.received = append([]byte(nil), payload...)
+
+		if !c.initiator {
+			if c.sent, err = c.ns.MakeHandshakeMessage(); err != nil {
+				return nil, nil, err
+			}
+
+			reply = c.sent
+		}
+
+		close(c.done)
+
+		return nil, reply, nil
+	}
+
+	if c.err != nil {
+		return nil, nil, c.err
+	}
+
+	if bytes.Equal(payload, c.received) {
+		// the remote did not get our handshake message and retries
+		if !c.initiator {
+			reply = c.sent
+		}
+
+		return nil, reply, nil
+	}
+
+	data, err = c.decryptUnsafe(payload)
+
+	return data, nil, err
+}
+
+// processHandshakeMessage processes a handshake message received from the remote.
+// The underlying DH implementation panics on invalid public keys, so the ephemeral key
+// is validated first. Otherwise, anyone on the route could crash the visor with a forged message.
+// NOTE: not thread-safe.
+func (c *routeGroupCrypto) processHandshakeMessage(msg []byte) error {
+	if len(msg) != handshakeMessageSize {
+		return errMalformedHandshake
+	}
+
+	if _, err := cipher.NewPubKey(msg[:len(cipher.PubKey{})]); err != nil {
+		return fmt.Errorf("%w: %v", errMalformedHandshake, err)
+	}
+
+	return c.ns.ProcessHandshakeMessage(msg)
+}
+
+// decrypt decrypts the payload of an incoming data packet.
+func (c *routeGroupCrypto) decrypt(payload []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !chanClosed(c.done) {
+		return nil, errHandshakeNotFinished
+	}
+
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	return c.decryptUnsafe(payload)
+}
+
+// NOTE: not thread-safe.
+func (c *routeGroupCrypto) decryptUnsafe(payload []byte) ([]byte, error) {
+	if len(payload) < cryptoNonceSize+cryptoAuthSize {
+		return nil, errMalformedCiphertext
+	}
+
+	nonce := binary.BigEndian.Uint64(payload[:cryptoNonceSize])
+	if !c.window.accepts(nonce) {
+		return nil, errReplayedPacket
+	}
+
+	// nonces are tracked by the replay window, so no nonce map is needed
+	data, err := c.ns.DecryptWithNonceMap(nil, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	c.window.mark(nonce)
+
+	return data, nil
+}
+
+// encrypt encrypts the payload of an outgoing data packet.
+func (c *routeGroupCrypto) encrypt(data []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !chanClosed(c.done) {
+		return nil, errHandshakeNotFinished
+	}
+
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	return c.ns.EncryptUnsafe(data), nil
+}
+
+// fail aborts the handshake with `err` unless it is already over.
+func (c *routeGroupCrypto) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if chanClosed(c.done) {
+		return
+	}
+
+	c.err = err
+	close(c.done)
+}
+
+// wait returns a channel which is closed once the handshake is finished or failed.
+func (c *routeGroupCrypto) wait() <-chan struct{} {
+	return c.done
+}
+
+// failure returns the error the handshake failed with.
+func (c *routeGroupCrypto) failure() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+// replayWindow keeps track of the received nonces within the last `replayWindowSize` nonces.
+type replayWindow struct {
+	max  uint64
+	bits [replayWindowSize / 64]uint64
+}
+
+// accepts checks whether the nonce `n` was not received yet and is not too old.
+func (w *replayWindow) accepts(n uint64) bool {
+	if n == 0 {
+		// nonces start from 1
+		return false
+	}
+
+	if n > w.max {
+		return true
+	}
+
+	if w.max-n >= replayWindowSize {
+		return false
+	}
+
+	word, bit := w.position(n)
+
+	return w.bits[word]&bit == 0
+}
+
+// mark marks the nonce `n` as received, moving the window if needed.
+func (w *replayWindow) mark(n uint64) {
+	if n > w.max {
+		if n-w.max >= replayWindowSize {
+			w.bits = [replayWindowSize / 64]uint64{}
+		} else {
+			for i := w.max + 1; i < n; i++ {
+				word, bit := w.position(i)
+				w.bits[word] &^= bit
+			}
+		}
+
+		w.max = n
+	}
+
+	word, bit := w.position(n)
+	w.bits[word] |= bit
+}
+
+func (w *replayWindow) position(n uint64) (word int, bit uint64) {
+	idx := n % replayWindowSize
+
+	return int(idx / 64), 1 << (idx % 64)
+}
@@ -0,0 +1,141 @@
+package router
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/snettest"
+)
+
+func TestRouteGroupCrypto(t *testing.T) {
+	keys := snettest.GenKeyPairs(2)
+
+	initiator, err := newRouteGroupCrypto(keys[0].PK, keys[0].SK, keys[1].PK, true)
+	require.NoError(t, err)
+
+	responder, err := newRouteGroupCrypto(keys[1].PK, keys[1].SK, keys[0].PK, false)
+	require.NoError(t, err)
+
+	_, err = initiator.encrypt([]byte("hello"))
+	require.Equal(t, errHandshakeNotFinished, err)
+
+	msg1, err := initiator.handshakeMessage()
+	require.NoError(t, err)
+	require.NotNil(t, msg1)
+
+	// garbage must not break the handshake
+	_, _, err = responder.open([]byte("garbage"))
+	require.Error(t, err)
+
+	// neither must a message with an invalid ephemeral key
+	forged := make([]byte, len(msg1))
+	forged[0] = 0x02
+	_, _, err = responder.open(forged)
+	require.True(t, errors.Is(err, errMalformedHandshake))
+
+	data, msg2, err := responder.open(msg1)
+	require.NoError(t, err)
+	require.Nil(t, data)
+	require.NotNil(t, msg2)
+	require.NoError(t, responder.failure())
+
+	// retried handshake message is answered again
+	_, reply, err := responder.open(msg1)
+	require.NoError(t, err)
+	require.Equal(t, msg2, reply)
+
+	data, reply, err = initiator.open(msg2)
+	require.NoError(t, err)
+	require.Nil(t, data)
+	require.Nil(t, reply)
+
+	msg, err := initiator.handshakeMessage()
+	require.NoError(t, err)
+	require.Nil(t, msg)
+
+	ciphertexts := make([][]byte, 3)
+	for i := range ciphertexts {
+		ciphertexts[i], err = initiator.encrypt([]byte("hello"))
+		require.NoError(t, err)
+		assert.NotContains(t, string(ciphertexts[i]), "hello")
+	}
+
+	// payloads may arrive out of order
+	for _, i := range []int{2, 0, 1} {
+		data, _, err = responder.open(ciphertexts[i])
+		require.NoError(t, err)
+		require.Equal(t, []byte("hello"), data)
+	}
+
+	_, err = responder.decrypt(ciphertexts[0])
+	require.Equal(t, errReplayedPacket, err)
+
+	tampered := append([]byte(nil), ciphertexts[2]...)
+	tampered[len(tampered)-1] ^= 0xFF
+	tampered[0] ^= 0xFF // fresh nonce
+	_, err = responder.decrypt(tampered)
+	require.Error(t, err)
+
+	ciphertext, err := responder.encrypt([]byte("world"))
+	require.NoError(t, err)
+
+	data, err = initiator.decrypt(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, []byte("world"), data)
+}
+
+func TestRouteGroupCrypto_WrongKey(t *testing.T) {
+	keys := snettest.GenKeyPairs(3)
+
+	initiator, err := newRouteGroupCrypto(keys[0].PK, keys[0].SK, keys[1].PK, true)
+	require.NoError(t, err)
+
+	// responder expects another initiator
+	responder, err := newRouteGroupCrypto(keys[1].PK, keys[1].SK, keys[2].PK, false)
+	require.NoError(t, err)
+
+	msg1, err := initiator.handshakeMessage()
+	require.NoError(t, err)
+
+	_, _, err = responder.open(msg1)
+	require.Error(t, err)
+}
+
+func TestRouteGroupCrypto_InvalidRemoteKey(t *testing.T) {
+	keys := snettest.GenKeyPairs(1)
+
+	_, err := newRouteGroupCrypto(keys[0].PK, keys[0].SK, cipher.PubKey{}, true)
+	require.Error(t, err)
+}
+
+func TestReplayWindow(t *testing.T) {
+	var w replayWindow
+
+	require.False(t, w.accepts(0))
+
+	for _, n := range []uint64{1, 3, 2, 5} {
+		require.True(t, w.accepts(n))
+		w.mark(n)
+		require.False(t, w.accepts(n))
+	}
+
+	require.True(t, w.accepts(4))
+
+	w.mark(5 + replayWindowSize)
+	require.False(t, w.accepts(4))
+	require.False(t, w.accepts(5))
+	require.True(t, w.accepts(6))
+	require.True(t, w.accepts(4+replayWindowSize))
+
+	w.mark(6 + replayWindowSize)
+	require.False(t, w.accepts(6))
+	require.True(t, w.accepts(7))
+
+	w.mark(10 * replayWindowSize)
+	require.False(t, w.accepts(10*replayWindowSize))
+	require.True(t, w.accepts(10*replayWindowSize-1))
+}
@@ -1,20 +1,27 @@
 package router
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/SkycoinProject/dmsg"
 	"github.com/SkycoinProject/dmsg/cipher"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/SkycoinProject/skywire-mainnet/pkg/routing"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/snet"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/snettest"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/stcp"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/transport"
@@ -81,9 +88,9 @@ func TestRouteGroup_Read(t *testing.T) {
 	buf3 := make([]byte, len(msg2)/2)
 	buf4 := make([]byte, len(msg2)/2)
 
-	rg1.readCh <- msg1
-	rg2.readCh <- msg2
-	rg2.readCh <- msg3
+	rg1.readCh <- readChunk{data: msg1}
+	rg2.readCh <- readChunk{data: msg2}
+	rg2.readCh <- readChunk{data: msg3}
 
 	n, err := rg1.Read([]byte{})
 	require.Equal(t, 0, n)
@@ -126,6 +133,627 @@ func TestRouteGroup_Write(t *testing.T) {
 	teardown()
 }
 
+func TestRouteGroup_MultipathWrite(t *testing.T) {
+	rg1, rg2, _, m2, teardown := setupEnv(t)
+
+	// add a second route to rg1 going over the same transport with another next route ID
+	rtIDs, err := rg1.rt.ReserveKeys(1)
+	require.NoError(t, err)
+
+	fwd := rg1.fwd[0]
+	desc := fwd.RouteDescriptor()
+	fwd2 := routing.ForwardRule(ruleKeepAlive, rtIDs[0], fwd.NextRouteID()+100, fwd.NextTransportID(),
+		desc.DstPK(), desc.SrcPK(), desc.DstPort(), desc.SrcPort())
+	require.NoError(t, rg1.rt.SaveRule(fwd2))
+
+	rg1.addRules(rg1.tps[0], fwd2, nil, 0)
+
+	msgs := [][]byte{[]byte("hello1"), []byte("hello2"), []byte("hello3"), []byte("hello4")}
+
+	var packets []routing.Packet
+
+	for i, msg := range msgs {
+		_, err := rg1.Write(msg)
+		require.NoError(t, err)
+
+		packet, err := m2.ReadPacket()
+		require.NoError(t, err)
+		require.Equal(t, routing.SequencedDataPacket, packet.Type())
+		require.Equal(t, uint32(i), packet.Sequence())
+		require.Equal(t, msg, packet.SequencedPayload())
+
+		// writes alternate between routes
+		if i%2 == 0 {
+			require.Equal(t, fwd.NextRouteID(), packet.RouteID())
+		} else {
+			require.Equal(t, fwd2.NextRouteID(), packet.RouteID())
+		}
+
+		packets = append(packets, packet)
+	}
+
+	// deliver packets out of order, route group should read them in order
+	for _, i := range []int{1, 0, 3, 2} {
+		require.NoError(t, rg2.handlePacket(packets[i]))
+	}
+
+	for _, msg := range msgs {
+		buf := make([]byte, len(msg))
+		_, err := rg2.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, msg, buf)
+	}
+
+	// write should fall back to the remaining route if one of them is unusable
+	rg1.tps[1] = nil
+
+	for i := 0; i < 2; i++ {
+		_, err := rg1.Write(msgs[i])
+		require.NoError(t, err)
+
+		packet, err := m2.ReadPacket()
+		require.NoError(t, err)
+		require.Equal(t, fwd.NextRouteID(), packet.RouteID())
+	}
+
+	rg1.tps[1] = rg1.tps[0]
+
+	// write should fail if all routes fail
+	require.NoError(t, rg1.tps[0].Close())
+
+	_, err = rg1.Write(msgs[0])
+	require.Error(t, err)
+
+	teardown()
+}
+
+func TestRouteGroup_WriteFailover(t *testing.T) {
+	rg1, _, _, m2, teardown := setupEnv(t)
+	defer teardown()
+
+	// add a second route to rg1 going over a transport whose writes fail
+	hub := &pipeHub{lis: make(map[cipher.PubKey]*pipeListener)}
+	keys := snettest.GenKeyPairs(2)
+	clients := make([]*pipeClient, len(keys))
+	managers := make([]*transport.Manager, len(keys))
+	dc := transport.NewDiscoveryMock()
+
+	for i, kp := range keys {
+		clients[i] = &pipeClient{hub: hub, pk: kp.PK}
+		n := snet.NewRaw(snet.Config{PubKey: kp.PK, SecKey: kp.SK}, nil, nil, nil, nil, clients[i])
+
+		m, err := transport.NewManager(n, &transport.ManagerConfig{
+			PubKey:          kp.PK,
+			SecKey:          kp.SK,
+			DiscoveryClient: dc,
+			LogStore:        transport.InMemoryTransportLogStore(),
+		})
+		require.NoError(t, err)
+
+		go m.Serve(context.TODO())
+
+		managers[i] = m
+	}
+
+	defer func() {
+		for _, m := range managers {
+			require.NoError(t, m.Close())
+		}
+	}()
+
+	require.Eventually(t, func() bool { return hub.listening(keys[1].PK) }, time.Second, 10*time.Millisecond)
+
+	tp, err := managers[0].SaveTransport(context.TODO(), keys[1].PK, pipeType)
+	require.NoError(t, err)
+	require.Eventually(t, tp.IsUp, time.Second, 10*time.Millisecond)
+
+	rtIDs, err := rg1.rt.ReserveKeys(1)
+	require.NoError(t, err)
+
+	fwd := rg1.fwd[0]
+	desc := fwd.RouteDescriptor()
+	fwd2 := routing.ForwardRule(ruleKeepAlive, rtIDs[0], fwd.NextRouteID()+100, tp.Entry.ID,
+		desc.DstPK(), desc.SrcPK(), desc.DstPort(), desc.SrcPort())
+	require.NoError(t, rg1.rt.SaveRule(fwd2))
+
+	rg1.addRules(tp, fwd2, nil, 0)
+
+	// the write goes via the failing route first and falls back to the remaining one
+	atomic.StoreInt32(&clients[0].fail, 1)
+	rg1.nextPath = 1
+
+	_, err = rg1.Write([]byte("hello"))
+	require.NoError(t, err)
+
+	packet, err := m2.ReadPacket()
+	require.NoError(t, err)
+	require.Equal(t, fwd.NextRouteID(), packet.RouteID())
+	require.Equal(t, []byte("hello"), packet.SequencedPayload())
+
+	require.Equal(t, []routing.Rule{fwd2}, rg1.brokenPaths())
+}
+
+const pipeType = "pipe"
+
+// pipeHub connects clients of the pipe network in memory.
+type pipeHub struct {
+	mu  sync.Mutex
+	lis map[cipher.PubKey]*pipeListener
+}
+
+func (h *pipeHub) listening(pk cipher.PubKey) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, ok := h.lis[pk]
+
+	return ok
+}
+
+// pipeClient is a client of the pipe network. Writes of connections it dialed fail once `fail` is set.
+type pipeClient struct {
+	hub  *pipeHub
+	pk   cipher.PubKey
+	fail int32
+}
+
+func (c *pipeClient) Dial(ctx context.Context, remote cipher.PubKey, port uint16) (net.Conn, error) {
+	c.hub.mu.Lock()
+	lis, ok := c.hub.lis[remote]
+	c.hub.mu.Unlock()
+
+	if !ok {
+		return nil, errors.New("nothing listens")
+	}
+
+	lConn, rConn := net.Pipe()
+	lAddr, rAddr := dmsg.Addr{PK: c.pk, Port: port + 1}, dmsg.Addr{PK: remote, Port: port}
+
+	select {
+	case lis.ch <- &pipeConn{Conn: rConn, lAddr: rAddr, rAddr: lAddr}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return &pipeConn{Conn: lConn, lAddr: lAddr, rAddr: rAddr, fail: &c.fail}, nil
+}
+
+func (c *pipeClient) Listen(port uint16) (net.Listener, error) {
+	lis := &pipeListener{addr: dmsg.Addr{PK: c.pk, Port: port}, ch: make(chan net.Conn), done: make(chan struct{})}
+
+	c.hub.mu.Lock()
+	c.hub.lis[c.pk] = lis
+	c.hub.mu.Unlock()
+
+	return lis, nil
+}
+
+func (c *pipeClient) Close() error { return nil }
+func (c *pipeClient) Type() string { return pipeType }
+
+type pipeConn struct {
+	net.Conn
+	lAddr, rAddr dmsg.Addr
+	fail         *int32
+}
+
+func (c *pipeConn) Write(b []byte) (int, error) {
+	if c.fail != nil && atomic.LoadInt32(c.fail) == 1 {
+		return 0, errors.New("write failed")
+	}
+
+	return c.Conn.Write(b)
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return c.lAddr }
+func (c *pipeConn) RemoteAddr() net.Addr { return c.rAddr }
+
+type pipeListener struct {
+	addr dmsg.Addr
+	ch   chan net.Conn
+	done chan struct{}
+	once sync.Once
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.ch:
+		return conn, nil
+	case <-l.done:
+		return nil, errors.New("listener closed")
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr { return l.addr }
+
+func TestRouteGroup_Encryption(t *testing.T) {
+	rg1, rg2, m1, m2, teardown := setupEnv(t)
+	defer teardown()
+
+	keys := snettest.GenKeyPairs(2)
+
+	crypto1, err := newRouteGroupCrypto(keys[0].PK, keys[0].SK, keys[1].PK, true)
+	require.NoError(t, err)
+
+	crypto2, err := newRouteGroupCrypto(keys[1].PK, keys[1].SK, keys[0].PK, false)
+	require.NoError(t, err)
+
+	rg1.startHandshake(crypto1)
+	rg2.startHandshake(crypto2)
+
+	go handlePackets(m1, rg1)
+
+	// intercept encrypted packets on the way to rg2
+	packets := make(chan routing.Packet, 1)
+
+	go func() {
+		for {
+			packet, err := m2.ReadPacket()
+			if err != nil {
+				return
+			}
+
+			crypto1.mu.Lock()
+			handshake := bytes.Equal(packet.Payload(), crypto1.sent)
+			crypto1.mu.Unlock()
+
+			if handshake {
+				_ = rg2.handlePacket(packet) // nolint:errcheck
+				continue
+			}
+
+			packets <- packet
+		}
+	}()
+
+	msg := []byte("hello")
+
+	_, err = rg1.Write(msg)
+	require.NoError(t, err)
+
+	packet := <-packets
+	require.NotContains(t, string(packet.Payload()), string(msg))
+
+	// the route group returns handled packets to the pool
+	replayed := append(routing.Packet(nil), packet...)
+	require.NoError(t, rg2.handlePacket(packet))
+
+	buf := make([]byte, len(msg))
+	_, err = rg2.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, msg, buf)
+
+	// replayed packet is dropped
+	require.Error(t, rg2.handlePacket(replayed))
+
+	_, err = rg2.Write([]byte("world"))
+	require.NoError(t, err)
+
+	buf = make([]byte, 5)
+	_, err = rg1.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, []byte("world"), buf)
+}
+
+func TestRouteGroup_HandshakeTimeout(t *testing.T) {
+	rg1, _, _, _, teardown := setupEnv(t)
+	defer teardown()
+
+	rg1.cfg.HandshakeTimeout = 100 * time.Millisecond
+
+	keys := snettest.GenKeyPairs(2)
+
+	crypto, err := newRouteGroupCrypto(keys[0].PK, keys[0].SK, keys[1].PK, false)
+	require.NoError(t, err)
+
+	rg1.startHandshake(crypto)
+
+	_, err = rg1.Write([]byte("hello"))
+	require.Equal(t, ErrHandshakeTimeout, err)
+
+	// route group is not left half-open
+	require.Eventually(t, rg1.isClosed, 5*time.Second, 50*time.Millisecond)
+}
+
+func handlePackets(from *transport.Manager, to *RouteGroup) {
+	for {
+		packet, err := from.ReadPacket()
+		if err != nil {
+			return
+		}
+
+		_ = to.handlePacket(packet) // nolint:errcheck
+	}
+}
+
+func TestRouteGroup_FlowControl(t *testing.T) {
+	rg1, rg2, m1, m2, teardown := setupEnv(t)
+	defer teardown()
+
+	const window = 4
+
+	// receive window of rg2
+	rg2.readCh = make(chan readChunk, window)
+	rg2.fc = newFlowControl(window, defaultPacketLossTimeout)
+
+	go handlePackets(m1, rg1)
+	go handlePackets(m2, rg2)
+
+	msg := []byte("hello")
+
+	// the window is announced on the first packet
+	_, err := rg1.Write(msg)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		rg1.fc.mu.Lock()
+		defer rg1.fc.mu.Unlock()
+
+		return rg1.fc.active
+	}, time.Second, 10*time.Millisecond)
+
+	for i := 1; i < window; i++ {
+		_, err := rg1.Write(msg)
+		require.NoError(t, err)
+	}
+
+	// reader of rg2 is too slow, rg1 backs off
+	require.NoError(t, rg1.SetWriteDeadline(time.Now().Add(100*time.Millisecond)))
+
+	_, err = rg1.Write(msg)
+	require.Equal(t, timeoutError{}, err)
+
+	require.NoError(t, rg1.SetWriteDeadline(time.Time{}))
+
+	errCh := make(chan error)
+	go func() {
+		_, err := rg1.Write(msg)
+		errCh <- err
+	}()
+
+	// consuming half of the window lets rg1 continue
+	for i := 0; i < window/2; i++ {
+		buf := make([]byte, len(msg))
+		_, err := rg2.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, msg, buf)
+	}
+
+	require.NoError(t, <-errCh)
+}
+
+func TestRouteGroup_FlowControlStalledReader(t *testing.T) {
+	rg1, rg2, m1, m2, teardown := setupEnv(t)
+	defer teardown()
+
+	const window = 4
+
+	// receive window of rg2, rg1 considers packets lost quickly
+	rg2.readCh = make(chan readChunk, window)
+	rg2.fc = newFlowControl(window, defaultPacketLossTimeout)
+	rg1.fc = newFlowControl(window, 50*time.Millisecond)
+
+	// another pair of route groups served by the same transports
+	rg3, rg4 := addRouteGroupPair(t, rg1, rg2)
+
+	go dispatchPackets(m1, rg1, rg3)
+	go dispatchPackets(m2, rg2, rg4)
+
+	msg := []byte("hello")
+
+	// the window is announced on the first packet
+	_, err := rg1.Write(msg)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		rg1.fc.mu.Lock()
+		defer rg1.fc.mu.Unlock()
+
+		return rg1.fc.active
+	}, time.Second, 10*time.Millisecond)
+
+	for i := 1; i < window; i++ {
+		_, err := rg1.Write(msg)
+		require.NoError(t, err)
+	}
+
+	errCh := make(chan error)
+	go func() {
+		_, err := rg1.Write(msg)
+		errCh <- err
+	}()
+
+	// reader of rg2 stalls for longer than the loss timeout, rg1 keeps waiting for it
+	// while the other route groups keep flowing
+	for start := time.Now(); time.Since(start) < 500*time.Millisecond; {
+		_, err := rg3.Write(msg)
+		require.NoError(t, err)
+
+		buf := make([]byte, len(msg))
+
+		require.NoError(t, rg4.SetReadDeadline(time.Now().Add(time.Second)))
+		_, err = rg4.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, msg, buf)
+	}
+
+	select {
+	case err := <-errCh:
+		t.Fatalf("write did not wait for the stalled reader: %v", err)
+	default:
+	}
+
+	for i := 0; i < window+1; i++ {
+		buf := make([]byte, len(msg))
+		_, err := rg2.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, msg, buf)
+	}
+
+	require.NoError(t, <-errCh)
+}
+
+// addRouteGroupPair creates a pair of route groups connected the same way as `rg1` and `rg2`.
+func addRouteGroupPair(t *testing.T, rg1, rg2 *RouteGroup) (rg3, rg4 *RouteGroup) {
+	rtIDs3, err := rg1.rt.ReserveKeys(1)
+	require.NoError(t, err)
+
+	rtIDs4, err := rg2.rt.ReserveKeys(1)
+	require.NoError(t, err)
+
+	desc := rg1.fwd[0].RouteDescriptor()
+	fwd3 := routing.ForwardRule(ruleKeepAlive, rtIDs3[0], rtIDs4[0], rg1.tps[0].Entry.ID,
+		desc.DstPK(), desc.SrcPK(), desc.DstPort()+10, desc.SrcPort()+10)
+	require.NoError(t, rg1.rt.SaveRule(fwd3))
+
+	desc = rg2.fwd[0].RouteDescriptor()
+	fwd4 := routing.ForwardRule(ruleKeepAlive, rtIDs4[0], rtIDs3[0], rg2.tps[0].Entry.ID,
+		desc.DstPK(), desc.SrcPK(), desc.DstPort()+10, desc.SrcPort()+10)
+	require.NoError(t, rg2.rt.SaveRule(fwd4))
+
+	fwd3Desc := fwd3.RouteDescriptor()
+	rg3 = NewRouteGroup(rg1.cfg, rg1.rt, fwd3Desc.Invert())
+	rg3.tps = append(rg3.tps, rg1.tps[0])
+	rg3.fwd = append(rg3.fwd, fwd3)
+
+	fwd4Desc := fwd4.RouteDescriptor()
+	rg4 = NewRouteGroup(rg2.cfg, rg2.rt, fwd4Desc.Invert())
+	rg4.tps = append(rg4.tps, rg2.tps[0])
+	rg4.fwd = append(rg4.fwd, fwd4)
+
+	return rg3, rg4
+}
+
+// dispatchPackets passes packets read from `from` to the route groups they are addressed to.
+func dispatchPackets(from *transport.Manager, to ...*RouteGroup) {
+	for {
+		packet, err := from.ReadPacket()
+		if err != nil {
+			return
+		}
+
+		for _, rg := range to {
+			if rg.fwd[0].KeyRouteID() == packet.RouteID() {
+				_ = rg.handlePacket(packet) // nolint:errcheck
+				break
+			}
+		}
+	}
+}
+
+func TestRouteGroup_ReplacePath(t *testing.T) {
+	rg1, _, _, _, teardown := setupEnv(t)
+	defer teardown()
+
+	fwd := rg1.fwd[0]
+	require.Empty(t, rg1.brokenPaths())
+
+	rg1.setPathFailed(fwd.KeyRouteID(), true)
+	require.Equal(t, []routing.Rule{fwd}, rg1.brokenPaths())
+
+	rtIDs, err := rg1.rt.ReserveKeys(2)
+	require.NoError(t, err)
+
+	desc := fwd.RouteDescriptor()
+	newFwd := routing.ForwardRule(ruleKeepAlive, rtIDs[0], fwd.NextRouteID()+100, fwd.NextTransportID(),
+		desc.DstPK(), desc.SrcPK(), desc.DstPort(), desc.SrcPort())
+	newRvs := routing.ConsumeRule(ruleKeepAlive, rtIDs[1], desc.SrcPK(), desc.DstPK(), desc.SrcPort(), desc.DstPort())
+
+	require.False(t, rg1.replacePath(rtIDs[0], rg1.tps[0], newFwd, newRvs, 0))
+	require.Equal(t, defaultRouteMTU, rg1.payloadMTU())
+	require.True(t, rg1.replacePath(fwd.KeyRouteID(), rg1.tps[0], newFwd, newRvs, 100))
+
+	require.Equal(t, []routing.Rule{newFwd}, rg1.fwd)
+	require.Equal(t, []routing.Rule{newRvs}, rg1.rvs)
+	require.Empty(t, rg1.brokenPaths())
+	require.Equal(t, 100, rg1.payloadMTU())
+}
+
+func TestRouteGroup_Fragmentation(t *testing.T) {
+	t.Run("large writes", func(t *testing.T) {
+		rg1, rg2, m1, m2, teardown := setupEnv(t)
+		defer teardown()
+
+		go handlePackets(m1, rg1)
+		go handlePackets(m2, rg2)
+
+		msg := make([]byte, 3*defaultRouteMTU)
+		_, err := rand.Read(msg)
+		require.NoError(t, err)
+
+		n, err := rg1.Write(msg)
+		require.NoError(t, err)
+		require.Equal(t, len(msg), n)
+
+		buf := make([]byte, len(msg))
+		_, err = io.ReadFull(rg2, buf)
+		require.NoError(t, err)
+		require.Equal(t, msg, buf)
+	})
+
+	t.Run("small MTU", func(t *testing.T) {
+		rg1, rg2, m1, m2, teardown := setupEnv(t)
+		defer teardown()
+
+		go handlePackets(m1, rg1)
+		go handlePackets(m2, rg2)
+
+		rg1.mu.Lock()
+		rg1.setMTU(rg1.fwd[0], 32)
+		rg1.mu.Unlock()
+
+		// more than `maxFragments` fragments, so the write is split into several messages
+		msg := make([]byte, 24*maxFragments+100)
+		_, err := rand.Read(msg)
+		require.NoError(t, err)
+
+		n, err := rg1.Write(msg)
+		require.NoError(t, err)
+		require.Equal(t, len(msg), n)
+
+		buf := make([]byte, len(msg))
+		_, err = io.ReadFull(rg2, buf)
+		require.NoError(t, err)
+		require.Equal(t, msg, buf)
+	})
+
+	t.Run("out of order and lost fragments", func(t *testing.T) {
+		rg := createRouteGroup(DefaultRouteGroupConfig())
+
+		fragment := func(seq uint32, index, count uint16, data string) routing.Packet {
+			packet, err := routing.MakeFragmentPacket(1, seq, index, count, []byte(data))
+			require.NoError(t, err)
+
+			return packet
+		}
+
+		require.NoError(t, rg.handlePacket(fragment(2, 2, 3, "baz")))
+		require.NoError(t, rg.handlePacket(fragment(0, 0, 3, "foo")))
+		require.NoError(t, rg.handlePacket(fragment(1, 1, 3, "bar")))
+
+		buf := make([]byte, 9)
+		n, err := rg.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, "foobarbaz", string(buf[:n]))
+
+		// the message missing its second fragment is dropped once the gap is skipped
+		rg.reorder.timeout = 10 * time.Millisecond
+		require.NoError(t, rg.handlePacket(fragment(3, 0, 2, "lost")))
+		require.NoError(t, rg.handlePacket(fragment(6, 0, 1, "qux")))
+
+		n, err = rg.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, "qux", string(buf[:n]))
+
+		require.Error(t, rg.handlePacket(fragment(7, 1, 1, "bad")))
+	})
+}
+
 func testWrite(t *testing.T, rg1, rg2 *RouteGroup, m1, m2 *transport.Manager) {
 	msg1 := []byte("hello1")
 	msg2 := []byte("hello2")
@@ -591,7 +1219,7 @@ func safeSend(ctx context.Context, to *RouteGroup, payload []byte) (keepSending
 		return false
 	case <-to.closed:
 		return false
-	case to.readCh <- payload:
+	case to.readCh <- readChunk{data: payload}:
 		return true
 	}
 }
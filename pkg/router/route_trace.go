@@ -0,0 +1,184 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/routing"
+)
+
+var errMalformedProbe = errors.New("malformed probe packet")
+
+// HopRTT is the round trip time between the local visor and a visor of a route.
+// RTT of an intermediary visor is only known if the visor is on both the forward and the reverse routes,
+// as it's computed from timestamps taken by the same visor. Otherwise, RTT is nil.
+type HopRTT struct {
+	PK  cipher.PubKey  `json:"pk"`
+	RTT *time.Duration `json:"rtt"`
+}
+
+// probe sends a probe via the forward route of `fwd` (or via the next available route if `fwd` is nil)
+// and waits for the remote edge to send it back. It returns hop records of the probe and its round trip time.
+func (rg *RouteGroup) probe(ctx context.Context, fwd routing.Rule) ([]routing.ProbeHop, time.Duration, error) {
+	probeID := atomic.AddUint32(&rg.nextProbeID, 1)
+	replyCh := make(chan []routing.ProbeHop, 1)
+
+	rg.mu.Lock()
+	path, err := rg.probePath(fwd)
+	if err == nil {
+		rg.probes[probeID] = replyCh
+	}
+	rg.mu.Unlock()
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer func() {
+		rg.mu.Lock()
+		delete(rg.probes, probeID)
+		rg.mu.Unlock()
+	}()
+
+	packet, err := routing.MakeProbePacket(path.rule.NextRouteID(), probeID, false, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	start := time.Now()
+
+	if err := rg.writePacket(ctx, path.tp, packet, path.rule.KeyRouteID()); err != nil {
+		return nil, 0, err
+	}
+
+	select {
+	case hops := <-replyCh:
+		return hops, time.Since(start), nil
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	case <-rg.closed:
+		return nil, 0, io.ErrClosedPipe
+	}
+}
+
+// probePath returns the path of the forward rule `fwd`, or the next available path if `fwd` is nil.
+// NOTE: not thread-safe.
+func (rg *RouteGroup) probePath(fwd routing.Rule) (routeGroupPath, error) {
+	if fwd == nil {
+		paths, err := rg.paths()
+		if err != nil {
+			return routeGroupPath{}, err
+		}
+
+		return paths[0], nil
+	}
+
+	for i, rule := range rg.fwd {
+		if rule.KeyRouteID() != fwd.KeyRouteID() || i >= len(rg.tps) {
+			continue
+		}
+
+		if rg.tps[i] == nil {
+			return routeGroupPath{}, ErrBadTransport
+		}
+
+		return routeGroupPath{tp: rg.tps[i], rule: rule}, nil
+	}
+
+	return routeGroupPath{}, ErrNoRules
+}
+
+// rule returns the rule of the route group with the key route ID `id`.
+func (rg *RouteGroup) rule(id routing.RouteID) (routing.Rule, bool) {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+
+	for _, rules := range [][]routing.Rule{rg.fwd, rg.rvs} {
+		for _, rule := range rules {
+			if rule != nil && rule.KeyRouteID() == id {
+				return rule, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// handleProbePacket sends probes back to the remote edge and passes replies to waiting probes.
+func (rg *RouteGroup) handleProbePacket(packet routing.Packet) error {
+	if len(packet.Payload()) < routing.PacketProbeHeaderSize {
+		return errMalformedProbe
+	}
+
+	probeID, reply, hops := packet.Probe()
+
+	if reply {
+		rg.mu.Lock()
+		replyCh, ok := rg.probes[probeID]
+		rg.mu.Unlock()
+
+		if ok {
+			select {
+			case replyCh <- hops:
+			default:
+			}
+		}
+
+		return nil
+	}
+
+	hops = append(hops, routing.ProbeHop{PK: rg.desc.DstPK(), Time: time.Now()})
+
+	return rg.writeNext(func(id routing.RouteID) (routing.Packet, error) {
+		return routing.MakeProbePacket(id, probeID, true, hops)
+	})
+}
+
+// hopRTTs computes round trip times to the visors of a route from hop records of a probe sent to `remote`
+// with the round trip time `rtt`. Visors which are on both the forward and the reverse routes take
+// two timestamps, the time between them is the part of `rtt` spent beyond the visor.
+func hopRTTs(remote cipher.PubKey, hops []routing.ProbeHop, rtt time.Duration) []HopRTT {
+	edge := len(hops)
+
+	for i, hop := range hops {
+		if hop.PK == remote {
+			edge = i
+			break
+		}
+	}
+
+	out := make([]HopRTT, 0, edge+1)
+
+	for i := 0; i < edge; i++ {
+		hopRTT := HopRTT{PK: hops[i].PK}
+
+		for j := edge + 1; j < len(hops); j++ {
+			if hops[j].PK != hops[i].PK {
+				continue
+			}
+
+			if beyond := hops[j].Time.Sub(hops[i].Time); beyond >= 0 && beyond <= rtt {
+				hopRTT.RTT = durationPtr(rtt - beyond)
+			}
+
+			break
+		}
+
+		out = append(out, hopRTT)
+	}
+
+	if edge < len(hops) {
+		out = append(out, HopRTT{PK: remote, RTT: durationPtr(rtt)})
+	}
+
+	return out
+}
+
+func durationPtr(d time.Duration) *time.Duration {
+	return &d
+}
@@ -0,0 +1,61 @@
+package router
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/routing"
+)
+
+func TestRouteGroup_Probe(t *testing.T) {
+	rg1, rg2, m1, m2, teardown := setupEnv(t)
+	defer teardown()
+
+	go handlePackets(m1, rg1)
+	go handlePackets(m2, rg2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hops, rtt, err := rg1.probe(ctx, rg1.fwd[0])
+	require.NoError(t, err)
+	require.True(t, rtt > 0)
+
+	// the remote edge adds its record before sending the probe back
+	require.Len(t, hops, 1)
+	require.Equal(t, rg2.desc.DstPK(), hops[0].PK)
+
+	rg1.mu.Lock()
+	require.Empty(t, rg1.probes)
+	rg1.mu.Unlock()
+}
+
+func TestHopRTTs(t *testing.T) {
+	hop1, _ := cipher.GenerateKeyPair()
+	hop2, _ := cipher.GenerateKeyPair()
+	remote, _ := cipher.GenerateKeyPair()
+
+	at := func(ms int) time.Time {
+		return time.Unix(0, 0).Add(time.Duration(ms) * time.Millisecond)
+	}
+
+	// forward route: local -> hop1 -> hop2 -> remote, reverse route: remote -> hop1 -> local
+	hops := []routing.ProbeHop{
+		{PK: hop1, Time: at(0)},
+		{PK: hop2, Time: at(1000)}, // clocks of visors are not synchronized
+		{PK: remote, Time: at(5000)},
+		{PK: hop1, Time: at(60)},
+	}
+
+	rtt := 100 * time.Millisecond
+
+	require.Equal(t, []HopRTT{
+		{PK: hop1, RTT: durationPtr(40 * time.Millisecond)},
+		{PK: hop2, RTT: nil}, // not on the reverse route
+		{PK: remote, RTT: durationPtr(rtt)},
+	}, hopRTTs(remote, hops, rtt))
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net"
 	"net/rpc"
 	"sync"
@@ -14,6 +15,7 @@ import (
 	"github.com/SkycoinProject/dmsg"
 	"github.com/SkycoinProject/dmsg/cipher"
 	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"github.com/google/uuid"
 
 	"github.com/SkycoinProject/skywire-mainnet/pkg/routefinder/rfclient"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/routing"
@@ -30,7 +32,16 @@ const (
 	DefaultRouteKeepAlive = 30 * time.Second
 	// DefaultRulesGCInterval is the default duration for garbage collection of routing rules.
 	DefaultRulesGCInterval = 5 * time.Second
-	acceptSize             = 1024
+	// DefaultRouteRepairInterval is the default interval of checking route groups for broken routes.
+	DefaultRouteRepairInterval = 5 * time.Second
+	acceptSize                 = 1024
+
+	// number of candidate paths requested from route finder when repairing a route
+	repairCandidates = 5
+	// maximum delay between attempts to repair a route
+	maxRepairBackoff = 5 * time.Minute
+	// interval between attempts to fetch routes from route finder
+	fetchRoutesRetryInterval = 500 * time.Millisecond
 
 	minHops = 0
 	maxHops = 50
@@ -42,18 +53,40 @@ var (
 
 	// ErrRemoteEmptyPK occurs when the specified remote public key is empty.
 	ErrRemoteEmptyPK = errors.New("empty remote public key")
+
+	// ErrNotEnoughRoutes is returned when less routes than requested via DialOptions could be established.
+	ErrNotEnoughRoutes = errors.New("not enough routes")
+
+	// ErrNoRouteGroup is returned when there is no route group with the requested route.
+	ErrNoRouteGroup = errors.New("no route group with the route")
+
+	// ErrNotEncrypted is returned when end-to-end encryption is required via DialOptions,
+	// but the route group could not be encrypted.
+	ErrNotEncrypted = errors.New("route group is not encrypted end-to-end")
 )
 
 // Config configures Router.
 type Config struct {
-	Logger           *logging.Logger
-	PubKey           cipher.PubKey
-	SecKey           cipher.SecKey
-	TransportManager *transport.Manager
-	RouteFinder      rfclient.Client
-	RouteGroupDialer setupclient.RouteGroupDialer
-	SetupNodes       []cipher.PubKey
-	RulesGCInterval  time.Duration
+	Logger              *logging.Logger
+	PubKey              cipher.PubKey
+	SecKey              cipher.SecKey
+	TransportManager    *transport.Manager
+	RouteFinder         rfclient.Client
+	RouteGroupDialer    setupclient.RouteGroupDialer
+	RoutingTable        routing.Table // in-memory table is used if nil
+	SetupNodes          []cipher.PubKey
+	RulesGCInterval     time.Duration
+	RouteRepairInterval time.Duration
+	// DisableEncryption disables end-to-end encryption of route groups.
+	// Encryption is negotiated while setting up a route group: it's used only if neither edge
+	// disables it and both support it, route groups fall back to plain data otherwise.
+	DisableEncryption bool
+	// BandwidthLimits limits traffic forwarded by the router.
+	BandwidthLimits BandwidthLimits
+	// OnRouteGroupOpened and OnRouteGroupClosed are called when route groups are registered and removed if set.
+	// They must not block.
+	OnRouteGroupOpened func(desc routing.RouteDescriptor)
+	OnRouteGroupClosed func(desc routing.RouteDescriptor)
 }
 
 // SetDefaults sets default values for certain empty values.
@@ -66,9 +99,17 @@ func (c *Config) SetDefaults() {
 		c.RouteGroupDialer = setupclient.NewSetupNodeDialer()
 	}
 
+	if c.RoutingTable == nil {
+		c.RoutingTable = routing.NewTable()
+	}
+
 	if c.RulesGCInterval <= 0 {
 		c.RulesGCInterval = DefaultRulesGCInterval
 	}
+
+	if c.RouteRepairInterval <= 0 {
+		c.RouteRepairInterval = DefaultRouteRepairInterval
+	}
 }
 
 // DialOptions describes dial options.
@@ -77,6 +118,9 @@ type DialOptions struct {
 	MaxForwardRts int
 	MinConsumeRts int
 	MaxConsumeRts int
+	// RequireEncryption fails dialing instead of falling back to plain data
+	// if the route group can't be encrypted end-to-end.
+	RequireEncryption bool
 }
 
 // DefaultDialOptions returns default dial options.
@@ -100,7 +144,7 @@ type Router interface {
 	// A nil 'opts' input results in a value of '1' for all DialOptions fields.
 	// A single call to DialRoutes should perform the following:
 	// - Find routes via RouteFinder (in one call).
-	// - Setup routes via SetupNode (in one call).
+	// - Setup routes via SetupNode (one call per forward/reverse route pair).
 	// - Save to routing.Table and internal RouteGroup map.
 	// - Return RouteGroup if successful.
 	DialRoutes(ctx context.Context, rPK cipher.PubKey, lPort, rPort routing.Port, opts *DialOptions) (*RouteGroup, error)
@@ -117,6 +161,19 @@ type Router interface {
 	Serve(context.Context) error
 	SetupIsTrusted(cipher.PubKey) bool
 
+	// TraceRoute sends a probe via the route group with the edge route of 'routeID'
+	// and returns round trip times to the visors of the route, the remote edge being the last one.
+	TraceRoute(ctx context.Context, routeID routing.RouteID) ([]HopRTT, error)
+
+	// BandwidthLimits returns the current limits of forwarded traffic.
+	BandwidthLimits() BandwidthLimits
+	// SetBandwidthLimits replaces limits of forwarded traffic.
+	SetBandwidthLimits(BandwidthLimits)
+	// SetRouteFinder replaces the route finder client used for new routes.
+	SetRouteFinder(rfclient.Client)
+	// SetSetupNodes replaces setup nodes used for new routes and trusted to introduce rules.
+	SetSetupNodes([]cipher.PubKey)
+
 	// routing table related methods
 	RoutesCount() int
 	Rules() []routing.Rule
@@ -130,6 +187,7 @@ type Router interface {
 // rules and manages route groups for apps.
 type router struct {
 	mx            sync.Mutex
+	confMx        sync.RWMutex // protects route finder, setup nodes and trusted visors, which may be replaced
 	conf          *Config
 	logger        *logging.Logger
 	n             *snet.Network
@@ -139,8 +197,11 @@ type router struct {
 	rt            routing.Table
 	rfc           rfclient.Client                         // route finder client
 	rgs           map[routing.RouteDescriptor]*RouteGroup // route groups to push incoming reads from transports.
+	limiter       *bandwidthLimiter
+	shaper        *forwardShaper
 	rpcSrv        *rpc.Server
 	accept        chan routing.EdgeRules
+	repairs       map[routing.RouteID]repairBackoff // failed repairs of broken routes, used by the repair loop only
 	done          chan struct{}
 	wg            sync.WaitGroup
 	once          sync.Once
@@ -165,19 +226,26 @@ func New(n *snet.Network, config *Config) (Router, error) {
 		logger:        config.Logger,
 		n:             n,
 		tm:            config.TransportManager,
-		rt:            routing.NewTable(),
+		rt:            config.RoutingTable,
 		sl:            sl,
 		rfc:           config.RouteFinder,
 		rgs:           make(map[routing.RouteDescriptor]*RouteGroup),
+		limiter:       newBandwidthLimiter(config.BandwidthLimits),
 		rpcSrv:        rpc.NewServer(),
 		accept:        make(chan routing.EdgeRules, acceptSize),
 		done:          make(chan struct{}),
 		trustedVisors: trustedVisors,
 	}
 
+	r.shaper = newForwardShaper(r.done, r.logger)
+
 	go r.rulesGCLoop()
+	go r.routeRepairLoop()
+
+	gateway := NewRPCGateway(r)
+	gateway.encrypt = !config.DisableEncryption
 
-	if err := r.rpcSrv.Register(NewRPCGateway(r)); err != nil {
+	if err := r.rpcSrv.Register(gateway); err != nil {
 		return nil, fmt.Errorf("failed to register RPC server")
 	}
 
@@ -189,7 +257,7 @@ func New(n *snet.Network, config *Config) (Router, error) {
 // A nil 'opts' input results in a value of '1' for all DialOptions fields.
 // A single call to DialRoutes should perform the following:
 // - Find routes via RouteFinder (in one call).
-// - Setup routes via SetupNode (in one call).
+// - Setup routes via SetupNode (one call per forward/reverse route pair).
 // - Save to routing.Table and internal RouteGroup map.
 // - Return RouteGroup if successful.
 func (r *router) DialRoutes(
@@ -205,35 +273,103 @@ func (r *router) DialRoutes(
 		return nil, fmt.Errorf("failed to dial routes: %v", err)
 	}
 
+	if opts == nil {
+		opts = DefaultDialOptions()
+	}
+
+	if opts.RequireEncryption && r.conf.DisableEncryption {
+		return nil, fmt.Errorf("%w: encryption is disabled", ErrNotEncrypted)
+	}
+
 	lPK := r.conf.PubKey
 	forwardDesc := routing.NewRouteDescriptor(lPK, rPK, lPort, rPort)
 
-	forwardPath, reversePath, err := r.fetchBestRoutes(lPK, rPK, opts)
+	forwardPaths, reversePaths, err := r.fetchBestRoutes(lPK, rPK, opts)
 	if err != nil {
 		return nil, fmt.Errorf("route finder: %s", err)
 	}
 
-	req := routing.BidirectionalRoute{
-		Desc:      forwardDesc,
-		KeepAlive: DefaultRouteKeepAlive,
-		Forward:   forwardPath,
-		Reverse:   reversePath,
+	// Every route setup requires both a forward and a reverse path,
+	// so the shorter list of paths is reused in cyclic order.
+	pairs := len(forwardPaths)
+	if len(reversePaths) > pairs {
+		pairs = len(reversePaths)
 	}
 
-	rules, err := r.conf.RouteGroupDialer.Dial(ctx, r.logger, r.n, r.conf.SetupNodes, req)
-	if err != nil {
-		r.logger.WithError(err).Error("Error dialing route group")
-		return nil, err
-	}
+	var rg *RouteGroup
+
+	for i := 0; i < pairs; i++ {
+		forwardPath := forwardPaths[i%len(forwardPaths)]
+		reversePath := reversePaths[i%len(reversePaths)]
+
+		req := routing.BidirectionalRoute{
+			Desc:       forwardDesc,
+			KeepAlive:  DefaultRouteKeepAlive,
+			Forward:    forwardPath,
+			Reverse:    reversePath,
+			Additional: rg != nil,
+			ForwardMTU: r.pathMTU(ctx, forwardPath),
+			ReverseMTU: r.pathMTU(ctx, reversePath),
+			Encrypt:    rg == nil && !r.conf.DisableEncryption,
+		}
 
-	if err := r.SaveRoutingRules(rules.Forward, rules.Reverse); err != nil {
-		r.logger.WithError(err).Error("Error saving routing rules")
-		return nil, err
+		rules, err := r.conf.RouteGroupDialer.Dial(ctx, r.logger, r.n, r.setupNodes(), req)
+		if err != nil {
+			if rg != nil {
+				r.logger.WithError(err).Warn("Error dialing additional route of route group")
+				continue
+			}
+
+			r.logger.WithError(err).Error("Error dialing route group")
+			return nil, err
+		}
+
+		// the remote edge or the setup node may not agree to encrypt the route group
+		if req.Encrypt && !rules.Encrypt {
+			if opts.RequireEncryption {
+				r.logger.Errorf("Route group to %s could not be encrypted end-to-end", rPK)
+				return nil, ErrNotEncrypted
+			}
+
+			r.logger.Warnf("Route group to %s is not encrypted end-to-end, falling back to plain data", rPK)
+		}
+
+		if err := r.SaveRoutingRules(rules.Forward, rules.Reverse); err != nil {
+			r.logger.WithError(err).Error("Error saving routing rules")
+
+			if rg != nil {
+				continue
+			}
+
+			return nil, err
+		}
+
+		if rg == nil {
+			crypto, err := r.newRouteGroupCrypto(rules, true)
+			if err != nil {
+				return nil, err
+			}
+
+			rg = r.saveRouteGroupRules(rules, crypto)
+			continue
+		}
+
+		rg.addRules(r.tm.Transport(rules.Forward.NextTransportID()), rules.Forward, rules.Reverse, rules.MTU)
 	}
 
-	rg := r.saveRouteGroupRules(rules)
+	rg.mu.Lock()
+	routes := len(rg.fwd)
+	rg.mu.Unlock()
 
-	r.logger.Infof("Created new routes to %s on port %d", rPK, lPort)
+	if routes < opts.MinForwardRts || routes < opts.MinConsumeRts {
+		if err := rg.Close(); err != nil {
+			r.logger.WithError(err).Warn("Failed to close route group")
+		}
+
+		return nil, fmt.Errorf("%w: established %d of %d", ErrNotEnoughRoutes, routes, pairs)
+	}
+
+	r.logger.Infof("Created %d new routes to %s on port %d", routes, rPK, lPort)
 
 	return rg, nil
 }
@@ -270,7 +406,12 @@ func (r *router) AcceptRoutes(ctx context.Context) (*RouteGroup, error) {
 		return nil, err
 	}
 
-	rg := r.saveRouteGroupRules(rules)
+	crypto, err := r.newRouteGroupCrypto(rules, false)
+	if err != nil {
+		return nil, err
+	}
+
+	rg := r.saveRouteGroupRules(rules, crypto)
 
 	return rg, nil
 }
@@ -341,7 +482,9 @@ func (r *router) serveSetup() {
 	}
 }
 
-func (r *router) saveRouteGroupRules(rules routing.EdgeRules) *RouteGroup {
+// saveRouteGroupRules creates a route group of `rules` and registers it.
+// End-to-end encryption is enabled for the route group if `crypto` is not nil.
+func (r *router) saveRouteGroupRules(rules routing.EdgeRules, crypto *routeGroupCrypto) *RouteGroup {
 	r.logger.Infof("Saving route group rules with desc: %s", &rules.Desc)
 	r.mx.Lock()
 	defer r.mx.Unlock()
@@ -362,24 +505,55 @@ func (r *router) saveRouteGroupRules(rules routing.EdgeRules) *RouteGroup {
 	rg = NewRouteGroup(DefaultRouteGroupConfig(), r.rt, rules.Desc)
 	r.rgs[rules.Desc] = rg
 
+	if r.conf.OnRouteGroupOpened != nil {
+		r.conf.OnRouteGroupOpened(rules.Desc)
+	}
+
 	rg.fwd = append(rg.fwd, rules.Forward)
 	rg.rvs = append(rg.rvs, rules.Reverse)
 
 	tp := r.tm.Transport(rules.Forward.NextTransportID())
 	rg.tps = append(rg.tps, tp)
+	rg.setMTU(rules.Forward, rules.MTU)
+
+	if crypto != nil {
+		rg.startHandshake(crypto)
+	}
 
 	return rg
 }
 
+// newRouteGroupCrypto returns end-to-end encryption state for a route group of `rules`.
+// The remote edge is the source of the descriptor. It returns nil if the edges didn't agree
+// on encryption while setting up the route group.
+func (r *router) newRouteGroupCrypto(rules routing.EdgeRules, initiator bool) (*routeGroupCrypto, error) {
+	if !rules.Encrypt {
+		return nil, nil
+	}
+
+	crypto, err := newRouteGroupCrypto(r.conf.PubKey, r.conf.SecKey, rules.Desc.SrcPK(), initiator)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up route group encryption: %v", err)
+	}
+
+	return crypto, nil
+}
+
+// handleTransportPacket handles a packet read from the transport manager.
+// Buffers of packets which are not passed to route groups are returned to the packet pool.
 func (r *router) handleTransportPacket(ctx context.Context, packet routing.Packet) error {
 	switch packet.Type() {
-	case routing.DataPacket:
+	case routing.DataPacket, routing.SequencedDataPacket, routing.FragmentPacket, routing.WindowUpdatePacket,
+		routing.ProbePacket:
 		return r.handleDataPacket(ctx, packet)
 	case routing.ClosePacket:
+		defer routing.PutPacket(packet)
 		return r.handleClosePacket(ctx, packet)
 	case routing.KeepAlivePacket:
+		defer routing.PutPacket(packet)
 		return r.handleKeepAlivePacket(ctx, packet)
 	default:
+		routing.PutPacket(packet)
 		return ErrUnknownPacketType
 	}
 }
@@ -387,6 +561,7 @@ func (r *router) handleTransportPacket(ctx context.Context, packet routing.Packe
 func (r *router) handleDataPacket(ctx context.Context, packet routing.Packet) error {
 	rule, err := r.GetRule(packet.RouteID())
 	if err != nil {
+		routing.PutPacket(packet)
 		return err
 	}
 
@@ -399,17 +574,24 @@ func (r *router) handleDataPacket(ctx context.Context, packet routing.Packet) er
 
 	switch rule.Type() {
 	case routing.RuleForward, routing.RuleIntermediaryForward:
-		r.logger.Infoln("Handling intermediary data packet")
+		// forwarded packets are copied, so the buffer can be reused right away
+		defer routing.PutPacket(packet)
+
+		r.logger.Debugln("Handling intermediary data packet")
 		return r.forwardPacket(ctx, packet, rule)
 	}
 
 	desc := rule.RouteDescriptor()
 	rg, ok := r.routeGroup(desc)
 
-	r.logger.Infof("Handling packet with descriptor %s", &desc)
+	r.logger.Debugf("Handling packet with descriptor %s", &desc)
+
+	if !ok || rg == nil {
+		routing.PutPacket(packet)
+	}
 
 	if !ok {
-		r.logger.Infof("Descriptor not found for rule with type %s, descriptor: %s", rule.Type(), &desc)
+		r.logger.Debugf("Descriptor not found for rule with type %s, descriptor: %s", rule.Type(), &desc)
 		return errors.New("route descriptor does not exist")
 	}
 
@@ -417,7 +599,8 @@ func (r *router) handleDataPacket(ctx context.Context, packet routing.Packet) er
 		return errors.New("RouteGroup is nil")
 	}
 
-	r.logger.Infof("Got new remote packet with size %d and route ID %d. Using rule: %s",
+	// the route group returns the buffer to the packet pool once it's done with it
+	r.logger.Debugf("Got new remote packet with size %d and route ID %d. Using rule: %s",
 		len(packet.Payload()), packet.RouteID(), rule)
 
 	return rg.handlePacket(packet)
@@ -426,7 +609,7 @@ func (r *router) handleDataPacket(ctx context.Context, packet routing.Packet) er
 func (r *router) handleClosePacket(ctx context.Context, packet routing.Packet) error {
 	routeID := packet.RouteID()
 
-	r.logger.Infof("Received close packet for route ID %v", routeID)
+	r.logger.Debugf("Received close packet for route ID %v", routeID)
 
 	rule, err := r.GetRule(routeID)
 	if err != nil {
@@ -446,27 +629,32 @@ func (r *router) handleClosePacket(ctx context.Context, packet routing.Packet) e
 	}()
 
 	if t := rule.Type(); t == routing.RuleIntermediaryForward {
-		r.logger.Infoln("Handling intermediary close packet")
+		r.logger.Debugln("Handling intermediary close packet")
 		return r.forwardPacket(ctx, packet, rule)
 	}
 
 	desc := rule.RouteDescriptor()
 	rg, ok := r.routeGroup(desc)
 
-	r.logger.Infof("Handling close packet with descriptor %s", &desc)
+	r.logger.Debugf("Handling close packet with descriptor %s", &desc)
 
 	if !ok {
-		r.logger.Infof("Descriptor not found for rule with type %s, descriptor: %s", rule.Type(), &desc)
+		r.logger.Debugf("Descriptor not found for rule with type %s, descriptor: %s", rule.Type(), &desc)
 		return errors.New("route descriptor does not exist")
 	}
 
-	defer r.removeRouteGroup(desc)
-
 	if rg == nil {
+		r.removeRouteGroup(desc)
 		return errors.New("RouteGroup is nil")
 	}
 
-	r.logger.Infof("Got new remote close packet with size %d and route ID %d. Using rule: %s",
+	// close packets arrive via every reverse route of the group,
+	// the group is removed once the last one got closed
+	if rg.removeReverseRule(routeID) == 0 {
+		defer r.removeRouteGroup(desc)
+	}
+
+	r.logger.Debugf("Got new remote close packet with size %d and route ID %d. Using rule: %s",
 		len(packet.Payload()), packet.RouteID(), rule)
 
 	closeCode := routing.CloseCode(packet.Payload()[0])
@@ -486,7 +674,7 @@ func (r *router) handleClosePacket(ctx context.Context, packet routing.Packet) e
 func (r *router) handleKeepAlivePacket(ctx context.Context, packet routing.Packet) error {
 	routeID := packet.RouteID()
 
-	r.logger.Infof("Received keepalive packet for route ID %v", routeID)
+	r.logger.Debugf("Received keepalive packet for route ID %v", routeID)
 
 	rule, err := r.GetRule(routeID)
 	if err != nil {
@@ -503,11 +691,11 @@ func (r *router) handleKeepAlivePacket(ctx context.Context, packet routing.Packe
 	// propagate packet only for intermediary rule. forward rule workflow doesn't get here,
 	// consume rules should be omitted, activity is already updated
 	if t := rule.Type(); t == routing.RuleIntermediaryForward {
-		r.logger.Infoln("Handling intermediary keep-alive packet")
+		r.logger.Debugln("Handling intermediary keep-alive packet")
 		return r.forwardPacket(ctx, packet, rule)
 	}
 
-	r.logger.Infof("Route ID %v found, updated activity", routeID)
+	r.logger.Debugf("Route ID %v found, updated activity", routeID)
 
 	return nil
 }
@@ -564,6 +752,10 @@ func (r *router) Close() error {
 
 	r.wg.Wait()
 
+	if err := r.rt.Close(); err != nil {
+		r.logger.WithError(err).Warnf("closing routing table returned error")
+	}
+
 	return r.tm.Close()
 }
 
@@ -583,6 +775,51 @@ func (r *router) forwardPacket(ctx context.Context, packet routing.Packet, rule
 		if err != nil {
 			return err
 		}
+	case routing.SequencedDataPacket:
+		if len(packet.Payload()) < routing.PacketSequenceSize {
+			return errors.New("malformed sequenced data packet")
+		}
+
+		var err error
+
+		p, err = routing.MakeSequencedDataPacket(rule.NextRouteID(), packet.Sequence(), packet.SequencedPayload())
+		if err != nil {
+			return err
+		}
+	case routing.FragmentPacket:
+		if len(packet.Payload()) < routing.PacketFragmentHeaderSize {
+			return errMalformedFragment
+		}
+
+		index, count := packet.Fragment()
+
+		var err error
+
+		p, err = routing.MakeFragmentPacket(rule.NextRouteID(), packet.Sequence(), index, count, packet.FragmentPayload())
+		if err != nil {
+			return err
+		}
+	case routing.WindowUpdatePacket:
+		if len(packet.Payload()) < routing.PacketWindowUpdateSize {
+			return errors.New("malformed window update packet")
+		}
+
+		received, limit := packet.WindowUpdate()
+		p = routing.MakeWindowUpdatePacket(rule.NextRouteID(), received, limit)
+	case routing.ProbePacket:
+		if len(packet.Payload()) < routing.PacketProbeHeaderSize {
+			return errMalformedProbe
+		}
+
+		probeID, reply, hops := packet.Probe()
+		hops = append(hops, routing.ProbeHop{PK: r.conf.PubKey, Time: time.Now()})
+
+		var err error
+
+		p, err = routing.MakeProbePacket(rule.NextRouteID(), probeID, reply, hops)
+		if err != nil {
+			return err
+		}
 	case routing.KeepAlivePacket:
 		p = routing.MakeKeepAlivePacket(rule.NextRouteID())
 	case routing.ClosePacket:
@@ -591,6 +828,21 @@ func (r *router) forwardPacket(ctx context.Context, packet routing.Packet, rule
 		return fmt.Errorf("packet of type %s can't be forwarded", packet.Type())
 	}
 
+	if isDataPacket(packet.Type()) {
+		// data packets exceeding bandwidth limits are delayed
+		delay := r.limiter.reserve(rule, tp.Remote(), len(packet))
+
+		return r.shaper.forward(ctx, rule.KeyRouteID(), delay, func() error {
+			return r.writeForwarded(ctx, tp, p, rule)
+		})
+	}
+
+	return r.writeForwarded(ctx, tp, p, rule)
+}
+
+// writeForwarded writes the packet `p` forwarded by `rule` to `tp`.
+func (r *router) writeForwarded(ctx context.Context, tp *transport.ManagedTransport, p routing.Packet,
+	rule routing.Rule) error {
 	if err := tp.WritePacket(ctx, p); err != nil {
 		return err
 	}
@@ -600,7 +852,7 @@ func (r *router) forwardPacket(ctx context.Context, packet routing.Packet, rule
 		r.logger.Errorf("Failed to update activity for rule with route ID %d: %v", rule.KeyRouteID(), err)
 	}
 
-	r.logger.Infof("Forwarded packet via Transport %s using rule %d", rule.NextTransportID(), rule.KeyRouteID())
+	r.logger.Debugf("Forwarded packet via Transport %s using rule %d", rule.NextTransportID(), rule.KeyRouteID())
 
 	return nil
 }
@@ -621,10 +873,11 @@ func (r *router) RemoveRouteDescriptor(desc routing.RouteDescriptor) {
 	}
 }
 
-func (r *router) fetchBestRoutes(src, dst cipher.PubKey, opts *DialOptions) (fwd, rev routing.Path, err error) {
-	// TODO(nkryuchkov): use opts
+// fetchBestRoutes returns up to opts.MaxForwardRts forward and opts.MaxConsumeRts reverse paths.
+// It fails if the route finder returns less than opts.MinForwardRts/opts.MinConsumeRts paths.
+func (r *router) fetchBestRoutes(src, dst cipher.PubKey, opts *DialOptions) (fwd, rev []routing.Path, err error) {
 	if opts == nil {
-		opts = DefaultDialOptions() // nolint
+		opts = DefaultDialOptions()
 	}
 
 	r.logger.Infof("Requesting new routes from %s to %s", src, dst)
@@ -638,29 +891,103 @@ func (r *router) fetchBestRoutes(src, dst cipher.PubKey, opts *DialOptions) (fwd
 fetchRoutesAgain:
 	ctx := context.Background()
 
-	paths, err := r.conf.RouteFinder.FindRoutes(ctx, []routing.PathEdges{forward, backward},
+	paths, err := r.routeFinder().FindRoutes(ctx, []routing.PathEdges{forward, backward},
 		&rfclient.RouteOptions{MinHops: minHops, MaxHops: maxHops})
 
 	if err != nil {
+		// local route computation fails immediately, so retries are spaced out
 		select {
 		case <-timer.C:
 			return nil, nil, err
-		default:
+		case <-time.After(fetchRoutesRetryInterval):
 			goto fetchRoutesAgain
 		}
 	}
 
 	r.logger.Infof("Found routes Forward: %s. Reverse %s", paths[forward], paths[backward])
 
-	return paths[forward][0], paths[backward][0], nil
+	fwd, err = pickPaths(paths[forward], opts.MinForwardRts, opts.MaxForwardRts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("forward: %w", err)
+	}
+
+	rev, err = pickPaths(paths[backward], opts.MinConsumeRts, opts.MaxConsumeRts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reverse: %w", err)
+	}
+
+	return fwd, rev, nil
+}
+
+// pickPaths returns at most `max` of `paths`, failing if there are less than `min` (and at least 1) of them.
+func pickPaths(paths []routing.Path, min, max int) ([]routing.Path, error) {
+	if min < 1 {
+		min = 1
+	}
+
+	if max < min {
+		max = min
+	}
+
+	if len(paths) < min {
+		return nil, fmt.Errorf("%w: found %d, need %d", ErrNotEnoughRoutes, len(paths), min)
+	}
+
+	if len(paths) > max {
+		paths = paths[:max]
+	}
+
+	return paths, nil
 }
 
 // SetupIsTrusted checks if setup node is trusted.
 func (r *router) SetupIsTrusted(sPK cipher.PubKey) bool {
+	r.confMx.RLock()
+	defer r.confMx.RUnlock()
+
 	_, ok := r.trustedVisors[sPK]
 	return ok
 }
 
+// SetRouteFinder replaces the route finder client used for new routes.
+func (r *router) SetRouteFinder(rfc rfclient.Client) {
+	r.confMx.Lock()
+	r.conf.RouteFinder = rfc
+	r.rfc = rfc
+	r.confMx.Unlock()
+
+	r.logger.Info("Updated route finder client")
+}
+
+// SetSetupNodes replaces setup nodes used for new routes and trusted to introduce rules.
+func (r *router) SetSetupNodes(nodes []cipher.PubKey) {
+	trustedVisors := make(map[cipher.PubKey]struct{}, len(nodes))
+	for _, node := range nodes {
+		trustedVisors[node] = struct{}{}
+	}
+
+	r.confMx.Lock()
+	r.conf.SetupNodes = nodes
+	r.trustedVisors = trustedVisors
+	r.confMx.Unlock()
+
+	r.logger.Infof("Updated setup nodes: %v", nodes)
+}
+
+func (r *router) routeFinder() rfclient.Client {
+	r.confMx.RLock()
+	defer r.confMx.RUnlock()
+
+	return r.conf.RouteFinder
+}
+
+func (r *router) setupNodes() []cipher.PubKey {
+	r.confMx.RLock()
+	defer r.confMx.RUnlock()
+
+	return r.conf.SetupNodes
+}
+
 // Saves `rules` to the routing table.
 func (r *router) SaveRoutingRules(rules ...routing.Rule) error {
 	for _, rule := range rules {
@@ -693,7 +1020,7 @@ func (r *router) popRouteGroup(desc routing.RouteDescriptor) (*RouteGroup, bool)
 		return nil, false
 	}
 
-	delete(r.rgs, desc)
+	r.deleteRouteGroup(desc)
 
 	return rg, true
 }
@@ -711,10 +1038,25 @@ func (r *router) removeRouteGroup(desc routing.RouteDescriptor) {
 	r.mx.Lock()
 	defer r.mx.Unlock()
 
+	if _, ok := r.rgs[desc]; ok {
+		r.deleteRouteGroup(desc)
+	}
+}
+
+// deleteRouteGroup removes the route group of `desc`, which should be registered. It expects `r.mx` to be locked.
+func (r *router) deleteRouteGroup(desc routing.RouteDescriptor) {
 	delete(r.rgs, desc)
+
+	if r.conf.OnRouteGroupClosed != nil {
+		r.conf.OnRouteGroupClosed(desc)
+	}
 }
 
 func (r *router) IntroduceRules(rules routing.EdgeRules) error {
+	if rules.Additional {
+		return r.extendRouteGroup(rules)
+	}
+
 	select {
 	case <-r.done:
 		return io.ErrClosedPipe
@@ -731,6 +1073,78 @@ func (r *router) IntroduceRules(rules routing.EdgeRules) error {
 	}
 }
 
+// extendRouteGroup saves additional edge rules and adds them to the existing route group of the same descriptor.
+func (r *router) extendRouteGroup(rules routing.EdgeRules) error {
+	select {
+	case <-r.done:
+		return io.ErrClosedPipe
+	default:
+	}
+
+	rg, ok := r.routeGroup(rules.Desc)
+	if !ok || rg == nil || rg.isClosed() || rg.isRemoteClosed() {
+		return fmt.Errorf("no route group to add rules to: %s", &rules.Desc)
+	}
+
+	if err := r.SaveRoutingRules(rules.Forward, rules.Reverse); err != nil {
+		return err
+	}
+
+	rg.addRules(r.tm.Transport(rules.Forward.NextTransportID()), rules.Forward, rules.Reverse, rules.MTU)
+
+	r.logger.Infof("Added route to route group with desc: %s", &rules.Desc)
+
+	return nil
+}
+
+// TraceRoute sends a probe via the route group with the edge route of `routeID`.
+// If `routeID` is the key of a forward rule, the probe is sent via its route.
+func (r *router) TraceRoute(ctx context.Context, routeID routing.RouteID) ([]HopRTT, error) {
+	r.mx.Lock()
+	var (
+		rg   *RouteGroup
+		rule routing.Rule
+	)
+	for _, group := range r.rgs {
+		if group == nil {
+			continue
+		}
+
+		if groupRule, ok := group.rule(routeID); ok {
+			rg, rule = group, groupRule
+			break
+		}
+	}
+	r.mx.Unlock()
+
+	if rg == nil {
+		return nil, fmt.Errorf("%w: %d", ErrNoRouteGroup, routeID)
+	}
+
+	var fwd routing.Rule
+	if rule.Type() == routing.RuleForward {
+		fwd = rule
+	}
+
+	hops, rtt, err := rg.probe(ctx, fwd)
+	if err != nil {
+		return nil, err
+	}
+
+	return hopRTTs(rg.desc.SrcPK(), hops, rtt), nil
+}
+
+// BandwidthLimits returns the current limits of forwarded traffic.
+func (r *router) BandwidthLimits() BandwidthLimits {
+	return r.limiter.Limits()
+}
+
+// SetBandwidthLimits replaces limits of forwarded traffic.
+func (r *router) SetBandwidthLimits(limits BandwidthLimits) {
+	r.limiter.setLimits(limits)
+	r.logger.Infof("Updated bandwidth limits: %+v", limits)
+}
+
 // RoutesCount returns count of the routes stored within the routing table.
 func (r *router) RoutesCount() int {
 	return r.rt.Count()
@@ -816,12 +1230,25 @@ func (r *router) removeRouteGroupOfRule(rule routing.Rule) {
 	}
 
 	rDesc := rule.RouteDescriptor()
+
+	rg, ok := r.routeGroup(rDesc)
+	if !ok || rg == nil {
+		log.Debug("No route group associated with expired rule. Nothing to be done.")
+		return
+	}
+
+	// a group with several reverse routes only loses the route of the removed rule
+	if remaining := rg.removeReverseRule(rule.KeyRouteID()); remaining > 0 {
+		log.WithField("remaining_routes", remaining).
+			Debug("Removed reverse route from route group.")
+		return
+	}
+
 	log.WithField("rt_desc", rDesc.String()).
 		Debug("Closing route group associated with rule...")
 
-	rg, ok := r.popRouteGroup(rDesc)
-	if !ok {
-		log.Debug("No route group associated with expired rule. Nothing to be done.")
+	if _, ok := r.popRouteGroup(rDesc); !ok {
+		log.Debug("Route group already removed. Nothing to be done.")
 		return
 	}
 	if rg.isClosed() {
@@ -834,3 +1261,215 @@ func (r *router) removeRouteGroupOfRule(rule routing.Rule) {
 	}
 	log.Debug("Route group closed.")
 }
+
+func (r *router) routeRepairLoop() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-r.done
+		cancel()
+	}()
+
+	ticker := time.NewTicker(r.conf.RouteRepairInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			r.repairRouteGroups(ctx)
+		}
+	}
+}
+
+// repairBackoff delays the next attempt to repair a route after failed ones.
+type repairBackoff struct {
+	next  time.Time
+	delay time.Duration
+}
+
+// repairRouteGroups replaces broken forward routes of all route groups with fresh ones.
+// Attempts to repair a route are backed off exponentially while they fail.
+func (r *router) repairRouteGroups(ctx context.Context) {
+	r.mx.Lock()
+	rgs := make([]*RouteGroup, 0, len(r.rgs))
+	for _, rg := range r.rgs {
+		if rg != nil {
+			rgs = append(rgs, rg)
+		}
+	}
+	r.mx.Unlock()
+
+	if r.repairs == nil {
+		r.repairs = make(map[routing.RouteID]repairBackoff)
+	}
+
+	broken := make(map[routing.RouteID]struct{})
+	now := time.Now()
+
+	for _, rg := range rgs {
+		if rg.isClosed() || rg.isRemoteClosed() {
+			continue
+		}
+
+		for _, rule := range rg.brokenPaths() {
+			id := rule.KeyRouteID()
+			broken[id] = struct{}{}
+
+			backoff, ok := r.repairs[id]
+			if ok && now.Before(backoff.next) {
+				continue
+			}
+
+			log := r.logger.
+				WithField("func", "router.repairRouteGroups").
+				WithField("rt_desc", rg.desc.String()).
+				WithField("rule_keyRtID", id).
+				WithField("tp_id", rule.NextTransportID())
+
+			if err := r.repairRoute(ctx, rg, rule); err != nil {
+				backoff.delay *= 2
+				if backoff.delay == 0 {
+					backoff.delay = r.conf.RouteRepairInterval
+				}
+
+				if backoff.delay > maxRepairBackoff {
+					backoff.delay = maxRepairBackoff
+				}
+
+				backoff.next = now.Add(backoff.delay)
+				r.repairs[id] = backoff
+
+				log.WithError(err).Warnf("Failed to repair route, retrying in %s.", backoff.delay)
+
+				continue
+			}
+
+			delete(r.repairs, id)
+			log.Info("Repaired route.")
+		}
+	}
+
+	for id := range r.repairs {
+		if _, ok := broken[id]; !ok {
+			delete(r.repairs, id)
+		}
+	}
+}
+
+// repairRoute sets up a new route for the descriptor of `rg` which avoids the transport of `broken`
+// and atomically swaps it with the `broken` forward rule. The remote edge adds the new route to its route group.
+func (r *router) repairRoute(ctx context.Context, rg *RouteGroup, broken routing.Rule) error {
+	desc := rg.desc.Invert()
+	brokenTpID := broken.NextTransportID()
+
+	opts := &DialOptions{
+		MinForwardRts: 1,
+		MaxForwardRts: repairCandidates,
+		MinConsumeRts: 1,
+		MaxConsumeRts: repairCandidates,
+	}
+
+	forwardPaths, reversePaths, err := r.fetchBestRoutes(desc.SrcPK(), desc.DstPK(), opts)
+	if err != nil {
+		return fmt.Errorf("route finder: %s", err)
+	}
+
+	forwardPath, ok := r.pickRepairPath(forwardPaths, brokenTpID, true)
+	if !ok {
+		return errors.New("no alternative forward route")
+	}
+
+	reversePath, ok := r.pickRepairPath(reversePaths, brokenTpID, false)
+	if !ok {
+		reversePath = reversePaths[0]
+	}
+
+	req := routing.BidirectionalRoute{
+		Desc:       desc,
+		KeepAlive:  DefaultRouteKeepAlive,
+		Forward:    forwardPath,
+		Reverse:    reversePath,
+		Additional: true,
+		ForwardMTU: r.pathMTU(ctx, forwardPath),
+		ReverseMTU: r.pathMTU(ctx, reversePath),
+	}
+
+	rules, err := r.conf.RouteGroupDialer.Dial(ctx, r.logger, r.n, r.setupNodes(), req)
+	if err != nil {
+		return fmt.Errorf("route setup: %s", err)
+	}
+
+	if err := r.SaveRoutingRules(rules.Forward, rules.Reverse); err != nil {
+		return err
+	}
+
+	tp := r.tm.Transport(rules.Forward.NextTransportID())
+	if !rg.replacePath(broken.KeyRouteID(), tp, rules.Forward, rules.Reverse, rules.MTU) {
+		// the broken route is gone already, keep the new one as an additional route
+		rg.addRules(tp, rules.Forward, rules.Reverse, rules.MTU)
+		return nil
+	}
+
+	r.rt.DelRules([]routing.RouteID{broken.KeyRouteID()})
+
+	return nil
+}
+
+// pathMTU returns the largest packet payload which fits into every transport of `path`.
+// Types of transports of remote hops are looked up in the transport discovery,
+// transports of unknown types are assumed to have the default MTU.
+func (r *router) pathMTU(ctx context.Context, path routing.Path) uint16 {
+	if len(path) == 0 {
+		return 0
+	}
+
+	mtu := math.MaxUint16
+
+	for _, hop := range path {
+		tpMTU := snet.DefaultMTU
+
+		if tp := r.tm.Transport(hop.TpID); tp != nil {
+			tpMTU = snet.MTU(tp.Entry.Type)
+		} else if dc := r.tm.Conf.DiscoveryClient; dc != nil {
+			if entry, err := dc.GetTransportByID(ctx, hop.TpID); err == nil {
+				tpMTU = snet.MTU(entry.Entry.Type)
+			}
+		}
+
+		if tpMTU-routing.PacketHeaderSize < mtu {
+			mtu = tpMTU - routing.PacketHeaderSize
+		}
+	}
+
+	return uint16(mtu)
+}
+
+// pickRepairPath returns the first path which doesn't use the transport of ID `avoid`.
+// If `local` is set, the transport of the first hop should also be up.
+func (r *router) pickRepairPath(paths []routing.Path, avoid uuid.UUID, local bool) (routing.Path, bool) {
+nextPath:
+	for _, path := range paths {
+		if len(path) == 0 {
+			continue
+		}
+
+		for _, hop := range path {
+			if hop.TpID == avoid {
+				continue nextPath
+			}
+		}
+
+		if local {
+			if tp := r.tm.Transport(path[0].TpID); tp == nil || !tp.IsUp() {
+				continue
+			}
+		}
+
+		return path, true
+	}
+
+	return nil, false
+}
@@ -98,6 +98,13 @@ func Test_router_DialRoutes(t *testing.T) {
 
 	require.NoError(t, err)
 	require.NotNil(t, rg)
+
+	// mock dialer never agrees to encryption, so it must not be downgraded silently
+	opts := DefaultDialOptions()
+	opts.RequireEncryption = true
+
+	_, err = r0.DialRoutes(context.Background(), r0.conf.PubKey, 0, 0, opts)
+	require.Equal(t, ErrNotEncrypted, err)
 }
 
 func Test_router_Introduce_AcceptRoutes(t *testing.T) {
@@ -242,6 +249,14 @@ func testHandlePackets(t *testing.T, r0, r1 *router, tp1 *transport.ManagedTrans
 	})
 	wg.Wait()
 
+	wg.Add(1)
+	t.Run("handlePacket_probe", func(t *testing.T) {
+		defer wg.Done()
+
+		testProbePacket(t, r0, r1, tp1)
+	})
+	wg.Wait()
+
 	wg.Add(1)
 	t.Run("handlePacket_cnsmRule", func(t *testing.T) {
 		defer wg.Done()
@@ -334,7 +349,7 @@ func testClosePacketRemote(t *testing.T, r0, r1 *router, pk1, pk2 cipher.PubKey,
 		Desc:    fwdRtDesc.Invert(),
 		Forward: fwdRule,
 		Reverse: cnsmRule,
-	})
+	}, nil)
 
 	packet := routing.MakeClosePacket(intFwdID[0], routing.CloseRequested)
 	err = r0.handleTransportPacket(context.TODO(), packet)
@@ -389,7 +404,7 @@ func testClosePacketInitiator(t *testing.T, r0, r1 *router, pk1, pk2 cipher.PubK
 		Desc:    fwdRtDesc.Invert(),
 		Forward: fwdRule,
 		Reverse: cnsmRule,
-	})
+	}, nil)
 
 	packet := routing.MakeClosePacket(intFwdID[0], routing.CloseRequested)
 	err = r0.handleTransportPacket(context.TODO(), packet)
@@ -430,7 +445,7 @@ func testForwardRule(t *testing.T, r0, r1 *router, tp1 *transport.ManagedTranspo
 	fwdRule := routing.ForwardRule(ruleKeepAlive, fwdRtID[0], routeID, tp1.Entry.ID, pk1, pk2, 0, 0)
 	err = r0.rt.SaveRule(fwdRule)
 	require.NoError(t, err)
-	r0.saveRouteGroupRules(routing.EdgeRules{Desc: fwdRule.RouteDescriptor(), Forward: fwdRule, Reverse: nil})
+	r0.saveRouteGroupRules(routing.EdgeRules{Desc: fwdRule.RouteDescriptor(), Forward: fwdRule, Reverse: nil}, nil)
 
 	// Call handleTransportPacket for r0 (this should in turn, use the rule we added).
 	packet, err := routing.MakeDataPacket(fwdRtID[0], []byte("This is a test!"))
@@ -472,6 +487,36 @@ func testIntermediaryForwardRule(t *testing.T, r0, r1 *router, tp1 *transport.Ma
 	assert.Equal(t, routing.RouteID(5), recvPacket.RouteID())
 }
 
+func testProbePacket(t *testing.T, r0, r1 *router, tp1 *transport.ManagedTransport) {
+	defer clearRouterRules(r0, r1)
+	defer clearRouteGroups(r0, r1)
+
+	fwdRtID, err := r0.ReserveKeys(1)
+	require.NoError(t, err)
+
+	fwdRule := routing.IntermediaryForwardRule(ruleKeepAlive, fwdRtID[0], routing.RouteID(5), tp1.Entry.ID)
+	require.NoError(t, r0.rt.SaveRule(fwdRule))
+
+	packet, err := routing.MakeProbePacket(fwdRtID[0], 3, false, nil)
+	require.NoError(t, err)
+
+	before := time.Now()
+	require.NoError(t, r0.handleTransportPacket(context.TODO(), packet))
+
+	// r0 appends its hop record while forwarding the probe
+	recvPacket, err := r1.tm.ReadPacket()
+	require.NoError(t, err)
+	assert.Equal(t, routing.ProbePacket, recvPacket.Type())
+	assert.Equal(t, routing.RouteID(5), recvPacket.RouteID())
+
+	probeID, reply, hops := recvPacket.Probe()
+	assert.Equal(t, uint32(3), probeID)
+	assert.False(t, reply)
+	require.Len(t, hops, 1)
+	assert.Equal(t, r0.conf.PubKey, hops[0].PK)
+	assert.False(t, hops[0].Time.Before(before))
+}
+
 func testConsumeRule(t *testing.T, r0, r1 *router, tp1 *transport.ManagedTransport, pk1, pk2 cipher.PubKey) {
 	defer clearRouterRules(r0, r1)
 	defer clearRouteGroups(r0, r1)
@@ -503,7 +548,7 @@ func testConsumeRule(t *testing.T, r0, r1 *router, tp1 *transport.ManagedTranspo
 		Desc:    fwdRtDesc.Invert(),
 		Forward: fwdRule,
 		Reverse: cnsmRule,
-	})
+	}, nil)
 
 	packet, err := routing.MakeDataPacket(intFwdRtID[0], []byte("test intermediary forward"))
 	require.NoError(t, err)
@@ -526,8 +571,8 @@ func testConsumeRule(t *testing.T, r0, r1 *router, tp1 *transport.ManagedTranspo
 	require.True(t, ok)
 	require.NotNil(t, rg)
 
-	data := <-rg.readCh
-	require.Equal(t, consumeMsg, data)
+	chunk := <-rg.readCh
+	require.Equal(t, consumeMsg, chunk.data)
 }
 
 func clearRouteGroups(routers ...*router) {
@@ -575,6 +620,57 @@ func TestRouter_Rules(t *testing.T) {
 	t.Run("RemoveRouteDescriptor", func(t *testing.T) {
 		testRemoveRouteDescriptor(t, r, rt)
 	})
+
+	// TEST: Ensure route group with several reverse routes survives removal of one of them.
+	t.Run("RemoveRouteGroupOfRule", func(t *testing.T) {
+		testRemoveRouteGroupOfRule(t, r, rt)
+	})
+}
+
+func testRemoveRouteGroupOfRule(t *testing.T, r *router, rt routing.Table) {
+	clearRoutingTableRules(rt)
+	defer clearRouteGroups(r)
+
+	localPK, _ := cipher.GenerateKeyPair()
+	remotePK, _ := cipher.GenerateKeyPair()
+
+	ids, err := r.rt.ReserveKeys(4)
+	require.NoError(t, err)
+
+	fwd1 := routing.ForwardRule(10*time.Minute, ids[0], 10, uuid.UUID{}, remotePK, localPK, 3, 2)
+	cnsm1 := routing.ConsumeRule(10*time.Minute, ids[1], localPK, remotePK, 2, 3)
+	fwd2 := routing.ForwardRule(10*time.Minute, ids[2], 11, uuid.UUID{}, remotePK, localPK, 3, 2)
+	cnsm2 := routing.ConsumeRule(10*time.Minute, ids[3], localPK, remotePK, 2, 3)
+
+	desc := cnsm1.RouteDescriptor()
+
+	var opened, closed []routing.RouteDescriptor
+	r.conf.OnRouteGroupOpened = func(desc routing.RouteDescriptor) { opened = append(opened, desc) }
+	r.conf.OnRouteGroupClosed = func(desc routing.RouteDescriptor) { closed = append(closed, desc) }
+
+	defer func() {
+		r.conf.OnRouteGroupOpened = nil
+		r.conf.OnRouteGroupClosed = nil
+	}()
+
+	rg := r.saveRouteGroupRules(routing.EdgeRules{Desc: desc, Forward: fwd1, Reverse: cnsm1}, nil)
+	rg.addRules(nil, fwd2, cnsm2, 0)
+	require.Equal(t, []routing.RouteDescriptor{desc}, opened)
+
+	r.removeRouteGroupOfRule(cnsm1)
+
+	_, ok := r.routeGroup(desc)
+	require.True(t, ok)
+	require.False(t, rg.isClosed())
+	require.Equal(t, []routing.Rule{cnsm2}, rg.rvs)
+	require.Empty(t, closed)
+
+	r.removeRouteGroupOfRule(cnsm2)
+
+	_, ok = r.routeGroup(desc)
+	require.False(t, ok)
+	require.True(t, rg.isClosed())
+	require.Equal(t, []routing.RouteDescriptor{desc}, closed)
 }
 
 func testRemoveRouteDescriptor(t *testing.T, r *router, rt routing.Table) {
@@ -727,3 +823,124 @@ func (e *TestEnv) GenRouterConfig(i int) *Config {
 func (e *TestEnv) Teardown() {
 	e.teardown()
 }
+
+type repairRouteFinder struct {
+	tpID  uuid.UUID
+	calls int
+}
+
+func (rf *repairRouteFinder) FindRoutes(_ context.Context, edges []routing.PathEdges,
+	_ *rfclient.RouteOptions) (map[routing.PathEdges][]routing.Path, error) {
+	rf.calls++
+
+	paths := make(map[routing.PathEdges][]routing.Path, len(edges))
+	for _, e := range edges {
+		paths[e] = []routing.Path{{{TpID: rf.tpID, From: e[0], To: e[1]}}}
+	}
+
+	return paths, nil
+}
+
+type repairDialer struct {
+	rt  routing.Table
+	req routing.BidirectionalRoute
+}
+
+func (d *repairDialer) Dial(_ context.Context, _ *logging.Logger, _ *snet.Network, _ []cipher.PubKey,
+	req routing.BidirectionalRoute) (routing.EdgeRules, error) {
+	d.req = req
+
+	ids, err := d.rt.ReserveKeys(2)
+	if err != nil {
+		return routing.EdgeRules{}, err
+	}
+
+	desc := req.Desc
+
+	return routing.EdgeRules{
+		Desc: desc,
+		Forward: routing.ForwardRule(req.KeepAlive, ids[0], 100, req.Forward[0].TpID,
+			desc.DstPK(), desc.SrcPK(), desc.DstPort(), desc.SrcPort()),
+		Reverse: routing.ConsumeRule(req.KeepAlive, ids[1], desc.SrcPK(), desc.DstPK(), desc.SrcPort(), desc.DstPort()),
+		MTU:     req.ForwardMTU,
+	}, nil
+}
+
+func TestRouter_repairRouteGroups(t *testing.T) {
+	rg1, _, m1, _, teardown := setupEnv(t)
+	defer teardown()
+
+	tp := rg1.tps[0]
+
+	// add a path over a transport which is gone
+	ids, err := rg1.rt.ReserveKeys(1)
+	require.NoError(t, err)
+
+	desc := rg1.fwd[0].RouteDescriptor()
+	broken := routing.ForwardRule(ruleKeepAlive, ids[0], 200, uuid.New(),
+		desc.DstPK(), desc.SrcPK(), desc.DstPort(), desc.SrcPort())
+	require.NoError(t, rg1.rt.SaveRule(broken))
+
+	rg1.fwd = append(rg1.fwd, broken)
+	rg1.tps = append(rg1.tps, nil)
+	require.Equal(t, []routing.Rule{broken}, rg1.brokenPaths())
+
+	rf := &repairRouteFinder{tpID: broken.NextTransportID()}
+	dialer := &repairDialer{rt: rg1.rt}
+
+	r := &router{
+		conf: &Config{
+			RouteFinder:         rf,
+			RouteGroupDialer:    dialer,
+			RouteRepairInterval: time.Second,
+		},
+		logger: logging.MustGetLogger("router"),
+		tm:     m1,
+		rt:     rg1.rt,
+		rgs:    map[routing.RouteDescriptor]*RouteGroup{rg1.desc: rg1},
+	}
+
+	// only routes over the broken transport are known, repairs are backed off
+	r.repairRouteGroups(context.Background())
+	require.Equal(t, 1, rf.calls)
+	require.Equal(t, time.Second, r.repairs[broken.KeyRouteID()].delay)
+
+	r.repairRouteGroups(context.Background())
+	require.Equal(t, 1, rf.calls)
+
+	backoff := r.repairs[broken.KeyRouteID()]
+	backoff.next = time.Now()
+	r.repairs[broken.KeyRouteID()] = backoff
+
+	r.repairRouteGroups(context.Background())
+	require.Equal(t, 2, rf.calls)
+	require.Equal(t, 2*time.Second, r.repairs[broken.KeyRouteID()].delay)
+
+	// a route over a transport which is up replaces the broken one
+	rf.tpID = tp.Entry.ID
+	backoff = r.repairs[broken.KeyRouteID()]
+	backoff.next = time.Now()
+	r.repairs[broken.KeyRouteID()] = backoff
+
+	r.repairRouteGroups(context.Background())
+	require.Equal(t, 3, rf.calls)
+	require.Empty(t, r.repairs)
+
+	require.True(t, dialer.req.Additional)
+	require.Equal(t, desc, dialer.req.Desc)
+
+	rg1.mu.Lock()
+	require.Len(t, rg1.fwd, 2)
+	require.Equal(t, tp.Entry.ID, rg1.fwd[1].NextTransportID())
+	require.Equal(t, tp, rg1.tps[1])
+	require.Len(t, rg1.rvs, 1)
+	rg1.mu.Unlock()
+
+	require.Empty(t, rg1.brokenPaths())
+
+	_, err = rg1.rt.Rule(broken.KeyRouteID())
+	require.Error(t, err)
+
+	_, err = rg1.Write([]byte("repaired"))
+	require.NoError(t, err)
+}
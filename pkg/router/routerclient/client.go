@@ -2,7 +2,9 @@ package routerclient
 
 import (
 	"context"
+	"errors"
 	"net/rpc"
+	"strings"
 
 	"github.com/SkycoinProject/dmsg/cipher"
 
@@ -52,6 +54,23 @@ func (c *Client) AddEdgeRules(ctx context.Context, rules routing.EdgeRules) (boo
 	return ok, err
 }
 
+// AddEncryptedEdgeRules adds edge rules of a route group which should be encrypted end-to-end.
+// It returns whether the remote router agreed to encrypt the route group. Routers which don't
+// support end-to-end encryption get plain edge rules instead.
+func (c *Client) AddEncryptedEdgeRules(ctx context.Context, rules routing.EdgeRules) (bool, error) {
+	var encrypted bool
+
+	rules.Encrypt = true
+	err := c.call(ctx, rpcName+".AddEncryptedEdgeRules", rules, &encrypted)
+
+	if isUnknownMethod(err) {
+		rules.Encrypt = false
+		_, err = c.AddEdgeRules(ctx, rules)
+	}
+
+	return encrypted, err
+}
+
 // AddIntermediaryRules adds intermediary rules to router.
 func (c *Client) AddIntermediaryRules(ctx context.Context, rules []routing.Rule) (bool, error) {
 	var ok bool
@@ -68,6 +87,13 @@ func (c *Client) ReserveIDs(ctx context.Context, n uint8) ([]routing.RouteID, er
 	return routeIDs, err
 }
 
+// isUnknownMethod checks whether `err` is returned by a remote which doesn't implement the called method.
+func isUnknownMethod(err error) bool {
+	var serverErr rpc.ServerError
+
+	return errors.As(err, &serverErr) && strings.HasPrefix(serverErr.Error(), "rpc: can't find method")
+}
+
 func (c *Client) call(ctx context.Context, serviceMethod string, args interface{}, reply interface{}) error {
 	call := c.rpc.Go(serviceMethod, args, reply, nil)
 
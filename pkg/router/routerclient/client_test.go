@@ -55,6 +55,78 @@ func TestClient_AddEdgeRules(t *testing.T) {
 	require.True(t, ok)
 }
 
+// legacyGateway is a router RPC gateway of visors which don't support end-to-end encryption.
+type legacyGateway struct {
+	router router.Router
+}
+
+func (g *legacyGateway) AddEdgeRules(rules routing.EdgeRules, ok *bool) error {
+	*ok = g.router.IntroduceRules(rules) == nil
+	return nil
+}
+
+func TestClient_AddEncryptedEdgeRules(t *testing.T) {
+	srcPK, _ := cipher.GenerateKeyPair()
+	dstPK, _ := cipher.GenerateKeyPair()
+
+	var srcPort, dstPort routing.Port = 100, 110
+
+	desc := routing.NewRouteDescriptor(srcPK, dstPK, srcPort, dstPort)
+
+	rules := routing.EdgeRules{
+		Desc:    desc,
+		Forward: routing.Rule{0, 0, 0},
+		Reverse: routing.Rule{1, 1, 1},
+	}
+
+	encryptedRules := rules
+	encryptedRules.Encrypt = true
+
+	t.Run("ok", func(t *testing.T) {
+		r := &router.MockRouter{}
+		r.On("IntroduceRules", encryptedRules).Return(testhelpers.NoErr)
+
+		_, cl, cleanup := prepRPCServerAndClient(t, r)
+		defer cleanup()
+
+		encrypted, err := cl.AddEncryptedEdgeRules(context.Background(), rules)
+		require.NoError(t, err)
+		require.True(t, encrypted)
+		r.AssertExpectations(t)
+	})
+
+	t.Run("remote without encryption support", func(t *testing.T) {
+		r := &router.MockRouter{}
+		r.On("IntroduceRules", rules).Return(testhelpers.NoErr)
+
+		l, err := nettest.NewLocalListener("tcp")
+		require.NoError(t, err)
+
+		defer func() {
+			require.NoError(t, l.Close())
+		}()
+
+		s := rpc.NewServer()
+		require.NoError(t, s.RegisterName("RPCGateway", &legacyGateway{router: r}))
+
+		go s.Accept(l)
+
+		conn, err := net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+
+		cl := &Client{rpc: rpc.NewClient(conn)}
+
+		defer func() {
+			require.NoError(t, cl.Close())
+		}()
+
+		encrypted, err := cl.AddEncryptedEdgeRules(context.Background(), rules)
+		require.NoError(t, err)
+		require.False(t, encrypted)
+		r.AssertExpectations(t)
+	})
+}
+
 func TestClient_AddIntermediaryRules(t *testing.T) {
 	rule1 := routing.Rule{0, 0, 0}
 	rule2 := routing.Rule{1, 1, 1}
@@ -62,6 +62,33 @@ func AddEdgeRules(
 	return ok, nil
 }
 
+// AddEncryptedEdgeRules is a wrapper for (*Client).AddEncryptedEdgeRules.
+func AddEncryptedEdgeRules(
+	ctx context.Context,
+	log *logging.Logger,
+	dmsgC *dmsg.Client,
+	pk cipher.PubKey,
+	rules routing.EdgeRules,
+) (bool, error) {
+	client, err := NewClient(ctx, wrapDmsgC(dmsgC), pk)
+	if err != nil {
+		return false, fmt.Errorf("failed to dial remote: %v", err)
+	}
+
+	defer closeClient(log, client)
+
+	encrypted, err := client.AddEncryptedEdgeRules(ctx, rules)
+	if err != nil {
+		return false, fmt.Errorf("failed to add rules: %v", err)
+	}
+
+	if !encrypted {
+		log.Warnf("Remote %s did not agree to encrypt route group %s end-to-end", pk, &rules.Desc)
+	}
+
+	return encrypted, nil
+}
+
 // AddIntermediaryRules is a wrapper for (*Client).AddIntermediaryRules.
 func AddIntermediaryRules(
 	ctx context.Context,
@@ -8,15 +8,17 @@ import (
 
 // RPCGateway is a RPC interface for router.
 type RPCGateway struct {
-	logger *logging.Logger
-	router Router
+	logger  *logging.Logger
+	router  Router
+	encrypt bool // whether end-to-end encryption of route groups is agreed to
 }
 
 // NewRPCGateway creates a new RPCGateway.
 func NewRPCGateway(router Router) *RPCGateway {
 	return &RPCGateway{
-		logger: logging.MustGetLogger("router-gateway"),
-		router: router,
+		logger:  logging.MustGetLogger("router-gateway"),
+		router:  router,
+		encrypt: true,
 	}
 }
 
@@ -35,6 +37,24 @@ func (r *RPCGateway) AddEdgeRules(rules routing.EdgeRules, ok *bool) error {
 	return nil
 }
 
+// AddEncryptedEdgeRules adds edge rules of a route group which the initiating edge wants to encrypt end-to-end.
+// `encrypted` is set if the router agreed to encrypt the route group.
+func (r *RPCGateway) AddEncryptedEdgeRules(rules routing.EdgeRules, encrypted *bool) error {
+	rules.Encrypt = r.encrypt
+
+	if err := r.router.IntroduceRules(rules); err != nil {
+		*encrypted = false
+
+		r.logger.WithError(err).Warnf("Request completed with error.")
+
+		return routing.Failure{Code: routing.FailureAddRules, Msg: err.Error()}
+	}
+
+	*encrypted = rules.Encrypt
+
+	return nil
+}
+
 // AddIntermediaryRules adds intermediary rules.
 func (r *RPCGateway) AddIntermediaryRules(rules []routing.Rule, ok *bool) error {
 	if err := r.router.SaveRoutingRules(rules...); err != nil {
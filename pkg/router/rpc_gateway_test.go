@@ -73,6 +73,50 @@ func TestRPCGateway_AddEdgeRules(t *testing.T) {
 	})
 }
 
+func TestRPCGateway_AddEncryptedEdgeRules(t *testing.T) {
+	srcPK, _ := cipher.GenerateKeyPair()
+	dstPK, _ := cipher.GenerateKeyPair()
+
+	var srcPort, dstPort routing.Port = 100, 110
+
+	desc := routing.NewRouteDescriptor(srcPK, dstPK, srcPort, dstPort)
+
+	rules := routing.EdgeRules{
+		Desc:    desc,
+		Forward: routing.Rule{0, 0, 0},
+		Reverse: routing.Rule{1, 1, 1},
+		Encrypt: true,
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		r := &MockRouter{}
+		r.On("IntroduceRules", rules).Return(testhelpers.NoErr)
+
+		gateway := NewRPCGateway(r)
+
+		var encrypted bool
+		err := gateway.AddEncryptedEdgeRules(rules, &encrypted)
+		require.NoError(t, err)
+		require.True(t, encrypted)
+	})
+
+	t.Run("encryption disabled", func(t *testing.T) {
+		plainRules := rules
+		plainRules.Encrypt = false
+
+		r := &MockRouter{}
+		r.On("IntroduceRules", plainRules).Return(testhelpers.NoErr)
+
+		gateway := NewRPCGateway(r)
+		gateway.encrypt = false
+
+		var encrypted bool
+		err := gateway.AddEncryptedEdgeRules(rules, &encrypted)
+		require.NoError(t, err)
+		require.False(t, encrypted)
+	})
+}
+
 func TestRPCGateway_AddIntermediaryRules(t *testing.T) {
 	rule1 := routing.Rule{0, 0, 0}
 	rule2 := routing.Rule{1, 1, 1}
@@ -0,0 +1,299 @@
+package routing
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"go.etcd.io/bbolt"
+)
+
+// boltOpenTimeout bounds waiting for the database lock held by another process.
+const boltOpenTimeout = 5 * time.Second
+
+var (
+	boltRulesBucket    = []byte("rules")
+	boltActivityBucket = []byte("activity")
+	boltMetaBucket     = []byte("meta")
+	boltNextIDKey      = []byte("next_id")
+)
+
+// boltTable is a routing table which serves rules from memory and persists them in a bbolt database,
+// so that they survive visor restarts.
+// Only intermediary forward rules (with their activity timestamps) are persisted, as edge rules
+// are useless without route groups of the previous visor run. The last reserved RouteID is persisted
+// as well, so that RouteIDs of restored rules are never handed out again.
+// Activity timestamps are flushed to disk on garbage collection rather than on every packet.
+// The database is kept open until the table is closed.
+type boltTable struct {
+	*memTable
+	db  *bbolt.DB
+	log *logging.Logger
+
+	dirtyMu sync.Mutex
+	dirty   map[RouteID]struct{} // rules with activity not yet flushed to disk
+}
+
+// NewBoltTable returns a routing table persisted in a bbolt database at `path`.
+// Rules stored by a previous run are restored, timed out ones are removed on the first garbage collection.
+func NewBoltTable(path string) (Table, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+
+	bt := &boltTable{
+		memTable: NewTable().(*memTable),
+		db:       db,
+		log:      logging.MustGetLogger("routing_table"),
+		dirty:    make(map[RouteID]struct{}),
+	}
+
+	err = bt.update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{boltRulesBucket, boltActivityBucket, boltMetaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return fmt.Errorf("failed to create bucket: %s", err)
+			}
+		}
+
+		return bt.restore(tx)
+	})
+	if err != nil {
+		if closeErr := db.Close(); closeErr != nil {
+			bt.log.WithError(closeErr).Warn("Failed to close routing table database.")
+		}
+
+		return nil, err
+	}
+
+	return bt, nil
+}
+
+// restore loads persisted state into memory.
+func (bt *boltTable) restore(tx *bbolt.Tx) error {
+	if v := tx.Bucket(boltMetaBucket).Get(boltNextIDKey); len(v) == 4 {
+		bt.nextID = RouteID(binary.BigEndian.Uint32(v))
+	}
+
+	activity := tx.Bucket(boltActivityBucket)
+
+	return tx.Bucket(boltRulesBucket).ForEach(func(k, v []byte) error {
+		if len(k) != 4 || len(v) < RuleHeaderSize {
+			return nil
+		}
+
+		key := RouteID(binary.BigEndian.Uint32(k))
+
+		rule := make(Rule, len(v))
+		copy(rule, v)
+
+		var lastActivity time.Time
+		if ts := activity.Get(k); len(ts) == 8 {
+			lastActivity = time.Unix(0, int64(binary.BigEndian.Uint64(ts)))
+		}
+
+		bt.addRule(key, rule, lastActivity)
+
+		if key > bt.nextID {
+			bt.nextID = key
+		}
+
+		return nil
+	})
+}
+
+func (bt *boltTable) ReserveKeys(n int) ([]RouteID, error) {
+	ids, err := bt.memTable.ReserveKeys(n)
+	if err != nil {
+		return nil, err
+	}
+
+	bt.memTable.RLock()
+	nextID := bt.nextID
+	bt.memTable.RUnlock()
+
+	err = bt.update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltMetaBucket).Put(boltNextIDKey, routeIDKey(nextID))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (bt *boltTable) SaveRule(rule Rule) error {
+	if err := bt.memTable.SaveRule(rule); err != nil {
+		return err
+	}
+
+	if rule.Type() != RuleIntermediaryForward {
+		return nil
+	}
+
+	key := routeIDKey(rule.KeyRouteID())
+
+	return bt.update(func(tx *bbolt.Tx) error {
+		if err := tx.Bucket(boltRulesBucket).Put(key, rule); err != nil {
+			return err
+		}
+
+		return tx.Bucket(boltActivityBucket).Put(key, timestampValue(time.Now()))
+	})
+}
+
+func (bt *boltTable) Rule(key RouteID) (Rule, error) {
+	rule, err := bt.memTable.Rule(key)
+	if err == nil && rule.Type() == RuleConsume {
+		bt.markDirty(key)
+	}
+
+	return rule, err
+}
+
+func (bt *boltTable) UpdateActivity(key RouteID) error {
+	if err := bt.memTable.UpdateActivity(key); err != nil {
+		return err
+	}
+
+	bt.markDirty(key)
+
+	return nil
+}
+
+func (bt *boltTable) DelRules(keys []RouteID) {
+	bt.memTable.DelRules(keys)
+
+	err := bt.update(func(tx *bbolt.Tx) error {
+		return deleteBoltRules(tx, keys)
+	})
+	if err != nil {
+		bt.log.WithError(err).Warn("Failed to delete persisted rules.")
+	}
+}
+
+// CollectGarbage removes timed out rules and flushes activity timestamps to disk.
+func (bt *boltTable) CollectGarbage() []Rule {
+	removed := bt.memTable.CollectGarbage()
+
+	keys := make([]RouteID, 0, len(removed))
+	for _, rule := range removed {
+		keys = append(keys, rule.KeyRouteID())
+	}
+
+	if err := bt.persist(keys); err != nil {
+		bt.log.WithError(err).Warn("Failed to persist routing table.")
+	}
+
+	return removed
+}
+
+// persist deletes rules with `keys` from disk and flushes activity timestamps of dirty rules.
+func (bt *boltTable) persist(keys []RouteID) error {
+	activity := bt.dirtyActivity()
+
+	return bt.update(func(tx *bbolt.Tx) error {
+		if err := deleteBoltRules(tx, keys); err != nil {
+			return err
+		}
+
+		rules := tx.Bucket(boltRulesBucket)
+		b := tx.Bucket(boltActivityBucket)
+
+		for key, ts := range activity {
+			k := routeIDKey(key)
+
+			// activity is only stored for persisted rules
+			if rules.Get(k) == nil {
+				continue
+			}
+
+			if err := b.Put(k, timestampValue(ts)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (bt *boltTable) markDirty(key RouteID) {
+	bt.dirtyMu.Lock()
+	bt.dirty[key] = struct{}{}
+	bt.dirtyMu.Unlock()
+}
+
+// dirtyActivity returns activity timestamps of rules marked as dirty and resets the marks.
+func (bt *boltTable) dirtyActivity() map[RouteID]time.Time {
+	bt.dirtyMu.Lock()
+	dirty := bt.dirty
+	bt.dirty = make(map[RouteID]struct{})
+	bt.dirtyMu.Unlock()
+
+	bt.memTable.RLock()
+	defer bt.memTable.RUnlock()
+
+	activity := make(map[RouteID]time.Time, len(dirty))
+	for key := range dirty {
+		if ts, ok := bt.activity[key]; ok {
+			activity[key] = ts
+		}
+	}
+
+	return activity
+}
+
+// Close flushes activity timestamps to disk and closes the database.
+func (bt *boltTable) Close() error {
+	if err := bt.persist(nil); err != nil {
+		bt.log.WithError(err).Warn("Failed to persist routing table.")
+	}
+
+	return bt.db.Close()
+}
+
+// update runs `fn` within a read-write transaction.
+func (bt *boltTable) update(fn func(tx *bbolt.Tx) error) error {
+	return bt.db.Update(fn)
+}
+
+func deleteBoltRules(tx *bbolt.Tx, keys []RouteID) error {
+	rules := tx.Bucket(boltRulesBucket)
+	activity := tx.Bucket(boltActivityBucket)
+
+	for _, key := range keys {
+		k := routeIDKey(key)
+
+		if err := rules.Delete(k); err != nil {
+			return err
+		}
+
+		if err := activity.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func routeIDKey(id RouteID) []byte {
+	k := make([]byte, 4)
+	binary.BigEndian.PutUint32(k, uint32(id))
+
+	return k
+}
+
+func timestampValue(t time.Time) []byte {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, uint64(t.UnixNano()))
+
+	return v
+}
@@ -0,0 +1,74 @@
+package routing
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltTable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "routing_table")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+
+	tbl, err := NewBoltTable(filepath.Join(dir, "routing.db"))
+	require.NoError(t, err)
+
+	RoutingTableSuite(t, tbl)
+	require.NoError(t, tbl.Close())
+}
+
+func TestBoltTable_Restore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "routing_table")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+
+	path := filepath.Join(dir, "routing.db")
+
+	tbl, err := NewBoltTable(path)
+	require.NoError(t, err)
+
+	ids, err := tbl.ReserveKeys(3)
+	require.NoError(t, err)
+
+	fwdRule := IntermediaryForwardRule(15*time.Minute, ids[0], 2, uuid.New())
+	require.NoError(t, tbl.SaveRule(fwdRule))
+
+	delRule := IntermediaryForwardRule(15*time.Minute, ids[1], 3, uuid.New())
+	require.NoError(t, tbl.SaveRule(delRule))
+	tbl.DelRules([]RouteID{ids[1]})
+
+	consumeRule := ConsumeRule(15*time.Minute, ids[2], cipher.PubKey{}, cipher.PubKey{}, 1, 2)
+	require.NoError(t, tbl.SaveRule(consumeRule))
+	require.NoError(t, tbl.Close())
+
+	restored, err := NewBoltTable(path)
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, restored.Close())
+	}()
+
+	assert.Equal(t, 1, restored.Count())
+
+	r, err := restored.Rule(ids[0])
+	require.NoError(t, err)
+	assert.Equal(t, fwdRule, r)
+
+	newIDs, err := restored.ReserveKeys(1)
+	require.NoError(t, err)
+	assert.Equal(t, ids[2]+1, newIDs[0])
+}
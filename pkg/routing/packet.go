@@ -5,6 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
 )
 
 // Packet defines generic packet recognized by all skywire visors.
@@ -23,6 +26,27 @@ const (
 	PacketRouteIDOffset     = 1
 	PacketPayloadSizeOffset = 5
 	PacketPayloadOffset     = PacketHeaderSize
+
+	// PacketSequenceSize is the size of the sequence number which prefixes
+	// the payload of a SequencedDataPacket.
+	PacketSequenceSize = 4
+
+	// PacketWindowUpdateSize is the size of the payload of a WindowUpdatePacket.
+	PacketWindowUpdateSize = 8
+
+	// PacketFragmentHeaderSize is the size of the sequence number, fragment index and fragments count
+	// which prefix the payload of a FragmentPacket.
+	PacketFragmentHeaderSize = PacketSequenceSize + 2 + 2
+
+	// PacketProbeHeaderSize is the size of the probe ID and the reply flag
+	// which prefix the payload of a ProbePacket.
+	PacketProbeHeaderSize = 4 + 1
+
+	// PacketProbeHopSize is the size of a single hop record of a ProbePacket.
+	PacketProbeHopSize = pkSize + 8
+
+	// PacketTransportProbeSize is the size of the payload of a TransportProbePacket.
+	PacketTransportProbeSize = 4 + 1 + 8
 )
 
 var (
@@ -41,19 +65,48 @@ func (t PacketType) String() string {
 		return "ClosePacket"
 	case KeepAlivePacket:
 		return "KeepAlivePacket"
+	case SequencedDataPacket:
+		return "SequencedDataPacket"
+	case WindowUpdatePacket:
+		return "WindowUpdatePacket"
+	case FragmentPacket:
+		return "FragmentPacket"
+	case ProbePacket:
+		return "ProbePacket"
+	case TransportProbePacket:
+		return "TransportProbePacket"
 	default:
 		return fmt.Sprintf("Unknown(%d)", t)
 	}
 }
 
 // Possible PacketType values:
-// - DataPacket      - Payload is just the underlying data.
-// - ClosePacket     - Payload is a type CloseCode byte.
-// - KeepAlivePacket - Payload is empty.
+// - DataPacket          - Payload is just the underlying data.
+// - ClosePacket         - Payload is a type CloseCode byte.
+// - KeepAlivePacket     - Payload is empty.
+// - SequencedDataPacket - Payload is a sequence number (uint32) followed by the underlying data.
+//                         Used by route groups which spread writes over several routes.
+// - WindowUpdatePacket  - Payload is the number of data packets received (uint32) followed by
+//                         the number of data packets the remote is allowed to send (uint32).
+//                         Both numbers are cumulative. Used for flow control of route groups.
+// - FragmentPacket      - Payload is a sequence number (uint32), fragment index (uint16) and fragments
+//                         count (uint16) followed by a fragment of the underlying data.
+//                         Used by route groups for writes which don't fit into a single packet.
+// - ProbePacket         - Payload is a probe ID (uint32) and a reply flag (byte) followed by hop records.
+//                         Every visor on the way appends a record of its public key and local time (int64).
+//                         The remote edge sends the probe back as a reply. Used to trace routes.
+// - TransportProbePacket - Payload is a probe ID (uint32), a reply flag (byte) and the time the probe
+//                          was sent (int64). Route ID is unused. The remote edge of the transport sends
+//                          the probe back as a reply. Used to measure latency and loss of transports.
 const (
 	DataPacket PacketType = iota
 	ClosePacket
 	KeepAlivePacket
+	SequencedDataPacket
+	WindowUpdatePacket
+	FragmentPacket
+	ProbePacket
+	TransportProbePacket
 )
 
 // CloseCode represents close code for ClosePacket.
@@ -93,6 +146,97 @@ func MakeDataPacket(id RouteID, payload []byte) (Packet, error) {
 	return packet, nil
 }
 
+// MakeSequencedDataPacket constructs a new SequencedDataPacket.
+// If payload size (including the sequence number) is more than uint16, MakeSequencedDataPacket returns an error.
+func MakeSequencedDataPacket(id RouteID, seq uint32, payload []byte) (Packet, error) {
+	if len(payload)+PacketSequenceSize > math.MaxUint16 {
+		return Packet{}, ErrPayloadTooBig
+	}
+
+	packet := make([]byte, PacketHeaderSize+PacketSequenceSize+len(payload))
+
+	packet[PacketTypeOffset] = byte(SequencedDataPacket)
+	binary.BigEndian.PutUint32(packet[PacketRouteIDOffset:], uint32(id))
+	binary.BigEndian.PutUint16(packet[PacketPayloadSizeOffset:], uint16(PacketSequenceSize+len(payload)))
+	binary.BigEndian.PutUint32(packet[PacketPayloadOffset:], seq)
+	copy(packet[PacketPayloadOffset+PacketSequenceSize:], payload)
+
+	return packet, nil
+}
+
+// MakeFragmentPacket constructs a new FragmentPacket.
+// If payload size (including the fragment header) is more than uint16, MakeFragmentPacket returns an error.
+func MakeFragmentPacket(id RouteID, seq uint32, index, count uint16, payload []byte) (Packet, error) {
+	if len(payload)+PacketFragmentHeaderSize > math.MaxUint16 {
+		return Packet{}, ErrPayloadTooBig
+	}
+
+	packet := make([]byte, PacketHeaderSize+PacketFragmentHeaderSize+len(payload))
+
+	packet[PacketTypeOffset] = byte(FragmentPacket)
+	binary.BigEndian.PutUint32(packet[PacketRouteIDOffset:], uint32(id))
+	binary.BigEndian.PutUint16(packet[PacketPayloadSizeOffset:], uint16(PacketFragmentHeaderSize+len(payload)))
+	binary.BigEndian.PutUint32(packet[PacketPayloadOffset:], seq)
+	binary.BigEndian.PutUint16(packet[PacketPayloadOffset+PacketSequenceSize:], index)
+	binary.BigEndian.PutUint16(packet[PacketPayloadOffset+PacketSequenceSize+2:], count)
+	copy(packet[PacketPayloadOffset+PacketFragmentHeaderSize:], payload)
+
+	return packet, nil
+}
+
+// ProbeHop is a hop record of a ProbePacket: the public key of a visor
+// and the local time at which the probe passed the visor.
+type ProbeHop struct {
+	PK   cipher.PubKey
+	Time time.Time
+}
+
+// MakeProbePacket constructs a new ProbePacket.
+// If payload size is more than uint16, MakeProbePacket returns an error.
+func MakeProbePacket(id RouteID, probeID uint32, reply bool, hops []ProbeHop) (Packet, error) {
+	payloadSize := PacketProbeHeaderSize + len(hops)*PacketProbeHopSize
+	if payloadSize > math.MaxUint16 {
+		return Packet{}, ErrPayloadTooBig
+	}
+
+	packet := make([]byte, PacketHeaderSize+payloadSize)
+
+	packet[PacketTypeOffset] = byte(ProbePacket)
+	binary.BigEndian.PutUint32(packet[PacketRouteIDOffset:], uint32(id))
+	binary.BigEndian.PutUint16(packet[PacketPayloadSizeOffset:], uint16(payloadSize))
+	binary.BigEndian.PutUint32(packet[PacketPayloadOffset:], probeID)
+
+	if reply {
+		packet[PacketPayloadOffset+4] = 1
+	}
+
+	offset := PacketPayloadOffset + PacketProbeHeaderSize
+	for _, hop := range hops {
+		copy(packet[offset:], hop.PK[:])
+		binary.BigEndian.PutUint64(packet[offset+pkSize:], uint64(hop.Time.UnixNano()))
+		offset += PacketProbeHopSize
+	}
+
+	return packet, nil
+}
+
+// MakeTransportProbePacket constructs a new TransportProbePacket.
+func MakeTransportProbePacket(probeID uint32, reply bool, sent time.Time) Packet {
+	packet := make([]byte, PacketHeaderSize+PacketTransportProbeSize)
+
+	packet[PacketTypeOffset] = byte(TransportProbePacket)
+	binary.BigEndian.PutUint16(packet[PacketPayloadSizeOffset:], uint16(PacketTransportProbeSize))
+	binary.BigEndian.PutUint32(packet[PacketPayloadOffset:], probeID)
+
+	if reply {
+		packet[PacketPayloadOffset+4] = 1
+	}
+
+	binary.BigEndian.PutUint64(packet[PacketPayloadOffset+5:], uint64(sent.UnixNano()))
+
+	return packet
+}
+
 // MakeClosePacket constructs a new ClosePacket.
 func MakeClosePacket(id RouteID, code CloseCode) Packet {
 	packet := make([]byte, PacketHeaderSize+1)
@@ -116,6 +260,19 @@ func MakeKeepAlivePacket(id RouteID) Packet {
 	return packet
 }
 
+// MakeWindowUpdatePacket constructs a new WindowUpdatePacket.
+func MakeWindowUpdatePacket(id RouteID, received, limit uint32) Packet {
+	packet := make([]byte, PacketHeaderSize+PacketWindowUpdateSize)
+
+	packet[PacketTypeOffset] = byte(WindowUpdatePacket)
+	binary.BigEndian.PutUint32(packet[PacketRouteIDOffset:], uint32(id))
+	binary.BigEndian.PutUint16(packet[PacketPayloadSizeOffset:], uint16(PacketWindowUpdateSize))
+	binary.BigEndian.PutUint32(packet[PacketPayloadOffset:], received)
+	binary.BigEndian.PutUint32(packet[PacketPayloadOffset+4:], limit)
+
+	return packet
+}
+
 // Type returns Packet's type.
 func (p Packet) Type() PacketType {
 	return PacketType(p[PacketTypeOffset])
@@ -135,3 +292,61 @@ func (p Packet) RouteID() RouteID {
 func (p Packet) Payload() []byte {
 	return p[PacketPayloadOffset:] // TODO: consider checking if real payload size differs
 }
+
+// Sequence returns the sequence number of a SequencedDataPacket or a FragmentPacket.
+func (p Packet) Sequence() uint32 {
+	return binary.BigEndian.Uint32(p[PacketPayloadOffset:])
+}
+
+// SequencedPayload returns the underlying data of a SequencedDataPacket.
+func (p Packet) SequencedPayload() []byte {
+	return p[PacketPayloadOffset+PacketSequenceSize:]
+}
+
+// WindowUpdate returns the number of received data packets and the limit of data packets
+// to send from a WindowUpdatePacket.
+func (p Packet) WindowUpdate() (received, limit uint32) {
+	return binary.BigEndian.Uint32(p[PacketPayloadOffset:]), binary.BigEndian.Uint32(p[PacketPayloadOffset+4:])
+}
+
+// Fragment returns the fragment index and the fragments count of a FragmentPacket.
+func (p Packet) Fragment() (index, count uint16) {
+	offset := PacketPayloadOffset + PacketSequenceSize
+
+	return binary.BigEndian.Uint16(p[offset:]), binary.BigEndian.Uint16(p[offset+2:])
+}
+
+// FragmentPayload returns the underlying data fragment of a FragmentPacket.
+func (p Packet) FragmentPayload() []byte {
+	return p[PacketPayloadOffset+PacketFragmentHeaderSize:]
+}
+
+// Probe returns the probe ID, the reply flag and hop records of a ProbePacket.
+// Incomplete trailing hop records are ignored.
+func (p Packet) Probe() (probeID uint32, reply bool, hops []ProbeHop) {
+	probeID = binary.BigEndian.Uint32(p[PacketPayloadOffset:])
+	reply = p[PacketPayloadOffset+4] != 0
+
+	records := p[PacketPayloadOffset+PacketProbeHeaderSize:]
+	hops = make([]ProbeHop, 0, len(records)/PacketProbeHopSize)
+
+	for ; len(records) >= PacketProbeHopSize; records = records[PacketProbeHopSize:] {
+		var hop ProbeHop
+
+		copy(hop.PK[:], records[:pkSize])
+		hop.Time = time.Unix(0, int64(binary.BigEndian.Uint64(records[pkSize:])))
+
+		hops = append(hops, hop)
+	}
+
+	return probeID, reply, hops
+}
+
+// TransportProbe returns the probe ID, the reply flag and the sending time of a TransportProbePacket.
+func (p Packet) TransportProbe() (probeID uint32, reply bool, sent time.Time) {
+	probeID = binary.BigEndian.Uint32(p[PacketPayloadOffset:])
+	reply = p[PacketPayloadOffset+4] != 0
+	sent = time.Unix(0, int64(binary.BigEndian.Uint64(p[PacketPayloadOffset+5:])))
+
+	return probeID, reply, sent
+}
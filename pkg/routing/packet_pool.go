@@ -0,0 +1,43 @@
+package routing
+
+import (
+	"math"
+	"sync"
+)
+
+// packetSizeClasses are capacities of pooled packet buffers. The largest one fits any packet.
+var packetSizeClasses = [...]int{512, 2 << 10, 16 << 10, PacketHeaderSize + math.MaxUint16}
+
+var packetPools [len(packetSizeClasses)]sync.Pool
+
+// GetPacket returns a packet of `size` bytes backed by a pooled buffer. Contents of the packet are undefined.
+// The packet may be returned to the pool with PutPacket once it's no longer used.
+func GetPacket(size int) Packet {
+	for i, c := range packetSizeClasses {
+		if size > c {
+			continue
+		}
+
+		if b, ok := packetPools[i].Get().(*[]byte); ok {
+			return (*b)[:size]
+		}
+
+		return make(Packet, size, c)
+	}
+
+	return make(Packet, size)
+}
+
+// PutPacket returns the buffer of a packet obtained with GetPacket to the pool.
+// Neither the packet nor slices of it (e.g. its payload) may be used afterwards.
+// Packets of capacities other than the ones of pooled buffers are ignored.
+func PutPacket(p Packet) {
+	for i, c := range packetSizeClasses {
+		if cap(p) == c {
+			b := []byte(p[:0])
+			packetPools[i].Put(&b)
+
+			return
+		}
+	}
+}
@@ -2,7 +2,9 @@ package routing
 
 import (
 	"testing"
+	"time"
 
+	"github.com/SkycoinProject/dmsg/cipher"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -38,3 +40,99 @@ func TestMakeKeepAlivePacket(t *testing.T) {
 	assert.Equal(t, RouteID(4), packet.RouteID())
 	assert.Equal(t, []byte{}, packet.Payload())
 }
+
+func TestMakeSequencedDataPacket(t *testing.T) {
+	packet, err := MakeSequencedDataPacket(2, 5, []byte("foo"))
+	require.NoError(t, err)
+
+	expected := []byte{0x3, 0x0, 0x0, 0x0, 0x2, 0x0, 0x7, 0x0, 0x0, 0x0, 0x5, 0x66, 0x6f, 0x6f}
+
+	assert.Equal(t, expected, []byte(packet))
+	assert.Equal(t, uint16(7), packet.Size())
+	assert.Equal(t, RouteID(2), packet.RouteID())
+	assert.Equal(t, uint32(5), packet.Sequence())
+	assert.Equal(t, []byte("foo"), packet.SequencedPayload())
+}
+
+func TestMakeWindowUpdatePacket(t *testing.T) {
+	packet := MakeWindowUpdatePacket(2, 5, 1029)
+
+	expected := []byte{0x4, 0x0, 0x0, 0x0, 0x2, 0x0, 0x8, 0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x4, 0x5}
+
+	assert.Equal(t, expected, []byte(packet))
+	assert.Equal(t, uint16(8), packet.Size())
+	assert.Equal(t, RouteID(2), packet.RouteID())
+
+	received, limit := packet.WindowUpdate()
+	assert.Equal(t, uint32(5), received)
+	assert.Equal(t, uint32(1029), limit)
+}
+
+func TestMakeFragmentPacket(t *testing.T) {
+	packet, err := MakeFragmentPacket(2, 5, 1, 3, []byte("foo"))
+	require.NoError(t, err)
+
+	expected := []byte{0x5, 0x0, 0x0, 0x0, 0x2, 0x0, 0xb, 0x0, 0x0, 0x0, 0x5, 0x0, 0x1, 0x0, 0x3, 0x66, 0x6f, 0x6f}
+
+	assert.Equal(t, expected, []byte(packet))
+	assert.Equal(t, uint16(11), packet.Size())
+	assert.Equal(t, RouteID(2), packet.RouteID())
+	assert.Equal(t, uint32(5), packet.Sequence())
+	assert.Equal(t, []byte("foo"), packet.FragmentPayload())
+
+	index, count := packet.Fragment()
+	assert.Equal(t, uint16(1), index)
+	assert.Equal(t, uint16(3), count)
+}
+
+func TestMakeProbePacket(t *testing.T) {
+	pk1, _ := cipher.GenerateKeyPair()
+	pk2, _ := cipher.GenerateKeyPair()
+
+	hops := []ProbeHop{
+		{PK: pk1, Time: time.Unix(0, 1)},
+		{PK: pk2, Time: time.Unix(0, 2)},
+	}
+
+	packet, err := MakeProbePacket(2, 7, true, hops)
+	require.NoError(t, err)
+
+	assert.Equal(t, ProbePacket, packet.Type())
+	assert.Equal(t, uint16(PacketProbeHeaderSize+2*PacketProbeHopSize), packet.Size())
+	assert.Equal(t, RouteID(2), packet.RouteID())
+
+	probeID, reply, gotHops := packet.Probe()
+	assert.Equal(t, uint32(7), probeID)
+	assert.True(t, reply)
+	assert.Equal(t, hops, gotHops)
+}
+
+func TestMakeTransportProbePacket(t *testing.T) {
+	sent := time.Unix(0, 12345)
+
+	packet := MakeTransportProbePacket(7, true, sent)
+
+	assert.Equal(t, TransportProbePacket, packet.Type())
+	assert.Equal(t, uint16(PacketTransportProbeSize), packet.Size())
+	assert.Equal(t, RouteID(0), packet.RouteID())
+
+	probeID, reply, gotSent := packet.TransportProbe()
+	assert.Equal(t, uint32(7), probeID)
+	assert.True(t, reply)
+	assert.True(t, sent.Equal(gotSent))
+}
+
+func TestGetPacket(t *testing.T) {
+	for _, size := range []int{PacketHeaderSize, 600, PacketHeaderSize + 65535} {
+		p := GetPacket(size)
+		assert.Len(t, p, size)
+		assert.Contains(t, packetSizeClasses, cap(p))
+
+		PutPacket(p)
+	}
+
+	// buffers of other capacities are not pooled
+	p := make(Packet, 10)
+	PutPacket(p)
+	assert.Contains(t, packetSizeClasses, cap(GetPacket(10)))
+}
@@ -28,11 +28,20 @@ func (r Route) String() string {
 }
 
 // BidirectionalRoute is a Route with both forward and reverse Paths.
+// Additional is set when the route extends an already established route group
+// of the same descriptor instead of creating a new one.
+// ForwardMTU and ReverseMTU are the largest packet payloads which fit into every transport
+// of the corresponding path (0 if unknown).
+// Encrypt requests end-to-end encryption of the route group, it's used only if the remote edge agrees.
 type BidirectionalRoute struct {
-	Desc      RouteDescriptor
-	KeepAlive time.Duration
-	Forward   Path
-	Reverse   Path
+	Desc       RouteDescriptor
+	KeepAlive  time.Duration
+	Forward    Path
+	Reverse    Path
+	Additional bool
+	ForwardMTU uint16
+	ReverseMTU uint16
+	Encrypt    bool
 }
 
 // ForwardAndReverse generate forward and reverse routes for bidirectional route.
@@ -53,10 +62,16 @@ func (br *BidirectionalRoute) ForwardAndReverse() (forward, reverse Route) {
 }
 
 // EdgeRules represents edge forward and reverse rules. Edge rules are forward and consume rules.
+// Additional is set when the rules should be added to an existing route group of the same descriptor.
+// MTU is the largest packet payload which fits into every transport of the forward path (0 if unknown).
+// Encrypt is set when both edges agreed to encrypt the route group end-to-end.
 type EdgeRules struct {
-	Desc    RouteDescriptor
-	Forward Rule
-	Reverse Rule
+	Desc       RouteDescriptor
+	Forward    Rule
+	Reverse    Rule
+	Additional bool
+	MTU        uint16
+	Encrypt    bool
 }
 
 // Hop defines a route hop between 2 nodes.
@@ -18,6 +18,8 @@ const (
 	pkSize              = len(cipher.PubKey{})
 	uuidSize            = len(uuid.UUID{})
 	routeDescriptorSize = pkSize*2 + 2*2
+
+	intermediaryForwardRuleSize = RuleHeaderSize + 4 + pkSize
 )
 
 // RuleType defines type of a routing rule
@@ -124,6 +126,21 @@ func (r Rule) RouteDescriptor() RouteDescriptor {
 	}
 }
 
+// IntermediaryRouteDescriptor returns the route descriptor of an intermediary forward rule.
+// Intermediary forward rules only carry route descriptors if the setup node included them,
+// it returns false otherwise.
+func (r Rule) IntermediaryRouteDescriptor() (RouteDescriptor, bool) {
+	if r.Type() != RuleIntermediaryForward || len(r) < intermediaryForwardRuleSize+routeDescriptorSize {
+		return RouteDescriptor{}, false
+	}
+
+	var desc RouteDescriptor
+
+	copy(desc[:], r[intermediaryForwardRuleSize:])
+
+	return desc, true
+}
+
 // NextRouteID returns NextRouteID from the rule.
 func (r Rule) NextRouteID() RouteID {
 	offset := RuleHeaderSize
@@ -245,6 +262,11 @@ func (r Rule) String() string {
 		return fmt.Sprintf("FWD(keyRtID:%d, nxtRtID:%d, nxtTpID:%s, %s)",
 			r.KeyRouteID(), r.NextRouteID(), r.NextTransportID(), rd.String())
 	case RuleIntermediaryForward:
+		if rd, ok := r.IntermediaryRouteDescriptor(); ok {
+			return fmt.Sprintf("IFWD(keyRtID:%d, nxtRtID:%d, nxtTpID:%s, %s)",
+				r.KeyRouteID(), r.NextRouteID(), r.NextTransportID(), rd.String())
+		}
+
 		return fmt.Sprintf("IFWD(keyRtID:%d, nxtRtID:%d, nxtTpID:%s)",
 			r.KeyRouteID(), r.NextRouteID(), r.NextTransportID())
 	default:
@@ -274,8 +296,9 @@ type RuleForwardFields struct {
 
 // RuleIntermediaryForwardFields summarizes IntermediaryForward fields of a RoutingRule.
 type RuleIntermediaryForwardFields struct {
-	NextRID RouteID   `json:"next_rid"`
-	NextTID uuid.UUID `json:"next_tid"`
+	RouteDescriptor *RouteDescriptorFields `json:"route_descriptor,omitempty"`
+	NextRID         RouteID                `json:"next_rid"`
+	NextTID         uuid.UUID              `json:"next_tid"`
 }
 
 // RuleSummary provides a summary of a RoutingRule.
@@ -316,6 +339,11 @@ func (rs *RuleSummary) ToRule() (Rule, error) {
 
 		f := rs.IntermediaryForwardFields
 
+		if d := f.RouteDescriptor; d != nil {
+			desc := NewRouteDescriptor(d.SrcPK, d.DstPK, d.SrcPort, d.DstPort)
+			return IntermediaryForwardRuleWithDesc(rs.KeepAlive, rs.KeyRouteID, f.NextRID, f.NextTID, desc), nil
+		}
+
 		return IntermediaryForwardRule(rs.KeepAlive, rs.KeyRouteID, f.NextRID, f.NextTID), nil
 	default:
 		return nil, errors.New("invalid routing rule summary")
@@ -360,6 +388,15 @@ func (r Rule) Summary() *RuleSummary {
 			NextRID: r.NextRouteID(),
 			NextTID: r.NextTransportID(),
 		}
+
+		if rd, ok := r.IntermediaryRouteDescriptor(); ok {
+			summary.IntermediaryForwardFields.RouteDescriptor = &RouteDescriptorFields{
+				DstPK:   rd.DstPK(),
+				SrcPK:   rd.SrcPK(),
+				DstPort: rd.DstPort(),
+				SrcPort: rd.SrcPort(),
+			}
+		}
 	default:
 		panic(fmt.Sprintf("invalid rule: %v", t.String()))
 	}
@@ -409,7 +446,7 @@ func ForwardRule(
 
 // IntermediaryForwardRule constructs a new IntermediaryForward rule.
 func IntermediaryForwardRule(keepAlive time.Duration, key, nextRoute RouteID, nextTransport uuid.UUID) Rule {
-	rule := Rule(make([]byte, RuleHeaderSize+4+pkSize))
+	rule := Rule(make([]byte, intermediaryForwardRuleSize))
 
 	rule.setKeepAlive(keepAlive)
 	rule.setType(RuleIntermediaryForward)
@@ -419,3 +456,17 @@ func IntermediaryForwardRule(keepAlive time.Duration, key, nextRoute RouteID, ne
 
 	return rule
 }
+
+// IntermediaryForwardRuleWithDesc constructs a new IntermediaryForward rule of a route with the descriptor `desc`.
+// The descriptor trails the rule, so visors which don't know about it ignore it.
+func IntermediaryForwardRuleWithDesc(
+	keepAlive time.Duration,
+	key, nextRoute RouteID,
+	nextTransport uuid.UUID,
+	desc RouteDescriptor,
+) Rule {
+	rule := append(IntermediaryForwardRule(keepAlive, key, nextRoute, nextTransport), make([]byte, routeDescriptorSize)...)
+	copy(rule[intermediaryForwardRuleSize:], desc[:])
+
+	return rule
+}
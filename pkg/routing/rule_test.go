@@ -67,3 +67,30 @@ func TestIntermediaryForwardRule(t *testing.T) {
 	rule.SetKeyRouteID(3)
 	assert.Equal(t, RouteID(3), rule.KeyRouteID())
 }
+
+func TestIntermediaryForwardRuleWithDesc(t *testing.T) {
+	trID := uuid.New()
+	keepAlive := 2 * time.Minute
+
+	srcPK, _ := cipher.GenerateKeyPair()
+	dstPK, _ := cipher.GenerateKeyPair()
+	desc := NewRouteDescriptor(srcPK, dstPK, 3, 4)
+
+	_, ok := IntermediaryForwardRule(keepAlive, 1, 2, trID).IntermediaryRouteDescriptor()
+	assert.False(t, ok)
+
+	rule := IntermediaryForwardRuleWithDesc(keepAlive, 1, 2, trID, desc)
+
+	assert.Equal(t, RuleIntermediaryForward, rule.Type())
+	assert.Equal(t, RouteID(1), rule.KeyRouteID())
+	assert.Equal(t, RouteID(2), rule.NextRouteID())
+	assert.Equal(t, trID, rule.NextTransportID())
+
+	gotDesc, ok := rule.IntermediaryRouteDescriptor()
+	assert.True(t, ok)
+	assert.Equal(t, desc, gotDesc)
+
+	summaryRule, err := rule.Summary().ToRule()
+	assert.NoError(t, err)
+	assert.Equal(t, rule, summaryRule)
+}
@@ -1,6 +1,7 @@
 package routing
 
 import (
+	"container/heap"
 	"errors"
 	"fmt"
 	"math"
@@ -42,53 +43,151 @@ type Table interface {
 
 	// CollectGarbage checks all the stored rules, removes and returns ones that timed out.
 	CollectGarbage() []Rule
+
+	// Close releases resources held by the table.
+	Close() error
 }
 
+const (
+	// minRouteID and maxRouteID bound RouteIDs handed out by the table.
+	minRouteID = RouteID(1)
+	maxRouteID = RouteID(math.MaxUint32 - 1)
+
+	// defaultIDQuarantine is the minimum time before a released RouteID is handed out again,
+	// so that late packets of a removed route are not delivered to a new one.
+	defaultIDQuarantine = 2 * time.Minute
+	// defaultReservationTimeout is the time after which RouteIDs reserved, but never used by a rule, are released.
+	defaultReservationTimeout = 2 * time.Minute
+)
+
+// memTable is an in-memory routing table.
+// RouteIDs are allocated by a cursor which wraps around and skips IDs which are in use, reserved
+// or quarantined, so IDs freed by garbage collection are eventually reused.
+// Rules are indexed by route descriptor and expired via a deadline heap, so neither RulesWithDesc nor
+// CollectGarbage scan the whole table.
 type memTable struct {
 	sync.RWMutex
 
-	nextID   RouteID
+	nextID   RouteID // the last allocated RouteID
 	rules    map[RouteID]Rule
 	activity map[RouteID]time.Time
+
+	descRules map[RouteDescriptor]map[RouteID]struct{}
+
+	deadlines deadlineHeap
+	scheduled map[RouteID]*ruleDeadline // entries of rules in `deadlines`
+
+	reserved           map[RouteID]time.Time // reserved RouteIDs not used by rules yet
+	reservationQueue   idQueue
+	reservationTimeout time.Duration
+
+	quarantined     map[RouteID]time.Time // released RouteIDs which can't be reused yet
+	quarantineQueue idQueue
+	quarantine      time.Duration
 }
 
 // NewTable returns an in-memory routing table implementation with a specified configuration.
 func NewTable() Table {
 	mt := &memTable{
-		rules:    map[RouteID]Rule{},
-		activity: make(map[RouteID]time.Time),
+		rules:              map[RouteID]Rule{},
+		activity:           make(map[RouteID]time.Time),
+		descRules:          make(map[RouteDescriptor]map[RouteID]struct{}),
+		scheduled:          make(map[RouteID]*ruleDeadline),
+		reserved:           make(map[RouteID]time.Time),
+		reservationTimeout: defaultReservationTimeout,
+		quarantined:        make(map[RouteID]time.Time),
+		quarantine:         defaultIDQuarantine,
 	}
 
 	return mt
 }
 
 func (mt *memTable) ReserveKeys(n int) ([]RouteID, error) {
-	first, last, err := mt.reserveKeysImpl(n)
-	if err != nil {
-		return nil, err
+	mt.Lock()
+	defer mt.Unlock()
+
+	now := time.Now()
+	mt.expireIDs(now)
+
+	used := int64(len(mt.rules)) + int64(len(mt.reserved)) + int64(len(mt.quarantined))
+	if n < 0 || used+int64(n) > int64(maxRouteID-minRouteID)+1 {
+		return nil, ErrNoAvailableRoutes
 	}
 
 	routes := make([]RouteID, 0, n)
-	for id := first; id <= last; id++ {
+
+	for len(routes) < n {
+		id := mt.nextID + 1
+		if id > maxRouteID || id < minRouteID {
+			id = minRouteID
+		}
+
+		mt.nextID = id
+
+		if !mt.idIsFree(id) {
+			continue
+		}
+
+		mt.reserved[id] = now
+		mt.reservationQueue.push(id, now)
 		routes = append(routes, id)
 	}
 
 	return routes, nil
 }
 
-func (mt *memTable) reserveKeysImpl(n int) (first, last RouteID, err error) {
-	mt.Lock()
-	defer mt.Unlock()
+// idIsFree checks whether RouteID is neither used by a rule, nor reserved, nor quarantined.
+// NOTE: for internal use, is NOT thread-safe, object lock should be acquired outside
+func (mt *memTable) idIsFree(id RouteID) bool {
+	if _, ok := mt.rules[id]; ok {
+		return false
+	}
 
-	if int64(mt.nextID)+int64(n) >= math.MaxUint32 {
-		return 0, 0, ErrNoAvailableRoutes
+	if _, ok := mt.reserved[id]; ok {
+		return false
 	}
 
-	first = mt.nextID + 1
-	mt.nextID += RouteID(n)
-	last = mt.nextID
+	_, ok := mt.quarantined[id]
 
-	return first, last, nil
+	return !ok
+}
+
+// expireIDs releases timed out reservations and lifts expired quarantines.
+// NOTE: for internal use, is NOT thread-safe, object lock should be acquired outside
+func (mt *memTable) expireIDs(now time.Time) {
+	for {
+		item, ok := mt.reservationQueue.peek()
+		if !ok || now.Sub(item.t) < mt.reservationTimeout {
+			break
+		}
+
+		mt.reservationQueue.pop()
+
+		if t, ok := mt.reserved[item.id]; ok && t.Equal(item.t) {
+			delete(mt.reserved, item.id)
+			mt.quarantineID(item.id, now)
+		}
+	}
+
+	for {
+		item, ok := mt.quarantineQueue.peek()
+		if !ok || now.Sub(item.t) < mt.quarantine {
+			break
+		}
+
+		mt.quarantineQueue.pop()
+
+		if t, ok := mt.quarantined[item.id]; ok && t.Equal(item.t) {
+			delete(mt.quarantined, item.id)
+		}
+	}
+}
+
+// quarantineID prevents RouteID from being reused until the quarantine is over.
+// NOTE: for internal use, is NOT thread-safe, object lock should be acquired outside
+func (mt *memTable) quarantineID(id RouteID, now time.Time) {
+	mt.quarantined[id] = now
+	mt.quarantineQueue.push(id, now)
 }
 
 func (mt *memTable) SaveRule(rule Rule) error {
@@ -98,13 +197,91 @@ func (mt *memTable) SaveRule(rule Rule) error {
 	mt.Lock()
 	defer mt.Unlock()
 
-	mt.rules[key] = rule
-	fmt.Printf("ROUTING TABLE CONTENTS: %v\n", mt.rules)
-	mt.activity[key] = now
+	mt.addRule(key, rule, now)
 
 	return nil
 }
 
+// addRule stores the rule with the given last activity time. Zero `lastActivity` means the rule is timed out.
+// NOTE: for internal use, is NOT thread-safe, object lock should be acquired outside
+func (mt *memTable) addRule(key RouteID, rule Rule, lastActivity time.Time) {
+	if old, ok := mt.rules[key]; ok {
+		mt.unindexRule(key, old)
+	}
+
+	delete(mt.reserved, key)
+	delete(mt.quarantined, key)
+
+	mt.rules[key] = rule
+	mt.indexRule(key, rule)
+
+	if lastActivity.IsZero() {
+		delete(mt.activity, key)
+	} else {
+		mt.activity[key] = lastActivity
+	}
+
+	mt.schedule(key, lastActivity.Add(rule.KeepAlive()))
+}
+
+// schedule adds the rule to the deadline heap or moves its deadline if it's already there.
+// NOTE: for internal use, is NOT thread-safe, object lock should be acquired outside
+func (mt *memTable) schedule(key RouteID, deadline time.Time) {
+	if item, ok := mt.scheduled[key]; ok {
+		item.deadline = deadline
+		heap.Fix(&mt.deadlines, item.index)
+
+		return
+	}
+
+	item := &ruleDeadline{id: key, deadline: deadline}
+	mt.scheduled[key] = item
+	heap.Push(&mt.deadlines, item)
+}
+
+// indexRule adds the rule to the route descriptor index.
+// NOTE: for internal use, is NOT thread-safe, object lock should be acquired outside
+func (mt *memTable) indexRule(key RouteID, rule Rule) {
+	desc, ok := ruleDescriptor(rule)
+	if !ok {
+		return
+	}
+
+	ids, ok := mt.descRules[desc]
+	if !ok {
+		ids = make(map[RouteID]struct{})
+		mt.descRules[desc] = ids
+	}
+
+	ids[key] = struct{}{}
+}
+
+// unindexRule removes the rule from the route descriptor index.
+// NOTE: for internal use, is NOT thread-safe, object lock should be acquired outside
+func (mt *memTable) unindexRule(key RouteID, rule Rule) {
+	desc, ok := ruleDescriptor(rule)
+	if !ok {
+		return
+	}
+
+	ids := mt.descRules[desc]
+	delete(ids, key)
+
+	if len(ids) == 0 {
+		delete(mt.descRules, desc)
+	}
+}
+
+// ruleDescriptor returns route descriptor of the rule if the rule type has one.
+func ruleDescriptor(rule Rule) (RouteDescriptor, bool) {
+	switch rule.Type() {
+	case RuleConsume, RuleForward:
+		return rule.RouteDescriptor(), true
+	default:
+		return RouteDescriptor{}, false
+	}
+}
+
 // Rule fetches rule with the `key` route ID. It updates rule activity
 // ONLY for the consume type of rules.
 func (mt *memTable) Rule(key RouteID) (Rule, error) {
@@ -152,9 +329,11 @@ func (mt *memTable) RulesWithDesc(desc RouteDescriptor) []Rule {
 	mt.RLock()
 	defer mt.RUnlock()
 
-	rules := make([]Rule, 0, len(mt.rules))
-	for k, v := range mt.rules {
-		if !mt.ruleIsTimedOut(k, v) && v.RouteDescriptor() == desc {
+	ids := mt.descRules[desc]
+
+	rules := make([]Rule, 0, len(ids))
+	for k := range ids {
+		if v := mt.rules[k]; !mt.ruleIsTimedOut(k, v) {
 			rules = append(rules, v)
 		}
 	}
@@ -184,9 +363,23 @@ func (mt *memTable) DelRules(keys []RouteID) {
 	}
 }
 
+// delRule removes the rule and quarantines its RouteID.
+// NOTE: for internal use, is NOT thread-safe, object lock should be acquired outside
 func (mt *memTable) delRule(key RouteID) {
+	rule, ok := mt.rules[key]
+	if ok {
+		mt.unindexRule(key, rule)
+	}
+
+	_, reserved := mt.reserved[key]
+
+	if ok || reserved {
+		mt.quarantineID(key, time.Now())
+	}
+
 	delete(mt.rules, key)
 	delete(mt.activity, key)
+	delete(mt.reserved, key)
 }
 
 func (mt *memTable) Count() int {
@@ -200,17 +393,40 @@ func (mt *memTable) CollectGarbage() []Rule {
 	mt.Lock()
 	defer mt.Unlock()
 
+	now := time.Now()
+	mt.expireIDs(now)
+
 	var timedOutRules []Rule
-	for routeID, rule := range mt.rules {
-		if mt.ruleIsTimedOut(routeID, rule) {
-			timedOutRules = append(timedOutRules, rule)
-			mt.delRule(routeID)
+
+	for len(mt.deadlines) > 0 && !mt.deadlines[0].deadline.After(now) {
+		item := heap.Pop(&mt.deadlines).(*ruleDeadline)
+		delete(mt.scheduled, item.id)
+
+		rule, ok := mt.rules[item.id]
+		if !ok {
+			continue
 		}
+
+		// activity might have been updated since the rule was scheduled
+		if lastActivity, ok := mt.activity[item.id]; ok {
+			if deadline := lastActivity.Add(rule.KeepAlive()); deadline.After(now) {
+				mt.schedule(item.id, deadline)
+				continue
+			}
+		}
+
+		timedOutRules = append(timedOutRules, rule)
+		mt.delRule(item.id)
 	}
 
 	return timedOutRules
 }
 
+// Close is a no-op, memory table holds no resources.
+func (mt *memTable) Close() error {
+	return nil
+}
+
 // ruleIsExpired checks whether rule's keep alive timeout is exceeded.
 // NOTE: for internal use, is NOT thread-safe, object lock should be acquired outside
 func (mt *memTable) ruleIsTimedOut(key RouteID, rule Rule) bool {
@@ -220,3 +436,74 @@ func (mt *memTable) ruleIsTimedOut(key RouteID, rule Rule) bool {
 
 	return !ok || idling > keepAlive
 }
+
+// ruleDeadline is the time after which the rule is checked for a timeout.
+type ruleDeadline struct {
+	id       RouteID
+	deadline time.Time
+	index    int // position in the heap, maintained by deadlineHeap
+}
+
+// deadlineHeap implements heap.Interface, the earliest deadline is on top.
+type deadlineHeap []*ruleDeadline
+
+func (h deadlineHeap) Len() int           { return len(h) }
+func (h deadlineHeap) Less(i, j int) bool { return h[i].deadline.Before(h[j].deadline) }
+
+func (h deadlineHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *deadlineHeap) Push(x interface{}) {
+	item := x.(*ruleDeadline)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *deadlineHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+
+	return item
+}
+
+// timedID is a RouteID with the time it was queued at.
+type timedID struct {
+	id RouteID
+	t  time.Time
+}
+
+// idQueue is a FIFO queue of RouteIDs. As items are queued with non-decreasing times,
+// the oldest item is always at the head.
+type idQueue struct {
+	items []timedID
+	head  int
+}
+
+func (q *idQueue) push(id RouteID, t time.Time) {
+	q.items = append(q.items, timedID{id: id, t: t})
+}
+
+func (q *idQueue) peek() (timedID, bool) {
+	if q.head == len(q.items) {
+		return timedID{}, false
+	}
+
+	return q.items[q.head], true
+}
+
+func (q *idQueue) pop() {
+	q.items[q.head] = timedID{}
+	q.head++
+
+	// reclaim space of popped items once they make up most of the slice
+	if q.head > len(q.items)/2 {
+		q.items = append(q.items[:0], q.items[q.head:]...)
+		q.head = 0
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/SkycoinProject/dmsg/cipher"
 	"github.com/SkycoinProject/skycoin/src/util/logging"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -72,3 +73,105 @@ func RoutingTableSuite(t *testing.T, tbl Table) {
 func TestRoutingTable(t *testing.T) {
 	RoutingTableSuite(t, NewTable())
 }
+
+func TestRoutingTable_RouteIDRecycling(t *testing.T) {
+	mt := NewTable().(*memTable)
+	mt.nextID = maxRouteID - 1
+
+	ids, err := mt.ReserveKeys(2)
+	require.NoError(t, err)
+	assert.Equal(t, []RouteID{maxRouteID, minRouteID}, ids)
+
+	for _, id := range ids {
+		require.NoError(t, mt.SaveRule(IntermediaryForwardRule(time.Hour, id, 2, uuid.New())))
+	}
+
+	// released ID is quarantined
+	mt.DelRules([]RouteID{ids[0]})
+	mt.nextID = maxRouteID - 1
+
+	next, err := mt.ReserveKeys(1)
+	require.NoError(t, err)
+	assert.Equal(t, []RouteID{2}, next)
+
+	// released ID is reused once the quarantine is over
+	mt.quarantine = 0
+	mt.nextID = maxRouteID - 1
+
+	next, err = mt.ReserveKeys(1)
+	require.NoError(t, err)
+	assert.Equal(t, []RouteID{maxRouteID}, next)
+
+	// unused reservations are released
+	mt.reservationTimeout = 0
+	mt.nextID = 1
+
+	next, err = mt.ReserveKeys(1)
+	require.NoError(t, err)
+	assert.Equal(t, []RouteID{2}, next)
+}
+
+func TestRoutingTable_RulesWithDesc(t *testing.T) {
+	tbl := NewTable()
+
+	pk1, _ := cipher.GenerateKeyPair()
+	pk2, _ := cipher.GenerateKeyPair()
+
+	ids, err := tbl.ReserveKeys(3)
+	require.NoError(t, err)
+
+	consume := ConsumeRule(time.Hour, ids[0], pk1, pk2, 1, 2)
+	other := ConsumeRule(time.Hour, ids[1], pk2, pk1, 2, 1)
+	intermediary := IntermediaryForwardRule(time.Hour, ids[2], 3, uuid.New())
+
+	for _, rule := range []Rule{consume, other, intermediary} {
+		require.NoError(t, tbl.SaveRule(rule))
+	}
+
+	assert.Equal(t, []Rule{consume}, tbl.RulesWithDesc(consume.RouteDescriptor()))
+
+	tbl.DelRules([]RouteID{ids[0]})
+	assert.Empty(t, tbl.RulesWithDesc(consume.RouteDescriptor()))
+}
+
+func TestRoutingTable_CollectGarbage(t *testing.T) {
+	tbl := NewTable()
+
+	ids, err := tbl.ReserveKeys(2)
+	require.NoError(t, err)
+
+	expiring := IntermediaryForwardRule(50*time.Millisecond, ids[0], 2, uuid.New())
+	active := IntermediaryForwardRule(50*time.Millisecond, ids[1], 3, uuid.New())
+
+	require.NoError(t, tbl.SaveRule(expiring))
+	require.NoError(t, tbl.SaveRule(active))
+
+	for i := 0; i < 3; i++ {
+		time.Sleep(30 * time.Millisecond)
+		require.NoError(t, tbl.UpdateActivity(ids[1]))
+	}
+
+	assert.Equal(t, []Rule{expiring}, tbl.CollectGarbage())
+	assert.Equal(t, 1, tbl.Count())
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, []Rule{active}, tbl.CollectGarbage())
+	assert.Equal(t, 0, tbl.Count())
+}
+
+func TestRoutingTable_CollectGarbage_ShorterKeepAlive(t *testing.T) {
+	tbl := NewTable()
+
+	ids, err := tbl.ReserveKeys(1)
+	require.NoError(t, err)
+
+	require.NoError(t, tbl.SaveRule(IntermediaryForwardRule(time.Hour, ids[0], 2, uuid.New())))
+
+	// re-saved rule must expire according to its new keep-alive
+	rule := IntermediaryForwardRule(50*time.Millisecond, ids[0], 2, uuid.New())
+	require.NoError(t, tbl.SaveRule(rule))
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, []Rule{rule}, tbl.CollectGarbage())
+	assert.Equal(t, 0, tbl.Count())
+}
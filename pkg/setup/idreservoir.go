@@ -172,7 +172,7 @@ func (idr *idReservoir) GenerateRules(fwd, rev routing.Route) (
 				rule := routing.ForwardRule(route.KeepAlive, rID, nxtRID, hop.TpID, srcPK, dstPK, srcPort, dstPort)
 				forwardRules[hop.From] = rule
 			} else {
-				rule := routing.IntermediaryForwardRule(route.KeepAlive, rID, nxtRID, hop.TpID)
+				rule := routing.IntermediaryForwardRuleWithDesc(route.KeepAlive, rID, nxtRID, hop.TpID, desc)
 				intermediaryRules[hop.From] = append(intermediaryRules[hop.From], rule)
 			}
 
@@ -127,24 +127,38 @@ func (sn *Node) handleDialRouteGroup(ctx context.Context, route routing.Bidirect
 	}
 
 	initRouteRules := routing.EdgeRules{
-		Desc:    reverseRoute.Desc,
-		Forward: forwardRules[route.Desc.SrcPK()],
-		Reverse: consumeRules[route.Desc.SrcPK()],
+		Desc:       reverseRoute.Desc,
+		Forward:    forwardRules[route.Desc.SrcPK()],
+		Reverse:    consumeRules[route.Desc.SrcPK()],
+		Additional: route.Additional,
+		MTU:        route.ForwardMTU,
 	}
 
 	respRouteRules := routing.EdgeRules{
-		Desc:    forwardRoute.Desc,
-		Forward: forwardRules[route.Desc.DstPK()],
-		Reverse: consumeRules[route.Desc.DstPK()],
+		Desc:       forwardRoute.Desc,
+		Forward:    forwardRules[route.Desc.DstPK()],
+		Reverse:    consumeRules[route.Desc.DstPK()],
+		Additional: route.Additional,
+		MTU:        route.ReverseMTU,
 	}
 
 	sn.logger.Infof("initRouteRules: Desc(%s), %s", &initRouteRules.Desc, initRouteRules)
 	sn.logger.Infof("respRouteRules: Desc(%s), %s", &respRouteRules.Desc, respRouteRules)
 
 	// Confirm routes with responding visor.
-	ok, err := routerclient.AddEdgeRules(ctx, sn.logger, sn.dmsgC, route.Desc.DstPK(), respRouteRules)
-	if err != nil || !ok {
-		return routing.EdgeRules{}, fmt.Errorf("failed to confirm route group with destination visor: %v", err)
+	// Encryption is used only if the responding visor supports and agrees to it.
+	if route.Encrypt && !route.Additional {
+		encrypted, err := routerclient.AddEncryptedEdgeRules(ctx, sn.logger, sn.dmsgC, route.Desc.DstPK(), respRouteRules)
+		if err != nil {
+			return routing.EdgeRules{}, fmt.Errorf("failed to confirm route group with destination visor: %v", err)
+		}
+
+		initRouteRules.Encrypt = encrypted
+	} else {
+		ok, err := routerclient.AddEdgeRules(ctx, sn.logger, sn.dmsgC, route.Desc.DstPK(), respRouteRules)
+		if err != nil || !ok {
+			return routing.EdgeRules{}, fmt.Errorf("failed to confirm route group with destination visor: %v", err)
+		}
 	}
 
 	sn.logger.Infof("Returning route rules to initiating visor: %v", initRouteRules)
@@ -6,19 +6,23 @@ import (
 
 // Constants for default services.
 const (
-	DefaultTpDiscAddr        = "http://transport.discovery.skywire.skycoin.com"
-	DefaultDmsgDiscAddr      = "http://dmsg.discovery.skywire.skycoin.com"
-	DefaultRouteFinderAddr   = "http://routefinder.skywire.skycoin.com"
-	DefaultUptimeTrackerAddr = "http://uptime-tracker.skywire.skycoin.com"
-	DefaultSetupPK           = "0324579f003e6b4048bae2def4365e634d8e0e3054a20fc7af49daf2a179658557"
+	DefaultTpDiscAddr          = "http://transport.discovery.skywire.skycoin.com"
+	DefaultDmsgDiscAddr        = "http://dmsg.discovery.skywire.skycoin.com"
+	DefaultRouteFinderAddr     = "http://routefinder.skywire.skycoin.com"
+	DefaultUptimeTrackerAddr   = "http://uptime-tracker.skywire.skycoin.com"
+	DefaultAddressResolverAddr = "http://address.resolver.skywire.skycoin.com"
+	DefaultRendezvousAddr      = "address.resolver.skywire.skycoin.com:9094"
+	DefaultSetupPK             = "0324579f003e6b4048bae2def4365e634d8e0e3054a20fc7af49daf2a179658557"
 )
 
 // Constants for testing deployment.
 const (
-	TestTpDiscAddr      = "http://transport.discovery.skywire.cc"
-	TestDmsgDiscAddr    = "http://dmsg.discovery.skywire.cc"
-	TestRouteFinderAddr = "http://routefinder.skywire.cc"
-	TestSetupPK         = "026c5a07de617c5c488195b76e8671bf9e7ee654d0633933e202af9e111ffa358d"
+	TestTpDiscAddr          = "http://transport.discovery.skywire.cc"
+	TestDmsgDiscAddr        = "http://dmsg.discovery.skywire.cc"
+	TestRouteFinderAddr     = "http://routefinder.skywire.cc"
+	TestAddressResolverAddr = "http://address.resolver.skywire.cc"
+	TestRendezvousAddr      = "address.resolver.skywire.cc:9094"
+	TestSetupPK             = "026c5a07de617c5c488195b76e8671bf9e7ee654d0633933e202af9e111ffa358d"
 )
 
 // Dmsg port constants.
@@ -27,6 +31,7 @@ const (
 	DmsgAwaitSetupPort = uint16(136) // Listening port of a visor for setup operations.
 	DmsgTransportPort  = uint16(45)  // Listening port of a visor for incoming transports.
 	DmsgHypervisorPort = uint16(46)  // Listening port of a visor for incoming hypervisor connections.
+	DmsgHolePunchPort  = uint16(47)  // Listening port of a visor for hole punching requests.
 )
 
 // Default dmsgpty constants.
@@ -2,20 +2,27 @@ package snet
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/SkycoinProject/skywire-mainnet/pkg/address-resolver/arclient"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/stcp"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/sudp"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/sudph"
 
 	"github.com/SkycoinProject/skycoin/src/util/logging"
 
 	"github.com/SkycoinProject/dmsg"
 	"github.com/SkycoinProject/dmsg/cipher"
 	"github.com/SkycoinProject/dmsg/disc"
+	"github.com/SkycoinProject/dmsg/noise"
 )
 
 // Default ports.
@@ -26,15 +33,60 @@ const (
 	TransportPort  = uint16(45)  // Listening port of a visor for incoming transports.
 )
 
+// Intervals of binding public addresses with the address resolver.
+const (
+	bindInterval      = 5 * time.Minute
+	bindRetryInterval = 10 * time.Second
+)
+
 // Network types.
 const (
-	DmsgType = dmsg.Type
-	STCPType = stcp.Type
+	DmsgType  = dmsg.Type
+	STCPType  = stcp.Type
+	SUDPType  = sudp.Type
+	SUDPHType = sudph.Type
+)
+
+// MTUs of network types: the largest single write which is delivered in one piece.
+const (
+	// DmsgMTU is limited by the size of a dmsg noise frame.
+	DmsgMTU = noise.MaxWriteSize
+	// STCPMTU is not limited, stcp writes go straight to a TCP connection.
+	STCPMTU = math.MaxInt32
+	// SUDPMTU is not limited, sudp sessions are reliable streams which segment writes themselves.
+	SUDPMTU = math.MaxInt32
+	// SUDPHMTU is the same as SUDPMTU, sudph connections are sudp sessions.
+	SUDPHMTU = SUDPMTU
+	// DefaultMTU is used for unknown network types.
+	DefaultMTU = DmsgMTU
 )
 
+// MTU returns the MTU of the network type.
+func MTU(network string) int {
+	switch network {
+	case DmsgType:
+		return DmsgMTU
+	case STCPType:
+		return STCPMTU
+	case SUDPType:
+		return SUDPMTU
+	case SUDPHType:
+		return SUDPHMTU
+	default:
+		if rn, ok := registeredNetworkOf(network); ok {
+			return rn.mtu
+		}
+
+		return DefaultMTU
+	}
+}
+
 var (
 	// ErrUnknownNetwork occurs on attempt to dial an unknown network type.
 	ErrUnknownNetwork = errors.New("unknown network type")
+
+	// ErrInvalidAddr occurs if a network client returns an address which is not in the `pk:port` form.
+	ErrInvalidAddr = errors.New("invalid address")
 )
 
 // NetworkConfig is a common interface for network configs.
@@ -54,9 +106,13 @@ func (c *DmsgConfig) Type() string {
 }
 
 // STCPConfig defines config for STCP network.
+// If AddressResolver is set, addresses of visors missing in PubKeyTable are looked up with it,
+// and PublicAddr (or LocalAddr if it's not set) is bound as the address of the local visor.
 type STCPConfig struct {
-	PubKeyTable map[cipher.PubKey]string `json:"pk_table"`
-	LocalAddr   string                   `json:"local_address"`
+	PubKeyTable     map[cipher.PubKey]string `json:"pk_table"`
+	LocalAddr       string                   `json:"local_address"`
+	PublicAddr      string                   `json:"public_address,omitempty"`
+	AddressResolver string                   `json:"address_resolver,omitempty"`
 }
 
 // Type returns STCPType.
@@ -64,26 +120,92 @@ func (c *STCPConfig) Type() string {
 	return STCPType
 }
 
+// SUDPConfig defines config for SUDP network.
+// Fields have the same meaning as the ones of STCPConfig.
+type SUDPConfig struct {
+	PubKeyTable     map[cipher.PubKey]string `json:"pk_table"`
+	LocalAddr       string                   `json:"local_address"`
+	PublicAddr      string                   `json:"public_address,omitempty"`
+	AddressResolver string                   `json:"address_resolver,omitempty"`
+}
+
+// Type returns SUDPType.
+func (c *SUDPConfig) Type() string {
+	return SUDPType
+}
+
+// SUDPHConfig defines config for SUDPH network.
+// Public addresses of visors are bound with the Rendezvous UDP address and resolved with AddressResolver.
+// LocalAddr may be left blank to listen on a random port. SUDPH requires Dmsg.
+type SUDPHConfig struct {
+	LocalAddr       string `json:"local_address,omitempty"`
+	AddressResolver string `json:"address_resolver"`
+	Rendezvous      string `json:"rendezvous"`
+}
+
+// Type returns SUDPHType.
+func (c *SUDPHConfig) Type() string {
+	return SUDPHType
+}
+
 // Config represents a network configuration.
+// Networks holds configs of network types registered with RegisterNetwork, keyed by network type.
 type Config struct {
-	PubKey cipher.PubKey
-	SecKey cipher.SecKey
-	Dmsg   *DmsgConfig
-	STCP   *STCPConfig
+	PubKey   cipher.PubKey
+	SecKey   cipher.SecKey
+	Dmsg     *DmsgConfig
+	STCP     *STCPConfig
+	SUDP     *SUDPConfig
+	SUDPH    *SUDPHConfig
+	Networks map[string]json.RawMessage
 }
 
 // Network represents a network between nodes in Skywire.
 type Network struct {
 	conf     Config
-	networks []string // networks to be used with transports
+	networks []string          // networks to be used with transports
+	clients  map[string]Client // key: network type
+	mx       sync.RWMutex      // guards networks and clients
 	dmsgC    *dmsg.Client
 	stcpC    *stcp.Client
+	sudpC    *sudp.Client
+	sudphC   *sudph.Client
+
+	arClients map[string]arclient.APIClient // key: network type
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 // New creates a network from a config.
 func New(conf Config) *Network {
 	var dmsgC *dmsg.Client
 	var stcpC *stcp.Client
+	var sudpC *sudp.Client
+	var sudphC *sudph.Client
+
+	// networks using the same address resolver share the client, so that they share the nonce
+	byAddr := make(map[string]arclient.APIClient)
+	arClient := func(arAddr string) arclient.APIClient {
+		c, ok := byAddr[arAddr]
+		if !ok {
+			c = arclient.NewHTTP(arAddr, conf.PubKey, conf.SecKey)
+			byAddr[arAddr] = c
+		}
+
+		return c
+	}
+
+	arClients := make(map[string]arclient.APIClient)
+	pkTable := func(network, arAddr string, static map[cipher.PubKey]string) stcp.PKTable {
+		if arAddr == "" {
+			return stcp.NewTable(static)
+		}
+
+		c := arClient(arAddr)
+		arClients[network] = c
+
+		return arclient.NewPKTable(c, network, static, arclient.DefaultCacheTTL)
+	}
 
 	if conf.Dmsg != nil {
 		c := &dmsg.Config{
@@ -95,31 +217,86 @@ func New(conf Config) *Network {
 	}
 
 	if conf.STCP != nil {
-		stcpC = stcp.NewClient(conf.PubKey, conf.SecKey, stcp.NewTable(conf.STCP.PubKeyTable))
+		table := pkTable(STCPType, conf.STCP.AddressResolver, conf.STCP.PubKeyTable)
+		stcpC = stcp.NewClient(conf.PubKey, conf.SecKey, table)
 		stcpC.SetLogger(logging.MustGetLogger("snet.stcpC"))
 	}
 
-	return NewRaw(conf, dmsgC, stcpC)
+	if conf.SUDP != nil {
+		table := pkTable(SUDPType, conf.SUDP.AddressResolver, conf.SUDP.PubKeyTable)
+		sudpC = sudp.NewClient(conf.PubKey, conf.SecKey, table)
+		sudpC.SetLogger(logging.MustGetLogger("snet.sudpC"))
+	}
+
+	if conf.SUDPH != nil && dmsgC != nil {
+		sudphC = sudph.NewClient(conf.PubKey, conf.SecKey, dmsgC, arClient(conf.SUDPH.AddressResolver), conf.SUDPH.Rendezvous)
+		sudphC.SetLogger(logging.MustGetLogger("snet.sudphC"))
+	}
+
+	n := NewRaw(conf, dmsgC, stcpC, sudpC, sudphC)
+	n.arClients = arClients
+
+	return n
 }
 
-// NewRaw creates a network from a config and a dmsg client.
-func NewRaw(conf Config, dmsgC *dmsg.Client, stcpC *stcp.Client) *Network {
-	networks := make([]string, 0)
+// NewRaw creates a network from a config and network clients.
+// Clients of other network types may be passed as `custom`, configs of these types in conf.Networks are ignored.
+func NewRaw(conf Config, dmsgC *dmsg.Client, stcpC *stcp.Client, sudpC *sudp.Client, sudphC *sudph.Client, custom ...Client) *Network {
+	n := &Network{
+		conf:    conf,
+		clients: make(map[string]Client),
+		dmsgC:   dmsgC,
+		stcpC:   stcpC,
+		sudpC:   sudpC,
+		sudphC:  sudphC,
+		done:    make(chan struct{}),
+	}
 
 	if dmsgC != nil {
-		networks = append(networks, DmsgType)
+		n.addClient(dmsgClient{dmsgC})
 	}
 
 	if stcpC != nil {
-		networks = append(networks, STCPType)
+		n.addClient(stcpClient{stcpC})
+	}
+
+	if sudpC != nil {
+		n.addClient(stcpClient{sudpC})
+	}
+
+	if sudphC != nil {
+		n.addClient(stcpClient{sudphC})
 	}
 
-	return &Network{
-		conf:     conf,
-		networks: networks,
-		dmsgC:    dmsgC,
-		stcpC:    stcpC,
+	for _, c := range custom {
+		n.addClient(c)
 	}
+
+	return n
+}
+
+// addClient adds the client to the networks used with transports. It reports false if its type is taken.
+func (n *Network) addClient(c Client) bool {
+	n.mx.Lock()
+	defer n.mx.Unlock()
+
+	if _, ok := n.clients[c.Type()]; ok {
+		return false
+	}
+
+	n.clients[c.Type()] = c
+	n.networks = append(n.networks, c.Type())
+
+	return true
+}
+
+func (n *Network) client(network string) (Client, bool) {
+	n.mx.RLock()
+	defer n.mx.RUnlock()
+
+	c, ok := n.clients[network]
+
+	return c, ok
 }
 
 // Init initiates server connections.
@@ -135,39 +312,148 @@ func (n *Network) Init(_ context.Context) error {
 			if err := n.stcpC.Serve(n.conf.STCP.LocalAddr); err != nil {
 				return fmt.Errorf("failed to initiate 'stcp': %v", err)
 			}
+
+			n.bindAddr(STCPType, n.conf.STCP.PublicAddr, n.conf.STCP.LocalAddr)
 		} else {
 			fmt.Println("No config found for stcp")
 		}
 	}
 
+	if n.conf.SUDP != nil && n.sudpC != nil && n.conf.SUDP.LocalAddr != "" {
+		if err := n.sudpC.Serve(n.conf.SUDP.LocalAddr); err != nil {
+			return fmt.Errorf("failed to initiate 'sudp': %v", err)
+		}
+
+		n.bindAddr(SUDPType, n.conf.SUDP.PublicAddr, n.conf.SUDP.LocalAddr)
+	}
+
+	if n.conf.SUDPH != nil && n.sudphC != nil {
+		addr := n.conf.SUDPH.LocalAddr
+		if addr == "" {
+			addr = ":0"
+		}
+
+		if err := n.sudphC.Serve(addr); err != nil {
+			return fmt.Errorf("failed to initiate 'sudph': %v", err)
+		}
+	}
+
+	netTypes := make([]string, 0, len(n.conf.Networks))
+	for netType := range n.conf.Networks {
+		netTypes = append(netTypes, netType)
+	}
+
+	sort.Strings(netTypes)
+
+	for _, netType := range netTypes {
+		if err := n.initNetwork(netType, n.conf.Networks[netType]); err != nil {
+			return fmt.Errorf("failed to initiate '%s': %v", netType, err)
+		}
+	}
+
 	return nil
 }
 
-// Close closes underlying connections.
-func (n *Network) Close() error {
-	wg := new(sync.WaitGroup)
-	wg.Add(2)
+// initNetwork creates a client of a registered network type, unless one was passed to NewRaw.
+func (n *Network) initNetwork(netType string, conf json.RawMessage) error {
+	if _, ok := n.client(netType); ok {
+		return nil
+	}
 
-	var dmsgErr error
-	go func() {
-		dmsgErr = n.dmsgC.Close()
-		wg.Done()
-	}()
+	rn, ok := registeredNetworkOf(netType)
+	if !ok {
+		return ErrUnknownNetwork
+	}
+
+	c, err := rn.factory(NetworkEnv{
+		PubKey: n.conf.PubKey,
+		SecKey: n.conf.SecKey,
+		Dmsg:   n.dmsgC,
+		Logger: logging.MustGetLogger("snet." + netType),
+	}, conf)
+	if err != nil {
+		return err
+	}
+
+	if c.Type() != netType || !n.addClient(c) {
+		if err := c.Close(); err != nil {
+			logging.MustGetLogger("snet").WithError(err).Warnf("Failed to close %s client", netType)
+		}
+
+		return fmt.Errorf("client of type '%s' can't be used as '%s'", c.Type(), netType)
+	}
+
+	return nil
+}
+
+// bindAddr keeps the public address of the network bound with the address resolver until the Network is closed.
+// It does nothing if the network doesn't use an address resolver.
+func (n *Network) bindAddr(network, publicAddr, localAddr string) {
+	c, ok := n.arClients[network]
+	if !ok {
+		return
+	}
+
+	addr := publicAddr
+	if addr == "" {
+		addr = localAddr
+	}
+
+	log := logging.MustGetLogger("snet.arclient")
 
-	var stcpErr error
 	go func() {
-		stcpErr = n.stcpC.Close()
-		wg.Done()
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), arclient.ResolveTimeout)
+			boundAddr, err := c.Bind(ctx, network, addr)
+			cancel()
+
+			interval := bindInterval
+			if err != nil {
+				log.WithError(err).Warnf("Failed to bind %s address %s with address resolver", network, addr)
+				interval = bindRetryInterval
+			} else {
+				log.Debugf("Bound %s address %s with address resolver", network, boundAddr)
+			}
+
+			select {
+			case <-n.done:
+				return
+			case <-time.After(interval):
+			}
+		}
 	}()
+}
 
-	wg.Wait()
+// Close closes underlying connections.
+func (n *Network) Close() error {
+	n.closeOnce.Do(func() { close(n.done) })
 
-	if dmsgErr != nil {
-		return dmsgErr
+	n.mx.RLock()
+	clients := make([]Client, 0, len(n.networks))
+	for _, network := range n.networks {
+		clients = append(clients, n.clients[network])
 	}
-	if stcpErr != nil {
-		return stcpErr
+	n.mx.RUnlock()
+
+	wg := new(sync.WaitGroup)
+	wg.Add(len(clients))
+
+	errs := make([]error, len(clients))
+	for i, c := range clients {
+		go func(i int, c Client) {
+			errs[i] = c.Close()
+			wg.Done()
+		}(i, c)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
 	}
+
 	return nil
 }
 
@@ -178,7 +464,12 @@ func (n *Network) LocalPK() cipher.PubKey { return n.conf.PubKey }
 func (n *Network) LocalSK() cipher.SecKey { return n.conf.SecKey }
 
 // TransportNetworks returns network types that are used for transports.
-func (n *Network) TransportNetworks() []string { return n.networks }
+func (n *Network) TransportNetworks() []string {
+	n.mx.RLock()
+	defer n.mx.RUnlock()
+
+	return append([]string(nil), n.networks...)
+}
 
 // Dmsg returns underlying dmsg client.
 func (n *Network) Dmsg() *dmsg.Client { return n.dmsgC }
@@ -186,6 +477,12 @@ func (n *Network) Dmsg() *dmsg.Client { return n.dmsgC }
 // STcp returns the underlying stcp.Client.
 func (n *Network) STcp() *stcp.Client { return n.stcpC }
 
+// SUdp returns the underlying sudp.Client.
+func (n *Network) SUdp() *sudp.Client { return n.sudpC }
+
+// SUdpH returns the underlying sudph.Client.
+func (n *Network) SUdpH() *sudph.Client { return n.sudphC }
+
 // Dialer is an entity that can be dialed and asked for its type.
 type Dialer interface {
 	Dial(ctx context.Context, remote cipher.PubKey, port uint16) (net.Conn, error)
@@ -194,51 +491,47 @@ type Dialer interface {
 
 // Dial dials a visor by its public key and returns a connection.
 func (n *Network) Dial(ctx context.Context, network string, pk cipher.PubKey, port uint16) (*Conn, error) {
-	switch network {
-	case DmsgType:
-		addr := dmsg.Addr{
-			PK:   pk,
-			Port: port,
-		}
-
-		conn, err := n.dmsgC.Dial(ctx, addr)
-		if err != nil {
-			return nil, err
-		}
+	c, ok := n.client(network)
+	if !ok {
+		return nil, ErrUnknownNetwork
+	}
 
-		return makeConn(conn, network), nil
-	case STCPType:
-		conn, err := n.stcpC.Dial(ctx, pk, port)
-		if err != nil {
-			return nil, err
-		}
+	conn, err := c.Dial(ctx, pk, port)
+	if err != nil {
+		return nil, err
+	}
 
-		return makeConn(conn, network), nil
-	default:
-		return nil, ErrUnknownNetwork
+	sConn, err := makeConn(conn, network)
+	if err != nil {
+		closeConn(conn)
+		return nil, err
 	}
+
+	return sConn, nil
 }
 
 // Listen listens on the specified port.
 func (n *Network) Listen(network string, port uint16) (*Listener, error) {
-	switch network {
-	case DmsgType:
-		lis, err := n.dmsgC.Listen(port)
-		if err != nil {
-			return nil, err
-		}
+	c, ok := n.client(network)
+	if !ok {
+		return nil, ErrUnknownNetwork
+	}
 
-		return makeListener(lis, network), nil
-	case STCPType:
-		lis, err := n.stcpC.Listen(port)
-		if err != nil {
-			return nil, err
+	lis, err := c.Listen(port)
+	if err != nil {
+		return nil, err
+	}
+
+	sLis, err := makeListener(lis, network)
+	if err != nil {
+		if err := lis.Close(); err != nil {
+			logging.MustGetLogger("snet").WithError(err).Warn("Failed to close listener")
 		}
 
-		return makeListener(lis, network), nil
-	default:
-		return nil, ErrUnknownNetwork
+		return nil, err
 	}
+
+	return sLis, nil
 }
 
 // Listener represents a listener.
@@ -249,9 +542,13 @@ type Listener struct {
 	network string
 }
 
-func makeListener(l net.Listener, network string) *Listener {
-	lPK, lPort := disassembleAddr(l.Addr())
-	return &Listener{Listener: l, lPK: lPK, lPort: lPort, network: network}
+func makeListener(l net.Listener, network string) (*Listener, error) {
+	lPK, lPort, err := disassembleAddr(l.Addr())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Listener{Listener: l, lPK: lPK, lPort: lPort, network: network}, nil
 }
 
 // LocalPK returns a local public key of listener.
@@ -270,7 +567,13 @@ func (l Listener) AcceptConn() (*Conn, error) {
 		return nil, err
 	}
 
-	return makeConn(conn, l.network), nil
+	sConn, err := makeConn(conn, l.network)
+	if err != nil {
+		closeConn(conn)
+		return nil, err
+	}
+
+	return sConn, nil
 }
 
 // Conn represent a connection between nodes in Skywire.
@@ -283,10 +586,24 @@ type Conn struct {
 	network string
 }
 
-func makeConn(conn net.Conn, network string) *Conn {
-	lPK, lPort := disassembleAddr(conn.LocalAddr())
-	rPK, rPort := disassembleAddr(conn.RemoteAddr())
-	return &Conn{Conn: conn, lPK: lPK, rPK: rPK, lPort: lPort, rPort: rPort, network: network}
+func makeConn(conn net.Conn, network string) (*Conn, error) {
+	lPK, lPort, err := disassembleAddr(conn.LocalAddr())
+	if err != nil {
+		return nil, err
+	}
+
+	rPK, rPort, err := disassembleAddr(conn.RemoteAddr())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{Conn: conn, lPK: lPK, rPK: rPK, lPort: lPort, rPort: rPort, network: network}, nil
+}
+
+func closeConn(conn net.Conn) {
+	if err := conn.Close(); err != nil {
+		logging.MustGetLogger("snet").WithError(err).Warn("Failed to close connection")
+	}
 }
 
 // LocalPK returns local public key of connection.
@@ -304,21 +621,22 @@ func (c Conn) RemotePort() uint16 { return c.rPort }
 // Network returns network of connection.
 func (c Conn) Network() string { return c.network }
 
-func disassembleAddr(addr net.Addr) (pk cipher.PubKey, port uint16) {
+// disassembleAddr parses an address of the `pk:port` form, which is the form of dmsg.Addr.
+func disassembleAddr(addr net.Addr) (pk cipher.PubKey, port uint16, err error) {
 	strs := strings.Split(addr.String(), ":")
 	if len(strs) != 2 {
-		panic(fmt.Errorf("network.disassembleAddr: %v %s", "invalid addr", addr.String()))
+		return pk, 0, fmt.Errorf("%w: %s", ErrInvalidAddr, addr.String())
 	}
 
 	if err := pk.Set(strs[0]); err != nil {
-		panic(fmt.Errorf("network.disassembleAddr: %v %s", err, addr.String()))
+		return pk, 0, fmt.Errorf("%w %s: %v", ErrInvalidAddr, addr.String(), err)
 	}
 
 	if strs[1] != "~" {
 		if _, err := fmt.Sscanf(strs[1], "%d", &port); err != nil {
-			panic(fmt.Errorf("network.disassembleAddr: %v", err))
+			return pk, 0, fmt.Errorf("%w %s: %v", ErrInvalidAddr, addr.String(), err)
 		}
 	}
 
-	return
+	return pk, port, nil
 }
@@ -16,7 +16,8 @@ func TestDisassembleAddr(t *testing.T) {
 		PK: pk, Port: port,
 	}
 
-	gotPK, gotPort := disassembleAddr(addr)
+	gotPK, gotPort, err := disassembleAddr(addr)
+	require.NoError(t, err)
 	require.Equal(t, pk, gotPK)
 	require.Equal(t, port, gotPort)
 }
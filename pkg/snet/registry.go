@@ -0,0 +1,165 @@
+package snet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/stcp"
+)
+
+var (
+	// ErrNetworkRegistered occurs on attempt to register a network type twice or to register a built-in one.
+	ErrNetworkRegistered = errors.New("network type is already registered")
+)
+
+// Client is a client of a network type which can be plugged into Network.
+// Local and remote addresses of its connections and listeners have to be in the `pk:port` form of dmsg.Addr,
+// otherwise Network fails to dial and accept them with ErrInvalidAddr.
+type Client interface {
+	Dial(ctx context.Context, remote cipher.PubKey, port uint16) (net.Conn, error)
+	Listen(port uint16) (net.Listener, error)
+	Close() error
+	Type() string
+}
+
+// NetworkEnv is what factories of registered network types may build their clients upon.
+type NetworkEnv struct {
+	PubKey cipher.PubKey
+	SecKey cipher.SecKey
+	Dmsg   *dmsg.Client // nil if dmsg is not configured
+	Logger *logging.Logger
+}
+
+// NetworkFactory creates a client of a registered network type from its JSON config.
+// The client is expected to accept remote connections once it's created.
+type NetworkFactory func(env NetworkEnv, conf json.RawMessage) (Client, error)
+
+type registeredNetwork struct {
+	mtu     int
+	factory NetworkFactory
+}
+
+var (
+	registryMx sync.RWMutex
+	registry   = make(map[string]registeredNetwork)
+)
+
+// RegisterNetwork registers a network type, so that Network instantiates its client
+// if Config.Networks contains a config of `netType`.
+// `mtu` is returned by MTU for the network type, DefaultMTU is used if it's not positive.
+// It's meant to be called from init functions of packages implementing network types.
+func RegisterNetwork(netType string, mtu int, factory NetworkFactory) error {
+	if netType == "" || factory == nil {
+		return errors.New("network type and factory are required")
+	}
+
+	registryMx.Lock()
+	defer registryMx.Unlock()
+
+	if _, ok := registry[netType]; ok || isBuiltinNetwork(netType) {
+		return fmt.Errorf("%w: %s", ErrNetworkRegistered, netType)
+	}
+
+	if mtu <= 0 {
+		mtu = DefaultMTU
+	}
+
+	registry[netType] = registeredNetwork{mtu: mtu, factory: factory}
+
+	return nil
+}
+
+// RegisteredNetworks returns registered network types, sorted by name. Built-in network types are not included.
+func RegisteredNetworks() []string {
+	registryMx.RLock()
+	defer registryMx.RUnlock()
+
+	types := make([]string, 0, len(registry))
+	for netType := range registry {
+		types = append(types, netType)
+	}
+
+	sort.Strings(types)
+
+	return types
+}
+
+func registeredNetworkOf(netType string) (registeredNetwork, bool) {
+	registryMx.RLock()
+	defer registryMx.RUnlock()
+
+	rn, ok := registry[netType]
+
+	return rn, ok
+}
+
+func isBuiltinNetwork(netType string) bool {
+	switch netType {
+	case DmsgType, STCPType, SUDPType, SUDPHType:
+		return true
+	default:
+		return false
+	}
+}
+
+// dmsgClient adapts dmsg.Client to Client.
+type dmsgClient struct {
+	*dmsg.Client
+}
+
+func (c dmsgClient) Dial(ctx context.Context, remote cipher.PubKey, port uint16) (net.Conn, error) {
+	return c.Client.Dial(ctx, dmsg.Addr{PK: remote, Port: port})
+}
+
+func (c dmsgClient) Listen(port uint16) (net.Listener, error) {
+	lis, err := c.Client.Listen(port)
+	if err != nil {
+		return nil, err
+	}
+
+	return lis, nil
+}
+
+func (c dmsgClient) Type() string {
+	return DmsgType
+}
+
+// stcpBasedClient is implemented by clients of stcp, sudp and sudph.
+type stcpBasedClient interface {
+	Dial(ctx context.Context, rPK cipher.PubKey, rPort uint16) (*stcp.Conn, error)
+	Listen(lPort uint16) (*stcp.Listener, error)
+	Close() error
+	Type() string
+}
+
+// stcpClient adapts clients of stcp, sudp and sudph to Client.
+type stcpClient struct {
+	stcpBasedClient
+}
+
+func (c stcpClient) Dial(ctx context.Context, remote cipher.PubKey, port uint16) (net.Conn, error) {
+	conn, err := c.stcpBasedClient.Dial(ctx, remote, port)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (c stcpClient) Listen(port uint16) (net.Listener, error) {
+	lis, err := c.stcpBasedClient.Listen(port)
+	if err != nil {
+		return nil, err
+	}
+
+	return lis, nil
+}
@@ -0,0 +1,191 @@
+package snet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const pipeType = "pipe"
+
+func init() {
+	if err := RegisterNetwork(pipeType, 1024, newPipeClient); err != nil {
+		panic(err)
+	}
+}
+
+// pipeClient is a network client which connects to its own listeners with net.Pipe.
+type pipeClient struct {
+	pk     cipher.PubKey
+	greet  string
+	lis    map[uint16]*pipeListener
+	closed bool
+	tcp    bool // whether connections have TCP addresses instead of dmsg ones
+}
+
+func newPipeClient(env NetworkEnv, conf json.RawMessage) (Client, error) {
+	var c struct {
+		Greeting string `json:"greeting"`
+	}
+
+	if err := json.Unmarshal(conf, &c); err != nil {
+		return nil, err
+	}
+
+	return &pipeClient{pk: env.PubKey, greet: c.Greeting, lis: make(map[uint16]*pipeListener)}, nil
+}
+
+func (c *pipeClient) Dial(_ context.Context, remote cipher.PubKey, port uint16) (net.Conn, error) {
+	lis, ok := c.lis[port]
+	if !ok || remote != c.pk {
+		return nil, errors.New("nothing listens")
+	}
+
+	lConn, rConn := net.Pipe()
+	var lAddr, rAddr net.Addr = dmsg.Addr{PK: c.pk, Port: port + 1}, dmsg.Addr{PK: remote, Port: port}
+
+	if c.tcp {
+		lAddr = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: int(port + 1)}
+		rAddr = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: int(port)}
+	}
+
+	lis.ch <- pipeConn{Conn: rConn, lAddr: rAddr, rAddr: lAddr}
+
+	return pipeConn{Conn: lConn, lAddr: lAddr, rAddr: rAddr}, nil
+}
+
+func (c *pipeClient) Listen(port uint16) (net.Listener, error) {
+	lis := &pipeListener{addr: dmsg.Addr{PK: c.pk, Port: port}, ch: make(chan net.Conn, 1)}
+	c.lis[port] = lis
+
+	return lis, nil
+}
+
+func (c *pipeClient) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (c *pipeClient) Type() string {
+	return pipeType
+}
+
+type pipeConn struct {
+	net.Conn
+	lAddr, rAddr net.Addr
+}
+
+func (c pipeConn) LocalAddr() net.Addr  { return c.lAddr }
+func (c pipeConn) RemoteAddr() net.Addr { return c.rAddr }
+
+type pipeListener struct {
+	addr dmsg.Addr
+	ch   chan net.Conn
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) { return <-l.ch, nil }
+func (l *pipeListener) Close() error              { return nil }
+func (l *pipeListener) Addr() net.Addr            { return l.addr }
+
+func TestRegisterNetwork(t *testing.T) {
+	assert.True(t, errors.Is(RegisterNetwork(pipeType, 0, newPipeClient), ErrNetworkRegistered))
+	assert.True(t, errors.Is(RegisterNetwork(STCPType, 0, newPipeClient), ErrNetworkRegistered))
+	assert.Error(t, RegisterNetwork("", 0, newPipeClient))
+
+	assert.Contains(t, RegisteredNetworks(), pipeType)
+	assert.Equal(t, 1024, MTU(pipeType))
+	assert.Equal(t, DefaultMTU, MTU("unknown"))
+}
+
+func TestNetwork_RegisteredNetwork(t *testing.T) {
+	pk, sk := cipher.GenerateKeyPair()
+
+	t.Run("dial and listen", func(t *testing.T) {
+		n := New(Config{
+			PubKey:   pk,
+			SecKey:   sk,
+			Networks: map[string]json.RawMessage{pipeType: json.RawMessage(`{"greeting":"hello"}`)},
+		})
+		require.NoError(t, n.Init(context.TODO()))
+		assert.Equal(t, []string{pipeType}, n.TransportNetworks())
+
+		c, ok := n.client(pipeType)
+		require.True(t, ok)
+		assert.Equal(t, "hello", c.(*pipeClient).greet)
+
+		lis, err := n.Listen(pipeType, 10)
+		require.NoError(t, err)
+		assert.Equal(t, pipeType, lis.Network())
+
+		conn, err := n.Dial(context.TODO(), pipeType, pk, 10)
+		require.NoError(t, err)
+		assert.Equal(t, pk, conn.RemotePK())
+		assert.Equal(t, uint16(10), conn.RemotePort())
+
+		rConn, err := lis.AcceptConn()
+		require.NoError(t, err)
+		assert.Equal(t, uint16(11), rConn.RemotePort())
+
+		go func() {
+			_, err := conn.Write([]byte("ping"))
+			assert.NoError(t, err)
+		}()
+
+		buf := make([]byte, 4)
+		_, err = io.ReadFull(rConn, buf)
+		require.NoError(t, err)
+		assert.Equal(t, "ping", string(buf))
+
+		require.NoError(t, n.Close())
+		assert.True(t, c.(*pipeClient).closed)
+	})
+
+	t.Run("client passed to NewRaw", func(t *testing.T) {
+		c := &pipeClient{pk: pk, lis: make(map[uint16]*pipeListener)}
+		n := NewRaw(Config{
+			PubKey:   pk,
+			SecKey:   sk,
+			Networks: map[string]json.RawMessage{pipeType: json.RawMessage(`invalid`)},
+		}, nil, nil, nil, nil, c)
+		require.NoError(t, n.Init(context.TODO()))
+
+		got, ok := n.client(pipeType)
+		require.True(t, ok)
+		assert.Equal(t, c, got)
+	})
+
+	t.Run("client with non-dmsg addresses", func(t *testing.T) {
+		c := &pipeClient{pk: pk, lis: make(map[uint16]*pipeListener), tcp: true}
+		n := NewRaw(Config{PubKey: pk, SecKey: sk}, nil, nil, nil, nil, c)
+		require.NoError(t, n.Init(context.TODO()))
+
+		lis, err := n.Listen(pipeType, 10)
+		require.NoError(t, err)
+
+		_, err = n.Dial(context.TODO(), pipeType, pk, 10)
+		assert.True(t, errors.Is(err, ErrInvalidAddr))
+
+		_, err = lis.AcceptConn()
+		assert.True(t, errors.Is(err, ErrInvalidAddr))
+	})
+
+	t.Run("unknown network type", func(t *testing.T) {
+		n := New(Config{
+			PubKey:   pk,
+			SecKey:   sk,
+			Networks: map[string]json.RawMessage{"unknown": json.RawMessage(`{}`)},
+		})
+		assert.Error(t, n.Init(context.TODO()))
+
+		_, err := n.Dial(context.TODO(), "unknown", pk, 10)
+		assert.Equal(t, ErrUnknownNetwork, err)
+	})
+}
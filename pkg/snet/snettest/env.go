@@ -2,8 +2,11 @@ package snettest
 
 import (
 	"context"
+	"net"
+	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/SkycoinProject/dmsg"
 	"github.com/SkycoinProject/dmsg/cipher"
@@ -12,8 +15,12 @@ import (
 	"github.com/stretchr/testify/require"
 	"golang.org/x/net/nettest"
 
+	"github.com/SkycoinProject/skywire-mainnet/pkg/address-resolver/arclient"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/address-resolver/arserver"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/snet"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/stcp"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/sudp"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/sudph"
 )
 
 // KeyPair holds a public/private key pair.
@@ -54,16 +61,22 @@ func NewEnv(t *testing.T, keys []KeyPair, networks []string) *Env {
 	dmsgD := disc.NewMock()
 	dmsgS, dmsgSErr := createDmsgSrv(t, dmsgD)
 
-	const baseSTCPPort = 7033
+	const (
+		baseSTCPPort = 7033
+		baseSUDPPort = 7133
+	)
 
 	tableEntries := make(map[cipher.PubKey]string)
+	udpTableEntries := make(map[cipher.PubKey]string)
 	for i, pair := range keys {
 		tableEntries[pair.PK] = "127.0.0.1:" + strconv.Itoa(baseSTCPPort+i)
+		udpTableEntries[pair.PK] = "127.0.0.1:" + strconv.Itoa(baseSUDPPort+i)
 	}
 
 	table := stcp.NewTable(tableEntries)
+	udpTable := stcp.NewTable(udpTableEntries)
 
-	var hasDmsg, hasStcp bool
+	var hasDmsg, hasStcp, hasSudp, hasSudph bool
 
 	for _, network := range networks {
 		switch network {
@@ -71,15 +84,39 @@ func NewEnv(t *testing.T, keys []KeyPair, networks []string) *Env {
 			hasDmsg = true
 		case stcp.Type:
 			hasStcp = true
+		case sudp.Type:
+			hasSudp = true
+		case sudph.Type:
+			// sudph is coordinated over dmsg
+			hasDmsg, hasSudph = true, true
 		}
 	}
 
+	// Prepare address resolver and rendezvous for `sudph`.
+	var (
+		arSrv     *httptest.Server
+		arUDPConn net.PacketConn
+	)
+
+	if hasSudph {
+		srv := arserver.New(nil, arserver.DefaultEntryTTL)
+		arSrv = httptest.NewServer(srv)
+
+		var err error
+		arUDPConn, err = net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		go func() { _ = srv.ServeUDP(arUDPConn) }() // nolint:errcheck
+	}
+
 	// Prepare `snets`.
 	ns := make([]*snet.Network, len(keys))
 
 	for i, pairs := range keys {
 		var dmsgClient *dmsg.Client
 		var stcpClient *stcp.Client
+		var sudpClient *sudp.Client
+		var sudphClient *sudph.Client
 
 		if hasDmsg {
 			dmsgClient = dmsg.NewClient(pairs.PK, pairs.SK, dmsgD, nil)
@@ -90,6 +127,22 @@ func NewEnv(t *testing.T, keys []KeyPair, networks []string) *Env {
 			stcpClient = stcp.NewClient(pairs.PK, pairs.SK, table)
 		}
 
+		if hasSudp {
+			sudpClient = sudp.NewClient(pairs.PK, pairs.SK, udpTable)
+		}
+
+		var sudphConf *snet.SUDPHConfig
+
+		if hasSudph {
+			arC := arclient.NewHTTP(arSrv.URL, pairs.PK, pairs.SK)
+			sudphClient = sudph.NewClient(pairs.PK, pairs.SK, dmsgClient, arC, arUDPConn.LocalAddr().String())
+			sudphConf = &snet.SUDPHConfig{
+				LocalAddr:       "127.0.0.1:0",
+				AddressResolver: arSrv.URL,
+				Rendezvous:      arUDPConn.LocalAddr().String(),
+			}
+		}
+
 		port := 7033
 		n := snet.NewRaw(
 			snet.Config{
@@ -101,19 +154,51 @@ func NewEnv(t *testing.T, keys []KeyPair, networks []string) *Env {
 				STCP: &snet.STCPConfig{
 					LocalAddr: "127.0.0.1:" + strconv.Itoa(port+i),
 				},
+				SUDP: &snet.SUDPConfig{
+					LocalAddr: "127.0.0.1:" + strconv.Itoa(baseSUDPPort+i),
+				},
+				SUDPH: sudphConf,
 			},
 			dmsgClient,
 			stcpClient,
+			sudpClient,
+			sudphClient,
 		)
 		require.NoError(t, n.Init(context.TODO()))
 		ns[i] = n
 	}
 
+	if hasSudph {
+		// wait for all the visors to bind with the rendezvous
+		pk, sk := cipher.GenerateKeyPair()
+		arC := arclient.NewHTTP(arSrv.URL, pk, sk)
+
+		for _, pair := range keys {
+			deadline := time.Now().Add(5 * time.Second)
+
+			for {
+				_, err := arC.Resolve(context.TODO(), sudph.Type, pair.PK)
+				if err == nil {
+					break
+				}
+
+				require.True(t, time.Now().Before(deadline), "visor %s is not bound with rendezvous: %v", pair.PK, err)
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+	}
+
 	// Prepare teardown closure.
 	teardown := func() {
 		for _, n := range ns {
 			assert.NoError(t, n.Close())
 		}
+
+		if hasSudph {
+			arSrv.Close()
+			assert.NoError(t, arUDPConn.Close())
+		}
+
 		assert.NoError(t, dmsgS.Close())
 		for err := range dmsgSErr {
 			assert.NoError(t, err)
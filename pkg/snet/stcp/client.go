@@ -25,8 +25,11 @@ type Conn struct {
 	freePort func()
 }
 
-func newConn(conn net.Conn, deadline time.Time, hs Handshake, freePort func()) (*Conn, error) {
-	lAddr, rAddr, err := hs(conn, deadline)
+// NewConn performs the handshake over `conn` and wraps it into Conn.
+// `freePort` is called once the connection is closed (or if the handshake fails).
+// It's also used by other stream-based networks which share the stcp handshake.
+func NewConn(conn net.Conn, deadline time.Time, hs Handshake, freePort func()) (*Conn, error) {
+	sConn, lAddr, rAddr, err := hs(conn, deadline)
 	if err != nil {
 		_ = conn.Close() //nolint:errcheck
 
@@ -36,7 +39,7 @@ func newConn(conn net.Conn, deadline time.Time, hs Handshake, freePort func()) (
 
 		return nil, err
 	}
-	return &Conn{Conn: conn, lAddr: lAddr, rAddr: rAddr, freePort: freePort}, nil
+	return &Conn{Conn: sConn, lAddr: lAddr, rAddr: rAddr, freePort: freePort}, nil
 }
 
 // LocalAddr implements net.Conn
@@ -67,7 +70,8 @@ type Listener struct {
 	mx       sync.Mutex
 }
 
-func newListener(lAddr dmsg.Addr, freePort func()) *Listener {
+// NewListener creates a Listener of the local address `lAddr`. `freePort` is called once the listener is closed.
+func NewListener(lAddr dmsg.Addr, freePort func()) *Listener {
 	return &Listener{
 		lAddr:    lAddr,
 		freePort: freePort,
@@ -146,7 +150,7 @@ func NewClient(pk cipher.PubKey, sk cipher.SecKey, t PKTable) *Client {
 		lPK:  pk,
 		lSK:  sk,
 		t:    t,
-		p:    newPorter(PorterMinEphemeral),
+		p:    NewPorter(PorterMinEphemeral),
 		lMap: make(map[uint16]*Listener),
 		done: make(chan struct{}),
 	}
@@ -195,7 +199,7 @@ func (c *Client) acceptTCPConn() error {
 		return err
 	}
 	var lis *Listener
-	hs := ResponderHandshake(func(f2 Frame2) error {
+	hs := ResponderHandshake(c.lSK, func(f2 Frame2) error {
 		c.mx.Lock()
 		defer c.mx.Unlock()
 		var ok bool
@@ -204,7 +208,7 @@ func (c *Client) acceptTCPConn() error {
 		}
 		return nil
 	})
-	conn, err := newConn(tcpConn, time.Now().Add(HandshakeTimeout), hs, nil)
+	conn, err := NewConn(tcpConn, time.Now().Add(HandshakeTimeout), hs, nil)
 	if err != nil {
 		return err
 	}
@@ -231,7 +235,7 @@ func (c *Client) Dial(ctx context.Context, rPK cipher.PubKey, rPort uint16) (*Co
 		return nil, err
 	}
 	hs := InitiatorHandshake(c.lSK, dmsg.Addr{PK: c.lPK, Port: lPort}, dmsg.Addr{PK: rPK, Port: rPort})
-	return newConn(conn, time.Now().Add(HandshakeTimeout), hs, freePort)
+	return NewConn(conn, time.Now().Add(HandshakeTimeout), hs, freePort)
 }
 
 // Listen creates a new listener for stcp.
@@ -250,7 +254,7 @@ func (c *Client) Listen(lPort uint16) (*Listener, error) {
 	defer c.mx.Unlock()
 
 	lAddr := dmsg.Addr{PK: c.lPK, Port: lPort}
-	lis := newListener(lAddr, freePort)
+	lis := NewListener(lAddr, freePort)
 	c.lMap[lPort] = lis
 	return lis, nil
 }
@@ -21,13 +21,14 @@ func TestConn(t *testing.T) {
 
 func prepareConns(t *testing.T) (*Conn, *Conn, func()) {
 	aPK, aSK := cipher.GenerateKeyPair()
-	bPK, _ := cipher.GenerateKeyPair()
+	bPK, bSK := cipher.GenerateKeyPair()
 
-	aConn, bConn := net.Pipe()
+	// noise connections rely on zero-length writes not blocking, which is not the case for net.Pipe
+	aConn, bConn := tcpConns(t)
 
 	ihs := InitiatorHandshake(aSK, dmsg.Addr{PK: aPK, Port: 1}, dmsg.Addr{PK: bPK, Port: 1})
 
-	rhs := ResponderHandshake(func(f2 Frame2) error {
+	rhs := ResponderHandshake(bSK, func(f2 Frame2) error {
 		return nil
 	})
 
@@ -36,19 +37,20 @@ func prepareConns(t *testing.T) (*Conn, *Conn, func()) {
 	done := make(chan struct{})
 
 	go func() {
-		b, respErr = newConn(bConn, time.Now().Add(HandshakeTimeout), rhs, nil)
+		b, respErr = NewConn(bConn, time.Now().Add(HandshakeTimeout), rhs, nil)
 		close(done)
 	}()
 
-	a, err := newConn(aConn, time.Now().Add(HandshakeTimeout), ihs, nil)
+	a, err := NewConn(aConn, time.Now().Add(HandshakeTimeout), ihs, nil)
 	require.NoError(t, err)
 
 	<-done
 	require.NoError(t, respErr)
 
+	// connections may be already closed by the test
 	closeFunc := func() {
-		require.NoError(t, a.Close())
-		require.NoError(t, b.Close())
+		_ = a.Close() // nolint:errcheck
+		_ = b.Close() // nolint:errcheck
 	}
 
 	return a, b, closeFunc
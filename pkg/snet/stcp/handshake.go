@@ -9,10 +9,9 @@ import (
 	"net"
 	"time"
 
-	cipher2 "github.com/SkycoinProject/skycoin/src/cipher"
-
 	"github.com/SkycoinProject/dmsg"
 	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/noise"
 )
 
 const (
@@ -39,11 +38,11 @@ func IsHandshakeError(err error) bool {
 
 // middleware to add deadline and HandshakeError to handshakes
 func handshakeMiddleware(origin Handshake) Handshake {
-	return func(conn net.Conn, deadline time.Time) (lAddr, rAddr dmsg.Addr, err error) {
+	return func(conn net.Conn, deadline time.Time) (sConn net.Conn, lAddr, rAddr dmsg.Addr, err error) {
 		if err = conn.SetDeadline(deadline); err != nil {
 			return
 		}
-		if lAddr, rAddr, err = origin(conn, deadline); err != nil {
+		if sConn, lAddr, rAddr, err = origin(conn, deadline); err != nil {
 			err = HandshakeError(err.Error())
 		}
 
@@ -54,11 +53,40 @@ func handshakeMiddleware(origin Handshake) Handshake {
 }
 
 // Handshake represents a handshake.
-type Handshake func(conn net.Conn, deadline time.Time) (lAddr, rAddr dmsg.Addr, err error)
+// It returns `sConn`, which wraps `conn` and is to be used once the handshake is complete.
+type Handshake func(conn net.Conn, deadline time.Time) (sConn net.Conn, lAddr, rAddr dmsg.Addr, err error)
+
+// encryptConn performs a noise KK handshake over `conn` and wraps it with noise encryption.
+// As both sides of KK know the static public key of the other side beforehand,
+// the handshake only succeeds if both visors possess the secret keys of their addresses.
+func encryptConn(conn net.Conn, lSK cipher.SecKey, rPK cipher.PubKey, initiator bool, deadline time.Time) (net.Conn, error) {
+	lPK, err := lSK.PubKey()
+	if err != nil {
+		return nil, err
+	}
+
+	ns, err := noise.KKAndSecp256k1(noise.Config{
+		LocalPK:   lPK,
+		LocalSK:   lSK,
+		RemotePK:  rPK,
+		Initiator: initiator,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sConn, err := noise.WrapConn(conn, ns, time.Until(deadline))
+	if err != nil {
+		return nil, fmt.Errorf("noise handshake failed: %w", err)
+	}
+
+	return sConn, nil
+}
 
 // InitiatorHandshake creates the handshake logic on the initiator's side.
+// Once the responder accepts the connection, it's encrypted with noise.
 func InitiatorHandshake(lSK cipher.SecKey, localAddr, remoteAddr dmsg.Addr) Handshake {
-	return handshakeMiddleware(func(conn net.Conn, deadline time.Time) (lAddr, rAddr dmsg.Addr, err error) {
+	return handshakeMiddleware(func(conn net.Conn, deadline time.Time) (sConn net.Conn, lAddr, rAddr dmsg.Addr, err error) {
 		var f1 Frame1
 		if f1, err = readFrame1(conn); err != nil {
 			return
@@ -78,6 +106,9 @@ func InitiatorHandshake(lSK cipher.SecKey, localAddr, remoteAddr dmsg.Addr) Hand
 			err = fmt.Errorf("handshake rejected: %s", f3.ErrMsg)
 			return
 		}
+		if sConn, err = encryptConn(conn, lSK, remoteAddr.PK, true, deadline); err != nil {
+			return
+		}
 		lAddr = localAddr
 		rAddr = remoteAddr
 		return
@@ -85,8 +116,9 @@ func InitiatorHandshake(lSK cipher.SecKey, localAddr, remoteAddr dmsg.Addr) Hand
 }
 
 // ResponderHandshake creates the handshake logic on the responder's side.
-func ResponderHandshake(checkF2 func(f2 Frame2) error) Handshake {
-	return handshakeMiddleware(func(conn net.Conn, deadline time.Time) (lAddr, rAddr dmsg.Addr, err error) {
+// Once the connection is accepted, it's encrypted with noise using `lSK`, which also authenticates the responder.
+func ResponderHandshake(lSK cipher.SecKey, checkF2 func(f2 Frame2) error) Handshake {
+	return handshakeMiddleware(func(conn net.Conn, deadline time.Time) (sConn net.Conn, lAddr, rAddr dmsg.Addr, err error) {
 		var nonce [HandshakeNonceSize]byte
 		copy(nonce[:], cipher.RandByte(HandshakeNonceSize))
 		if err = writeFrame1(conn, nonce); err != nil {
@@ -103,9 +135,14 @@ func ResponderHandshake(checkF2 func(f2 Frame2) error) Handshake {
 			_ = writeFrame3(conn, err) // nolint:errcheck
 			return
 		}
+		if err = writeFrame3(conn, nil); err != nil {
+			return
+		}
+		if sConn, err = encryptConn(conn, lSK, f2.SrcAddr.PK, false, deadline); err != nil {
+			return
+		}
 		lAddr = f2.DstAddr
 		rAddr = f2.SrcAddr
-		err = writeFrame3(conn, nil)
 		return
 	})
 }
@@ -142,7 +179,6 @@ func (f2 *Frame2) Sign(srcSK cipher.SecKey) error {
 	}
 	f2.Sig = sig
 
-	fmt.Println("SIGN! len(b.Bytes)", len(b.Bytes()), cipher2.SumSHA256(b.Bytes()).Hex())
 	return nil
 }
 
@@ -155,15 +191,10 @@ func (f2 Frame2) Verify(nonce [HandshakeNonceSize]byte) error {
 	sig := f2.Sig
 	f2.Sig = cipher.Sig{}
 
-	//cipher2.PubKeyFromSig(cipher2.Sig(sig))
-
 	var b bytes.Buffer
 	if err := json.NewEncoder(&b).Encode(f2); err != nil {
 		return err
 	}
-	hash := cipher.SumSHA256(b.Bytes())
-	rPK, err := cipher2.PubKeyFromSig(cipher2.Sig(sig), cipher2.SHA256(hash))
-	fmt.Println("VERIFY! len(b.Bytes)", len(b.Bytes()), cipher2.SHA256(hash).Hex(), "recovered:", rPK, err, "expected:", f2.SrcAddr.PK)
 
 	return cipher.VerifyPubKeySignedPayload(f2.SrcAddr.PK, sig, b.Bytes())
 }
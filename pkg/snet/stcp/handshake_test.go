@@ -1,8 +1,11 @@
 package stcp
 
 import (
+	"bytes"
 	"errors"
+	"io"
 	"net"
+	"sync"
 	"testing"
 	"time"
 
@@ -24,7 +27,7 @@ func TestHandshake(t *testing.T) {
 		require.NoError(t, err)
 		iAddr := dmsg.Addr{PK: initPK, Port: 10}
 
-		respPK, _, err := cipher.GenerateDeterministicKeyPair(append([]byte("resp"), i))
+		respPK, respSK, err := cipher.GenerateDeterministicKeyPair(append([]byte("resp"), i))
 		require.NoError(t, err)
 		rAddr := dmsg.Addr{PK: respPK, Port: 11}
 
@@ -36,7 +39,7 @@ func TestHandshake(t *testing.T) {
 
 		go func() {
 			defer close(respCh)
-			respHS := ResponderHandshake(func(f2 Frame2) error {
+			respHS := ResponderHandshake(respSK, func(f2 Frame2) error {
 				if f2.SrcAddr.PK != initPK {
 					return errors.New("unexpected src addr pk")
 				}
@@ -45,13 +48,13 @@ func TestHandshake(t *testing.T) {
 				}
 				return nil
 			})
-			lAddr, rAddr, err := respHS(respC, deadline)
+			_, lAddr, rAddr, err := respHS(respC, deadline)
 			respCh <- hsResult{lAddr: lAddr, rAddr: rAddr, err: err}
 		}()
 
 		initHS := InitiatorHandshake(initSK, iAddr, rAddr)
 		var initR hsResult
-		initR.lAddr, initR.rAddr, initR.err = initHS(initC, deadline)
+		_, initR.lAddr, initR.rAddr, initR.err = initHS(initC, deadline)
 		assert.NoError(t, err)
 		assert.Equal(t, initR.lAddr, iAddr)
 		assert.Equal(t, initR.rAddr, rAddr)
@@ -65,3 +68,108 @@ func TestHandshake(t *testing.T) {
 		assert.NoError(t, respC.Close())
 	}
 }
+
+// recordConn records the raw bytes written to the underlying net.Conn.
+type recordConn struct {
+	net.Conn
+	mx      sync.Mutex
+	written bytes.Buffer
+}
+
+func (c *recordConn) Write(b []byte) (int, error) {
+	c.mx.Lock()
+	c.written.Write(b)
+	c.mx.Unlock()
+
+	return c.Conn.Write(b)
+}
+
+func tcpConns(t *testing.T) (net.Conn, net.Conn) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, lis.Close()) }()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := lis.Accept()
+		assert.NoError(t, err)
+		accepted <- conn
+	}()
+
+	initC, err := net.Dial("tcp", lis.Addr().String())
+	require.NoError(t, err)
+
+	return initC, <-accepted
+}
+
+func TestHandshake_Encryption(t *testing.T) {
+	initPK, initSK := cipher.GenerateKeyPair()
+	respPK, respSK := cipher.GenerateKeyPair()
+
+	initC, respC := tcpConns(t)
+	recC := &recordConn{Conn: initC}
+
+	ihs := InitiatorHandshake(initSK, dmsg.Addr{PK: initPK, Port: 1}, dmsg.Addr{PK: respPK, Port: 2})
+	rhs := ResponderHandshake(respSK, func(f2 Frame2) error { return nil })
+
+	var b *Conn
+	var respErr error
+	done := make(chan struct{})
+
+	go func() {
+		b, respErr = NewConn(respC, time.Now().Add(HandshakeTimeout), rhs, nil)
+		close(done)
+	}()
+
+	a, err := NewConn(recC, time.Now().Add(HandshakeTimeout), ihs, nil)
+	require.NoError(t, err)
+
+	<-done
+	require.NoError(t, respErr)
+
+	defer func() {
+		assert.NoError(t, a.Close())
+		assert.NoError(t, b.Close())
+	}()
+
+	msg := []byte("this message should not be sent in plaintext")
+
+	_, err = a.Write(msg)
+	require.NoError(t, err)
+
+	got := make([]byte, len(msg))
+	_, err = io.ReadFull(b, got)
+	require.NoError(t, err)
+	assert.Equal(t, msg, got)
+
+	recC.mx.Lock()
+	defer recC.mx.Unlock()
+	assert.False(t, bytes.Contains(recC.written.Bytes(), msg))
+}
+
+func TestHandshake_ResponderAuthentication(t *testing.T) {
+	initPK, initSK := cipher.GenerateKeyPair()
+	respPK, _ := cipher.GenerateKeyPair()
+	_, otherSK := cipher.GenerateKeyPair()
+
+	initC, respC := tcpConns(t)
+
+	ihs := InitiatorHandshake(initSK, dmsg.Addr{PK: initPK, Port: 1}, dmsg.Addr{PK: respPK, Port: 2})
+
+	// The responder does not possess the secret key of the dialed public key.
+	rhs := ResponderHandshake(otherSK, func(f2 Frame2) error { return nil })
+
+	var respErr error
+	done := make(chan struct{})
+
+	go func() {
+		_, respErr = NewConn(respC, time.Now().Add(HandshakeTimeout), rhs, nil)
+		close(done)
+	}()
+
+	_, err := NewConn(initC, time.Now().Add(HandshakeTimeout), ihs, nil)
+	assert.True(t, IsHandshakeError(err))
+
+	<-done
+	assert.True(t, IsHandshakeError(respErr))
+}
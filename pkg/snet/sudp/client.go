@@ -0,0 +1,307 @@
+package sudp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/stcp"
+)
+
+// Type is sudp type.
+const Type = "sudp"
+
+// Client is the central control for incoming and outgoing 'sudp' connections.
+// Connections are reliable streams over UDP sessions (see session), which are authenticated
+// with the same handshake as stcp connections.
+type Client struct {
+	log *logging.Logger
+
+	lPK cipher.PubKey
+	lSK cipher.SecKey
+	t   stcp.PKTable
+	p   *stcp.Porter
+
+	lMux *udpMux                   // serves incoming sessions, also used to dial if set
+	dMux *udpMux                   // used to dial if the client doesn't serve
+	lMap map[uint16]*stcp.Listener // key: lPort
+	mx   sync.Mutex
+
+	done chan struct{}
+	once sync.Once
+}
+
+// NewClient creates a sudp Client. PKTable `t` maps public keys to UDP addresses.
+func NewClient(pk cipher.PubKey, sk cipher.SecKey, t stcp.PKTable) *Client {
+	return &Client{
+		log:  logging.MustGetLogger(Type),
+		lPK:  pk,
+		lSK:  sk,
+		t:    t,
+		p:    stcp.NewPorter(stcp.PorterMinEphemeral),
+		lMap: make(map[uint16]*stcp.Listener),
+		done: make(chan struct{}),
+	}
+}
+
+// SetLogger sets a logger for Client.
+func (c *Client) SetLogger(log *logging.Logger) {
+	c.log = log
+}
+
+// Serve serves the listening portion of the client.
+func (c *Client) Serve(udpAddr string) error {
+	if c.isClosed() {
+		return io.ErrClosedPipe
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.lMux != nil {
+		return errors.New("already listening")
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", udpAddr)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	c.lMux = newUDPMux(conn, true, c.log)
+	c.log.Infof("listening on udp addr: %v", conn.LocalAddr())
+
+	go func(m *udpMux) {
+		for {
+			s, err := m.accept()
+			if err != nil {
+				c.log.Warnf("stopped serving sudp: %v", err)
+				return
+			}
+
+			go c.acceptSession(s)
+		}
+	}(c.lMux)
+
+	return nil
+}
+
+func (c *Client) acceptSession(s *session) {
+	var lis *stcp.Listener
+
+	hs := stcp.ResponderHandshake(c.lSK, func(f2 stcp.Frame2) error {
+		c.mx.Lock()
+		defer c.mx.Unlock()
+
+		var ok bool
+		if lis, ok = c.lMap[f2.DstAddr.Port]; !ok {
+			return errors.New("not listening on given port")
+		}
+
+		return nil
+	})
+
+	conn, err := stcp.NewConn(s, time.Now().Add(stcp.HandshakeTimeout), hs, nil)
+	if err != nil {
+		c.log.Warnf("failed to accept incoming connection: %v", err)
+		return
+	}
+
+	if err := lis.Introduce(conn); err != nil {
+		c.log.Warnf("failed to introduce incoming connection: %v", err)
+		_ = conn.Close() // nolint:errcheck
+	}
+}
+
+// Dial dials a new sudp connection to specified remote public key and port.
+func (c *Client) Dial(ctx context.Context, rPK cipher.PubKey, rPort uint16) (*stcp.Conn, error) {
+	if c.isClosed() {
+		return nil, io.ErrClosedPipe
+	}
+
+	udpAddr, ok := c.t.Addr(rPK)
+	if !ok {
+		return nil, fmt.Errorf("pk table: entry of %s does not exist", rPK)
+	}
+
+	return c.DialAddr(ctx, rPK, rPort, udpAddr)
+}
+
+// DialAddr is similar to Dial, but the remote visor is dialed at `udpAddr` instead of the PKTable entry.
+func (c *Client) DialAddr(ctx context.Context, rPK cipher.PubKey, rPort uint16, udpAddr string) (*stcp.Conn, error) {
+	if c.isClosed() {
+		return nil, io.ErrClosedPipe
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := c.dialMux()
+	if err != nil {
+		return nil, err
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, stcp.HandshakeTimeout)
+	defer cancel()
+
+	s, err := m.dial(dialCtx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	lPort, freePort, err := c.p.ReserveEphemeral(ctx)
+	if err != nil {
+		_ = s.Close() // nolint:errcheck
+		return nil, err
+	}
+
+	hs := stcp.InitiatorHandshake(c.lSK, dmsg.Addr{PK: c.lPK, Port: lPort}, dmsg.Addr{PK: rPK, Port: rPort})
+
+	return stcp.NewConn(s, time.Now().Add(stcp.HandshakeTimeout), hs, freePort)
+}
+
+// dialMux returns the mux to dial sessions with. The listening socket is preferred,
+// so that remote visors see the same address for all the sessions.
+func (c *Client) dialMux() (*udpMux, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.lMux != nil {
+		return c.lMux, nil
+	}
+
+	if c.dMux == nil {
+		conn, err := net.ListenUDP("udp", nil)
+		if err != nil {
+			return nil, err
+		}
+
+		c.dMux = newUDPMux(conn, false, c.log)
+	}
+
+	return c.dMux, nil
+}
+
+// Punch sends punch packets from the listening socket to `udpAddr` every `interval` until `ctx` is done.
+// It opens NAT mapping of the local visor, so that sessions dialed from `udpAddr` get through.
+func (c *Client) Punch(ctx context.Context, udpAddr string, interval time.Duration) error {
+	addr, m, err := c.servingMux(udpAddr)
+	if err != nil {
+		return err
+	}
+
+	m.punch(ctx, addr, interval)
+
+	return nil
+}
+
+// WriteToUDP writes a raw datagram to `udpAddr` from the listening socket.
+// The datagram is not a part of any session, this is used to communicate with rendezvous servers.
+func (c *Client) WriteToUDP(b []byte, udpAddr string) error {
+	addr, m, err := c.servingMux(udpAddr)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.conn.WriteToUDP(b, addr)
+
+	return err
+}
+
+// servingMux resolves `udpAddr` and returns the mux of the listening socket.
+func (c *Client) servingMux(udpAddr string) (*net.UDPAddr, *udpMux, error) {
+	if c.isClosed() {
+		return nil, nil, io.ErrClosedPipe
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", udpAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.mx.Lock()
+	m := c.lMux
+	c.mx.Unlock()
+
+	if m == nil {
+		return nil, nil, errors.New("not serving")
+	}
+
+	return addr, m, nil
+}
+
+// Listen creates a new listener for sudp.
+// The created Listener cannot actually accept remote connections unless Serve is called beforehand.
+func (c *Client) Listen(lPort uint16) (*stcp.Listener, error) {
+	if c.isClosed() {
+		return nil, io.ErrClosedPipe
+	}
+
+	ok, freePort := c.p.Reserve(lPort)
+	if !ok {
+		return nil, errors.New("port is already occupied")
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	lAddr := dmsg.Addr{PK: c.lPK, Port: lPort}
+	lis := stcp.NewListener(lAddr, freePort)
+	c.lMap[lPort] = lis
+
+	return lis, nil
+}
+
+// Close closes the Client.
+func (c *Client) Close() error {
+	if c == nil {
+		return nil
+	}
+
+	c.once.Do(func() {
+		close(c.done)
+
+		c.mx.Lock()
+		defer c.mx.Unlock()
+
+		for _, m := range []*udpMux{c.lMux, c.dMux} {
+			if m != nil {
+				_ = m.Close() // nolint:errcheck
+			}
+		}
+
+		for _, lis := range c.lMap {
+			_ = lis.Close() // nolint:errcheck
+		}
+	})
+
+	return nil
+}
+
+func (c *Client) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Type returns the stream type.
+func (c *Client) Type() string {
+	return Type
+}
@@ -0,0 +1,74 @@
+package sudp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/stcp"
+)
+
+func TestClient(t *testing.T) {
+	aPK, aSK := cipher.GenerateKeyPair()
+	bPK, bSK := cipher.GenerateKeyPair()
+
+	const port = 45
+
+	b := NewClient(bPK, bSK, stcp.NewTable(nil))
+	require.NoError(t, b.Serve("127.0.0.1:0"))
+
+	defer func() {
+		assert.NoError(t, b.Close())
+	}()
+
+	table := stcp.NewTable(map[cipher.PubKey]string{bPK: b.lMux.conn.LocalAddr().String()})
+
+	a := NewClient(aPK, aSK, table)
+
+	defer func() {
+		assert.NoError(t, a.Close())
+	}()
+
+	lis, err := b.Listen(port)
+	require.NoError(t, err)
+
+	t.Run("dial unknown pk", func(t *testing.T) {
+		unknownPK, _ := cipher.GenerateKeyPair()
+
+		_, err := a.Dial(context.Background(), unknownPK, port)
+		require.Error(t, err)
+	})
+
+	t.Run("dial port not listened", func(t *testing.T) {
+		_, err := a.Dial(context.Background(), bPK, port+1)
+		require.Error(t, err)
+		require.True(t, stcp.IsHandshakeError(err))
+	})
+
+	t.Run("dial", func(t *testing.T) {
+		aConn, err := a.Dial(context.Background(), bPK, port)
+		require.NoError(t, err)
+
+		bConn, err := lis.Accept()
+		require.NoError(t, err)
+
+		assert.Equal(t, bPK.String()+":45", aConn.RemoteAddr().String())
+		assert.Equal(t, aPK, bConn.RemoteAddr().(dmsg.Addr).PK)
+
+		msg := []byte("hello")
+		_, err = aConn.Write(msg)
+		require.NoError(t, err)
+
+		buf := make([]byte, len(msg))
+		_, err = bConn.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, msg, buf)
+
+		require.NoError(t, aConn.Close())
+		require.NoError(t, bConn.Close())
+	})
+}
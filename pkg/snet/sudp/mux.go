@@ -0,0 +1,249 @@
+package sudp
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+)
+
+const (
+	synInterval   = 250 * time.Millisecond
+	acceptBacklog = 64
+)
+
+// sessionKey identifies a session within a mux.
+type sessionKey struct {
+	addr string
+	id   uint32
+}
+
+// udpMux multiplexes sessions over a single UDP socket.
+type udpMux struct {
+	log      *logging.Logger
+	conn     *net.UDPConn
+	accepted chan *session // nil if incoming sessions are rejected
+
+	mu       sync.Mutex
+	sessions map[sessionKey]*session
+
+	done chan struct{}
+	once sync.Once
+}
+
+// newUDPMux starts serving `conn`. Incoming sessions are only accepted if `accept` is true.
+func newUDPMux(conn *net.UDPConn, accept bool, log *logging.Logger) *udpMux {
+	m := &udpMux{
+		log:      log,
+		conn:     conn,
+		sessions: make(map[sessionKey]*session),
+		done:     make(chan struct{}),
+	}
+
+	if accept {
+		m.accepted = make(chan *session, acceptBacklog)
+	}
+
+	go m.readLoop()
+
+	return m
+}
+
+func (m *udpMux) readLoop() {
+	buf := make([]byte, maxPacketSize+1)
+
+	for {
+		n, addr, err := m.conn.ReadFromUDP(buf)
+		if err != nil {
+			if m.isClosed() {
+				return
+			}
+
+			if nErr, ok := err.(net.Error); ok && nErr.Temporary() {
+				continue
+			}
+
+			m.log.WithError(err).Warn("Failed to read from UDP socket, closing sudp mux.")
+			_ = m.Close() // nolint:errcheck
+
+			return
+		}
+
+		p := make(packet, n)
+		copy(p, buf[:n])
+
+		if err := p.validate(); err != nil {
+			continue
+		}
+
+		m.handlePacket(p, addr)
+	}
+}
+
+func (m *udpMux) handlePacket(p packet, addr *net.UDPAddr) {
+	if p.Type() == punchPacket {
+		return
+	}
+
+	key := sessionKey{addr: addr.String(), id: p.SessionID()}
+
+	m.mu.Lock()
+	s, ok := m.sessions[key]
+
+	if !ok && p.Type() == synPacket && m.accepted != nil && !m.isClosed() && len(m.accepted) < cap(m.accepted) {
+		s = m.newSession(key, addr, true)
+		ok = true
+		m.accepted <- s
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		// let the remote side know the session doesn't exist
+		if t := p.Type(); t != rstPacket && t != finAckPacket {
+			m.send(makeControlPacket(rstPacket, key.id), addr)
+		}
+
+		return
+	}
+
+	s.handlePacket(p)
+}
+
+// newSession creates a session and registers it.
+// NOTE: not thread-safe.
+func (m *udpMux) newSession(key sessionKey, addr *net.UDPAddr, established bool) *session {
+	out := func(p packet) {
+		m.send(p, addr)
+	}
+
+	release := func() {
+		m.mu.Lock()
+		delete(m.sessions, key)
+		m.mu.Unlock()
+	}
+
+	s := newSession(key.id, m.conn.LocalAddr(), addr, out, release, established)
+	m.sessions[key] = s
+
+	return s
+}
+
+func (m *udpMux) send(p packet, addr *net.UDPAddr) {
+	if _, err := m.conn.WriteToUDP(p, addr); err != nil && !m.isClosed() {
+		m.log.WithError(err).Debugf("Failed to send %s packet to %s", p.Type(), addr)
+	}
+}
+
+// dial establishes a session with the mux listening on `addr`.
+func (m *udpMux) dial(ctx context.Context, addr *net.UDPAddr) (*session, error) {
+	m.mu.Lock()
+
+	if m.isClosed() {
+		m.mu.Unlock()
+		return nil, io.ErrClosedPipe
+	}
+
+	var key sessionKey
+
+	for {
+		key = sessionKey{addr: addr.String(), id: binary.BigEndian.Uint32(cipher.RandByte(4))}
+		if _, ok := m.sessions[key]; !ok {
+			break
+		}
+	}
+
+	s := m.newSession(key, addr, false)
+	m.mu.Unlock()
+
+	ticker := time.NewTicker(synInterval)
+	defer ticker.Stop()
+
+	syn := makeControlPacket(synPacket, key.id)
+
+	for {
+		m.send(syn, addr)
+
+		select {
+		case <-s.estCh:
+			return s, nil
+		case <-s.done:
+			if err := s.termErr(); err != nil {
+				return nil, err
+			}
+
+			return nil, io.ErrClosedPipe
+		case <-ctx.Done():
+			_ = s.Close() // nolint:errcheck
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// punch sends punch packets to `addr` every `interval` until `ctx` is done.
+func (m *udpMux) punch(ctx context.Context, addr *net.UDPAddr, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	p := makeControlPacket(punchPacket, 0)
+
+	for {
+		m.send(p, addr)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// accept accepts an incoming session.
+func (m *udpMux) accept() (*session, error) {
+	select {
+	case s := <-m.accepted:
+		return s, nil
+	case <-m.done:
+		return nil, io.ErrClosedPipe
+	}
+}
+
+// Close closes the socket and terminates all the sessions.
+func (m *udpMux) Close() error {
+	var err error
+
+	m.once.Do(func() {
+		m.mu.Lock()
+		close(m.done)
+
+		sessions := make([]*session, 0, len(m.sessions))
+		for _, s := range m.sessions {
+			sessions = append(sessions, s)
+		}
+		m.mu.Unlock()
+
+		err = m.conn.Close()
+
+		for _, s := range sessions {
+			s.kill(io.ErrClosedPipe)
+		}
+	})
+
+	return err
+}
+
+func (m *udpMux) isClosed() bool {
+	select {
+	case <-m.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,163 @@
+package sudp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Packet format:
+//
+//	| type (1 byte) | session ID (4 bytes) | body |
+//
+// Bodies of packet types:
+//
+//	syn, syn-ack, fin, fin-ack, rst, punch: empty
+//	data: | seq (4 bytes) | payload |
+//	ack:  | ack (4 bytes) | window (2 bytes) | sack (8 bytes) |
+//
+// `ack` is the sequence number of the next expected data segment, bit `i` of `sack` is set
+// if segment `ack+1+i` was received out of order. `window` is the number of segments
+// the receiver is able to buffer.
+//
+// Punch packets don't belong to sessions, they are sent to open NAT mappings towards remote visors
+// and are ignored by receivers.
+const (
+	headerSize   = 5
+	dataHeadSize = headerSize + 4
+	ackSize      = headerSize + 4 + 2 + 8
+
+	// maxSegmentSize is the maximum payload of a data packet,
+	// it keeps datagrams below the minimum IPv6 MTU.
+	maxSegmentSize = 1200
+	// maxPacketSize is the maximum size of a valid packet.
+	maxPacketSize = dataHeadSize + maxSegmentSize
+)
+
+var errMalformedPacket = errors.New("malformed sudp packet")
+
+type packetType byte
+
+const (
+	synPacket packetType = iota + 1
+	synAckPacket
+	dataPacket
+	ackPacket
+	finPacket
+	finAckPacket
+	rstPacket
+	punchPacket
+)
+
+func (t packetType) String() string {
+	switch t {
+	case synPacket:
+		return "syn"
+	case synAckPacket:
+		return "syn-ack"
+	case dataPacket:
+		return "data"
+	case ackPacket:
+		return "ack"
+	case finPacket:
+		return "fin"
+	case finAckPacket:
+		return "fin-ack"
+	case rstPacket:
+		return "rst"
+	case punchPacket:
+		return "punch"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(t))
+	}
+}
+
+// packet is a single sudp datagram.
+type packet []byte
+
+func makeControlPacket(t packetType, id uint32) packet {
+	p := make(packet, headerSize)
+	p[0] = byte(t)
+	binary.BigEndian.PutUint32(p[1:], id)
+
+	return p
+}
+
+func makeDataPacket(id, seq uint32, payload []byte) packet {
+	p := make(packet, dataHeadSize+len(payload))
+	p[0] = byte(dataPacket)
+	binary.BigEndian.PutUint32(p[1:], id)
+	binary.BigEndian.PutUint32(p[headerSize:], seq)
+	copy(p[dataHeadSize:], payload)
+
+	return p
+}
+
+func makeAckPacket(id, ack uint32, window uint16, sack uint64) packet {
+	p := make(packet, ackSize)
+	p[0] = byte(ackPacket)
+	binary.BigEndian.PutUint32(p[1:], id)
+	binary.BigEndian.PutUint32(p[headerSize:], ack)
+	binary.BigEndian.PutUint16(p[headerSize+4:], window)
+	binary.BigEndian.PutUint64(p[headerSize+6:], sack)
+
+	return p
+}
+
+// validate checks that the packet is large enough for its type.
+func (p packet) validate() error {
+	if len(p) < headerSize {
+		return errMalformedPacket
+	}
+
+	switch p.Type() {
+	case synPacket, synAckPacket, finPacket, finAckPacket, rstPacket, punchPacket:
+		return nil
+	case dataPacket:
+		if len(p) < dataHeadSize || len(p) > maxPacketSize {
+			return errMalformedPacket
+		}
+
+		return nil
+	case ackPacket:
+		if len(p) < ackSize {
+			return errMalformedPacket
+		}
+
+		return nil
+	default:
+		return errMalformedPacket
+	}
+}
+
+func (p packet) Type() packetType {
+	return packetType(p[0])
+}
+
+func (p packet) SessionID() uint32 {
+	return binary.BigEndian.Uint32(p[1:])
+}
+
+// Seq returns sequence number of a data packet.
+func (p packet) Seq() uint32 {
+	return binary.BigEndian.Uint32(p[headerSize:])
+}
+
+// Payload returns payload of a data packet.
+func (p packet) Payload() []byte {
+	return p[dataHeadSize:]
+}
+
+// Ack returns the fields of an ack packet.
+func (p packet) Ack() (ack uint32, window uint16, sack uint64) {
+	ack = binary.BigEndian.Uint32(p[headerSize:])
+	window = binary.BigEndian.Uint16(p[headerSize+4:])
+	sack = binary.BigEndian.Uint64(p[headerSize+6:])
+
+	return ack, window, sack
+}
+
+// seqLess compares sequence numbers taking wrapping into account.
+func seqLess(a, b uint32) bool {
+	return int32(a-b) < 0
+}
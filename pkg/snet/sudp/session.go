@@ -0,0 +1,832 @@
+package sudp
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// Session tunables.
+const (
+	maxWindow         = 1024 // maximum number of segments in flight, also the size of the receive window
+	maxBuffered       = 2 * maxWindow
+	initialCwnd       = 10
+	minCwnd           = 2
+	dupThreshold      = 3 // number of segments acknowledged after a missing one to consider it lost
+	initialRTO        = time.Second
+	minRTO            = 200 * time.Millisecond
+	maxRTO            = 10 * time.Second
+	maxRetransmits    = 10
+	tickInterval      = 10 * time.Millisecond
+	keepAliveInterval = 5 * time.Second
+	idleTimeout       = 30 * time.Second
+	closeTimeout      = 10 * time.Second
+)
+
+var (
+	// ErrSessionTimeout is returned when the remote side of a session stops responding.
+	ErrSessionTimeout = errors.New("sudp session timed out")
+	// ErrSessionReset is returned when the remote side of a session resets it.
+	ErrSessionReset = errors.New("sudp session reset by peer")
+)
+
+// segment is a data segment sent, but not yet cumulatively acknowledged.
+type segment struct {
+	data   []byte
+	sentAt time.Time
+	sends  int
+	sacked bool
+}
+
+// session is a reliable ordered byte stream over UDP. It implements net.Conn.
+//
+// Data is split into segments numbered by sequence numbers. Every data packet is acknowledged with
+// the next expected sequence number and a bitmap of segments received out of order (SACK).
+// Lost segments are retransmitted either after `dupThreshold` later segments got acknowledged,
+// or once the retransmission timeout (computed as in RFC 6298) expires.
+// The number of segments in flight is limited by the window advertised by the receiver and
+// by the congestion window, which grows in slow start / congestion avoidance and shrinks on losses (AIMD).
+type session struct {
+	id      uint32
+	laddr   net.Addr
+	raddr   *net.UDPAddr
+	out     func(p packet)
+	release func()
+
+	mu          sync.Mutex
+	established bool
+	estCh       chan struct{}
+
+	// sender state
+	pending  [][]byte
+	unacked  map[uint32]*segment
+	sndUna   uint32
+	sndNxt   uint32
+	highAck  uint32 // highest acknowledged sequence number + 1
+	inflight int
+	cwnd     float64
+	ssthresh float64
+	rwnd     int
+	recover  uint32 // losses of segments below are part of the last handled loss event
+	srtt     time.Duration
+	rttvar   time.Duration
+	rto      time.Duration
+
+	// receiver state
+	rcvNxt  uint32
+	ooo     map[uint32][]byte
+	readQ   [][]byte
+	lastWnd int
+
+	lastRecv     time.Time
+	lastSend     time.Time
+	closingSince time.Time
+	finSentAt    time.Time
+
+	closing      bool  // Close was called
+	remoteClosed bool  // remote side closed the session
+	err          error // error which terminated the session
+
+	readReady  chan struct{}
+	writeReady chan struct{}
+	rDeadline  deadline
+	wDeadline  deadline
+	closeCh    chan struct{}
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+func newSession(id uint32, laddr net.Addr, raddr *net.UDPAddr, out func(packet), release func(), established bool) *session {
+	now := time.Now()
+
+	s := &session{
+		id:          id,
+		laddr:       laddr,
+		raddr:       raddr,
+		out:         out,
+		release:     release,
+		established: established,
+		estCh:       make(chan struct{}),
+		unacked:     make(map[uint32]*segment),
+		cwnd:        initialCwnd,
+		ssthresh:    maxWindow,
+		rwnd:        maxWindow,
+		rto:         initialRTO,
+		ooo:         make(map[uint32][]byte),
+		lastWnd:     maxWindow,
+		lastRecv:    now,
+		lastSend:    now,
+		readReady:   make(chan struct{}, 1),
+		writeReady:  make(chan struct{}, 1),
+		rDeadline:   makeDeadline(),
+		wDeadline:   makeDeadline(),
+		closeCh:     make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	if established {
+		close(s.estCh)
+	}
+
+	go s.serve()
+
+	return s
+}
+
+// serve runs timers of the session.
+func (s *session) serve() {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			s.tick(now)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *session) tick(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.established || s.isDone() {
+		return
+	}
+
+	if now.Sub(s.lastRecv) >= idleTimeout {
+		s.terminate(ErrSessionTimeout)
+		return
+	}
+
+	if !s.checkRTO(now) {
+		return
+	}
+
+	s.flush(now)
+
+	if s.closing {
+		s.closeStep(now)
+		return
+	}
+
+	if now.Sub(s.lastSend) >= keepAliveInterval {
+		s.sendAck()
+	}
+}
+
+// handlePacket handles a packet received from the remote side.
+func (s *session) handlePacket(p packet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.isDone() {
+		return
+	}
+
+	s.lastRecv = time.Now()
+
+	switch p.Type() {
+	case synPacket:
+		s.send(makeControlPacket(synAckPacket, s.id))
+	case synAckPacket:
+		s.establish()
+	case dataPacket:
+		s.establish()
+		s.handleData(p.Seq(), p.Payload())
+	case ackPacket:
+		s.establish()
+		s.handleAck(p.Ack())
+	case finPacket:
+		s.remoteClosed = true
+		s.send(makeControlPacket(finAckPacket, s.id))
+		s.notifyRead()
+		s.notifyWrite()
+	case finAckPacket:
+		if s.closing {
+			s.terminate(nil)
+		}
+	case rstPacket:
+		s.terminate(ErrSessionReset)
+	}
+}
+
+func (s *session) establish() {
+	if !s.established {
+		s.established = true
+		close(s.estCh)
+	}
+}
+
+func (s *session) handleData(seq uint32, payload []byte) {
+	switch {
+	case seqLess(seq, s.rcvNxt):
+		// duplicate, acknowledged again below as the previous ack might have been lost
+	case seq-s.rcvNxt >= maxWindow, len(s.ooo)+len(s.readQ) >= maxBuffered:
+		// no room for the segment, it will be retransmitted
+	case seq == s.rcvNxt:
+		s.readQ = append(s.readQ, payload)
+		s.rcvNxt++
+
+		for {
+			next, ok := s.ooo[s.rcvNxt]
+			if !ok {
+				break
+			}
+
+			delete(s.ooo, s.rcvNxt)
+			s.readQ = append(s.readQ, next)
+			s.rcvNxt++
+		}
+
+		s.notifyRead()
+	default:
+		if _, ok := s.ooo[seq]; !ok {
+			s.ooo[seq] = payload
+		}
+	}
+
+	s.sendAck()
+}
+
+func (s *session) handleAck(ack uint32, window uint16, sack uint64) {
+	// acknowledges data which was never sent
+	if seqLess(s.sndNxt, ack) {
+		return
+	}
+
+	now := time.Now()
+	s.rwnd = int(window)
+
+	acked := 0
+	sample := time.Duration(-1)
+
+	ackSegment := func(seg *segment) {
+		if seg.sacked {
+			return
+		}
+
+		seg.sacked = true
+		s.inflight--
+		acked++
+
+		// Karn's algorithm: RTT of retransmitted segments is ambiguous
+		if seg.sends == 1 {
+			sample = now.Sub(seg.sentAt)
+		}
+	}
+
+	for seqLess(s.sndUna, ack) {
+		if seg, ok := s.unacked[s.sndUna]; ok {
+			ackSegment(seg)
+			delete(s.unacked, s.sndUna)
+		}
+
+		s.sndUna++
+	}
+
+	high := ack
+
+	for i := uint32(0); i < 64; i++ {
+		if sack&(1<<i) == 0 {
+			continue
+		}
+
+		seq := ack + 1 + i
+		if seg, ok := s.unacked[seq]; ok {
+			ackSegment(seg)
+		}
+
+		high = seq + 1
+	}
+
+	if seqLess(s.highAck, high) {
+		s.highAck = high
+	}
+
+	if sample >= 0 {
+		s.updateRTO(sample)
+	}
+
+	if acked > 0 {
+		if s.cwnd < s.ssthresh {
+			s.cwnd += float64(acked)
+		} else {
+			s.cwnd += float64(acked) / s.cwnd
+		}
+
+		s.cwnd = math.Min(s.cwnd, maxWindow)
+	}
+
+	s.fastRetransmit(now)
+	s.flush(now)
+}
+
+func (s *session) updateRTO(sample time.Duration) {
+	if s.srtt == 0 {
+		s.srtt = sample
+		s.rttvar = sample / 2
+	} else {
+		diff := s.srtt - sample
+		if diff < 0 {
+			diff = -diff
+		}
+
+		s.rttvar = (3*s.rttvar + diff) / 4
+		s.srtt = (7*s.srtt + sample) / 8
+	}
+
+	variance := 4 * s.rttvar
+	if variance < tickInterval {
+		variance = tickInterval
+	}
+
+	s.rto = s.srtt + variance
+
+	if s.rto < minRTO {
+		s.rto = minRTO
+	}
+
+	if s.rto > maxRTO {
+		s.rto = maxRTO
+	}
+}
+
+// fastRetransmit retransmits segments followed by at least `dupThreshold` acknowledged ones.
+func (s *session) fastRetransmit(now time.Time) {
+	for seq := s.sndUna; seqLess(seq+dupThreshold, s.highAck); seq++ {
+		seg, ok := s.unacked[seq]
+		if !ok || seg.sacked || now.Sub(seg.sentAt) < s.srtt {
+			continue
+		}
+
+		s.onLoss(seq)
+		s.retransmit(seq, seg, now)
+	}
+}
+
+// checkRTO retransmits segments with expired retransmission timeout.
+// It returns false if the session got terminated.
+func (s *session) checkRTO(now time.Time) bool {
+	budget := int(s.cwnd)
+	timedOut := false
+
+	for seq := s.sndUna; seqLess(seq, s.sndNxt) && budget > 0; seq++ {
+		seg, ok := s.unacked[seq]
+		if !ok || seg.sacked || now.Sub(seg.sentAt) < s.rto {
+			continue
+		}
+
+		if seg.sends > maxRetransmits {
+			s.terminate(ErrSessionTimeout)
+			return false
+		}
+
+		if !timedOut {
+			timedOut = true
+
+			// back off if the segment was already retransmitted or it's a new loss event
+			if seg.sends > 1 || s.onLoss(seq) {
+				s.rto *= 2
+				if s.rto > maxRTO {
+					s.rto = maxRTO
+				}
+			}
+
+			s.cwnd = minCwnd
+		}
+
+		s.retransmit(seq, seg, now)
+		budget--
+	}
+
+	return true
+}
+
+// onLoss shrinks the congestion window once per window of data.
+// It returns true if the loss of segment `seq` starts a new loss event.
+func (s *session) onLoss(seq uint32) bool {
+	if seqLess(seq, s.recover) {
+		return false
+	}
+
+	s.ssthresh = math.Max(s.cwnd/2, minCwnd)
+	s.cwnd = s.ssthresh
+	s.recover = s.sndNxt
+
+	return true
+}
+
+func (s *session) retransmit(seq uint32, seg *segment, now time.Time) {
+	seg.sentAt = now
+	seg.sends++
+	s.send(makeDataPacket(s.id, seq, seg.data))
+}
+
+// flush sends pending segments allowed by the send window.
+func (s *session) flush(now time.Time) {
+	sent := false
+
+	for len(s.pending) > 0 && s.inflight < s.sendWindow() && s.sndNxt-s.sndUna < maxWindow {
+		data := s.pending[0]
+		s.pending[0] = nil
+		s.pending = s.pending[1:]
+
+		seq := s.sndNxt
+		s.sndNxt++
+
+		s.unacked[seq] = &segment{data: data, sentAt: now, sends: 1}
+		s.inflight++
+		s.send(makeDataPacket(s.id, seq, data))
+
+		sent = true
+	}
+
+	if sent {
+		s.notifyWrite()
+	}
+}
+
+// sendWindow returns the number of segments allowed to be in flight.
+func (s *session) sendWindow() int {
+	w := int(s.cwnd)
+	if s.rwnd < w {
+		w = s.rwnd
+	}
+
+	// probe zero window, so that its reopening isn't missed
+	if w < 1 && s.inflight == 0 {
+		w = 1
+	}
+
+	return w
+}
+
+func (s *session) sendAck() {
+	var sack uint64
+
+	for i := uint32(0); i < 64 && len(s.ooo) > 0; i++ {
+		if _, ok := s.ooo[s.rcvNxt+1+i]; ok {
+			sack |= 1 << i
+		}
+	}
+
+	s.lastWnd = s.window()
+	s.send(makeAckPacket(s.id, s.rcvNxt, uint16(s.lastWnd), sack))
+}
+
+// window returns the number of segments the receiver is able to buffer.
+func (s *session) window() int {
+	w := maxWindow - len(s.ooo) - len(s.readQ)
+	if w < 0 {
+		return 0
+	}
+
+	return w
+}
+
+func (s *session) send(p packet) {
+	s.lastSend = time.Now()
+	s.out(p)
+}
+
+// closeStep sends fin once all the data is acknowledged.
+func (s *session) closeStep(now time.Time) {
+	if now.Sub(s.closingSince) >= closeTimeout {
+		s.terminate(nil)
+		return
+	}
+
+	if len(s.pending) != 0 || len(s.unacked) != 0 {
+		return
+	}
+
+	if s.finSentAt.IsZero() || now.Sub(s.finSentAt) >= s.rto {
+		s.send(makeControlPacket(finPacket, s.id))
+		s.finSentAt = now
+	}
+}
+
+// terminate stops the session and removes it from its mux.
+func (s *session) terminate(err error) {
+	if s.isDone() {
+		return
+	}
+
+	s.err = err
+	close(s.done)
+	s.release()
+}
+
+// kill terminates the session with an error.
+func (s *session) kill(err error) {
+	s.mu.Lock()
+	s.terminate(err)
+	s.mu.Unlock()
+}
+
+// termErr returns the error which terminated the session.
+func (s *session) termErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+func (s *session) isDone() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *session) notifyRead() {
+	select {
+	case s.readReady <- struct{}{}:
+	default:
+	}
+}
+
+func (s *session) notifyWrite() {
+	select {
+	case s.writeReady <- struct{}{}:
+	default:
+	}
+}
+
+// Read implements net.Conn.
+func (s *session) Read(b []byte) (int, error) {
+	for {
+		s.mu.Lock()
+
+		if n, ok, err := s.read(b); ok {
+			s.mu.Unlock()
+			return n, err
+		}
+
+		s.mu.Unlock()
+
+		select {
+		case <-s.readReady:
+		case <-s.rDeadline.wait():
+		case <-s.closeCh:
+		case <-s.done:
+		}
+	}
+}
+
+// read reads buffered data, ok is false if Read should wait.
+func (s *session) read(b []byte) (n int, ok bool, err error) {
+	switch {
+	case s.closing:
+		return 0, true, io.ErrClosedPipe
+	case isClosedChan(s.rDeadline.wait()):
+		return 0, true, timeoutError{}
+	case len(b) == 0:
+		return 0, true, nil
+	case len(s.readQ) > 0:
+	case s.remoteClosed:
+		return 0, true, io.EOF
+	case s.err != nil:
+		return 0, true, s.err
+	case s.isDone():
+		return 0, true, io.EOF
+	default:
+		return 0, false, nil
+	}
+
+	for len(b) > 0 && len(s.readQ) > 0 {
+		copied := copy(b, s.readQ[0])
+		n += copied
+		b = b[copied:]
+
+		if copied == len(s.readQ[0]) {
+			s.readQ[0] = nil
+			s.readQ = s.readQ[1:]
+		} else {
+			s.readQ[0] = s.readQ[0][copied:]
+		}
+	}
+
+	// let the sender know the window reopened
+	if s.lastWnd < maxWindow/4 && s.window() >= maxWindow/4 && !s.isDone() {
+		s.sendAck()
+	}
+
+	if len(s.readQ) > 0 {
+		s.notifyRead()
+	}
+
+	return n, true, nil
+}
+
+// Write implements net.Conn.
+func (s *session) Write(b []byte) (int, error) {
+	n := 0
+
+	for {
+		s.mu.Lock()
+
+		if err := s.writeErr(); err != nil {
+			s.mu.Unlock()
+			return n, err
+		}
+
+		for len(b) > 0 && len(s.pending) < maxWindow {
+			size := len(b)
+			if size > maxSegmentSize {
+				size = maxSegmentSize
+			}
+
+			chunk := make([]byte, size)
+			copy(chunk, b)
+			s.pending = append(s.pending, chunk)
+
+			b = b[size:]
+			n += size
+		}
+
+		s.flush(time.Now())
+
+		if len(b) == 0 {
+			if len(s.pending) < maxWindow {
+				s.notifyWrite()
+			}
+
+			s.mu.Unlock()
+
+			return n, nil
+		}
+
+		s.mu.Unlock()
+
+		select {
+		case <-s.writeReady:
+		case <-s.wDeadline.wait():
+		case <-s.closeCh:
+		case <-s.done:
+		}
+	}
+}
+
+func (s *session) writeErr() error {
+	switch {
+	case s.closing:
+		return io.ErrClosedPipe
+	case isClosedChan(s.wDeadline.wait()):
+		return timeoutError{}
+	case s.err != nil:
+		return s.err
+	case s.remoteClosed, s.isDone():
+		return io.ErrClosedPipe
+	default:
+		return nil
+	}
+}
+
+// Close implements net.Conn.
+// Data which is already written is delivered in background before the session is terminated.
+func (s *session) Close() error {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.closing = true
+		s.closingSince = time.Now()
+		close(s.closeCh)
+
+		if !s.established || s.err != nil {
+			s.terminate(nil)
+		}
+	})
+
+	return nil
+}
+
+// LocalAddr implements net.Conn.
+func (s *session) LocalAddr() net.Addr {
+	return s.laddr
+}
+
+// RemoteAddr implements net.Conn.
+func (s *session) RemoteAddr() net.Addr {
+	return s.raddr
+}
+
+// SetDeadline implements net.Conn.
+func (s *session) SetDeadline(t time.Time) error {
+	if err := s.SetReadDeadline(t); err != nil {
+		return err
+	}
+
+	return s.SetWriteDeadline(t)
+}
+
+// SetReadDeadline implements net.Conn.
+func (s *session) SetReadDeadline(t time.Time) error {
+	if isClosedChan(s.closeCh) {
+		return io.ErrClosedPipe
+	}
+
+	s.rDeadline.set(t)
+
+	return nil
+}
+
+// SetWriteDeadline implements net.Conn.
+func (s *session) SetWriteDeadline(t time.Time) error {
+	if isClosedChan(s.closeCh) {
+		return io.ErrClosedPipe
+	}
+
+	s.wDeadline.set(t)
+
+	return nil
+}
+
+// timeoutError is returned on exceeded deadlines, it implements net.Error.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "sudp: i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// deadline is an abstraction for handling timeouts, the same as the one of net.Pipe.
+type deadline struct {
+	mu     sync.Mutex // Guards timer and cancel
+	timer  *time.Timer
+	cancel chan struct{} // Must be non-nil
+}
+
+func makeDeadline() deadline {
+	return deadline{cancel: make(chan struct{})}
+}
+
+// set sets the point in time when the deadline will time out.
+// A timeout event is signaled by closing the channel returned by wait.
+// Once a timeout has occurred, the deadline can be refreshed by specifying a
+// t value in the future.
+//
+// A zero value for t prevents timeout.
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel // Wait for the timer callback to finish and close cancel
+	}
+
+	d.timer = nil
+
+	// Time is zero, then there is no deadline.
+	closed := isClosedChan(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+
+		return
+	}
+
+	// Time in the future, setup a timer to cancel in the future.
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+
+		d.timer = time.AfterFunc(dur, func() {
+			close(d.cancel)
+		})
+
+		return
+	}
+
+	// Time in the past, so close immediately.
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+// wait returns a channel that is closed when the deadline is exceeded.
+func (d *deadline) wait() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.cancel
+}
+
+func isClosedChan(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
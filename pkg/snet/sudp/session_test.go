@@ -0,0 +1,179 @@
+package sudp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/nettest"
+)
+
+func TestMain(m *testing.M) {
+	logging.Disable()
+	os.Exit(m.Run())
+}
+
+func TestSession(t *testing.T) {
+	nettest.TestConn(t, func() (c1, c2 net.Conn, stop func(), err error) {
+		c1, c2, stop = prepareSessions(t, nil)
+		return c1, c2, stop, nil
+	})
+}
+
+func TestSession_Lossy(t *testing.T) {
+	// drop every 10th datagram in both directions
+	var (
+		mu      sync.Mutex
+		counter int
+	)
+
+	drop := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		counter++
+
+		return counter%10 == 0
+	}
+
+	c1, c2, stop := prepareSessions(t, drop)
+	defer stop()
+
+	want := make([]byte, 1<<20)
+	rand.New(rand.NewSource(0)).Read(want) // nolint:gosec
+
+	go func() {
+		_, err := c1.Write(want)
+		assert.NoError(t, err)
+		assert.NoError(t, c1.Close())
+	}()
+
+	got, err := ioutil.ReadAll(c2)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(want, got))
+}
+
+func TestSession_Reset(t *testing.T) {
+	c1, c2, stop := prepareSessions(t, nil)
+	defer stop()
+
+	// remote session disappears without closing
+	c2.kill(io.ErrClosedPipe)
+
+	_, err := c1.Write([]byte("ping"))
+	require.NoError(t, err)
+
+	_, err = c1.Read(make([]byte, 4))
+	require.Equal(t, ErrSessionReset, err)
+}
+
+// prepareSessions establishes a pair of sessions over loopback.
+// If `drop` is not nil, datagrams for which it returns true are dropped by a proxy between them.
+func prepareSessions(t *testing.T, drop func() bool) (*session, *session, func()) {
+	lConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+
+	dConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+
+	log := logging.MustGetLogger("sudp_test")
+	lMux := newUDPMux(lConn, true, log)
+	dMux := newUDPMux(dConn, false, log)
+
+	addr := lConn.LocalAddr().(*net.UDPAddr)
+	stopProxy := func() {}
+
+	if drop != nil {
+		addr, stopProxy = lossyProxy(t, addr, drop)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c1, err := dMux.dial(ctx, addr)
+	require.NoError(t, err)
+
+	c2, err := lMux.accept()
+	require.NoError(t, err)
+
+	stop := func() {
+		_ = c1.Close() // nolint:errcheck
+		_ = c2.Close() // nolint:errcheck
+
+		assert.NoError(t, dMux.Close())
+		assert.NoError(t, lMux.Close())
+
+		stopProxy()
+	}
+
+	return c1, c2, stop
+}
+
+// lossyProxy relays datagrams between a single client and `target`, dropping some of them.
+func lossyProxy(t *testing.T, target *net.UDPAddr, drop func() bool) (*net.UDPAddr, func()) {
+	front, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+
+	back, err := net.DialUDP("udp", nil, target)
+	require.NoError(t, err)
+
+	var (
+		mu     sync.Mutex
+		client *net.UDPAddr
+	)
+
+	go func() {
+		buf := make([]byte, maxPacketSize)
+
+		for {
+			n, addr, err := front.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+
+			mu.Lock()
+			client = addr
+			mu.Unlock()
+
+			if !drop() {
+				_, _ = back.Write(buf[:n]) // nolint:errcheck
+			}
+		}
+	}()
+
+	go func() {
+		buf := make([]byte, maxPacketSize)
+
+		for {
+			n, err := back.Read(buf)
+			if err != nil {
+				return
+			}
+
+			mu.Lock()
+			addr := client
+			mu.Unlock()
+
+			if addr != nil && !drop() {
+				_, _ = front.WriteToUDP(buf[:n], addr) // nolint:errcheck
+			}
+		}
+	}()
+
+	stop := func() {
+		_ = front.Close() // nolint:errcheck
+		_ = back.Close()  // nolint:errcheck
+	}
+
+	return front.LocalAddr().(*net.UDPAddr), stop
+}
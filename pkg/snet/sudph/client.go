@@ -0,0 +1,299 @@
+// Package sudph implements sudp connections established with UDP hole punching.
+package sudph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/skyenv"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/stcp"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/sudp"
+)
+
+// Type is sudph type.
+const Type = "sudph"
+
+const (
+	// bindInterval is the interval of bind packets, it also keeps NAT mapping towards the rendezvous open.
+	bindInterval  = 10 * time.Second
+	punchInterval = 100 * time.Millisecond
+	signalTimeout = 10 * time.Second
+)
+
+// ErrNotServing is returned on attempt to dial before the client serves.
+var ErrNotServing = errors.New("sudph client is not serving")
+
+// Resolver looks up public UDP addresses of visors bound with the rendezvous server.
+type Resolver interface {
+	Resolve(ctx context.Context, network string, pk cipher.PubKey) (string, error)
+}
+
+// punchResponse is sent back to the visor which requested hole punching.
+type punchResponse struct {
+	Error string `json:"error,omitempty"`
+}
+
+// Client establishes sudp connections through NATs.
+//
+// The listening UDP socket of the client is periodically bound with the rendezvous server,
+// which records public address of the socket as seen from the Internet.
+// To dial a remote visor, its public address is resolved and the remote visor is asked over dmsg
+// to punch a hole towards the public address of the dialing visor. Both visors then send packets
+// to each other until a sudp session is established.
+type Client struct {
+	log *logging.Logger
+
+	lPK        cipher.PubKey
+	lSK        cipher.SecKey
+	sudpC      *sudp.Client
+	dmsgC      *dmsg.Client
+	r          Resolver
+	rendezvous string // UDP address of the rendezvous server
+
+	lis  *dmsg.Listener // accepts hole punching requests
+	mx   sync.Mutex
+	done chan struct{}
+	once sync.Once
+}
+
+// NewClient creates a sudph Client. Hole punching is coordinated over `dmsgC`.
+func NewClient(pk cipher.PubKey, sk cipher.SecKey, dmsgC *dmsg.Client, r Resolver, rendezvous string) *Client {
+	return &Client{
+		log:        logging.MustGetLogger(Type),
+		lPK:        pk,
+		lSK:        sk,
+		sudpC:      sudp.NewClient(pk, sk, stcp.NewTable(nil)),
+		dmsgC:      dmsgC,
+		r:          r,
+		rendezvous: rendezvous,
+		done:       make(chan struct{}),
+	}
+}
+
+// SetLogger sets a logger for Client.
+func (c *Client) SetLogger(log *logging.Logger) {
+	c.log = log
+	c.sudpC.SetLogger(log)
+}
+
+// Serve serves the listening portion of the client. Unlike sudp, sudph clients can't dial before serving,
+// as dialing has to happen from the socket bound with the rendezvous server.
+func (c *Client) Serve(udpAddr string) error {
+	if c.isClosed() {
+		return io.ErrClosedPipe
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.lis != nil {
+		return errors.New("already listening")
+	}
+
+	if err := c.sudpC.Serve(udpAddr); err != nil {
+		return err
+	}
+
+	lis, err := c.dmsgC.Listen(skyenv.DmsgHolePunchPort)
+	if err != nil {
+		return err
+	}
+
+	c.lis = lis
+
+	go c.bindLoop()
+	go c.serveSignals(lis)
+
+	return nil
+}
+
+// bindLoop keeps the listening socket bound with the rendezvous server.
+func (c *Client) bindLoop() {
+	ticker := time.NewTicker(bindInterval)
+	defer ticker.Stop()
+
+	for {
+		p, err := MakeBindPacket(c.lPK, c.lSK, time.Now())
+		if err != nil {
+			c.log.WithError(err).Error("Failed to make bind packet.")
+			return
+		}
+
+		if err := c.sudpC.WriteToUDP(p, c.rendezvous); err != nil && !c.isClosed() {
+			c.log.WithError(err).Warnf("Failed to bind with rendezvous %s", c.rendezvous)
+		}
+
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Client) serveSignals(lis *dmsg.Listener) {
+	for {
+		stream, err := lis.AcceptStream()
+		if err != nil {
+			if !c.isClosed() {
+				c.log.Warnf("stopped accepting hole punching requests: %v", err)
+			}
+
+			return
+		}
+
+		go c.handleSignal(stream)
+	}
+}
+
+// handleSignal punches a hole towards the visor which requested it.
+func (c *Client) handleSignal(stream *dmsg.Stream) {
+	defer func() {
+		if err := stream.Close(); err != nil {
+			c.log.WithError(err).Debug("Failed to close hole punching stream.")
+		}
+	}()
+
+	if err := stream.SetDeadline(time.Now().Add(signalTimeout)); err != nil {
+		c.log.WithError(err).Warn("Failed to set deadline of hole punching stream.")
+		return
+	}
+
+	rPK := stream.RawRemoteAddr().PK
+
+	ctx, cancel := context.WithTimeout(context.Background(), signalTimeout)
+	defer cancel()
+
+	var resp punchResponse
+
+	udpAddr, err := c.r.Resolve(ctx, Type, rPK)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to resolve address of %s: %v", rPK, err)
+	} else {
+		c.log.Debugf("Punching hole towards %s at %s", rPK, udpAddr)
+		go c.punch(udpAddr)
+	}
+
+	if err := json.NewEncoder(stream).Encode(resp); err != nil {
+		c.log.WithError(err).Warnf("Failed to respond to hole punching request of %s", rPK)
+	}
+}
+
+// punch sends punch packets to `udpAddr` for the duration of a handshake.
+func (c *Client) punch(udpAddr string) {
+	ctx, cancel := context.WithTimeout(context.Background(), stcp.HandshakeTimeout)
+	defer cancel()
+
+	if err := c.sudpC.Punch(ctx, udpAddr, punchInterval); err != nil && !c.isClosed() {
+		c.log.WithError(err).Warnf("Failed to punch hole towards %s", udpAddr)
+	}
+}
+
+// requestPunch asks the remote visor to punch a hole towards the local one.
+func (c *Client) requestPunch(ctx context.Context, rPK cipher.PubKey) error {
+	stream, err := c.dmsgC.DialStream(ctx, dmsg.Addr{PK: rPK, Port: skyenv.DmsgHolePunchPort})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := stream.Close(); err != nil {
+			c.log.WithError(err).Debug("Failed to close hole punching stream.")
+		}
+	}()
+
+	if err := stream.SetDeadline(time.Now().Add(signalTimeout)); err != nil {
+		return err
+	}
+
+	var resp punchResponse
+	if err := json.NewDecoder(stream).Decode(&resp); err != nil {
+		return err
+	}
+
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+
+	return nil
+}
+
+// Dial dials a new sudph connection to specified remote public key and port.
+func (c *Client) Dial(ctx context.Context, rPK cipher.PubKey, rPort uint16) (*stcp.Conn, error) {
+	if c.isClosed() {
+		return nil, io.ErrClosedPipe
+	}
+
+	c.mx.Lock()
+	serving := c.lis != nil
+	c.mx.Unlock()
+
+	if !serving {
+		return nil, ErrNotServing
+	}
+
+	udpAddr, err := c.r.Resolve(ctx, Type, rPK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve address of %s: %w", rPK, err)
+	}
+
+	if err := c.requestPunch(ctx, rPK); err != nil {
+		return nil, fmt.Errorf("hole punching request failed: %w", err)
+	}
+
+	return c.sudpC.DialAddr(ctx, rPK, rPort, udpAddr)
+}
+
+// Listen creates a new listener for sudph.
+// The created Listener cannot actually accept remote connections unless Serve is called beforehand.
+func (c *Client) Listen(lPort uint16) (*stcp.Listener, error) {
+	if c.isClosed() {
+		return nil, io.ErrClosedPipe
+	}
+
+	return c.sudpC.Listen(lPort)
+}
+
+// Close closes the Client.
+func (c *Client) Close() error {
+	if c == nil {
+		return nil
+	}
+
+	c.once.Do(func() {
+		close(c.done)
+
+		c.mx.Lock()
+		if c.lis != nil {
+			_ = c.lis.Close() // nolint:errcheck
+		}
+		c.mx.Unlock()
+
+		_ = c.sudpC.Close() // nolint:errcheck
+	})
+
+	return nil
+}
+
+func (c *Client) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Type returns the stream type.
+func (c *Client) Type() string {
+	return Type
+}
@@ -0,0 +1,63 @@
+package sudph
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+// Bind packets are sent to the rendezvous server from the listening UDP socket of a visor,
+// so that the rendezvous server learns the public (NAT-mapped) address of the socket.
+//
+//	| public key (33 bytes) | timestamp (8 bytes) | signature (65 bytes) |
+//
+// The timestamp is in Unix nanoseconds, the signature covers the public key and the timestamp.
+const (
+	bindPayloadSize = len(cipher.PubKey{}) + 8
+	// BindPacketSize is the size of bind packets.
+	BindPacketSize = bindPayloadSize + len(cipher.Sig{})
+)
+
+// ErrInvalidBindPacket is returned when a bind packet is malformed or its signature is invalid.
+var ErrInvalidBindPacket = errors.New("invalid bind packet")
+
+// MakeBindPacket creates a bind packet signed with `sk`.
+func MakeBindPacket(pk cipher.PubKey, sk cipher.SecKey, t time.Time) ([]byte, error) {
+	p := make([]byte, BindPacketSize)
+	copy(p, pk[:])
+	binary.BigEndian.PutUint64(p[len(pk):], uint64(t.UnixNano()))
+
+	sig, err := cipher.SignPayload(p[:bindPayloadSize], sk)
+	if err != nil {
+		return nil, err
+	}
+
+	copy(p[bindPayloadSize:], sig[:])
+
+	return p, nil
+}
+
+// ParseBindPacket verifies a bind packet and returns its public key and timestamp.
+func ParseBindPacket(p []byte) (cipher.PubKey, time.Time, error) {
+	if len(p) != BindPacketSize {
+		return cipher.PubKey{}, time.Time{}, ErrInvalidBindPacket
+	}
+
+	var (
+		pk  cipher.PubKey
+		sig cipher.Sig
+	)
+
+	copy(pk[:], p)
+	copy(sig[:], p[bindPayloadSize:])
+
+	if err := cipher.VerifyPubKeySignedPayload(pk, sig, p[:bindPayloadSize]); err != nil {
+		return cipher.PubKey{}, time.Time{}, ErrInvalidBindPacket
+	}
+
+	t := time.Unix(0, int64(binary.BigEndian.Uint64(p[len(pk):])))
+
+	return pk, t, nil
+}
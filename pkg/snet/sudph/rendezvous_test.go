@@ -0,0 +1,37 @@
+package sudph
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindPacket(t *testing.T) {
+	pk, sk := cipher.GenerateKeyPair()
+	now := time.Now()
+
+	p, err := MakeBindPacket(pk, sk, now)
+	require.NoError(t, err)
+	require.Len(t, p, BindPacketSize)
+
+	gotPK, gotTime, err := ParseBindPacket(p)
+	require.NoError(t, err)
+	assert.Equal(t, pk, gotPK)
+	assert.Equal(t, now.UnixNano(), gotTime.UnixNano())
+
+	t.Run("tampered", func(t *testing.T) {
+		tampered := append([]byte(nil), p...)
+		tampered[len(pk)]++
+
+		_, _, err := ParseBindPacket(tampered)
+		assert.Equal(t, ErrInvalidBindPacket, err)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		_, _, err := ParseBindPacket(p[:len(p)-1])
+		assert.Equal(t, ErrInvalidBindPacket, err)
+	})
+}
@@ -46,6 +46,13 @@ func NewHTTP(addr string, key cipher.PubKey, sec cipher.SecKey) (transport.Disco
 	return &apiClient{client: client, key: key, sec: sec}, nil
 }
 
+// NewLazyHTTP creates a new client like NewHTTP, but doesn't contact the discovery until the first request,
+// so it may be created while the discovery is unreachable.
+func NewLazyHTTP(addr string, key cipher.PubKey, sec cipher.SecKey) transport.DiscoveryClient {
+	client := httpauth.NewLazyClient(addr, key, sec)
+	return &apiClient{client: client, key: key, sec: sec}
+}
+
 // Post performs a POST request.
 func (c *apiClient) Post(ctx context.Context, path string, payload interface{}) (*http.Response, error) {
 	body := bytes.NewBuffer(nil)
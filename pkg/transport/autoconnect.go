@@ -0,0 +1,394 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"github.com/google/uuid"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/snet"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/util/pathutil"
+)
+
+const (
+	defaultAutoConnectInterval = time.Minute
+	defaultAutoConnectLookups  = 16
+
+	// autoConnectDialTimeout limits dialing of a single auto-connected transport.
+	autoConnectDialTimeout = 30 * time.Second
+
+	// autoConnectCooldown is for how long visors which failed to connect or were replaced are skipped.
+	autoConnectCooldown = 30 * time.Minute
+)
+
+// AutoConnectConfig configures the auto-connect policy of Manager.
+//
+// The policy keeps `Transports` transports up. If there are fewer of them, transports to well-connected
+// public visors found through transport discovery are established. Auto-connected transports which are down
+// or slow are replaced. Transports established otherwise count towards the target but are never removed.
+type AutoConnectConfig struct {
+	Transports    int             // Number of transports to keep up.
+	MaxTransports int             // No transports are auto-connected if the manager has this many, 0 means no limit.
+	Type          string          // Type of auto-connected transports, dmsg if empty.
+	Allow         []cipher.PubKey // If not empty, only these visors are auto-connected.
+	Deny          []cipher.PubKey // Visors which are never auto-connected.
+	MaxLatency    time.Duration   // Auto-connected transports of higher latency are replaced, 0 means no limit.
+	MaxLoss       float64         // Auto-connected transports of higher packet loss are replaced, 0 means no limit.
+	Interval      time.Duration   // Interval of policy evaluation, a minute if 0.
+	MaxLookups    int             // Maximum number of transport discovery lookups per evaluation, 16 if 0.
+	StateFile     string          // File auto-connected transports are kept in, they are only kept in memory if empty.
+}
+
+func (c AutoConnectConfig) withDefaults() AutoConnectConfig {
+	if c.Type == "" {
+		c.Type = snet.DmsgType
+	}
+
+	if c.Interval <= 0 {
+		c.Interval = defaultAutoConnectInterval
+	}
+
+	if c.MaxLookups <= 0 {
+		c.MaxLookups = defaultAutoConnectLookups
+	}
+
+	return c
+}
+
+// autoConnector enforces AutoConnectConfig. It is only used by a single goroutine.
+type autoConnector struct {
+	tm   *Manager
+	conf AutoConnectConfig
+	log  *logging.Logger
+
+	allow    map[cipher.PubKey]struct{}
+	deny     map[cipher.PubKey]struct{}
+	tps      map[uuid.UUID]time.Time     // auto-connected transports and when they were created
+	cooldown map[cipher.PubKey]time.Time // visors which are skipped until the time
+	changed  bool                        // whether tps changed since they were last saved
+}
+
+func newAutoConnector(tm *Manager, conf AutoConnectConfig) *autoConnector {
+	ac := &autoConnector{
+		tm:       tm,
+		conf:     conf.withDefaults(),
+		log:      tm.Logger,
+		allow:    make(map[cipher.PubKey]struct{}),
+		deny:     make(map[cipher.PubKey]struct{}),
+		tps:      make(map[uuid.UUID]time.Time),
+		cooldown: make(map[cipher.PubKey]time.Time),
+	}
+
+	for _, pk := range conf.Allow {
+		ac.allow[pk] = struct{}{}
+	}
+
+	for _, pk := range conf.Deny {
+		ac.deny[pk] = struct{}{}
+	}
+
+	if err := ac.load(); err != nil {
+		ac.log.WithError(err).Warnf("Failed to load auto-connected transports from %s", ac.conf.StateFile)
+	}
+
+	return ac
+}
+
+// load reads auto-connected transports from the state file.
+// Transports which no longer exist are forgotten by the next evaluation.
+func (ac *autoConnector) load() error {
+	if ac.conf.StateFile == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(filepath.Clean(ac.conf.StateFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, &ac.tps)
+}
+
+// save writes auto-connected transports to the state file if they changed.
+func (ac *autoConnector) save() {
+	if ac.conf.StateFile == "" || !ac.changed {
+		return
+	}
+
+	data, err := json.Marshal(ac.tps)
+	if err != nil {
+		ac.log.WithError(err).Warn("Failed to encode auto-connected transports")
+		return
+	}
+
+	if err := pathutil.EnsureDir(filepath.Dir(ac.conf.StateFile)); err != nil {
+		ac.log.WithError(err).Warnf("Failed to save auto-connected transports to %s", ac.conf.StateFile)
+		return
+	}
+
+	if err := pathutil.AtomicWriteFile(ac.conf.StateFile, data); err != nil {
+		ac.log.WithError(err).Warnf("Failed to save auto-connected transports to %s", ac.conf.StateFile)
+		return
+	}
+
+	ac.changed = false
+}
+
+// run evaluates the policy every interval until the manager is closed.
+func (ac *autoConnector) run(ctx context.Context) {
+	ticker := time.NewTicker(ac.conf.Interval)
+	defer ticker.Stop()
+
+	for {
+		ac.evaluate(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ac.tm.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// evaluate replaces bad auto-connected transports and establishes missing ones.
+func (ac *autoConnector) evaluate(ctx context.Context) {
+	now := time.Now()
+	defer ac.save()
+
+	for id, created := range ac.tps {
+		tp := ac.tm.Transport(id)
+		if tp == nil {
+			delete(ac.tps, id)
+			ac.changed = true
+
+			continue
+		}
+
+		if reason, ok := ac.shouldReplace(tp, now.Sub(created)); ok {
+			ac.log.Infof("Replacing auto-connected transport %s to %s: %s", id, tp.Remote(), reason)
+			ac.tm.DeleteTransport(id)
+			ac.cooldown[tp.Remote()] = now.Add(autoConnectCooldown)
+			delete(ac.tps, id)
+			ac.changed = true
+		}
+	}
+
+	for pk, until := range ac.cooldown {
+		if now.After(until) {
+			delete(ac.cooldown, pk)
+		}
+	}
+
+	need := ac.conf.Transports - ac.upTransports(now)
+	if ac.conf.MaxTransports > 0 {
+		if free := ac.conf.MaxTransports - ac.transports(); free < need {
+			need = free
+		}
+	}
+
+	if need <= 0 {
+		return
+	}
+
+	candidates := ac.candidates(ctx)
+	ac.log.Debugf("Auto-connecting %d transports, %d candidates found", need, len(candidates))
+
+	for _, pk := range candidates {
+		if need == 0 {
+			return
+		}
+
+		if !ac.connect(ctx, pk) {
+			ac.cooldown[pk] = now.Add(autoConnectCooldown)
+			continue
+		}
+
+		need--
+	}
+}
+
+// shouldReplace reports whether an auto-connected transport which exists for `age` should be replaced.
+func (ac *autoConnector) shouldReplace(tp *ManagedTransport, age time.Duration) (string, bool) {
+	if _, ok := ac.deny[tp.Remote()]; ok {
+		return "remote visor is denied", true
+	}
+
+	if !tp.IsUp() {
+		// Give new transports an interval to come up.
+		return "transport is down", age > ac.conf.Interval
+	}
+
+	stats, ok := tp.LinkStats()
+	if !ok {
+		return "", false
+	}
+
+	if ac.conf.MaxLatency > 0 && stats.Latency() > ac.conf.MaxLatency {
+		return fmt.Sprintf("latency %s exceeds %s", stats.Latency(), ac.conf.MaxLatency), true
+	}
+
+	if ac.conf.MaxLoss > 0 && stats.Loss > ac.conf.MaxLoss {
+		return fmt.Sprintf("packet loss %.2f exceeds %.2f", stats.Loss, ac.conf.MaxLoss), true
+	}
+
+	return "", false
+}
+
+// upTransports counts transports which are up, including auto-connected transports which are coming up.
+func (ac *autoConnector) upTransports(now time.Time) int {
+	n := 0
+
+	ac.tm.WalkTransports(func(tp *ManagedTransport) bool {
+		if created, ok := ac.tps[tp.Entry.ID]; tp.IsUp() || ok && now.Sub(created) <= ac.conf.Interval {
+			n++
+		}
+
+		return true
+	})
+
+	return n
+}
+
+func (ac *autoConnector) transports() int {
+	n := 0
+
+	ac.tm.WalkTransports(func(*ManagedTransport) bool {
+		n++
+		return true
+	})
+
+	return n
+}
+
+// candidates crawls transport discovery starting from the local visor and its remotes, and returns visors
+// which may be auto-connected, the best-connected ones first.
+// Visors are ranked by the number of their public transports which are up.
+func (ac *autoConnector) candidates(ctx context.Context) []cipher.PubKey {
+	local := ac.tm.Local()
+	connected := map[cipher.PubKey]struct{}{local: {}}
+	queue := []cipher.PubKey{local}
+
+	ac.tm.WalkTransports(func(tp *ManagedTransport) bool {
+		if _, ok := connected[tp.Remote()]; !ok {
+			connected[tp.Remote()] = struct{}{}
+			queue = append(queue, tp.Remote())
+		}
+
+		return true
+	})
+
+	for _, pk := range ac.conf.Allow {
+		queue = append(queue, pk)
+	}
+
+	degrees := make(map[cipher.PubKey]int)
+	counted := make(map[uuid.UUID]struct{})
+	looked := make(map[cipher.PubKey]struct{})
+
+	for lookups := 0; len(queue) > 0 && lookups < ac.conf.MaxLookups; {
+		pk := queue[0]
+		queue = queue[1:]
+
+		if _, ok := looked[pk]; ok {
+			continue
+		}
+
+		looked[pk] = struct{}{}
+		lookups++
+
+		entries, err := ac.tm.Conf.DiscoveryClient.GetTransportsByEdge(ctx, pk)
+		if err != nil {
+			ac.log.WithError(err).Debugf("Failed to get transports of %s", pk)
+			continue
+		}
+
+		for _, e := range entries {
+			if e.Entry == nil || !e.Entry.Public || !e.IsUp {
+				continue
+			}
+
+			if _, ok := counted[e.Entry.ID]; ok {
+				continue
+			}
+
+			counted[e.Entry.ID] = struct{}{}
+
+			for _, edge := range e.Entry.Edges {
+				degrees[edge]++
+				queue = append(queue, edge)
+			}
+		}
+	}
+
+	var candidates []cipher.PubKey
+
+	if len(ac.allow) > 0 {
+		for pk := range ac.allow {
+			candidates = append(candidates, pk)
+		}
+	} else {
+		for pk := range degrees {
+			candidates = append(candidates, pk)
+		}
+	}
+
+	filtered := candidates[:0]
+
+	for _, pk := range candidates {
+		if _, ok := connected[pk]; ok {
+			continue
+		}
+
+		if _, ok := ac.deny[pk]; ok {
+			continue
+		}
+
+		if _, ok := ac.cooldown[pk]; ok {
+			continue
+		}
+
+		filtered = append(filtered, pk)
+	}
+
+	sort.Slice(filtered, func(i, j int) bool {
+		if degrees[filtered[i]] != degrees[filtered[j]] {
+			return degrees[filtered[i]] > degrees[filtered[j]]
+		}
+
+		return filtered[i].Hex() < filtered[j].Hex()
+	})
+
+	return filtered
+}
+
+// connect establishes a transport to `pk` and reports whether it succeeded.
+func (ac *autoConnector) connect(ctx context.Context, pk cipher.PubKey) bool {
+	ctx, cancel := context.WithTimeout(ctx, autoConnectDialTimeout)
+	defer cancel()
+
+	tp, err := ac.tm.SaveTransport(ctx, pk, ac.conf.Type)
+	if err != nil {
+		ac.log.WithError(err).Warnf("Failed to auto-connect transport to %s", pk)
+		return false
+	}
+
+	ac.tps[tp.Entry.ID] = time.Now()
+	ac.changed = true
+	ac.log.Infof("Auto-connected transport %s to %s", tp.Entry.ID, pk)
+
+	return true
+}
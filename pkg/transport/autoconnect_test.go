@@ -0,0 +1,200 @@
+package transport
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoConnector_Candidates(t *testing.T) {
+	pks := make([]cipher.PubKey, 6)
+	for i := range pks {
+		pks[i], _ = cipher.GenerateKeyPair()
+	}
+
+	local := pks[0]
+	dc := NewDiscoveryMock()
+
+	register := func(a, b cipher.PubKey, public, isUp bool) {
+		entry := &SignedEntry{Entry: NewEntry(a, b, "dmsg", public)}
+		require.NoError(t, dc.RegisterTransports(context.TODO(), entry))
+
+		if !isUp {
+			_, err := dc.UpdateStatuses(context.TODO(), &Status{ID: entry.Entry.ID})
+			require.NoError(t, err)
+		}
+	}
+
+	// pks[1] is connected to the local visor, pks[2] is the best-connected visor.
+	register(local, pks[1], true, true)
+	register(pks[1], pks[2], true, true)
+	register(pks[2], pks[3], true, true)
+	register(pks[2], pks[4], true, true)
+	register(pks[3], pks[4], true, true)
+	// Transports which are private or down don't count.
+	register(pks[3], pks[5], false, true)
+	register(pks[4], pks[5], true, false)
+
+	tm := &Manager{
+		Logger: logging.MustGetLogger("tp_manager"),
+		Conf:   &ManagerConfig{PubKey: local, DiscoveryClient: dc},
+		tps:    map[uuid.UUID]*ManagedTransport{},
+	}
+	tm.tps[MakeTransportID(local, pks[1], "dmsg")] = &ManagedTransport{rPK: pks[1]}
+
+	t.Run("ranked by public transports", func(t *testing.T) {
+		ac := newAutoConnector(tm, AutoConnectConfig{Transports: 1})
+		candidates := ac.candidates(context.TODO())
+
+		require.Len(t, candidates, 3)
+		assert.Equal(t, pks[2], candidates[0])
+		assert.ElementsMatch(t, []cipher.PubKey{pks[3], pks[4]}, candidates[1:])
+		assert.NotContains(t, candidates, pks[5])
+	})
+
+	t.Run("deny list and cooldown", func(t *testing.T) {
+		ac := newAutoConnector(tm, AutoConnectConfig{Transports: 1, Deny: []cipher.PubKey{pks[2]}})
+		ac.cooldown[pks[3]] = time.Now().Add(time.Minute)
+
+		assert.Equal(t, []cipher.PubKey{pks[4]}, ac.candidates(context.TODO()))
+	})
+
+	t.Run("allow list", func(t *testing.T) {
+		ac := newAutoConnector(tm, AutoConnectConfig{Transports: 1, Allow: []cipher.PubKey{pks[1], pks[5]}})
+
+		// pks[1] is already connected.
+		assert.Equal(t, []cipher.PubKey{pks[5]}, ac.candidates(context.TODO()))
+	})
+
+	t.Run("lookup limit", func(t *testing.T) {
+		ac := newAutoConnector(tm, AutoConnectConfig{Transports: 1, MaxLookups: 1})
+
+		assert.Empty(t, ac.candidates(context.TODO()))
+	})
+}
+
+func TestAutoConnector_Budget(t *testing.T) {
+	pk, _ := cipher.GenerateKeyPair()
+	rPK, _ := cipher.GenerateKeyPair()
+	otherPK, _ := cipher.GenerateKeyPair()
+
+	dc := NewDiscoveryMock()
+	require.NoError(t, dc.RegisterTransports(context.TODO(), &SignedEntry{Entry: NewEntry(rPK, otherPK, "dmsg", true)}))
+
+	tm := &Manager{
+		Logger: logging.MustGetLogger("tp_manager"),
+		Conf:   &ManagerConfig{PubKey: pk, DiscoveryClient: dc},
+		tps:    map[uuid.UUID]*ManagedTransport{},
+		done:   make(chan struct{}),
+	}
+	tm.tps[MakeTransportID(pk, rPK, "dmsg")] = &ManagedTransport{rPK: rPK, done: make(chan struct{})}
+
+	t.Run("within budget", func(t *testing.T) {
+		ac := newAutoConnector(tm, AutoConnectConfig{Transports: 2, MaxTransports: 2})
+		ac.evaluate(context.TODO())
+
+		// The manager has no networks, so dialing fails and the candidate is skipped for a while.
+		assert.Empty(t, ac.tps)
+		assert.Contains(t, ac.cooldown, otherPK)
+	})
+
+	t.Run("budget exhausted", func(t *testing.T) {
+		ac := newAutoConnector(tm, AutoConnectConfig{Transports: 2, MaxTransports: 1})
+		ac.evaluate(context.TODO())
+
+		assert.Empty(t, ac.tps)
+		assert.Empty(t, ac.cooldown)
+	})
+}
+
+func TestAutoConnector_ShouldReplace(t *testing.T) {
+	rPK, _ := cipher.GenerateKeyPair()
+	tm := &Manager{Logger: logging.MustGetLogger("tp_manager")}
+	ac := newAutoConnector(tm, AutoConnectConfig{
+		Interval:   time.Minute,
+		MaxLatency: 100 * time.Millisecond,
+		MaxLoss:    0.2,
+	})
+
+	// probed returns a transport which is up and whose probes took `rtt`, `lost` out of 10 probes were lost.
+	probed := func(rtt time.Duration, lost int) *ManagedTransport {
+		tp := &ManagedTransport{rPK: rPK, done: make(chan struct{}), isUp: true}
+		sent := time.Now().Add(-time.Minute)
+
+		for i := 0; i < 10; i++ {
+			id := tp.stats.add(sent)
+			if i >= lost {
+				require.True(t, tp.stats.answer(id, sent.Add(rtt)))
+			}
+		}
+
+		return tp
+	}
+
+	tests := []struct {
+		name    string
+		tp      *ManagedTransport
+		age     time.Duration
+		replace bool
+	}{
+		{"down and new", &ManagedTransport{rPK: rPK, done: make(chan struct{})}, time.Second, false},
+		{"down and old", &ManagedTransport{rPK: rPK, done: make(chan struct{})}, 2 * time.Minute, true},
+		{"up without probes", &ManagedTransport{rPK: rPK, done: make(chan struct{}), isUp: true}, time.Hour, false},
+		{"good", probed(50*time.Millisecond, 0), time.Hour, false},
+		{"high latency", probed(400*time.Millisecond, 0), time.Hour, true},
+		{"high loss", probed(50*time.Millisecond, 5), time.Hour, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reason, replace := ac.shouldReplace(tc.tp, tc.age)
+			assert.Equal(t, tc.replace, replace, reason)
+		})
+	}
+}
+
+func TestAutoConnector_StateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "autoconnect")
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, os.RemoveAll(dir)) }()
+
+	pk, _ := cipher.GenerateKeyPair()
+	rPK, _ := cipher.GenerateKeyPair()
+	id := MakeTransportID(pk, rPK, "dmsg")
+
+	tm := &Manager{
+		Logger: logging.MustGetLogger("tp_manager"),
+		Conf:   &ManagerConfig{PubKey: pk, DiscoveryClient: NewDiscoveryMock()},
+		tps:    map[uuid.UUID]*ManagedTransport{id: {rPK: rPK, done: make(chan struct{}), isUp: true}},
+		done:   make(chan struct{}),
+	}
+	conf := AutoConnectConfig{StateFile: filepath.Join(dir, "skywire", "auto_connected.json")}
+
+	created := time.Now().Add(-time.Hour).Round(0)
+	ac := newAutoConnector(tm, conf)
+	ac.tps[id] = created
+	ac.tps[uuid.New()] = created // no longer exists
+	ac.changed = true
+	ac.evaluate(context.TODO())
+
+	// A restarted visor still knows the transport was auto-connected.
+	restarted := newAutoConnector(tm, conf)
+	require.Len(t, restarted.tps, 1)
+	assert.True(t, created.Equal(restarted.tps[id]))
+
+	// And forgets it once it is removed.
+	delete(tm.tps, id)
+	restarted.evaluate(context.TODO())
+	assert.Empty(t, restarted.tps)
+	assert.Empty(t, newAutoConnector(tm, conf).tps)
+}
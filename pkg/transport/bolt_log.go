@@ -0,0 +1,403 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"go.etcd.io/bbolt"
+)
+
+// Granularity is the length of intervals bandwidth history is aggregated by.
+type Granularity string
+
+const (
+	// GranularityMinute aggregates bandwidth history by minutes.
+	GranularityMinute Granularity = "minute"
+	// GranularityHour aggregates bandwidth history by hours.
+	GranularityHour Granularity = "hour"
+	// GranularityDay aggregates bandwidth history by days (UTC).
+	GranularityDay Granularity = "day"
+)
+
+// Granularities lists supported granularities, from the finest one.
+var Granularities = []Granularity{GranularityMinute, GranularityHour, GranularityDay}
+
+// ErrUnknownGranularity is returned when bandwidth history is queried with an unsupported granularity.
+var ErrUnknownGranularity = errors.New("unknown bandwidth history granularity")
+
+// Interval returns the length of intervals of the granularity.
+func (g Granularity) Interval() time.Duration {
+	switch g {
+	case GranularityMinute:
+		return time.Minute
+	case GranularityHour:
+		return time.Hour
+	case GranularityDay:
+		return 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+// Retention returns for how long bandwidth history of the granularity is kept.
+func (g Granularity) Retention() time.Duration {
+	switch g {
+	case GranularityMinute:
+		return 24 * time.Hour
+	case GranularityHour:
+		return 30 * 24 * time.Hour
+	case GranularityDay:
+		return 365 * 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+// GranularitySince returns the finest granularity of which bandwidth history since `from` is retained.
+func GranularitySince(from time.Time) Granularity {
+	age := time.Since(from)
+
+	for _, g := range Granularities {
+		if age <= g.Retention() {
+			return g
+		}
+	}
+
+	return GranularityDay
+}
+
+// BandwidthRecord represents traffic of a transport within an interval starting at Time.
+type BandwidthRecord struct {
+	Time      time.Time `json:"time"`
+	RecvBytes uint64    `json:"recv"`
+	SentBytes uint64    `json:"sent"`
+}
+
+// MergeBandwidthRecords sums up records of the same intervals. The result is sorted by time.
+func MergeBandwidthRecords(records ...[]BandwidthRecord) []BandwidthRecord {
+	sums := make(map[int64]*BandwidthRecord)
+
+	for _, rs := range records {
+		for _, r := range rs {
+			sum, ok := sums[r.Time.UnixNano()]
+			if !ok {
+				sum = &BandwidthRecord{Time: r.Time}
+				sums[r.Time.UnixNano()] = sum
+			}
+
+			sum.RecvBytes += r.RecvBytes
+			sum.SentBytes += r.SentBytes
+		}
+	}
+
+	merged := make([]BandwidthRecord, 0, len(sums))
+	for _, sum := range sums {
+		merged = append(merged, *sum)
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Time.Before(merged[j].Time)
+	})
+
+	return merged
+}
+
+// HistoryLogStore is a LogStore which also keeps bandwidth history of transports.
+type HistoryLogStore interface {
+	LogStore
+
+	// History returns bandwidth records of the transport of `id` for intervals within [from, to).
+	History(id uuid.UUID, g Granularity, from, to time.Time) ([]BandwidthRecord, error)
+}
+
+var (
+	boltTotalsBucket = []byte("totals")
+)
+
+const boltHistoryCleanupInterval = 10 * time.Minute
+
+// recordedEntry is the state of a LogEntry the last time it was recorded.
+type recordedEntry struct {
+	entry     *LogEntry
+	recvBytes uint64
+	sentBytes uint64
+}
+
+type boltTransportLogStore struct {
+	path string
+
+	mu          sync.Mutex
+	recorded    map[uuid.UUID]recordedEntry
+	lastCleanup time.Time
+}
+
+// BoltTransportLogStore implements TransportLogStore which keeps bandwidth history in a bbolt database at `path`.
+//
+// LogEntries only keep cumulative byte counts of a ManagedTransport, so traffic since the previous Record
+// of the same LogEntry is added to the intervals of every granularity. Totals returned by Entry cover
+// all recorded traffic of a transport, including previous visor runs.
+// Intervals older than the retention of their granularity are removed periodically.
+func BoltTransportLogStore(path string) (HistoryLogStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	tls := &boltTransportLogStore{
+		path:     path,
+		recorded: make(map[uuid.UUID]recordedEntry),
+	}
+
+	err := tls.update(func(tx *bbolt.Tx) error {
+		for _, name := range boltLogBuckets() {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return fmt.Errorf("failed to create bucket: %s", err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tls, nil
+}
+
+func (tls *boltTransportLogStore) Entry(id uuid.UUID) (*LogEntry, error) {
+	var entry *LogEntry
+
+	err := tls.view(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(boltTotalsBucket).Get(id[:])
+		if v == nil {
+			return errors.New("transport log entry not found")
+		}
+
+		recv, sent := decodeBandwidth(v)
+		entry = &LogEntry{RecvBytes: recv, SentBytes: sent}
+
+		return nil
+	})
+
+	return entry, err
+}
+
+func (tls *boltTransportLogStore) Record(id uuid.UUID, entry *LogEntry) error {
+	tls.mu.Lock()
+	defer tls.mu.Unlock()
+
+	current := recordedEntry{
+		entry:     entry,
+		recvBytes: atomic.LoadUint64(&entry.RecvBytes),
+		sentBytes: atomic.LoadUint64(&entry.SentBytes),
+	}
+
+	recv, sent := current.recvBytes, current.sentBytes
+
+	// Only traffic since the previous record of the same LogEntry is new.
+	if prev, ok := tls.recorded[id]; ok && prev.entry == entry &&
+		prev.recvBytes <= recv && prev.sentBytes <= sent {
+		recv -= prev.recvBytes
+		sent -= prev.sentBytes
+	}
+
+	now := time.Now()
+	cleanup := now.Sub(tls.lastCleanup) >= boltHistoryCleanupInterval
+
+	if recv == 0 && sent == 0 && !cleanup {
+		tls.recorded[id] = current
+		return nil
+	}
+
+	err := tls.update(func(tx *bbolt.Tx) error {
+		if err := addBandwidth(tx.Bucket(boltTotalsBucket), id[:], recv, sent); err != nil {
+			return err
+		}
+
+		for _, g := range Granularities {
+			b, err := tx.Bucket([]byte(g)).CreateBucketIfNotExists(id[:])
+			if err != nil {
+				return err
+			}
+
+			if err := addBandwidth(b, timestampKey(now.Truncate(g.Interval())), recv, sent); err != nil {
+				return err
+			}
+		}
+
+		if cleanup {
+			return removeExpiredBandwidth(tx, now)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	tls.recorded[id] = current
+
+	if cleanup {
+		tls.lastCleanup = now
+	}
+
+	return nil
+}
+
+func (tls *boltTransportLogStore) History(id uuid.UUID, g Granularity, from, to time.Time) ([]BandwidthRecord, error) {
+	if g.Interval() == 0 {
+		return nil, ErrUnknownGranularity
+	}
+
+	records := make([]BandwidthRecord, 0)
+
+	err := tls.view(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(g)).Bucket(id[:])
+		if b == nil {
+			return nil
+		}
+
+		end := timestampKey(to)
+		c := b.Cursor()
+
+		for k, v := c.Seek(timestampKey(from.Truncate(g.Interval()))); k != nil && bytes.Compare(k, end) < 0; k, v = c.Next() {
+			recv, sent := decodeBandwidth(v)
+			records = append(records, BandwidthRecord{
+				Time:      time.Unix(int64(binary.BigEndian.Uint64(k)), 0).UTC(),
+				RecvBytes: recv,
+				SentBytes: sent,
+			})
+		}
+
+		return nil
+	})
+
+	return records, err
+}
+
+// update opens the database, runs `fn` within a read-write transaction and closes the database.
+func (tls *boltTransportLogStore) update(fn func(tx *bbolt.Tx) error) (err error) {
+	db, err := bbolt.Open(tls.path, 0600, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if closeErr := db.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	return db.Update(fn)
+}
+
+// view opens the database, runs `fn` within a read-only transaction and closes the database.
+func (tls *boltTransportLogStore) view(fn func(tx *bbolt.Tx) error) (err error) {
+	db, err := bbolt.Open(tls.path, 0600, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if closeErr := db.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	return db.View(fn)
+}
+
+func boltLogBuckets() [][]byte {
+	buckets := [][]byte{boltTotalsBucket}
+	for _, g := range Granularities {
+		buckets = append(buckets, []byte(g))
+	}
+
+	return buckets
+}
+
+// removeExpiredBandwidth removes intervals older than the retention of their granularity.
+func removeExpiredBandwidth(tx *bbolt.Tx, now time.Time) error {
+	for _, g := range Granularities {
+		cutoff := timestampKey(now.Add(-g.Retention()))
+		gb := tx.Bucket([]byte(g))
+
+		var tpIDs [][]byte
+		if err := gb.ForEach(func(k, _ []byte) error {
+			tpIDs = append(tpIDs, k)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, id := range tpIDs {
+			b := gb.Bucket(id)
+			if b == nil {
+				continue
+			}
+
+			var expired [][]byte
+
+			c := b.Cursor()
+			for k, _ := c.First(); k != nil && bytes.Compare(k, cutoff) < 0; k, _ = c.Next() {
+				expired = append(expired, k)
+			}
+
+			for _, k := range expired {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+
+			if k, _ := b.Cursor().First(); k == nil {
+				if err := gb.DeleteBucket(id); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func addBandwidth(b *bbolt.Bucket, key []byte, recv, sent uint64) error {
+	prevRecv, prevSent := decodeBandwidth(b.Get(key))
+	return b.Put(key, encodeBandwidth(prevRecv+recv, prevSent+sent))
+}
+
+func encodeBandwidth(recv, sent uint64) []byte {
+	v := make([]byte, 16)
+	binary.BigEndian.PutUint64(v, recv)
+	binary.BigEndian.PutUint64(v[8:], sent)
+
+	return v
+}
+
+func decodeBandwidth(v []byte) (recv, sent uint64) {
+	if len(v) != 16 {
+		return 0, 0
+	}
+
+	return binary.BigEndian.Uint64(v), binary.BigEndian.Uint64(v[8:])
+}
+
+// timestampKey encodes `t` as a bbolt key which sorts chronologically. Times before the Unix epoch are clamped to it.
+func timestampKey(t time.Time) []byte {
+	var sec uint64
+	if t.Unix() > 0 {
+		sec = uint64(t.Unix())
+	}
+
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, sec)
+
+	return k
+}
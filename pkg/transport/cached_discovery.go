@@ -0,0 +1,652 @@
+package transport
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/httputil"
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"github.com/google/uuid"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// discoveryReplayInterval is the interval of attempts to replay queued calls.
+	discoveryReplayInterval = 30 * time.Second
+
+	// discoveryReplayTimeout limits a single replayed call.
+	discoveryReplayTimeout = 10 * time.Second
+
+	// discoveryQueueLimit is the maximum number of queued calls. The oldest ones are dropped beyond it.
+	discoveryQueueLimit = 1024
+
+	// discoveryCacheOpenTimeout limits waiting for the database to be unlocked by another process.
+	discoveryCacheOpenTimeout = 5 * time.Second
+)
+
+var (
+	cachedEntriesBucket = []byte("entries")
+	queuedCallsBucket   = []byte("queue")
+)
+
+// ErrNotCached is returned by CachedDiscovery if transport discovery is unreachable and the entry isn't cached.
+var ErrNotCached = errors.New("transport discovery is unreachable and the entry is not cached")
+
+// cachedEntry is an entry of transport discovery along with the time it was last received from it.
+type cachedEntry struct {
+	Entry   EntryWithStatus `json:"entry"`
+	Updated time.Time       `json:"updated"`
+}
+
+// queuedCall is a call of transport discovery which was made while it was unreachable.
+type queuedCall struct {
+	Register []*SignedEntry `json:"register,omitempty"`
+	Statuses []*Status      `json:"statuses,omitempty"`
+	Delete   *uuid.UUID     `json:"delete,omitempty"`
+}
+
+// CachedDiscovery is a DiscoveryClient which keeps working while transport discovery is unreachable.
+//
+// Entries received from transport discovery are kept in a bbolt database. While transport discovery is
+// unreachable, entries are served from the database with EntryWithStatus.Stale set, and registrations,
+// status updates and deletions are applied to the database and queued. Queued calls are replayed in order
+// once transport discovery is reachable again, before any new call is made.
+// Queued status updates of a transport are replaced by newer ones, and at most discoveryQueueLimit
+// calls are queued.
+type CachedDiscovery struct {
+	dc  DiscoveryClient
+	db  *bbolt.DB
+	log *logging.Logger
+
+	mu       sync.Mutex // serializes replays and calls which modify transport discovery
+	syncMu   sync.Mutex
+	lastSync time.Time
+
+	ctx       context.Context // canceled on Close
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewCachedDiscovery wraps `dc` with a cache kept in a bbolt database at `path`.
+// Calls queued by previous runs are replayed in the background.
+func NewCachedDiscovery(dc DiscoveryClient, path string) (*CachedDiscovery, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: discoveryCacheOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{cachedEntriesBucket, queuedCallsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return fmt.Errorf("failed to create bucket: %s", err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		_ = db.Close() //nolint:errcheck
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cd := &CachedDiscovery{
+		dc:     dc,
+		db:     db,
+		log:    logging.MustGetLogger("tp_discovery_cache"),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	cd.wg.Add(1)
+	go cd.replayLoop()
+
+	return cd, nil
+}
+
+// LastSync returns when transport discovery was last reachable. It's zero if it hasn't been reached yet.
+func (cd *CachedDiscovery) LastSync() time.Time {
+	cd.syncMu.Lock()
+	defer cd.syncMu.Unlock()
+
+	return cd.lastSync
+}
+
+// Queued returns the number of calls waiting to be replayed.
+func (cd *CachedDiscovery) Queued() (int, error) {
+	var n int
+
+	err := cd.view(func(tx *bbolt.Tx) error {
+		n = tx.Bucket(queuedCallsBucket).Stats().KeyN
+		return nil
+	})
+
+	return n, err
+}
+
+// Close stops replaying queued calls and closes the database. Queued calls are kept in the database.
+func (cd *CachedDiscovery) Close() error {
+	cd.closeOnce.Do(func() {
+		cd.cancel()
+		cd.wg.Wait()
+
+		cd.closeErr = cd.db.Close()
+	})
+
+	return cd.closeErr
+}
+
+// RegisterTransports registers transports in transport discovery.
+// If it's unreachable, the registration is queued and the entries are cached as up.
+func (cd *CachedDiscovery) RegisterTransports(ctx context.Context, entries ...*SignedEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	call := queuedCall{Register: entries}
+
+	return cd.modify(ctx, call, func() error {
+		return cd.dc.RegisterTransports(ctx, entries...)
+	})
+}
+
+// GetTransportByID returns the entry of `id`. If transport discovery is unreachable, the cached entry is returned.
+func (cd *CachedDiscovery) GetTransportByID(ctx context.Context, id uuid.UUID) (*EntryWithStatus, error) {
+	entry, err := cd.dc.GetTransportByID(ctx, id)
+	if err == nil {
+		cd.synced()
+		cd.cacheEntries(entry)
+
+		return entry, nil
+	}
+
+	if !isUnreachable(err) {
+		return nil, err
+	}
+
+	cd.log.WithError(err).Debugf("Transport discovery is unreachable, looking up cached transport %s.", id)
+
+	entries, cacheErr := cd.cachedEntries(func(e *EntryWithStatus) bool { return e.Entry.ID == id })
+	if cacheErr != nil {
+		return nil, cacheErr
+	}
+
+	if len(entries) == 0 {
+		return nil, ErrNotCached
+	}
+
+	return entries[0], nil
+}
+
+// GetTransportsByEdge returns entries of `pk`. If transport discovery is unreachable, cached entries are returned.
+func (cd *CachedDiscovery) GetTransportsByEdge(ctx context.Context, pk cipher.PubKey) ([]*EntryWithStatus, error) {
+	entries, err := cd.dc.GetTransportsByEdge(ctx, pk)
+	if err == nil {
+		cd.synced()
+		cd.replaceEdgeEntries(pk, entries)
+
+		return entries, nil
+	}
+
+	if !isUnreachable(err) {
+		return nil, err
+	}
+
+	cd.log.WithError(err).Debugf("Transport discovery is unreachable, looking up cached transports of %s.", pk)
+
+	return cd.cachedEntries(func(e *EntryWithStatus) bool { return e.Entry.HasEdge(pk) })
+}
+
+// DeleteTransport deletes the transport of `id`. If transport discovery is unreachable, the deletion is queued.
+func (cd *CachedDiscovery) DeleteTransport(ctx context.Context, id uuid.UUID) error {
+	call := queuedCall{Delete: &id}
+
+	return cd.modify(ctx, call, func() error {
+		return cd.dc.DeleteTransport(ctx, id)
+	})
+}
+
+// UpdateStatuses updates statuses of transports. If transport discovery is unreachable, the update is queued
+// and cached entries are updated and returned.
+func (cd *CachedDiscovery) UpdateStatuses(ctx context.Context, statuses ...*Status) ([]*EntryWithStatus, error) {
+	if len(statuses) == 0 {
+		return nil, nil
+	}
+
+	var entries []*EntryWithStatus
+
+	call := queuedCall{Statuses: statuses}
+
+	err := cd.modify(ctx, call, func() error {
+		var err error
+		entries, err = cd.dc.UpdateStatuses(ctx, statuses...)
+
+		return err
+	})
+	if err != nil || entries != nil {
+		return entries, err
+	}
+
+	ids := make(map[uuid.UUID]struct{}, len(statuses))
+	for _, s := range statuses {
+		ids[s.ID] = struct{}{}
+	}
+
+	return cd.cachedEntries(func(e *EntryWithStatus) bool {
+		_, ok := ids[e.Entry.ID]
+		return ok
+	})
+}
+
+// modify replays queued calls and makes a call which modifies transport discovery.
+// If transport discovery is unreachable, `call` is applied to the cache and queued instead.
+func (cd *CachedDiscovery) modify(ctx context.Context, call queuedCall, fn func() error) error {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+
+	err := cd.replay(ctx)
+	if err == nil {
+		if err = fn(); err == nil {
+			cd.synced()
+			return cd.apply(call, false)
+		}
+	}
+
+	if !isUnreachable(err) {
+		return err
+	}
+
+	cd.log.WithError(err).Debug("Transport discovery is unreachable, queueing the call.")
+
+	return cd.apply(call, true)
+}
+
+// apply applies a call to cached entries, and queues it if `queue` is set.
+func (cd *CachedDiscovery) apply(call queuedCall, queue bool) error {
+	now := time.Now()
+
+	return cd.update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(cachedEntriesBucket)
+
+		for _, se := range call.Register {
+			entry := EntryWithStatus{
+				Entry:      se.Entry,
+				IsUp:       true,
+				Registered: se.Registered,
+				Statuses:   [2]bool{true, true},
+			}
+
+			if err := putCachedEntry(b, cachedEntry{Entry: entry, Updated: now}); err != nil {
+				return err
+			}
+		}
+
+		for _, s := range call.Statuses {
+			ce, ok := getCachedEntry(b, s.ID)
+			if !ok {
+				continue
+			}
+
+			ce.Entry.IsUp = s.IsUp
+			if s.LinkStats != nil {
+				ce.Entry.LinkStats = s.LinkStats
+			}
+
+			if err := putCachedEntry(b, ce); err != nil {
+				return err
+			}
+		}
+
+		if call.Delete != nil {
+			if err := b.Delete(call.Delete[:]); err != nil {
+				return err
+			}
+		}
+
+		if !queue {
+			return nil
+		}
+
+		return cd.queueCall(tx.Bucket(queuedCallsBucket), call)
+	})
+}
+
+// queueCall queues `call`. Queued status updates of transports updated by `call` are dropped,
+// so that only the latest status of each transport is replayed. Once the queue is full,
+// the oldest calls are dropped.
+func (cd *CachedDiscovery) queueCall(b *bbolt.Bucket, call queuedCall) error {
+	if len(call.Statuses) > 0 {
+		if err := dropQueuedStatuses(b, call.Statuses); err != nil {
+			return err
+		}
+	}
+
+	n := 0
+
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		n++
+	}
+
+	for ; n >= discoveryQueueLimit; n-- {
+		k, _ := b.Cursor().First()
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+
+		cd.log.Warn("Too many calls of transport discovery are queued, dropping the oldest one.")
+	}
+
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+
+	v, err := json.Marshal(call)
+	if err != nil {
+		return err
+	}
+
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+
+	return b.Put(k, v)
+}
+
+// replay replays queued calls in order. Calls rejected by transport discovery are dropped.
+// It returns an error if transport discovery is unreachable. cd.mu has to be locked.
+func (cd *CachedDiscovery) replay(ctx context.Context) error {
+	for {
+		var (
+			key  []byte
+			call queuedCall
+		)
+
+		err := cd.view(func(tx *bbolt.Tx) error {
+			k, v := tx.Bucket(queuedCallsBucket).Cursor().First()
+			if k == nil {
+				return nil
+			}
+
+			key = append([]byte(nil), k...)
+
+			return json.Unmarshal(v, &call)
+		})
+		if err != nil {
+			return err
+		}
+
+		if key == nil {
+			return nil
+		}
+
+		if err := cd.call(ctx, call); err != nil {
+			if isUnreachable(err) {
+				return err
+			}
+
+			cd.log.WithError(err).Warn("Transport discovery rejected a queued call, dropping it.")
+		}
+
+		if err := cd.update(func(tx *bbolt.Tx) error {
+			return tx.Bucket(queuedCallsBucket).Delete(key)
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+func (cd *CachedDiscovery) call(ctx context.Context, call queuedCall) error {
+	switch {
+	case len(call.Register) > 0:
+		return cd.dc.RegisterTransports(ctx, call.Register...)
+	case len(call.Statuses) > 0:
+		_, err := cd.dc.UpdateStatuses(ctx, call.Statuses...)
+		return err
+	case call.Delete != nil:
+		return cd.dc.DeleteTransport(ctx, *call.Delete)
+	default:
+		return nil
+	}
+}
+
+// replayLoop periodically replays queued calls until CachedDiscovery is closed.
+func (cd *CachedDiscovery) replayLoop() {
+	defer cd.wg.Done()
+
+	ticker := time.NewTicker(discoveryReplayInterval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := cd.Queued(); err != nil {
+			cd.log.WithError(err).Warn("Failed to read queued calls.")
+		} else if n > 0 {
+			ctx, cancel := context.WithTimeout(cd.ctx, discoveryReplayTimeout)
+
+			cd.mu.Lock()
+			err := cd.replay(ctx)
+			cd.mu.Unlock()
+
+			cancel()
+
+			if err != nil {
+				cd.log.WithError(err).Debugf("Failed to replay %d queued calls.", n)
+			} else {
+				cd.synced()
+				cd.log.Infof("Replayed %d queued calls.", n)
+			}
+		}
+
+		select {
+		case <-cd.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cd *CachedDiscovery) synced() {
+	cd.syncMu.Lock()
+	cd.lastSync = time.Now()
+	cd.syncMu.Unlock()
+}
+
+func (cd *CachedDiscovery) cacheEntries(entries ...*EntryWithStatus) {
+	now := time.Now()
+
+	err := cd.update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(cachedEntriesBucket)
+
+		for _, e := range entries {
+			if e == nil || e.Entry == nil {
+				continue
+			}
+
+			if err := putCachedEntry(b, cachedEntry{Entry: *e, Updated: now}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		cd.log.WithError(err).Warn("Failed to cache transport entries.")
+	}
+}
+
+// replaceEdgeEntries caches `entries` as all entries of `pk`.
+func (cd *CachedDiscovery) replaceEdgeEntries(pk cipher.PubKey, entries []*EntryWithStatus) {
+	err := cd.update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(cachedEntriesBucket)
+
+		var gone [][]byte
+
+		if err := b.ForEach(func(k, v []byte) error {
+			var ce cachedEntry
+			if err := json.Unmarshal(v, &ce); err != nil || ce.Entry.Entry == nil || ce.Entry.Entry.HasEdge(pk) {
+				gone = append(gone, k)
+			}
+
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, k := range gone {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		cd.log.WithError(err).Warn("Failed to remove cached transport entries.")
+		return
+	}
+
+	cd.cacheEntries(entries...)
+}
+
+// cachedEntries returns cached entries matching `match`, marked as stale.
+func (cd *CachedDiscovery) cachedEntries(match func(e *EntryWithStatus) bool) ([]*EntryWithStatus, error) {
+	var entries []*EntryWithStatus
+
+	err := cd.view(func(tx *bbolt.Tx) error {
+		return tx.Bucket(cachedEntriesBucket).ForEach(func(_, v []byte) error {
+			var ce cachedEntry
+			if err := json.Unmarshal(v, &ce); err != nil {
+				return err
+			}
+
+			if ce.Entry.Entry == nil || !match(&ce.Entry) {
+				return nil
+			}
+
+			ce.Entry.Stale = true
+			entries = append(entries, &ce.Entry)
+
+			return nil
+		})
+	})
+
+	return entries, err
+}
+
+// update runs `fn` within a read-write transaction.
+func (cd *CachedDiscovery) update(fn func(tx *bbolt.Tx) error) error {
+	return cd.db.Update(fn)
+}
+
+// view runs `fn` within a read-only transaction.
+func (cd *CachedDiscovery) view(fn func(tx *bbolt.Tx) error) error {
+	return cd.db.View(fn)
+}
+
+func getCachedEntry(b *bbolt.Bucket, id uuid.UUID) (cachedEntry, bool) {
+	var ce cachedEntry
+
+	v := b.Get(id[:])
+	if v == nil || json.Unmarshal(v, &ce) != nil || ce.Entry.Entry == nil {
+		return ce, false
+	}
+
+	return ce, true
+}
+
+func putCachedEntry(b *bbolt.Bucket, ce cachedEntry) error {
+	ce.Entry.Stale = false
+
+	v, err := json.Marshal(ce)
+	if err != nil {
+		return err
+	}
+
+	return b.Put(ce.Entry.Entry.ID[:], v)
+}
+
+// dropQueuedStatuses removes queued status updates of transports of `statuses`.
+// Queued calls which are left without any status updates are removed.
+func dropQueuedStatuses(b *bbolt.Bucket, statuses []*Status) error {
+	ids := make(map[uuid.UUID]struct{}, len(statuses))
+	for _, s := range statuses {
+		ids[s.ID] = struct{}{}
+	}
+
+	changed := make(map[string]*queuedCall)
+
+	if err := b.ForEach(func(k, v []byte) error {
+		var call queuedCall
+		if err := json.Unmarshal(v, &call); err != nil || len(call.Statuses) == 0 {
+			return nil
+		}
+
+		kept := call.Statuses[:0]
+		for _, s := range call.Statuses {
+			if _, ok := ids[s.ID]; !ok {
+				kept = append(kept, s)
+			}
+		}
+
+		if len(kept) == len(call.Statuses) {
+			return nil
+		}
+
+		call.Statuses = kept
+		changed[string(k)] = &call
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for k, call := range changed {
+		if len(call.Statuses) == 0 {
+			if err := b.Delete([]byte(k)); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		v, err := json.Marshal(call)
+		if err != nil {
+			return err
+		}
+
+		if err := b.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isUnreachable reports whether `err` means that transport discovery couldn't be reached,
+// rather than that it rejected the request.
+func isUnreachable(err error) bool {
+	var httpErr *httputil.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Temporary() || httpErr.Status >= 500
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,181 @@
+package transport_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/httputil"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/transport"
+)
+
+// flakyDiscovery is a transport discovery client which fails with `err` if it's set.
+type flakyDiscovery struct {
+	transport.DiscoveryClient
+	mu  sync.Mutex
+	err error
+}
+
+func (d *flakyDiscovery) setErr(err error) {
+	d.mu.Lock()
+	d.err = err
+	d.mu.Unlock()
+}
+
+func (d *flakyDiscovery) getErr() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.err
+}
+
+func (d *flakyDiscovery) RegisterTransports(ctx context.Context, entries ...*transport.SignedEntry) error {
+	if err := d.getErr(); err != nil {
+		return err
+	}
+
+	return d.DiscoveryClient.RegisterTransports(ctx, entries...)
+}
+
+func (d *flakyDiscovery) GetTransportByID(ctx context.Context, id uuid.UUID) (*transport.EntryWithStatus, error) {
+	if err := d.getErr(); err != nil {
+		return nil, err
+	}
+
+	return d.DiscoveryClient.GetTransportByID(ctx, id)
+}
+
+func (d *flakyDiscovery) GetTransportsByEdge(ctx context.Context, pk cipher.PubKey) ([]*transport.EntryWithStatus, error) {
+	if err := d.getErr(); err != nil {
+		return nil, err
+	}
+
+	return d.DiscoveryClient.GetTransportsByEdge(ctx, pk)
+}
+
+func (d *flakyDiscovery) DeleteTransport(ctx context.Context, id uuid.UUID) error {
+	if err := d.getErr(); err != nil {
+		return err
+	}
+
+	return d.DiscoveryClient.DeleteTransport(ctx, id)
+}
+
+func (d *flakyDiscovery) UpdateStatuses(ctx context.Context, statuses ...*transport.Status) ([]*transport.EntryWithStatus, error) {
+	if err := d.getErr(); err != nil {
+		return nil, err
+	}
+
+	return d.DiscoveryClient.UpdateStatuses(ctx, statuses...)
+}
+
+func TestCachedDiscovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tp_discovery_cache")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+
+	path := filepath.Join(dir, "cache.db")
+	unreachable := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	pk1, _ := cipher.GenerateKeyPair()
+	pk2, _ := cipher.GenerateKeyPair()
+	pk3, _ := cipher.GenerateKeyPair()
+
+	online := &transport.SignedEntry{Entry: transport.NewEntry(pk1, pk2, "dmsg", true)}
+	offline := &transport.SignedEntry{Entry: transport.NewEntry(pk1, pk3, "dmsg", true)}
+
+	mock := transport.NewDiscoveryMock()
+	dc := &flakyDiscovery{DiscoveryClient: mock}
+
+	cd, err := transport.NewCachedDiscovery(dc, path)
+	require.NoError(t, err)
+	assert.True(t, cd.LastSync().IsZero())
+
+	// Entries are cached while transport discovery is reachable.
+	require.NoError(t, cd.RegisterTransports(context.TODO(), online))
+	assert.False(t, cd.LastSync().IsZero())
+
+	entries, err := cd.GetTransportsByEdge(context.TODO(), pk1)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.False(t, entries[0].Stale)
+
+	// Errors other than transport discovery being unreachable are returned and calls are not queued.
+	dc.setErr(&httputil.HTTPError{Status: 400, Body: "bad request"})
+	assert.Error(t, cd.DeleteTransport(context.TODO(), online.Entry.ID))
+
+	n, err := cd.Queued()
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// Calls are queued while transport discovery is unreachable.
+	dc.setErr(unreachable)
+
+	require.NoError(t, cd.RegisterTransports(context.TODO(), offline))
+
+	// Only the latest status of a transport is queued.
+	for _, isUp := range []bool{true, false, true, false} {
+		_, err = cd.UpdateStatuses(context.TODO(), &transport.Status{ID: online.Entry.ID, IsUp: isUp})
+		require.NoError(t, err)
+	}
+
+	n, err = cd.Queued()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	require.NoError(t, cd.Close())
+
+	// Cached entries and queued calls persist across restarts.
+	cd, err = transport.NewCachedDiscovery(dc, path)
+	require.NoError(t, err)
+
+	entries, err = cd.GetTransportsByEdge(context.TODO(), pk1)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	for _, e := range entries {
+		assert.True(t, e.Stale)
+		assert.Equal(t, e.Entry.ID == offline.Entry.ID, e.IsUp)
+	}
+
+	entry, err := cd.GetTransportByID(context.TODO(), offline.Entry.ID)
+	require.NoError(t, err)
+	assert.True(t, entry.Stale)
+
+	_, err = cd.GetTransportByID(context.TODO(), uuid.New())
+	assert.Equal(t, transport.ErrNotCached, err)
+
+	// Queued calls are replayed in order before the next call.
+	dc.setErr(nil)
+	require.NoError(t, cd.DeleteTransport(context.TODO(), online.Entry.ID))
+
+	n, err = cd.Queued()
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	entries, err = mock.GetTransportsByEdge(context.TODO(), pk1)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, offline.Entry.ID, entries[0].Entry.ID)
+
+	dc.setErr(unreachable)
+
+	entries, err = cd.GetTransportsByEdge(context.TODO(), pk1)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, offline.Entry.ID, entries[0].Entry.ID)
+
+	require.NoError(t, cd.Close())
+}
@@ -61,6 +61,7 @@ func (td *mockDiscoveryClient) GetTransportByID(ctx context.Context, id uuid.UUI
 		IsUp:       entry.IsUp,
 		Registered: entry.Registered,
 		Statuses:   entry.Statuses,
+		LinkStats:  entry.LinkStats,
 	}, nil
 }
 
@@ -109,6 +110,9 @@ func (td *mockDiscoveryClient) UpdateStatuses(ctx context.Context, statuses ...*
 
 		td.Lock()
 		entry.IsUp = status.IsUp
+		if status.LinkStats != nil {
+			entry.LinkStats = status.LinkStats
+		}
 		td.entries[status.ID] = *entry
 		td.Unlock()
 	}
@@ -169,14 +169,22 @@ type Status struct {
 
 	// Updated is the epoch timestamp of when the status is last updated.
 	Updated int64 `json:"updated,omitempty"`
+
+	// LinkStats are latency and loss of the Transport measured by the edge, if reported.
+	LinkStats *LinkStats `json:"link_stats,omitempty"`
 }
 
 // EntryWithStatus stores Entry and Statuses returned by both Edges.
+// LinkStats are the latest link statistics reported by either of the edges, if any.
 type EntryWithStatus struct {
-	Entry      *Entry  `json:"entry"`
-	IsUp       bool    `json:"is_up"`
-	Registered int64   `json:"registered"`
-	Statuses   [2]bool `json:"statuses"`
+	Entry      *Entry     `json:"entry"`
+	IsUp       bool       `json:"is_up"`
+	Registered int64      `json:"registered"`
+	Statuses   [2]bool    `json:"statuses"`
+	LinkStats  *LinkStats `json:"link_stats,omitempty"`
+
+	// Stale is set if the entry was served from a local cache while transport discovery was unreachable.
+	Stale bool `json:"stale,omitempty"`
 }
 
 // String implements stringer
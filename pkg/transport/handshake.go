@@ -47,8 +47,22 @@ func compareEntries(expected, received *Entry) error {
 	return nil
 }
 
-func receiveAndVerifyEntry(r io.Reader, expected *Entry, remotePK cipher.PubKey) (*SignedEntry, error) {
-	var recvSE SignedEntry
+// settlementEntry is the signed entry sent by the initiating visor of the settlement handshake.
+// Besides the entry, it advertises features of the initiating visor, older visors ignore them.
+type settlementEntry struct {
+	SignedEntry
+	Probes bool `json:"probes,omitempty"` // whether transport probes are supported
+}
+
+// Responses of the responding visor of the settlement handshake.
+// Older visors accept with 1 and treat any non-zero response as acceptance.
+const (
+	settlementRejected       = 0
+	settlementAcceptedProbes = 2 // accepted, transport probes are supported
+)
+
+func receiveAndVerifyEntry(r io.Reader, expected *Entry, remotePK cipher.PubKey) (*settlementEntry, error) {
+	var recvSE settlementEntry
 
 	if err := json.NewDecoder(r).Decode(&recvSE); err != nil {
 		return nil, fmt.Errorf("failed to read entry: %s", err)
@@ -72,20 +86,21 @@ func receiveAndVerifyEntry(r io.Reader, expected *Entry, remotePK cipher.PubKey)
 
 // SettlementHS represents a settlement handshake.
 // This is the handshake responsible for registering a transport to transport discovery.
-type SettlementHS func(ctx context.Context, dc DiscoveryClient, conn *snet.Conn, sk cipher.SecKey) error
+// It returns whether the remote supports transport probes, older visors don't.
+type SettlementHS func(ctx context.Context, dc DiscoveryClient, conn *snet.Conn, sk cipher.SecKey) (probes bool, err error)
 
 // Do performs the settlement handshake.
-func (hs SettlementHS) Do(ctx context.Context, dc DiscoveryClient, conn *snet.Conn, sk cipher.SecKey) (err error) {
+func (hs SettlementHS) Do(ctx context.Context, dc DiscoveryClient, conn *snet.Conn, sk cipher.SecKey) (probes bool, err error) {
 	done := make(chan struct{})
 	go func() {
-		err = hs(ctx, dc, conn, sk)
+		probes, err = hs(ctx, dc, conn, sk)
 		close(done)
 	}()
 	select {
 	case <-done:
-		return err
+		return probes, err
 	case <-ctx.Done():
-		return ctx.Err()
+		return false, ctx.Err()
 	}
 }
 
@@ -94,7 +109,7 @@ func (hs SettlementHS) Do(ctx context.Context, dc DiscoveryClient, conn *snet.Co
 // The handshake logic only REGISTERS the transport, and does not update the status of the transport.
 func MakeSettlementHS(init bool) SettlementHS {
 	// initiating logic.
-	initHS := func(ctx context.Context, dc DiscoveryClient, conn *snet.Conn, sk cipher.SecKey) (err error) {
+	initHS := func(ctx context.Context, dc DiscoveryClient, conn *snet.Conn, sk cipher.SecKey) (probes bool, err error) {
 		entry := makeEntryFromTpConn(conn)
 
 		// TODO(evanlinjin): Probably not needed as this is called in mTp already. Need to double check.
@@ -108,41 +123,41 @@ func MakeSettlementHS(init bool) SettlementHS {
 		// create signed entry and send it to responding visor.
 		se, err := NewSignedEntry(&entry, conn.LocalPK(), sk)
 		if err != nil {
-			return fmt.Errorf("failed to sign entry: %w", err)
+			return false, fmt.Errorf("failed to sign entry: %w", err)
 		}
-		if err := json.NewEncoder(conn).Encode(se); err != nil {
-			return fmt.Errorf("failed to write entry: %v", err)
+		if err := json.NewEncoder(conn).Encode(settlementEntry{SignedEntry: *se, Probes: true}); err != nil {
+			return false, fmt.Errorf("failed to write entry: %v", err)
 		}
 
 		// await okay signal.
 		accepted := make([]byte, 1)
 		if _, err := io.ReadFull(conn, accepted); err != nil {
-			return fmt.Errorf("failed to read response: %v", err)
+			return false, fmt.Errorf("failed to read response: %v", err)
 		}
-		if accepted[0] == 0 {
-			return fmt.Errorf("transport settlement rejected by remote")
+		if accepted[0] == settlementRejected {
+			return false, fmt.Errorf("transport settlement rejected by remote")
 		}
-		return nil
+		return accepted[0] == settlementAcceptedProbes, nil
 	}
 
 	// responding logic.
-	respHS := func(ctx context.Context, dc DiscoveryClient, conn *snet.Conn, sk cipher.SecKey) error {
+	respHS := func(ctx context.Context, dc DiscoveryClient, conn *snet.Conn, sk cipher.SecKey) (bool, error) {
 		entry := makeEntryFromTpConn(conn)
 
 		// receive, verify and sign entry.
 		recvSE, err := receiveAndVerifyEntry(conn, &entry, conn.RemotePK())
 		if err != nil {
-			return err
+			return false, err
 		}
 
 		if err := recvSE.Sign(conn.LocalPK(), sk); err != nil {
-			return fmt.Errorf("failed to sign received entry: %w", err)
+			return false, fmt.Errorf("failed to sign received entry: %w", err)
 		}
 
 		entry = *recvSE.Entry
 
 		// Ensure transport is registered.
-		if err := dc.RegisterTransports(ctx, recvSE); err != nil {
+		if err := dc.RegisterTransports(ctx, &recvSE.SignedEntry); err != nil {
 			if httpErr, ok := err.(*httputil.HTTPError); ok && httpErr.Status == http.StatusConflict {
 				log.WithError(err).Debug("An expected error occurred while trying to register transport.")
 			} else {
@@ -152,10 +167,10 @@ func MakeSettlementHS(init bool) SettlementHS {
 		}
 
 		// inform initiating visor.
-		if _, err := conn.Write([]byte{1}); err != nil {
-			return fmt.Errorf("failed to accept transport settlement: write failed: %v", err)
+		if _, err := conn.Write([]byte{settlementAcceptedProbes}); err != nil {
+			return false, fmt.Errorf("failed to accept transport settlement: write failed: %v", err)
 		}
-		return nil
+		return recvSE.Probes, nil
 	}
 
 	if init {
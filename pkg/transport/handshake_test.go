@@ -2,13 +2,17 @@ package transport_test
 
 import (
 	"context"
+	"encoding/json"
+	"io"
 	"testing"
 	"time"
 
 	"github.com/SkycoinProject/dmsg"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/SkycoinProject/skywire-mainnet/pkg/skyenv"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/snet"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/snettest"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/transport"
 )
@@ -20,42 +24,102 @@ func TestSettlementHS(t *testing.T) {
 	nEnv := snettest.NewEnv(t, keys, []string{dmsg.Type})
 	defer nEnv.Teardown()
 
+	// Wait until entry is set.
+	require.Eventually(t, func() bool {
+		_, err := nEnv.DmsgD.Entry(context.TODO(), keys[1].PK)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond, "Entry in Dmsg Discovery is not set within expected time")
+
+	lis1, err := nEnv.Nets[1].Listen(dmsg.Type, skyenv.DmsgTransportPort)
+	require.NoError(t, err)
+
+	// connect returns both ends of a new connection.
+	connect := func(t *testing.T) (*snet.Conn, *snet.Conn) {
+		connCh := make(chan *snet.Conn, 1)
+		go func() {
+			conn1, err := lis1.AcceptConn()
+			assert.NoError(t, err)
+			connCh <- conn1
+		}()
+
+		conn0, err := nEnv.Nets[0].Dial(context.TODO(), dmsg.Type, keys[1].PK, skyenv.DmsgTransportPort)
+		require.NoError(t, err)
+
+		return conn0, <-connCh
+	}
+
 	// TEST: Perform a handshake between two snet.Network instances.
 	t.Run("Do", func(t *testing.T) {
-		lis1, err := nEnv.Nets[1].Listen(dmsg.Type, skyenv.DmsgTransportPort)
+		conn0, conn1 := connect(t)
+
+		type result struct {
+			probes bool
+			err    error
+		}
+
+		resCh := make(chan result, 1)
+		go func() {
+			probes, err := transport.MakeSettlementHS(false).Do(context.TODO(), tpDisc, conn1, keys[1].SK)
+			resCh <- result{probes: probes, err: err}
+		}()
+
+		probes, err := transport.MakeSettlementHS(true).Do(context.TODO(), tpDisc, conn0, keys[0].SK)
 		require.NoError(t, err)
+		assert.True(t, probes)
+
+		res := <-resCh
+		require.NoError(t, res.err)
+		assert.True(t, res.probes)
+	})
+
+	// TEST: Visors which don't support probes only send and accept plain signed entries.
+	entry := transport.Entry{
+		ID:     transport.MakeTransportID(keys[0].PK, keys[1].PK, dmsg.Type),
+		Edges:  transport.SortEdges(keys[0].PK, keys[1].PK),
+		Type:   dmsg.Type,
+		Public: true,
+	}
 
-		errCh1 := make(chan error, 1)
+	t.Run("old initiator", func(t *testing.T) {
+		conn0, conn1 := connect(t)
+
+		done := make(chan struct{})
 		go func() {
-			defer close(errCh1)
-			conn1, err := lis1.AcceptConn()
-			if err != nil {
-				errCh1 <- err
-				return
-			}
-			errCh1 <- transport.MakeSettlementHS(false).Do(context.TODO(), tpDisc, conn1, keys[1].SK)
+			defer close(done)
+
+			se, err := transport.NewSignedEntry(&entry, keys[0].PK, keys[0].SK)
+			assert.NoError(t, err)
+			assert.NoError(t, json.NewEncoder(conn0).Encode(se))
+			_, err = io.ReadFull(conn0, make([]byte, 1))
+			assert.NoError(t, err)
 		}()
 
-		const entryTimeout = 5 * time.Second
-		start := time.Now()
+		probes, err := transport.MakeSettlementHS(false).Do(context.TODO(), tpDisc, conn1, keys[1].SK)
+		require.NoError(t, err)
+		assert.False(t, probes)
 
-		// Wait until entry is set.
-		// TODO: Implement more elegant solution.
-		for {
-			if time.Since(start) > entryTimeout {
-				t.Fatal("Entry in Dmsg Discovery is not set within expected time")
-			}
+		<-done
+	})
 
-			if _, err := nEnv.DmsgD.Entry(context.TODO(), keys[1].PK); err == nil {
-				break
-			}
-		}
+	t.Run("old responder", func(t *testing.T) {
+		conn0, conn1 := connect(t)
 
-		conn0, err := nEnv.Nets[0].Dial(context.TODO(), dmsg.Type, keys[1].PK, skyenv.DmsgTransportPort)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+
+			var se transport.SignedEntry
+			assert.NoError(t, json.NewDecoder(conn1).Decode(&se))
+			assert.Equal(t, entry, *se.Entry)
+			_, err := conn1.Write([]byte{1})
+			assert.NoError(t, err)
+		}()
+
+		probes, err := transport.MakeSettlementHS(true).Do(context.TODO(), tpDisc, conn0, keys[0].SK)
 		require.NoError(t, err)
-		require.NoError(t, transport.MakeSettlementHS(true).Do(context.TODO(), tpDisc, conn0, keys[0].SK))
+		assert.False(t, probes)
 
-		require.NoError(t, <-errCh1)
+		<-done
 	})
 }
 
@@ -0,0 +1,158 @@
+package transport
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// linkProbeInterval is the interval of probes sent over transports.
+	linkProbeInterval = 10 * time.Second
+
+	// linkProbeTimeout is the time after which an unanswered probe is considered lost.
+	linkProbeTimeout = 5 * time.Second
+
+	// linkStatsWindow is the number of latest probes link statistics are computed from.
+	linkStatsWindow = 30
+
+	// linkStatsReportInterval is the interval of link statistics reports to transport discovery.
+	linkStatsReportInterval = time.Minute
+
+	// maxLatencyLoss caps packet loss taken into account by LinkStats.Latency.
+	maxLatencyLoss = 0.9
+)
+
+// LinkStats are rolling statistics of probes sent over a transport.
+type LinkStats struct {
+	RTT    time.Duration `json:"rtt"`    // Average round trip time of answered probes.
+	Jitter time.Duration `json:"jitter"` // Average difference of round trip times of consecutive answered probes.
+	Loss   float64       `json:"loss"`   // Fraction of lost probes.
+	Probes int           `json:"probes"` // Number of probes the statistics are computed from.
+}
+
+// Latency estimates one-way latency of the transport.
+// The latency is increased with packet loss, as lost packets have to be retransmitted.
+func (s LinkStats) Latency() time.Duration {
+	loss := s.Loss
+	if loss > maxLatencyLoss {
+		loss = maxLatencyLoss
+	}
+
+	return time.Duration(float64(s.RTT/2) / (1 - loss))
+}
+
+type linkProbe struct {
+	id       uint32
+	sent     time.Time
+	rtt      time.Duration
+	answered bool
+}
+
+// linkStats keeps results of the latest probes of a transport.
+type linkStats struct {
+	mu     sync.Mutex
+	nextID uint32
+	probes []linkProbe // oldest first
+}
+
+// add registers a probe sent at `sent` and returns its ID.
+func (ls *linkStats) add(sent time.Time) uint32 {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	ls.nextID++
+	ls.probes = append(ls.probes, linkProbe{id: ls.nextID, sent: sent})
+
+	if len(ls.probes) > linkStatsWindow {
+		ls.probes = ls.probes[len(ls.probes)-linkStatsWindow:]
+	}
+
+	return ls.nextID
+}
+
+// remove forgets a probe which failed to be sent.
+func (ls *linkStats) remove(id uint32) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	for i, p := range ls.probes {
+		if p.id == id {
+			ls.probes = append(ls.probes[:i], ls.probes[i+1:]...)
+			return
+		}
+	}
+}
+
+// answer records a reply to the probe of `id` received at `received`.
+// Replies to unknown probes are ignored.
+func (ls *linkStats) answer(id uint32, received time.Time) bool {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	for i, p := range ls.probes {
+		if p.id == id && !p.answered {
+			ls.probes[i].answered = true
+			ls.probes[i].rtt = received.Sub(p.sent)
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// stats computes statistics of answered probes and probes which timed out as of `now`.
+// It returns false if there are no such probes.
+func (ls *linkStats) stats(now time.Time) (LinkStats, bool) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	var (
+		s           LinkStats
+		rttSum      time.Duration
+		jitterSum   time.Duration
+		answered    int
+		lost        int
+		prevRTT     time.Duration
+		prevCounted bool
+	)
+
+	for _, p := range ls.probes {
+		switch {
+		case p.answered:
+			answered++
+			rttSum += p.rtt
+
+			if prevCounted {
+				diff := p.rtt - prevRTT
+				if diff < 0 {
+					diff = -diff
+				}
+
+				jitterSum += diff
+			}
+
+			prevRTT, prevCounted = p.rtt, true
+
+		case now.Sub(p.sent) >= linkProbeTimeout:
+			lost++
+		}
+	}
+
+	s.Probes = answered + lost
+	if s.Probes == 0 {
+		return s, false
+	}
+
+	s.Loss = float64(lost) / float64(s.Probes)
+
+	if answered > 0 {
+		s.RTT = rttSum / time.Duration(answered)
+	}
+
+	if answered > 1 {
+		s.Jitter = jitterSum / time.Duration(answered-1)
+	}
+
+	return s, true
+}
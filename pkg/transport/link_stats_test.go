@@ -0,0 +1,55 @@
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinkStats(t *testing.T) {
+	var ls linkStats
+
+	now := time.Now()
+
+	_, ok := ls.stats(now)
+	require.False(t, ok)
+
+	// answered probes
+	for i, rtt := range []time.Duration{10, 30, 20} {
+		sent := now.Add(time.Duration(i) * time.Second)
+		id := ls.add(sent)
+		require.True(t, ls.answer(id, sent.Add(rtt*time.Millisecond)))
+		require.False(t, ls.answer(id, sent.Add(rtt*time.Millisecond)))
+	}
+
+	// lost probe
+	ls.add(now)
+
+	// pending probe
+	ls.add(now.Add(linkProbeTimeout))
+
+	// probe which failed to be sent
+	ls.remove(ls.add(now))
+
+	s, ok := ls.stats(now.Add(linkProbeTimeout))
+	require.True(t, ok)
+	assert.Equal(t, LinkStats{
+		RTT:    20 * time.Millisecond,
+		Jitter: 15 * time.Millisecond,
+		Loss:   0.25,
+		Probes: 4,
+	}, s)
+	assert.Equal(t, 13333333*time.Nanosecond, s.Latency()) // 10ms increased by 25% loss
+
+	// old probes leave the window
+	for i := 0; i < linkStatsWindow; i++ {
+		sent := now.Add(time.Duration(i) * time.Second)
+		ls.answer(ls.add(sent), sent.Add(time.Millisecond))
+	}
+
+	s, ok = ls.stats(now.Add(linkProbeTimeout))
+	require.True(t, ok)
+	assert.Equal(t, LinkStats{RTT: time.Millisecond, Probes: linkStatsWindow}, s)
+}
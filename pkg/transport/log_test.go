@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -52,6 +54,89 @@ func TestFileTransportLogStore(t *testing.T) {
 	testTransportLogStore(t, ls)
 }
 
+func TestBoltTransportLogStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_store")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+
+	ls, err := transport.BoltTransportLogStore(filepath.Join(dir, "transport_logs.db"))
+	require.NoError(t, err)
+	testTransportLogStore(t, ls)
+}
+
+func TestBoltTransportLogStore_History(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_store")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+
+	ls, err := transport.BoltTransportLogStore(filepath.Join(dir, "transport_logs.db"))
+	require.NoError(t, err)
+
+	id := uuid.New()
+	from := time.Now().Add(-time.Hour)
+	to := time.Now().Add(time.Hour)
+
+	// cumulative counts of the same entry are recorded as differences
+	entry := new(transport.LogEntry)
+	entry.AddRecv(100)
+	entry.AddSent(200)
+	require.NoError(t, ls.Record(id, entry))
+	entry.AddRecv(10)
+	entry.AddSent(20)
+	require.NoError(t, ls.Record(id, entry))
+	require.NoError(t, ls.Record(id, entry))
+
+	// entries of new transports start from zero
+	entry = new(transport.LogEntry)
+	entry.AddRecv(1)
+	entry.AddSent(2)
+	require.NoError(t, ls.Record(id, entry))
+
+	for _, g := range transport.Granularities {
+		records, err := ls.History(id, g, from, to)
+		require.NoError(t, err)
+		require.Len(t, records, 1, g)
+		assert.Equal(t, uint64(111), records[0].RecvBytes)
+		assert.Equal(t, uint64(222), records[0].SentBytes)
+		assert.WithinDuration(t, time.Now(), records[0].Time, g.Interval())
+	}
+
+	total, err := ls.Entry(id)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(111), total.RecvBytes)
+	assert.Equal(t, uint64(222), total.SentBytes)
+
+	records, err := ls.History(id, transport.GranularityMinute, to, to.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	records, err = ls.History(uuid.New(), transport.GranularityMinute, from, to)
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	_, err = ls.History(id, "week", from, to)
+	assert.Equal(t, transport.ErrUnknownGranularity, err)
+}
+
+func TestMergeBandwidthRecords(t *testing.T) {
+	t1 := time.Unix(60, 0)
+	t2 := time.Unix(120, 0)
+
+	merged := transport.MergeBandwidthRecords(
+		[]transport.BandwidthRecord{{Time: t2, RecvBytes: 1, SentBytes: 2}},
+		[]transport.BandwidthRecord{{Time: t1, RecvBytes: 3, SentBytes: 4}, {Time: t2, RecvBytes: 5, SentBytes: 6}},
+	)
+
+	assert.Equal(t, []transport.BandwidthRecord{
+		{Time: t1, RecvBytes: 3, SentBytes: 4},
+		{Time: t2, RecvBytes: 6, SentBytes: 8},
+	}, merged)
+}
+
 func TestLogEntry_MarshalJSON(t *testing.T) {
 	entry := new(transport.LogEntry)
 	entry.AddSent(10)
@@ -1,6 +1,7 @@
 package transport
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"fmt"
@@ -23,6 +24,14 @@ import (
 
 const logWriteInterval = time.Second * 3
 
+// Packets written within writeFlushWindow are coalesced into a single write to the underlying connection
+// of up to maxWriteBatch bytes. Reads of the underlying connection are buffered with readBufferSize bytes.
+const (
+	writeFlushWindow = time.Millisecond
+	maxWriteBatch    = 64 << 10
+	readBufferSize   = 32 << 10
+)
+
 // Records number of managedTransports.
 var mTpCount int32
 
@@ -32,6 +41,8 @@ var (
 
 	// ErrConnAlreadyExists occurs when an underlying transport connection already exists.
 	ErrConnAlreadyExists = errors.New("underlying transport connection already exists")
+
+	errNoConn = errors.New("no underlying connection")
 )
 
 // Constants associated with transport redial loop.
@@ -59,6 +70,12 @@ type ManagedTransport struct {
 	dc DiscoveryClient
 	ls LogStore
 
+	stats           linkStats // results of latest probes
+	remoteProbes    int32     // whether the remote supports probes, set by settlement handshakes, atomic
+	reportLinkStats bool      // whether link statistics are reported to transport discovery
+
+	onEvent func(tp *ManagedTransport, event Event) // called on lifecycle events if set
+
 	isUp    bool  // records last successful status update to discovery
 	isUpErr error // records whether the last status update was successful or not
 	isUpMux sync.Mutex
@@ -71,6 +88,18 @@ type ManagedTransport struct {
 	connCh chan struct{}
 	connMx sync.Mutex
 
+	wBuf     []byte      // packets to be written to 'conn', guarded by 'connMx'
+	wSpare   []byte      // buffer of the last write, reused for 'wBuf'
+	wPayload uint64      // payload bytes of packets in 'wBuf'
+	wBatch   *writeBatch // result of writing 'wBuf'
+	wWriting bool        // whether a write is in progress, 'connMx' is released during writes
+	wCond    *sync.Cond  // signals the end of a write
+	wTimer   *time.Timer // flushes 'wBuf' once the flush window passes
+	wPending bool        // whether 'wTimer' is armed
+
+	rConn *snet.Conn    // connection 'rBuf' reads from, only used by the read loop
+	rBuf  *bufio.Reader // buffers reads of 'rConn'
+
 	done chan struct{}
 	once sync.Once
 	wg   sync.WaitGroup
@@ -90,6 +119,7 @@ func NewManagedTransport(n *snet.Network, dc DiscoveryClient, ls LogStore, rPK c
 		connCh:   make(chan struct{}, 1),
 		done:     make(chan struct{}),
 	}
+	mt.wCond = sync.NewCond(&mt.connMx)
 	mt.wg.Add(2)
 	return mt
 }
@@ -122,6 +152,11 @@ func (mt *ManagedTransport) Serve(readCh chan<- routing.Packet) {
 		// End connection.
 		mt.connMx.Lock()
 		close(mt.connCh)
+		if mt.conn != nil {
+			if err := mt.flush(); err != nil {
+				log.WithError(err).Debug("Failed to flush pending packets.")
+			}
+		}
 		if mt.conn != nil {
 			if err := mt.conn.Close(); err != nil {
 				log.WithError(err).Warn("Failed to close underlying connection.")
@@ -155,6 +190,11 @@ func (mt *ManagedTransport) Serve(readCh chan<- routing.Packet) {
 				log.WithError(err).Warn("Failed to read packet.")
 				continue
 			}
+			if p.Type() == routing.TransportProbePacket {
+				mt.handleProbe(p)
+				routing.PutPacket(p)
+				continue
+			}
 			select {
 			case <-mt.done:
 				return
@@ -164,14 +204,26 @@ func (mt *ManagedTransport) Serve(readCh chan<- routing.Packet) {
 		}
 	}()
 
-	// Logging & redialing loop.
+	// Logging, probing & redialing loop.
 	logTicker := time.NewTicker(logWriteInterval)
+	probeTicker := time.NewTicker(linkProbeInterval)
+	reportTicker := time.NewTicker(linkStatsReportInterval)
 	for {
 		select {
 		case <-mt.done:
 			logTicker.Stop()
+			probeTicker.Stop()
+			reportTicker.Stop()
 			return
 
+		case <-probeTicker.C:
+			mt.sendProbe()
+
+		case <-reportTicker.C:
+			if mt.reportLinkStats {
+				mt.reportStats(ctx)
+			}
+
 		case <-logTicker.C:
 			if mt.logMod() {
 				if err := mt.ls.Record(mt.Entry.ID, mt.LogEntry); err != nil {
@@ -245,10 +297,13 @@ func (mt *ManagedTransport) Accept(ctx context.Context, conn *snet.Conn) error {
 	defer cancel()
 
 	mt.log.Debug("Performing settlement handshake...")
-	if err := MakeSettlementHS(false).Do(ctx, mt.dc, conn, mt.n.LocalSK()); err != nil {
+	probes, err := MakeSettlementHS(false).Do(ctx, mt.dc, conn, mt.n.LocalSK())
+	if err != nil {
 		return fmt.Errorf("settlement handshake failed: %v", err)
 	}
 
+	mt.setRemoteProbes(probes)
+
 	mt.log.Debug("Setting underlying connection...")
 	return mt.setConn(conn)
 }
@@ -277,9 +332,13 @@ func (mt *ManagedTransport) dial(ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, time.Second*20)
 	defer cancel()
 
-	if err := MakeSettlementHS(true).Do(ctx, mt.dc, tp, mt.n.LocalSK()); err != nil {
+	probes, err := MakeSettlementHS(true).Do(ctx, mt.dc, tp, mt.n.LocalSK())
+	if err != nil {
 		return fmt.Errorf("settlement handshake failed: %v", err)
 	}
+
+	mt.setRemoteProbes(probes)
+
 	return mt.setConn(tp)
 }
 
@@ -396,6 +455,15 @@ func (mt *ManagedTransport) setConn(newConn *snet.Conn) error {
 }
 
 func (mt *ManagedTransport) clearConn() {
+	// Pending packets are lost along with the connection.
+	mt.wBuf = mt.wBuf[:0]
+	mt.wPayload = 0
+
+	if mt.wBatch != nil {
+		mt.wBatch.finish(errNoConn)
+		mt.wBatch = nil
+	}
+
 	if !mt.isServing() {
 		return
 	}
@@ -470,9 +538,31 @@ func (mt *ManagedTransport) updateStatus(isUp bool, tries int) (err error) {
 	mt.isUp = isUp
 	mt.isUpErr = err
 	mt.isUpMux.Unlock()
+
+	if isUp {
+		mt.emit(EventUp)
+	} else {
+		mt.emit(EventDown)
+	}
+
 	return err
 }
 
+func (mt *ManagedTransport) emit(event Event) {
+	if mt.onEvent != nil {
+		mt.onEvent(mt, event)
+	}
+}
+
+// IsUp returns whether the transport is served and its last status update reported it as UP.
+func (mt *ManagedTransport) IsUp() bool {
+	mt.isUpMux.Lock()
+	isUp := mt.isUp
+	mt.isUpMux.Unlock()
+
+	return isUp && mt.isServing()
+}
+
 func statusString(isUp bool) string {
 	if isUp {
 		return "UP"
@@ -485,10 +575,70 @@ func statusString(isUp bool) string {
 */
 
 // WritePacket writes a packet to the remote.
+// Packets are coalesced: the packet is written to the underlying connection along with packets written
+// within the flush window, so a nil error doesn't guarantee delivery. Failures of writes done after
+// WritePacket returns are only logged, so it's meant for packets which can't be resent anyway,
+// such as forwarded ones. The packet may be reused once WritePacket returns.
 func (mt *ManagedTransport) WritePacket(ctx context.Context, packet routing.Packet) error {
 	mt.connMx.Lock()
 	defer mt.connMx.Unlock()
 
+	if _, err := mt.queuePacket(ctx, packet); err != nil {
+		return err
+	}
+
+	if len(mt.wBuf) >= maxWriteBatch {
+		return mt.flush()
+	}
+
+	if !mt.wPending {
+		mt.wPending = true
+
+		if mt.wTimer == nil {
+			mt.wTimer = time.AfterFunc(writeFlushWindow, mt.flushPending)
+		} else {
+			mt.wTimer.Reset(writeFlushWindow)
+		}
+	}
+
+	return nil
+}
+
+// WritePacketSync writes a packet to the remote and waits until it's written to the underlying connection.
+// The packet is written right away along with pending packets. While another write is in progress,
+// packets written concurrently are coalesced into the next write. Unlike WritePacket, it returns the error
+// of the write the packet was a part of, so it's meant for packets which may be resent via another transport.
+func (mt *ManagedTransport) WritePacketSync(ctx context.Context, packet routing.Packet) error {
+	mt.connMx.Lock()
+
+	batch, err := mt.queuePacket(ctx, packet)
+	if err != nil {
+		mt.connMx.Unlock()
+		return err
+	}
+
+	if !mt.wWriting {
+		err := mt.flush()
+		mt.connMx.Unlock()
+
+		return err
+	}
+
+	// the batch is written once the write in progress is over
+	batch.waiters++
+	mt.connMx.Unlock()
+
+	select {
+	case <-batch.done:
+		return batch.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// queuePacket appends a packet to the pending ones, redialing the underlying connection if needed.
+// It returns the batch the packet is written with. 'connMx' has to be locked.
+func (mt *ManagedTransport) queuePacket(ctx context.Context, packet routing.Packet) (*writeBatch, error) {
 	if mt.conn == nil {
 		if err := mt.redial(ctx); err != nil {
 
@@ -497,25 +647,120 @@ func (mt *ManagedTransport) WritePacket(ctx context.Context, packet routing.Pack
 				mt.wg.Wait()
 			}
 
-			return fmt.Errorf("failed to redial underlying connection: %v", err)
+			return nil, fmt.Errorf("failed to redial underlying connection: %v", err)
+		}
+	}
+
+	if len(mt.wBuf)+len(packet) > maxWriteBatch {
+		if err := mt.flush(); err != nil {
+			return nil, err
+		}
+
+		// the connection may be gone while the lock was released
+		if mt.conn == nil {
+			return nil, errNoConn
 		}
 	}
 
-	n, err := mt.conn.Write(packet)
+	if mt.wBatch == nil {
+		mt.wBatch = &writeBatch{done: make(chan struct{})}
+	}
+
+	mt.wBuf = append(mt.wBuf, packet...)
+	if len(packet) > routing.PacketHeaderSize {
+		mt.wPayload += uint64(len(packet) - routing.PacketHeaderSize)
+	}
+
+	return mt.wBatch, nil
+}
+
+// flushPending flushes coalesced packets once the flush window passes.
+// Writers of the packets have already returned, so the error is only logged.
+func (mt *ManagedTransport) flushPending() {
+	mt.connMx.Lock()
+	defer mt.connMx.Unlock()
+
+	mt.wPending = false
+
+	if err := mt.flush(); err != nil {
+		mt.log.WithError(err).Warn("Failed to write packets.")
+	}
+}
+
+// flushWaiting writes packets of writers waiting for a write which was in progress.
+func (mt *ManagedTransport) flushWaiting() {
+	mt.connMx.Lock()
+	defer mt.connMx.Unlock()
+
+	if err := mt.flush(); err != nil {
+		mt.log.WithError(err).Debug("Failed to write packets.")
+	}
+}
+
+// flush writes coalesced packets to the underlying connection. 'connMx' has to be locked.
+// The lock is released during the write, so that writers may queue packets for the next one.
+// Writes are done one at a time, flush waits for the write in progress first.
+func (mt *ManagedTransport) flush() error {
+	for mt.wWriting {
+		mt.wCond.Wait()
+	}
+
+	if len(mt.wBuf) == 0 {
+		return nil
+	}
+
+	conn := mt.conn
+	if conn == nil {
+		// pending packets are dropped along with the connection
+		return errNoConn
+	}
+
+	buf, payload, batch := mt.wBuf, mt.wPayload, mt.wBatch
+	mt.wBuf, mt.wSpare = mt.wSpare[:0], nil
+	mt.wPayload, mt.wBatch = 0, nil
+	mt.wWriting = true
+
+	mt.connMx.Unlock()
+	_, err := conn.Write(buf)
+	mt.connMx.Lock()
+
+	mt.wWriting = false
+	mt.wSpare = buf[:0]
+	mt.wCond.Broadcast()
+
 	if err != nil {
-		mt.clearConn()
-		return err
+		// the connection may have been replaced during the write
+		if mt.conn == conn {
+			mt.clearConn()
+		}
+	} else if payload > 0 {
+		mt.logSent(payload)
 	}
-	if n > routing.PacketHeaderSize {
-		mt.logSent(uint64(n - routing.PacketHeaderSize))
+
+	batch.finish(err)
+
+	if mt.wBatch != nil && mt.wBatch.waiters > 0 {
+		go mt.flushWaiting()
 	}
-	return nil
+
+	return err
+}
+
+// writeBatch is the result of a write of coalesced packets.
+type writeBatch struct {
+	done    chan struct{} // closed once the batch is written or dropped
+	err     error
+	waiters int // number of writers waiting for the batch, guarded by 'connMx'
 }
 
+func (b *writeBatch) finish(err error) {
+	b.err = err
+	close(b.done)
+}
+
+// readPacket reads a packet into a buffer obtained with routing.GetPacket.
 // WARNING: Not thread safe.
 func (mt *ManagedTransport) readPacket() (packet routing.Packet, err error) {
-	log := mt.log.WithField("func", "readPacket")
-
 	var conn *snet.Conn
 	for {
 		if conn = mt.getConn(); conn != nil {
@@ -528,31 +773,34 @@ func (mt *ManagedTransport) readPacket() (packet routing.Packet, err error) {
 		}
 	}
 
-	log.Debug("Awaiting packet...")
+	if conn != mt.rConn {
+		if mt.rBuf == nil {
+			mt.rBuf = bufio.NewReaderSize(conn, readBufferSize)
+		} else {
+			mt.rBuf.Reset(conn)
+		}
+
+		mt.rConn = conn
+	}
 
-	h := make(routing.Packet, routing.PacketHeaderSize)
-	if _, err = io.ReadFull(conn, h); err != nil {
-		log.WithError(err).Debugf("Failed to read packet header.")
+	// Packets are not logged one by one, as it's too expensive with many small packets.
+	h, err := mt.rBuf.Peek(routing.PacketHeaderSize)
+	if err != nil {
+		mt.log.WithError(err).Debugf("Failed to read packet header.")
 		return nil, err
 	}
-	log.WithField("header_len", len(h)).WithField("header_raw", h).Debug("Read packet header.")
 
-	p := make([]byte, h.Size())
-	if _, err = io.ReadFull(conn, p); err != nil {
-		log.WithError(err).Debugf("Failed to read packet payload.")
+	packet = routing.GetPacket(routing.PacketHeaderSize + int(routing.Packet(h).Size()))
+	if _, err = io.ReadFull(mt.rBuf, packet); err != nil {
+		routing.PutPacket(packet)
+		mt.log.WithError(err).Debugf("Failed to read packet payload.")
 		return nil, err
 	}
-	log.WithField("payload_len", len(p)).Debug("Read packet payload.")
 
-	packet = append(h, p...)
 	if n := len(packet); n > routing.PacketHeaderSize {
 		mt.logRecv(uint64(n - routing.PacketHeaderSize))
 	}
 
-	log.WithField("type", packet.Type().String()).
-		WithField("rt_id", packet.RouteID()).
-		WithField("size", packet.Size()).
-		Info("Received packet.")
 	return packet, nil
 }
 
@@ -578,6 +826,91 @@ func (mt *ManagedTransport) logMod() bool {
 	return false
 }
 
+/*
+	<<< LINK STATISTICS >>>
+*/
+
+// LinkStats returns rolling statistics of probes sent over the transport.
+// It returns false if no probes have been answered or lost yet.
+func (mt *ManagedTransport) LinkStats() (LinkStats, bool) {
+	return mt.stats.stats(time.Now())
+}
+
+// setRemoteProbes records whether the remote of the current connection supports probes.
+func (mt *ManagedTransport) setRemoteProbes(probes bool) {
+	var v int32
+	if probes {
+		v = 1
+	}
+
+	atomic.StoreInt32(&mt.remoteProbes, v)
+}
+
+// sendProbe sends a probe over the underlying connection, if there is one.
+// Probes are not sent to remotes which don't support them, as they would reject every one.
+func (mt *ManagedTransport) sendProbe() {
+	if atomic.LoadInt32(&mt.remoteProbes) == 0 {
+		return
+	}
+
+	sent := time.Now()
+	id := mt.stats.add(sent)
+
+	if err := mt.writeProbe(routing.MakeTransportProbePacket(id, false, sent)); err != nil {
+		mt.stats.remove(id)
+		mt.log.WithError(err).Debug("Failed to send probe.")
+	}
+}
+
+// handleProbe replies to probes of the remote edge and records replies to local probes.
+func (mt *ManagedTransport) handleProbe(packet routing.Packet) {
+	id, reply, sent := packet.TransportProbe()
+
+	if reply {
+		if !mt.stats.answer(id, time.Now()) {
+			mt.log.WithField("probe_id", id).Debug("Received reply to unknown probe.")
+		}
+
+		return
+	}
+
+	if err := mt.writeProbe(routing.MakeTransportProbePacket(id, true, sent)); err != nil {
+		mt.log.WithError(err).Debug("Failed to reply to probe.")
+	}
+}
+
+// writeProbe writes a probe packet. Unlike WritePacket, it doesn't redial the underlying connection.
+func (mt *ManagedTransport) writeProbe(packet routing.Packet) error {
+	mt.connMx.Lock()
+	defer mt.connMx.Unlock()
+
+	if mt.conn == nil {
+		return errNoConn
+	}
+
+	// Probes are written along with pending packets, but without waiting for the flush window.
+	if _, err := mt.queuePacket(context.Background(), packet); err != nil {
+		return err
+	}
+
+	return mt.flush()
+}
+
+// reportStats reports link statistics to transport discovery along with the transport status.
+func (mt *ManagedTransport) reportStats(ctx context.Context) {
+	stats, ok := mt.LinkStats()
+	if !ok || !mt.IsUp() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, linkProbeInterval)
+	defer cancel()
+
+	if _, err := mt.dc.UpdateStatuses(ctx, &Status{ID: mt.Entry.ID, IsUp: true, LinkStats: &stats}); err != nil {
+		mt.log.WithError(err).Debug("Failed to report link statistics.")
+	}
+}
+
 // Remote returns the remote public key.
 func (mt *ManagedTransport) Remote() cipher.PubKey { return mt.rPK }
 
@@ -0,0 +1,396 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/routing"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/snet"
+)
+
+// countingConn counts writes to the underlying connection.
+type countingConn struct {
+	net.Conn
+	writes int64
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	atomic.AddInt64(&c.writes, 1)
+	return c.Conn.Write(b)
+}
+
+// failingConn fails all writes.
+type failingConn struct {
+	net.Conn
+}
+
+func (failingConn) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+// tcpConns returns both ends of a TCP connection over the loopback interface.
+func tcpConns(tb testing.TB) (net.Conn, net.Conn) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(tb, err)
+
+	defer func() {
+		require.NoError(tb, lis.Close())
+	}()
+
+	connCh := make(chan net.Conn, 1)
+	go func() {
+		conn, err := lis.Accept()
+		assert.NoError(tb, err)
+		connCh <- conn
+	}()
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	require.NoError(tb, err)
+
+	return conn, <-connCh
+}
+
+// gatedConn blocks the first write until 'gate' is closed and fails all the writes after it.
+type gatedConn struct {
+	net.Conn
+	gate   chan struct{}
+	writes int64
+}
+
+func (c *gatedConn) Write(b []byte) (int, error) {
+	if atomic.AddInt64(&c.writes, 1) == 1 {
+		<-c.gate
+		return len(b), nil
+	}
+
+	return 0, errors.New("write failed")
+}
+
+// connectedTransport returns a ManagedTransport which isn't served, but has `conn` as the underlying connection.
+func connectedTransport(conn net.Conn) *ManagedTransport {
+	mt := &ManagedTransport{
+		log:      logging.MustGetLogger("tp"),
+		dc:       NewDiscoveryMock(),
+		LogEntry: new(LogEntry),
+		conn:     &snet.Conn{Conn: conn},
+		connCh:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	mt.wCond = sync.NewCond(&mt.connMx)
+
+	return mt
+}
+
+func TestManagedTransport_WritePacket(t *testing.T) {
+	wConn, rConn := tcpConns(t)
+	conn := &countingConn{Conn: wConn}
+	mt := connectedTransport(conn)
+
+	defer func() {
+		assert.NoError(t, wConn.Close())
+		assert.NoError(t, rConn.Close())
+	}()
+
+	var packets []routing.Packet
+
+	for i := 0; i < 3; i++ {
+		packet, err := routing.MakeDataPacket(routing.RouteID(i), []byte{byte(i)})
+		require.NoError(t, err)
+		require.NoError(t, mt.WritePacket(context.TODO(), packet))
+
+		packets = append(packets, packet)
+	}
+
+	// Packets written within the flush window are coalesced.
+	for _, packet := range packets {
+		got := make([]byte, len(packet))
+		_, err := io.ReadFull(rConn, got)
+		require.NoError(t, err)
+		assert.Equal(t, []byte(packet), got)
+	}
+
+	assert.Equal(t, int64(1), atomic.LoadInt64(&conn.writes))
+	assert.Equal(t, uint64(3), atomic.LoadUint64(&mt.LogEntry.SentBytes))
+
+	// Packets filling a batch are written right away.
+	packet, err := routing.MakeDataPacket(1, make([]byte, maxWriteBatch-routing.PacketHeaderSize))
+	require.NoError(t, err)
+	require.NoError(t, mt.WritePacket(context.TODO(), packet))
+
+	mt.connMx.Lock()
+	assert.Empty(t, mt.wBuf)
+	mt.connMx.Unlock()
+
+	_, err = io.ReadFull(rConn, make([]byte, len(packet)))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&conn.writes))
+}
+
+func TestManagedTransport_WritePacketError(t *testing.T) {
+	packet, err := routing.MakeDataPacket(1, []byte("foo"))
+	require.NoError(t, err)
+
+	t.Run("coalesced", func(t *testing.T) {
+		wConn, rConn := tcpConns(t)
+		mt := connectedTransport(failingConn{Conn: wConn})
+
+		// The batch is written once WritePacket returns, so its error is only logged.
+		require.NoError(t, mt.WritePacket(context.TODO(), packet))
+		require.Eventually(t, func() bool {
+			return mt.getConn() == nil
+		}, time.Second, writeFlushWindow)
+		require.NoError(t, rConn.Close())
+
+		// Writers of later batches are not told of the failure.
+		wConn, rConn = tcpConns(t)
+		defer func() {
+			assert.NoError(t, wConn.Close())
+			assert.NoError(t, rConn.Close())
+		}()
+
+		mt.connMx.Lock()
+		mt.conn = &snet.Conn{Conn: wConn}
+		mt.connMx.Unlock()
+
+		assert.NoError(t, mt.WritePacket(context.TODO(), packet))
+	})
+
+	t.Run("sync", func(t *testing.T) {
+		wConn, rConn := tcpConns(t)
+		defer func() { assert.NoError(t, rConn.Close()) }()
+
+		conn := &gatedConn{Conn: wConn, gate: make(chan struct{})}
+		mt := connectedTransport(conn)
+
+		firstErr := make(chan error, 1)
+		go func() {
+			firstErr <- mt.WritePacketSync(context.TODO(), packet)
+		}()
+
+		require.Eventually(t, func() bool {
+			mt.connMx.Lock()
+			defer mt.connMx.Unlock()
+
+			return mt.wWriting
+		}, time.Second, time.Millisecond)
+
+		// Packets written during the first write are coalesced into the next one.
+		errs := make(chan error, 2)
+		for i := 0; i < cap(errs); i++ {
+			go func() {
+				errs <- mt.WritePacketSync(context.TODO(), packet)
+			}()
+		}
+
+		require.Eventually(t, func() bool {
+			mt.connMx.Lock()
+			defer mt.connMx.Unlock()
+
+			return mt.wBatch != nil && mt.wBatch.waiters == cap(errs)
+		}, time.Second, time.Millisecond)
+
+		close(conn.gate)
+
+		// Only writers of the failed write get its error.
+		assert.NoError(t, <-firstErr)
+		for i := 0; i < cap(errs); i++ {
+			assert.Error(t, <-errs)
+		}
+
+		assert.Equal(t, int64(2), atomic.LoadInt64(&conn.writes))
+	})
+}
+
+func TestManagedTransport_sendProbe(t *testing.T) {
+	wConn, rConn := tcpConns(t)
+	conn := &countingConn{Conn: wConn}
+	mt := connectedTransport(conn)
+
+	defer func() {
+		assert.NoError(t, wConn.Close())
+		assert.NoError(t, rConn.Close())
+	}()
+
+	// Remotes which don't support probes would reject them.
+	mt.sendProbe()
+	assert.Equal(t, int64(0), atomic.LoadInt64(&conn.writes))
+
+	mt.setRemoteProbes(true)
+	mt.sendProbe()
+	assert.Equal(t, int64(1), atomic.LoadInt64(&conn.writes))
+
+	packet, err := connectedTransport(rConn).readPacket()
+	require.NoError(t, err)
+	assert.Equal(t, routing.TransportProbePacket, packet.Type())
+}
+
+func TestManagedTransport_readPacket(t *testing.T) {
+	wConn, rConn := tcpConns(t)
+	mt := connectedTransport(rConn)
+
+	defer func() {
+		assert.NoError(t, wConn.Close())
+		assert.NoError(t, rConn.Close())
+	}()
+
+	small, err := routing.MakeDataPacket(1, []byte("foo"))
+	require.NoError(t, err)
+
+	big, err := routing.MakeDataPacket(2, make([]byte, readBufferSize+1))
+	require.NoError(t, err)
+
+	go func() {
+		_, err := wConn.Write(append(append([]byte(nil), small...), big...))
+		assert.NoError(t, err)
+	}()
+
+	for _, want := range []routing.Packet{small, big} {
+		got, err := mt.readPacket()
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+
+		routing.PutPacket(got)
+	}
+}
+
+func BenchmarkManagedTransport_WritePacket(b *testing.B) {
+	packet, err := routing.MakeDataPacket(1, make([]byte, 64))
+	require.NoError(b, err)
+
+	// flush is called before the connection is closed.
+	run := func(b *testing.B, write func(conn net.Conn) error, flush func()) {
+		wConn, rConn := tcpConns(b)
+		conn := &countingConn{Conn: wConn}
+
+		go func() {
+			_, _ = io.Copy(ioutil.Discard, rConn) // nolint:errcheck
+		}()
+
+		b.SetBytes(int64(len(packet)))
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			if err := write(conn); err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		b.StopTimer()
+		flush()
+		b.ReportMetric(float64(atomic.LoadInt64(&conn.writes))/float64(b.N), "writes/op")
+
+		require.NoError(b, wConn.Close())
+		require.NoError(b, rConn.Close())
+	}
+
+	// Each packet is written to the connection separately.
+	b.Run("direct", func(b *testing.B) {
+		run(b, func(conn net.Conn) error {
+			_, err := conn.Write(packet)
+			return err
+		}, func() {})
+	})
+
+	b.Run("coalesced", func(b *testing.B) {
+		var mt *ManagedTransport
+
+		run(b, func(conn net.Conn) error {
+			if mt == nil {
+				mt = connectedTransport(conn)
+			}
+
+			return mt.WritePacket(context.TODO(), packet)
+		}, func() {
+			mt.connMx.Lock()
+			mt.wTimer.Stop()
+			require.NoError(b, mt.flush())
+			mt.connMx.Unlock()
+		})
+	})
+}
+
+func BenchmarkManagedTransport_readPacket(b *testing.B) {
+	packet, err := routing.MakeDataPacket(1, make([]byte, 64))
+	require.NoError(b, err)
+
+	var stream []byte
+	for len(stream) < maxWriteBatch {
+		stream = append(stream, packet...)
+	}
+
+	run := func(b *testing.B, read func(conn net.Conn) error) {
+		wConn, rConn := tcpConns(b)
+
+		go func() {
+			for {
+				if _, err := wConn.Write(stream); err != nil {
+					return
+				}
+			}
+		}()
+
+		b.SetBytes(int64(len(packet)))
+		b.ReportAllocs()
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			if err := read(rConn); err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		b.StopTimer()
+
+		require.NoError(b, wConn.Close())
+		require.NoError(b, rConn.Close())
+	}
+
+	// The header and the payload are read from the connection separately, into new buffers.
+	b.Run("direct", func(b *testing.B) {
+		run(b, func(conn net.Conn) error {
+			h := make(routing.Packet, routing.PacketHeaderSize)
+			if _, err := io.ReadFull(conn, h); err != nil {
+				return err
+			}
+
+			p := make([]byte, h.Size())
+			if _, err := io.ReadFull(conn, p); err != nil {
+				return err
+			}
+
+			_ = append(h, p...)
+
+			return nil
+		})
+	})
+
+	b.Run("buffered", func(b *testing.B) {
+		var mt *ManagedTransport
+
+		run(b, func(conn net.Conn) error {
+			if mt == nil {
+				mt = connectedTransport(conn)
+			}
+
+			p, err := mt.readPacket()
+			if err != nil {
+				return err
+			}
+
+			routing.PutPacket(p)
+
+			return nil
+		})
+	})
+}
@@ -26,8 +26,24 @@ type ManagerConfig struct {
 	DefaultVisors   []cipher.PubKey // Visors to automatically connect to
 	DiscoveryClient DiscoveryClient
 	LogStore        LogStore
+	ReportLinkStats bool               // Report latency and loss of transports to transport discovery
+	AutoConnect     *AutoConnectConfig // Keep transports to well-connected visors, disabled if nil
+
+	// OnEvent is called on lifecycle events of transports if set. It must not block.
+	OnEvent func(tp *ManagedTransport, event Event)
 }
 
+// Event is a lifecycle event of a managed transport.
+type Event string
+
+// Lifecycle events of managed transports.
+const (
+	EventCreated Event = "created"
+	EventDeleted Event = "deleted" // not emitted for transports closed along with the Manager
+	EventUp      Event = "up"
+	EventDown    Event = "down"
+)
+
 // Manager manages Transports.
 type Manager struct {
 	Logger *logging.Logger
@@ -117,6 +133,11 @@ func (tm *Manager) serve(ctx context.Context) {
 	}
 
 	tm.initTransports(ctx)
+
+	if ac := tm.Conf.AutoConnect; ac != nil && ac.Transports > 0 {
+		go newAutoConnector(tm, *ac).run(ctx)
+	}
+
 	tm.Logger.Info("transport manager is serving.")
 
 	// closing logic
@@ -179,18 +200,7 @@ func (tm *Manager) acceptTransport(ctx context.Context, lis *snet.Listener) erro
 	if !ok {
 		tm.Logger.Debugln("No TP found, creating new one")
 
-		mTp = NewManagedTransport(tm.n, tm.Conf.DiscoveryClient, tm.Conf.LogStore, conn.RemotePK(), lis.Network())
-
-		go func() {
-			mTp.Serve(tm.readCh)
-
-			tm.mx.Lock()
-			delete(tm.tps, mTp.Entry.ID)
-			tm.mx.Unlock()
-		}()
-
-		tm.tps[tpID] = mTp
-
+		mTp = tm.serveTransport(conn.RemotePK(), lis.Network())
 	} else {
 		tm.Logger.Debugln("TP found, accepting...")
 	}
@@ -269,17 +279,46 @@ func (tm *Manager) saveTransport(remote cipher.PubKey, netName string) (*Managed
 		return tp, nil
 	}
 
+	if tm.isClosing() {
+		return nil, io.ErrClosedPipe
+	}
+
+	mTp := tm.serveTransport(remote, netName)
+
+	tm.Logger.Infof("saved transport: remote(%s) type(%s) tpID(%s)", remote, netName, tpID)
+	return mTp, nil
+}
+
+// serveTransport creates a managed transport to 'remote' and serves it until it's closed.
+// The Manager waits for the transport to stop serving before it closes the read channel.
+// tm.mx has to be locked.
+func (tm *Manager) serveTransport(remote cipher.PubKey, netName string) *ManagedTransport {
 	mTp := NewManagedTransport(tm.n, tm.Conf.DiscoveryClient, tm.Conf.LogStore, remote, netName)
+	mTp.reportLinkStats = tm.Conf.ReportLinkStats
+	mTp.onEvent = tm.Conf.OnEvent
+
+	tm.wgMu.Lock()
+	tm.wg.Add(1)
+	tm.wgMu.Unlock()
+
 	go func() {
 		mTp.Serve(tm.readCh)
+		mTp.wg.Wait()
+		tm.wg.Done()
+
 		tm.mx.Lock()
 		delete(tm.tps, mTp.Entry.ID)
 		tm.mx.Unlock()
+
+		if !tm.isClosing() {
+			mTp.emit(EventDeleted)
+		}
 	}()
-	tm.tps[tpID] = mTp
 
-	tm.Logger.Infof("saved transport: remote(%s) type(%s) tpID(%s)", remote, netName, tpID)
-	return mTp, nil
+	tm.tps[mTp.Entry.ID] = mTp
+	mTp.emit(EventCreated)
+
+	return mTp
 }
 
 // DeleteTransport deregisters the Transport of Transport ID in transport discovery and deletes it locally.
@@ -310,6 +349,8 @@ func (tm *Manager) DeleteTransport(id uuid.UUID) {
 }
 
 // ReadPacket reads data packets from routes.
+// Packets are backed by buffers obtained with routing.GetPacket, which may be returned with routing.PutPacket
+// once the packet is handled.
 func (tm *Manager) ReadPacket() (routing.Packet, error) {
 	p, ok := <-tm.readCh
 	if !ok {
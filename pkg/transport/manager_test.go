@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -13,6 +14,8 @@ import (
 
 	"github.com/SkycoinProject/skywire-mainnet/pkg/routing"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/snettest"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/sudp"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/snet/sudph"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/transport"
 
 	"github.com/SkycoinProject/dmsg"
@@ -50,11 +53,13 @@ func TestNewManager(t *testing.T) {
 	// Prepare tp manager 0.
 	pk0, sk0 := keys[0].PK, keys[0].SK
 	ls0 := transport.InMemoryTransportLogStore()
+	events0 := new(eventRecorder)
 	m0, err := transport.NewManager(nEnv.Nets[0], &transport.ManagerConfig{
 		PubKey:          pk0,
 		SecKey:          sk0,
 		DiscoveryClient: tpDisc,
 		LogStore:        ls0,
+		OnEvent:         events0.record,
 	})
 	require.NoError(t, err)
 	go m0.Serve(context.TODO())
@@ -63,11 +68,13 @@ func TestNewManager(t *testing.T) {
 	// Prepare tp manager 1.
 	pk1, sk1 := keys[1].PK, keys[1].SK
 	ls1 := transport.InMemoryTransportLogStore()
+	events1 := new(eventRecorder)
 	m2, err := transport.NewManager(nEnv.Nets[1], &transport.ManagerConfig{
 		PubKey:          pk1,
 		SecKey:          sk1,
 		DiscoveryClient: tpDisc,
 		LogStore:        ls1,
+		OnEvent:         events1.record,
 	})
 	require.NoError(t, err)
 	go m2.Serve(context.TODO())
@@ -81,6 +88,12 @@ func TestNewManager(t *testing.T) {
 
 	fmt.Println("transports created")
 
+	// Accepted transports are announced as well as saved ones.
+	require.Eventually(t, func() bool {
+		return len(events0.get()) >= 2
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []transport.Event{transport.EventCreated, transport.EventUp}, events0.get()[:2])
+
 	totalSent2 := 0
 	totalSent1 := 0
 
@@ -156,9 +169,102 @@ func TestNewManager(t *testing.T) {
 		_, err = tpDisc.GetTransportByID(context.TODO(), tpID)
 		require.NotNil(t, err)
 		require.Contains(t, err.Error(), "not found")
+
+		require.Eventually(t, func() bool {
+			events := events1.get()
+			return len(events) > 0 && events[len(events)-1] == transport.EventDeleted
+		}, time.Second, 10*time.Millisecond)
+
+		assert.Equal(t, []transport.Event{transport.EventCreated, transport.EventUp}, events1.get()[:2])
 	})
 }
 
+// eventRecorder records lifecycle events of transports.
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []transport.Event
+}
+
+func (r *eventRecorder) record(_ *transport.ManagedTransport, event transport.Event) {
+	r.mu.Lock()
+	r.events = append(r.events, event)
+	r.mu.Unlock()
+}
+
+func (r *eventRecorder) get() []transport.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]transport.Event(nil), r.events...)
+}
+
+func TestManager_SUDP(t *testing.T) {
+	tpDisc := transport.NewDiscoveryMock()
+
+	keys := snettest.GenKeyPairs(2)
+	nEnv := snettest.NewEnv(t, keys, []string{sudp.Type})
+	defer nEnv.Teardown()
+
+	m0, m1, tp0, tp1, err := transport.CreateTransportPair(tpDisc, keys, nEnv, sudp.Type)
+	require.NoError(t, err)
+	require.NotNil(t, tp0)
+
+	defer func() {
+		require.NoError(t, m0.Close())
+		require.NoError(t, m1.Close())
+	}()
+
+	// larger than a single sudp segment
+	payload := cipher.RandByte(4096)
+
+	packet, err := routing.MakeDataPacket(1, payload)
+	require.NoError(t, err)
+
+	require.NoError(t, tp1.WritePacket(context.TODO(), packet))
+
+	recv, err := m0.ReadPacket()
+	require.NoError(t, err)
+	require.Equal(t, payload, recv.Payload())
+
+	require.NoError(t, tp0.WritePacket(context.TODO(), packet))
+
+	recv, err = m1.ReadPacket()
+	require.NoError(t, err)
+	require.Equal(t, payload, recv.Payload())
+}
+
+func TestManager_SUDPH(t *testing.T) {
+	tpDisc := transport.NewDiscoveryMock()
+
+	keys := snettest.GenKeyPairs(2)
+	nEnv := snettest.NewEnv(t, keys, []string{sudph.Type})
+	defer nEnv.Teardown()
+
+	m0, m1, tp0, tp1, err := transport.CreateTransportPair(tpDisc, keys, nEnv, sudph.Type)
+	require.NoError(t, err)
+	require.NotNil(t, tp0)
+
+	defer func() {
+		require.NoError(t, m0.Close())
+		require.NoError(t, m1.Close())
+	}()
+
+	packet, err := routing.MakeDataPacket(1, []byte("foo"))
+	require.NoError(t, err)
+
+	require.NoError(t, tp1.WritePacket(context.TODO(), packet))
+
+	recv, err := m0.ReadPacket()
+	require.NoError(t, err)
+	require.Equal(t, []byte("foo"), recv.Payload())
+
+	require.NoError(t, tp0.WritePacket(context.TODO(), packet))
+
+	recv, err = m1.ReadPacket()
+	require.NoError(t, err)
+	require.Equal(t, []byte("foo"), recv.Payload())
+}
+
 func TestSortEdges(t *testing.T) {
 	for i := 0; i < 100; i++ {
 		keyA, _ := cipher.GenerateKeyPair()
@@ -0,0 +1,183 @@
+package visor
+
+import (
+	"errors"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// appSupervisor keeps track of exits of apps to tell crashes apart and restart apps according to their restart policies.
+// Its zero value is ready to use.
+type appSupervisor struct {
+	mu      sync.Mutex
+	apps    map[string]*supervisedApp
+	closing bool // whether the visor is stopping all apps
+}
+
+type supervisedApp struct {
+	restarts int           // restarts since the app was last started by the visor or a user
+	runSince time.Time     // start of the current run
+	exitCode *int          // exit code of the last run, nil if the app hasn't exited yet
+	stopping bool          // whether the app is being stopped by the visor
+	cancel   chan struct{} // closed to cancel a pending restart, nil if none is pending
+}
+
+// appExit describes what should follow an exit of an app.
+type appExit struct {
+	stopped  bool          // whether the app was stopped by the visor
+	restart  bool          // whether the app should be restarted
+	restarts int           // restarts including the following one
+	delay    time.Duration // delay of the restart
+	cancel   <-chan struct{}
+}
+
+// app returns the state of app of given name. 'mu' has to be locked.
+func (s *appSupervisor) app(name string) *supervisedApp {
+	if s.apps == nil {
+		s.apps = make(map[string]*supervisedApp)
+	}
+
+	app, ok := s.apps[name]
+	if !ok {
+		app = &supervisedApp{}
+		s.apps[name] = app
+	}
+
+	return app
+}
+
+// started records a start of the app of given name by the visor or a user, which cancels its pending restart.
+func (s *appSupervisor) started(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app := s.app(name)
+	app.restarts = 0
+	app.stopping = false
+	app.cancelRestart()
+}
+
+// running records a start of a run of the app of given name, including restarts.
+func (s *appSupervisor) running(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.app(name).runSince = time.Now()
+}
+
+// cancelRestart cancels the pending restart of the app of given name. It returns false if there was none.
+func (s *appSupervisor) cancelRestart(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.app(name).cancelRestart()
+}
+
+// setStopping records whether the app of given name is being stopped by the visor.
+func (s *appSupervisor) setStopping(name string, stopping bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.app(name).stopping = stopping
+}
+
+// close marks all apps as being stopped by the visor and cancels pending restarts.
+func (s *appSupervisor) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closing = true
+
+	for _, app := range s.apps {
+		app.cancelRestart()
+	}
+}
+
+// exited records an exit of the app of given name with `err` and decides on its restart according to `conf`.
+// Restarts are counted anew if the app ran long enough.
+func (s *appSupervisor) exited(name string, err error, conf *AppRestartConfig) appExit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app := s.app(name)
+
+	exitCode := appExitCode(err)
+	app.exitCode = &exitCode
+
+	res := appExit{stopped: app.stopping || s.closing}
+	app.stopping = false
+
+	if !app.runSince.IsZero() && time.Since(app.runSince) >= conf.resetAfter() {
+		app.restarts = 0
+	}
+
+	if res.stopped || !conf.shouldRestart(err, app.restarts) {
+		return res
+	}
+
+	res.restart = true
+	res.delay = conf.delay(app.restarts)
+
+	app.restarts++
+	app.cancel = make(chan struct{})
+	res.restarts = app.restarts
+	res.cancel = app.cancel
+
+	return res
+}
+
+// restarting claims the pending restart of the app of given name before it's started.
+// It returns false if the restart got cancelled in the meantime.
+func (s *appSupervisor) restarting(name string, cancel <-chan struct{}) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app := s.app(name)
+	if app.cancel != cancel {
+		return false
+	}
+
+	app.cancel = nil
+
+	return true
+}
+
+// state returns the restart count and the exit code of the last run of the app of given name.
+func (s *appSupervisor) state(name string) (restarts int, exitCode *int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app, ok := s.apps[name]
+	if !ok {
+		return 0, nil
+	}
+
+	return app.restarts, app.exitCode
+}
+
+func (app *supervisedApp) cancelRestart() bool {
+	if app.cancel == nil {
+		return false
+	}
+
+	close(app.cancel)
+	app.cancel = nil
+
+	return true
+}
+
+// appExitCode returns the exit code of an app which exited with `err`.
+// It's -1 if the app was killed by a signal or failed to run.
+func appExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+
+	return -1
+}
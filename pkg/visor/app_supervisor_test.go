@@ -0,0 +1,138 @@
+package visor
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppRestartConfig(t *testing.T) {
+	appErr := errors.New("failed")
+
+	t.Run("policies", func(t *testing.T) {
+		tests := []struct {
+			policy AppRestartPolicy
+			err    error
+			want   bool
+		}{
+			{AppRestartNever, appErr, false},
+			{AppRestartOnFailure, nil, false},
+			{AppRestartOnFailure, appErr, true},
+			{AppRestartAlways, nil, true},
+			{AppRestartAlways, appErr, true},
+		}
+
+		for _, tc := range tests {
+			conf := &AppRestartConfig{Policy: tc.policy}
+			assert.Equal(t, tc.want, conf.shouldRestart(tc.err, 10), "%s %v", tc.policy, tc.err)
+		}
+
+		var conf *AppRestartConfig
+		assert.False(t, conf.shouldRestart(appErr, 0))
+	})
+
+	t.Run("max retries", func(t *testing.T) {
+		conf := &AppRestartConfig{Policy: AppRestartAlways, MaxRetries: 2}
+		assert.True(t, conf.shouldRestart(nil, 1))
+		assert.False(t, conf.shouldRestart(nil, 2))
+	})
+
+	t.Run("backoff", func(t *testing.T) {
+		conf := &AppRestartConfig{Backoff: Duration(time.Second), MaxBackoff: Duration(5 * time.Second)}
+		assert.Equal(t, time.Second, conf.delay(0))
+		assert.Equal(t, 2*time.Second, conf.delay(1))
+		assert.Equal(t, 4*time.Second, conf.delay(2))
+		assert.Equal(t, 5*time.Second, conf.delay(3))
+		assert.Equal(t, 5*time.Second, conf.delay(100))
+
+		assert.Equal(t, time.Duration(DefaultAppRestartBackoff), (&AppRestartConfig{}).delay(0))
+		assert.Equal(t, time.Duration(DefaultAppRestartMaxBackoff), (&AppRestartConfig{}).delay(100))
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		assert.NoError(t, (&AppRestartConfig{Policy: AppRestartOnFailure}).validate())
+		assert.Error(t, (&AppRestartConfig{Policy: "sometimes"}).validate())
+		assert.Error(t, (&AppRestartConfig{Policy: AppRestartAlways, MaxRetries: -1}).validate())
+		assert.Error(t, (&AppRestartConfig{Policy: AppRestartAlways, ResetAfter: -1}).validate())
+	})
+}
+
+func TestAppSupervisor(t *testing.T) {
+	conf := &AppRestartConfig{Policy: AppRestartAlways}
+
+	t.Run("stopped apps are not restarted", func(t *testing.T) {
+		var s appSupervisor
+
+		s.started("foo")
+		s.setStopping("foo", true)
+		assert.Equal(t, appExit{stopped: true}, s.exited("foo", nil, conf))
+
+		s.started("foo")
+		s.close()
+		assert.Equal(t, appExit{stopped: true}, s.exited("foo", nil, conf))
+	})
+
+	t.Run("restart is claimed once", func(t *testing.T) {
+		var s appSupervisor
+
+		s.started("foo")
+
+		exit := s.exited("foo", nil, conf)
+		assert.True(t, exit.restart)
+		assert.Equal(t, 1, exit.restarts)
+		assert.True(t, s.restarting("foo", exit.cancel))
+		assert.False(t, s.restarting("foo", exit.cancel))
+
+		restarts, exitCode := s.state("foo")
+		assert.Equal(t, 1, restarts)
+		assert.Equal(t, 0, *exitCode)
+	})
+
+	t.Run("start cancels pending restart", func(t *testing.T) {
+		var s appSupervisor
+
+		s.started("foo")
+
+		exit := s.exited("foo", nil, conf)
+		s.started("foo")
+
+		select {
+		case <-exit.cancel:
+		default:
+			t.Fatal("restart is not cancelled")
+		}
+
+		assert.False(t, s.restarting("foo", exit.cancel))
+		assert.False(t, s.cancelRestart("foo"))
+
+		restarts, _ := s.state("foo")
+		assert.Equal(t, 0, restarts)
+	})
+
+	t.Run("restarts are counted anew after healthy uptime", func(t *testing.T) {
+		var s appSupervisor
+
+		conf := &AppRestartConfig{Policy: AppRestartAlways, MaxRetries: 1, ResetAfter: Duration(time.Minute)}
+
+		s.started("foo")
+		s.running("foo")
+
+		exit := s.exited("foo", nil, conf)
+		assert.True(t, exit.restart)
+		assert.True(t, s.restarting("foo", exit.cancel))
+
+		// A crash right after the restart exhausts retries.
+		s.running("foo")
+		assert.False(t, s.exited("foo", nil, conf).restart)
+
+		// An exit after the app ran long enough doesn't.
+		s.running("foo")
+		s.apps["foo"].runSince = time.Now().Add(-time.Hour)
+
+		exit = s.exited("foo", nil, conf)
+		assert.True(t, exit.restart)
+		assert.Equal(t, 1, exit.restarts)
+	})
+}
@@ -17,6 +17,8 @@ import (
 	"github.com/SkycoinProject/skycoin/src/util/logging"
 
 	"github.com/SkycoinProject/skywire-mainnet/pkg/app/appcommon"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/routefinder/rfclient"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/router"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/routing"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/skyenv"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/snet"
@@ -54,11 +56,15 @@ type Config struct {
 	Dmsg          *snet.DmsgConfig     `json:"dmsg"`
 	DmsgPty       *DmsgPtyConfig       `json:"dmsg_pty,omitempty"`
 	STCP          *snet.STCPConfig     `json:"stcp,omitempty"`
+	SUDP          *snet.SUDPConfig     `json:"sudp,omitempty"`
+	SUDPH         *snet.SUDPHConfig    `json:"sudph,omitempty"`
+	Networks      NetworksConfig       `json:"networks,omitempty"`
 	Transport     *TransportConfig     `json:"transport"`
 	Routing       *RoutingConfig       `json:"routing"`
 	UptimeTracker *UptimeTrackerConfig `json:"uptime_tracker,omitempty"`
 
-	Apps []AppConfig `json:"apps"`
+	Apps       []AppConfig       `json:"apps"`
+	AppsCgroup *AppsCgroupConfig `json:"apps_cgroup,omitempty"`
 
 	TrustedVisors []cipher.PubKey    `json:"trusted_visors"`
 	Hypervisors   []HypervisorConfig `json:"hypervisors"`
@@ -76,6 +82,41 @@ type Config struct {
 	RestartCheckDelay string `json:"restart_check_delay,omitempty"`
 }
 
+// ReadConfig reads visor config from the JSON file at `path`.
+func ReadConfig(path string) (*Config, error) {
+	raw, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	conf := new(Config)
+	if err := json.Unmarshal(raw, conf); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+
+	conf.Path = &path
+
+	return conf, nil
+}
+
+// clone returns a deep copy of the config, which is flushed to the same file.
+func (c *Config) clone() (*Config, error) {
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := new(Config)
+	if err := json.Unmarshal(raw, conf); err != nil {
+		return nil, err
+	}
+
+	conf.Path = c.Path
+	conf.log = c.log
+
+	return conf, nil
+}
+
 // Flush flushes config to file.
 func (c *Config) flush() error {
 	c.flushMu.Lock()
@@ -185,6 +226,18 @@ func (c *Config) TransportDiscovery() (transport.DiscoveryClient, error) {
 	return trClient.NewHTTP(c.Transport.Discovery, c.Keys().PubKey, c.Keys().SecKey)
 }
 
+// CachedTransportDiscovery is like TransportDiscovery, but if TransportConfig.Cache is set, the returned
+// transport.DiscoveryClient keeps working while transport discovery is unreachable, including on startup.
+func (c *Config) CachedTransportDiscovery() (transport.DiscoveryClient, error) {
+	if c.Transport == nil || c.Transport.Cache == "" {
+		return c.TransportDiscovery()
+	}
+
+	dc := trClient.NewLazyHTTP(c.Transport.Discovery, c.Keys().PubKey, c.Keys().SecKey)
+
+	return transport.NewCachedDiscovery(dc, c.Transport.Cache)
+}
+
 // TransportLogStore extracts LogStoreConfig and returns transport.LogStore based on the config.
 // If LogStoreConfig is not found, DefaultLogStoreConfig() is used.
 func (c *Config) TransportLogStore() (transport.LogStore, error) {
@@ -200,11 +253,14 @@ func (c *Config) TransportLogStore() (transport.LogStore, error) {
 		}
 	}
 
-	if c.Transport.LogStore.Type == LogStoreFile {
+	switch c.Transport.LogStore.Type {
+	case LogStoreFile:
 		return transport.FileTransportLogStore(c.Transport.LogStore.Location)
+	case LogStoreBolt:
+		return transport.BoltTransportLogStore(c.Transport.LogStore.Location)
+	default:
+		return transport.InMemoryTransportLogStore(), nil
 	}
-
-	return transport.InMemoryTransportLogStore(), nil
 }
 
 // RoutingConfig extracts and returns RoutingConfig from Visor Config.
@@ -220,10 +276,53 @@ func (c *Config) RoutingConfig() *RoutingConfig {
 	return c.Routing
 }
 
+// RoutingTable extracts RoutingTableConfig and returns routing.Table based on the config.
+// If RoutingTableConfig is not found, DefaultRoutingTableConfig() is used.
+func (c *Config) RoutingTable() (routing.Table, error) {
+	rConf := c.RoutingConfig()
+	if rConf.Table == nil {
+		rConf.Table = DefaultRoutingTableConfig()
+		if err := c.flush(); err != nil && c.log != nil {
+			c.log.WithError(err).Errorf("Failed to flush config to disk")
+		}
+	}
+
+	switch rConf.Table.Type {
+	case RoutingTableBolt:
+		return routing.NewBoltTable(rConf.Table.Location)
+	case RoutingTableMemory, "":
+		return routing.NewTable(), nil
+	default:
+		return nil, fmt.Errorf("unknown routing table type: %s", rConf.Table.Type)
+	}
+}
+
+// RouteFinder returns the route finder client based on RoutingConfig.
+// Transports of `tm` and its transport discovery are used to compute routes locally.
+func (c *Config) RouteFinder(tm *transport.Manager) rfclient.Client {
+	rConf := c.RoutingConfig()
+
+	var clients []rfclient.Client
+
+	if rConf.RouteFinder != "" || rConf.DisableLocalRouteFinder {
+		clients = append(clients, rfclient.NewHTTP(rConf.RouteFinder, time.Duration(rConf.RouteFinderTimeout)))
+	}
+
+	if !rConf.DisableLocalRouteFinder {
+		clients = append(clients, rfclient.NewLocal(tm.Conf.DiscoveryClient, tm, nil))
+	}
+
+	return rfclient.NewFallback(clients...)
+}
+
 // AppsConfig decodes AppsConfig from a local json config file.
 func (c *Config) AppsConfig() (map[string]AppConfig, error) {
 	apps := make(map[string]AppConfig)
 	for _, app := range c.Apps {
+		if err := app.validate(); err != nil {
+			return nil, fmt.Errorf("app %s: %w", app.App, err)
+		}
+
 		apps[app.App] = app
 	}
 
@@ -321,12 +420,21 @@ func DefaultSTCPConfig() (*snet.STCPConfig, error) {
 	}
 
 	c := &snet.STCPConfig{
-		LocalAddr: lIPaddr,
+		LocalAddr:       lIPaddr,
+		AddressResolver: skyenv.DefaultAddressResolverAddr,
 	}
 
 	return c, nil
 }
 
+// DefaultSUDPHConfig returns default SUDPH config.
+func DefaultSUDPHConfig() *snet.SUDPHConfig {
+	return &snet.SUDPHConfig{
+		AddressResolver: skyenv.DefaultAddressResolverAddr,
+		Rendezvous:      skyenv.DefaultRendezvousAddr,
+	}
+}
+
 // DefaultDmsgConfig returns default Dmsg config.
 func DefaultDmsgConfig() *snet.DmsgConfig {
 	return &snet.DmsgConfig{
@@ -353,10 +461,22 @@ func DefaultDmsgPtyConfig() *DmsgPtyConfig {
 	}
 }
 
+// NetworksConfig holds configs of network types registered with snet.RegisterNetwork, keyed by network type.
+// Configs are passed to factories of the network types as is.
+type NetworksConfig map[string]json.RawMessage
+
 // TransportConfig defines a transport config.
+// If ReportLinkStats is set, latency and loss of transports are reported to transport discovery,
+// so that route finding can prefer good links.
+// If AutoConnect is set, the visor keeps transports to well-connected public visors.
+// If Cache is set, entries of transport discovery are cached in a bbolt database at Cache,
+// and calls made while transport discovery is unreachable are replayed once it's back.
 type TransportConfig struct {
-	Discovery string          `json:"discovery"`
-	LogStore  *LogStoreConfig `json:"log_store"`
+	Discovery       string             `json:"discovery"`
+	LogStore        *LogStoreConfig    `json:"log_store"`
+	Cache           string             `json:"cache,omitempty"`
+	ReportLinkStats bool               `json:"report_link_stats,omitempty"`
+	AutoConnect     *AutoConnectConfig `json:"auto_connect,omitempty"`
 }
 
 // DefaultTransportConfig returns default transport config.
@@ -367,17 +487,64 @@ func DefaultTransportConfig() *TransportConfig {
 	}
 }
 
-// LogStoreType defines a type for LogStore. It may be either file or memory.
+// AutoConnectConfig configures the auto-connect policy of the transport manager.
+// See transport.AutoConnectConfig for the meaning of the fields.
+// StateFile defaults to DefaultAutoConnectStateFile.
+type AutoConnectConfig struct {
+	Transports    int             `json:"transports"`
+	MaxTransports int             `json:"max_transports,omitempty"`
+	Type          string          `json:"type,omitempty"`
+	Allow         []cipher.PubKey `json:"allow,omitempty"`
+	Deny          []cipher.PubKey `json:"deny,omitempty"`
+	MaxLatency    Duration        `json:"max_latency,omitempty"`
+	MaxLoss       float64         `json:"max_loss,omitempty"`
+	Interval      Duration        `json:"interval,omitempty"`
+	MaxLookups    int             `json:"max_lookups,omitempty"`
+	StateFile     string          `json:"state_file,omitempty"`
+}
+
+// DefaultAutoConnectStateFile is the default file auto-connected transports are kept in.
+const DefaultAutoConnectStateFile = "./skywire/auto_connected_transports.json"
+
+// Policy returns the auto-connect policy of the config. It returns nil if c is nil.
+func (c *AutoConnectConfig) Policy() *transport.AutoConnectConfig {
+	if c == nil {
+		return nil
+	}
+
+	stateFile := c.StateFile
+	if stateFile == "" {
+		stateFile = DefaultAutoConnectStateFile
+	}
+
+	return &transport.AutoConnectConfig{
+		Transports:    c.Transports,
+		MaxTransports: c.MaxTransports,
+		Type:          c.Type,
+		Allow:         c.Allow,
+		Deny:          c.Deny,
+		MaxLatency:    time.Duration(c.MaxLatency),
+		MaxLoss:       c.MaxLoss,
+		Interval:      time.Duration(c.Interval),
+		MaxLookups:    c.MaxLookups,
+		StateFile:     stateFile,
+	}
+}
+
+// LogStoreType defines a type for LogStore. It may be either file, bbolt or memory.
 type LogStoreType string
 
 const (
 	// LogStoreFile tells LogStore to use a file for storage.
 	LogStoreFile = "file"
+	// LogStoreBolt tells LogStore to use a bbolt database for storage, which also keeps bandwidth history.
+	LogStoreBolt = "bbolt"
 	// LogStoreMemory tells LogStore to use memory for storage.
 	LogStoreMemory = "memory"
 )
 
 // LogStoreConfig configures a LogStore.
+// Location is a directory for file LogStore and a database file for bbolt LogStore.
 type LogStoreConfig struct {
 	Type     LogStoreType `json:"type"`
 	Location string       `json:"location"`
@@ -392,10 +559,17 @@ func DefaultLogStoreConfig() *LogStoreConfig {
 }
 
 // RoutingConfig configures routing.
+// Routes are computed locally from transport discovery data if the route finder is unreachable
+// (or not set at all), unless DisableLocalRouteFinder is set.
+// BandwidthLimits limit traffic forwarded by the router, they may be changed at runtime via RPC.
 type RoutingConfig struct {
-	SetupNodes         []cipher.PubKey `json:"setup_nodes,omitempty"`
-	RouteFinder        string          `json:"route_finder"`
-	RouteFinderTimeout Duration        `json:"route_finder_timeout,omitempty"`
+	SetupNodes              []cipher.PubKey         `json:"setup_nodes,omitempty"`
+	RouteFinder             string                  `json:"route_finder"`
+	RouteFinderTimeout      Duration                `json:"route_finder_timeout,omitempty"`
+	DisableLocalRouteFinder bool                    `json:"disable_local_route_finder,omitempty"`
+	Table                   *RoutingTableConfig     `json:"table,omitempty"`
+	DisableEncryption       bool                    `json:"disable_encryption,omitempty"`
+	BandwidthLimits         *router.BandwidthLimits `json:"bandwidth_limits,omitempty"`
 }
 
 // DefaultRoutingConfig returns default routing config.
@@ -404,6 +578,31 @@ func DefaultRoutingConfig() *RoutingConfig {
 		SetupNodes:         []cipher.PubKey{skyenv.MustPK(skyenv.DefaultSetupPK)},
 		RouteFinder:        skyenv.DefaultRouteFinderAddr,
 		RouteFinderTimeout: DefaultTimeout,
+		Table:              DefaultRoutingTableConfig(),
+	}
+}
+
+// RoutingTableType defines a type for routing table. It may be either bbolt or memory.
+type RoutingTableType string
+
+const (
+	// RoutingTableBolt tells routing table to persist rules in a bbolt database.
+	RoutingTableBolt = "bbolt"
+	// RoutingTableMemory tells routing table to keep rules in memory only.
+	RoutingTableMemory = "memory"
+)
+
+// RoutingTableConfig configures a routing table.
+type RoutingTableConfig struct {
+	Type     RoutingTableType `json:"type"`
+	Location string           `json:"location,omitempty"`
+}
+
+// DefaultRoutingTableConfig returns default routing table config.
+func DefaultRoutingTableConfig() *RoutingTableConfig {
+	return &RoutingTableConfig{
+		Type:     RoutingTableMemory,
+		Location: "./skywire/routing.db",
 	}
 }
 
@@ -427,15 +626,161 @@ type HypervisorConfig struct {
 
 // AppConfig defines app startup parameters.
 type AppConfig struct {
-	App       string       `json:"app"`
-	AutoStart bool         `json:"auto_start"`
-	Port      routing.Port `json:"port"`
-	Args      []string     `json:"args,omitempty"`
+	App        string                    `json:"app"`
+	AutoStart  bool                      `json:"auto_start"`
+	Port       routing.Port              `json:"port"`
+	Args       []string                  `json:"args,omitempty"`
+	Restart    *AppRestartConfig         `json:"restart,omitempty"`     // apps are not restarted if nil
+	User       string                    `json:"user,omitempty"`        // user to run the app as, the visor's user if empty
+	Env        map[string]string         `json:"env,omitempty"`         // variables added to the environment inherited from the visor
+	IsolateEnv bool                      `json:"isolate_env,omitempty"` // the app only gets Env and variables set by the visor if set
+	Limits     *appcommon.ResourceLimits `json:"limits,omitempty"`
+}
+
+func (c AppConfig) validate() error {
+	if c.Restart != nil {
+		if err := c.Restart.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Limits != nil && c.Limits.CPUs < 0 {
+		return errors.New("negative cpus limit")
+	}
+
+	return nil
+}
+
+// procConfig returns the config of the app process.
+func (c AppConfig) procConfig() appcommon.Config {
+	conf := appcommon.Config{
+		Name:       c.App,
+		User:       c.User,
+		Env:        c.Env,
+		IsolateEnv: c.IsolateEnv,
+	}
+
+	if c.Limits != nil {
+		conf.Limits = *c.Limits
+	}
+
+	return conf
+}
+
+// AppsCgroupConfig configures the cgroup v2 resource limits of apps are applied with.
+// Cgroups of apps are created in Dir, which is either absolute or relative to /sys/fs/cgroup and has to be
+// delegated to the visor, e.g. with `Delegate=yes` of systemd. The cgroup of the visor is used if Dir is empty.
+// Only cgroups without processes may enable controllers for their children, so if the visor is in Dir,
+// it's moved to the "visor" child cgroup of Dir if MoveVisor is set.
+// Without the config, memory of apps is limited with rlimits and their CPU usage is not limited.
+type AppsCgroupConfig struct {
+	Dir       string `json:"dir,omitempty"`
+	MoveVisor bool   `json:"move_visor,omitempty"`
+}
+
+// AppRestartPolicy defines which exits of an app make the visor restart it.
+type AppRestartPolicy string
+
+const (
+	// AppRestartNever tells the visor to leave exited apps stopped.
+	AppRestartNever AppRestartPolicy = "never"
+	// AppRestartOnFailure tells the visor to restart apps which exited with an error.
+	AppRestartOnFailure AppRestartPolicy = "on-failure"
+	// AppRestartAlways tells the visor to restart apps whenever they exit.
+	AppRestartAlways AppRestartPolicy = "always"
+)
+
+const (
+	// DefaultAppRestartBackoff is the delay of the first restart of an app if not set in config.
+	DefaultAppRestartBackoff = Duration(time.Second)
+	// DefaultAppRestartMaxBackoff is the maximum delay of restarts of an app if not set in config.
+	DefaultAppRestartMaxBackoff = Duration(time.Minute)
+	// DefaultAppRestartResetAfter is the uptime after which restarts of an app are counted anew if not set in config.
+	DefaultAppRestartResetAfter = Duration(5 * time.Minute)
+)
+
+// AppRestartConfig configures restarts of an app which exited without being stopped by the visor.
+// The delay of the first restart is Backoff, and it's doubled with every following one up to MaxBackoff.
+// Restarts are counted from the last time the app was started by the visor or a user,
+// or from the last run of the app which lasted at least ResetAfter.
+type AppRestartConfig struct {
+	Policy     AppRestartPolicy `json:"policy"`
+	MaxRetries int              `json:"max_retries,omitempty"` // 0 means unlimited
+	Backoff    Duration         `json:"backoff,omitempty"`
+	MaxBackoff Duration         `json:"max_backoff,omitempty"`
+	ResetAfter Duration         `json:"reset_after,omitempty"`
+}
+
+func (c *AppRestartConfig) validate() error {
+	switch c.Policy {
+	case AppRestartNever, AppRestartOnFailure, AppRestartAlways:
+	default:
+		return fmt.Errorf("unknown restart policy: %q", c.Policy)
+	}
+
+	if c.MaxRetries < 0 || c.Backoff < 0 || c.MaxBackoff < 0 || c.ResetAfter < 0 {
+		return errors.New("negative restart max_retries, backoff, max_backoff or reset_after")
+	}
+
+	return nil
+}
+
+// shouldRestart returns whether an app exited with `exitErr` after `restarts` restarts should be restarted.
+func (c *AppRestartConfig) shouldRestart(exitErr error, restarts int) bool {
+	if c == nil || (c.MaxRetries > 0 && restarts >= c.MaxRetries) {
+		return false
+	}
+
+	switch c.Policy {
+	case AppRestartAlways:
+		return true
+	case AppRestartOnFailure:
+		return exitErr != nil
+	default:
+		return false
+	}
+}
+
+// resetAfter returns the uptime after which restarts of the app are counted anew.
+func (c *AppRestartConfig) resetAfter() time.Duration {
+	if c == nil || c.ResetAfter == 0 {
+		return time.Duration(DefaultAppRestartResetAfter)
+	}
+
+	return time.Duration(c.ResetAfter)
+}
+
+// delay returns the delay of the restart following `restarts` restarts.
+func (c *AppRestartConfig) delay(restarts int) time.Duration {
+	backoff, maxBackoff := c.Backoff, c.MaxBackoff
+	if backoff == 0 {
+		backoff = DefaultAppRestartBackoff
+	}
+
+	if maxBackoff == 0 {
+		maxBackoff = DefaultAppRestartMaxBackoff
+	}
+
+	delay := time.Duration(backoff)
+	for i := 0; i < restarts && delay < time.Duration(maxBackoff); i++ {
+		delay *= 2
+	}
+
+	if delay > time.Duration(maxBackoff) {
+		delay = time.Duration(maxBackoff)
+	}
+
+	return delay
 }
 
 // InterfaceConfig defines listening interfaces for skywire visor.
 type InterfaceConfig struct {
 	RPCAddress string `json:"rpc"` // RPC address and port for command-line interface (leave blank to disable RPC interface).
+
+	// HTTPAddress is the address and port of the local HTTP API (leave blank to disable it).
+	// Requests to it should carry HTTPToken in the `Authorization: Bearer <token>` header.
+	HTTPAddress string `json:"http,omitempty"`
+	HTTPToken   string `json:"http_token,omitempty"`
 }
 
 // DefaultInterfaceConfig returns default server interface config.
@@ -1,19 +1,24 @@
 package visor
 
 import (
+	"context"
 	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/SkycoinProject/dmsg/cipher"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/SkycoinProject/skywire-mainnet/internal/httpauth"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/app/appcommon"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/routing"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/transport"
 )
 
 func TestTransportDiscovery(t *testing.T) {
@@ -36,6 +41,33 @@ func TestTransportDiscovery(t *testing.T) {
 	assert.NotNil(t, discovery)
 }
 
+func TestCachedTransportDiscovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tp_discovery_cache")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+
+	// Transport discovery doesn't need to be reachable.
+	conf := Config{
+		Transport: &TransportConfig{
+			Discovery: "http://127.0.0.1:1",
+			Cache:     filepath.Join(dir, "transport_discovery.db"),
+		},
+	}
+
+	discovery, err := conf.CachedTransportDiscovery()
+	require.NoError(t, err)
+	require.IsType(t, (*transport.CachedDiscovery)(nil), discovery)
+
+	entries, err := discovery.GetTransportsByEdge(context.TODO(), conf.Keys().PubKey)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	require.NoError(t, discovery.(*transport.CachedDiscovery).Close())
+}
+
 func TestTransportLogStore(t *testing.T) {
 	dir := filepath.Join(os.TempDir(), "foo")
 
@@ -56,6 +88,13 @@ func TestTransportLogStore(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, ls)
 
+	conf.Transport.LogStore.Type = LogStoreBolt
+	conf.Transport.LogStore.Location = filepath.Join(dir, "transport_logs.db")
+
+	ls, err = conf.TransportLogStore()
+	require.NoError(t, err)
+	require.Implements(t, (*transport.HistoryLogStore)(nil), ls)
+
 	conf.Transport.LogStore.Type = LogStoreMemory
 	conf.Transport.LogStore.Location = ""
 
@@ -64,6 +103,25 @@ func TestTransportLogStore(t *testing.T) {
 	require.NotNil(t, ls)
 }
 
+func TestAutoConnectConfig(t *testing.T) {
+	var conf TransportConfig
+	require.Nil(t, conf.AutoConnect.Policy())
+
+	pk, _ := cipher.GenerateKeyPair()
+	raw := `{"auto_connect": {"transports": 3, "max_transports": 10, "deny": ["` + pk.Hex() + `"], "max_latency": "200ms", "interval": "30s", "max_lookups": 32}}`
+	require.NoError(t, json.Unmarshal([]byte(raw), &conf))
+
+	assert.Equal(t, &transport.AutoConnectConfig{
+		Transports:    3,
+		MaxTransports: 10,
+		Deny:          []cipher.PubKey{pk},
+		MaxLatency:    200 * time.Millisecond,
+		Interval:      30 * time.Second,
+		MaxLookups:    32,
+		StateFile:     DefaultAutoConnectStateFile,
+	}, conf.AutoConnect.Policy())
+}
+
 func TestAppsConfig(t *testing.T) {
 	conf := Config{
 		Apps: []AppConfig{
@@ -84,6 +142,11 @@ func TestAppsConfig(t *testing.T) {
 	assert.Equal(t, "bar", app2.App)
 	assert.Equal(t, routing.Port(2), app2.Port)
 	assert.True(t, app2.AutoStart)
+
+	conf.Apps = append(conf.Apps, AppConfig{App: "baz", Port: 3, Limits: &appcommon.ResourceLimits{CPUs: -1}})
+
+	_, err = conf.AppsConfig()
+	assert.EqualError(t, err, "app baz: negative cpus limit")
 }
 
 func TestAppsDir(t *testing.T) {
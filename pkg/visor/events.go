@@ -0,0 +1,189 @@
+package visor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/routing"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/transport"
+)
+
+// eventBufferSize is the number of latest events kept by the visor.
+const eventBufferSize = 1024
+
+// EventType is the type of an event of the visor.
+type EventType string
+
+// Types of events of the visor.
+const (
+	EventTransportCreated EventType = "transport_created"
+	EventTransportDeleted EventType = "transport_deleted"
+	EventTransportUp      EventType = "transport_up"
+	EventTransportDown    EventType = "transport_down"
+	EventRouteGroupOpened EventType = "route_group_opened"
+	EventRouteGroupClosed EventType = "route_group_closed"
+	EventAppStarted       EventType = "app_started"
+	EventAppStopped       EventType = "app_stopped"
+	EventAppCrashed       EventType = "app_crashed"
+	EventAppRestarting    EventType = "app_restarting"
+	EventUpdateStarted    EventType = "update_started"
+	EventUpdateFinished   EventType = "update_finished"
+	EventUpdateFailed     EventType = "update_failed"
+)
+
+// Event is something which happened in the visor.
+// Seq increases by one with every event, so subscribers may tell which events they missed.
+type Event struct {
+	Seq    uint64            `json:"seq"`
+	Time   time.Time         `json:"time"`
+	Type   EventType         `json:"type"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// String returns the event type along with its params sorted by name.
+func (e Event) String() string {
+	keys := make([]string, 0, len(e.Params))
+	for k := range e.Params {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(string(e.Type))
+
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%s", k, e.Params[k])
+	}
+
+	return b.String()
+}
+
+// eventBus keeps the latest events of the visor. Subscribers poll it with the sequence number of the last event they got.
+// A nil eventBus drops published events.
+type eventBus struct {
+	mu     sync.Mutex
+	size   int
+	events []Event       // latest events, oldest first
+	seq    uint64        // sequence number of the latest event
+	notify chan struct{} // closed and replaced when an event is published
+}
+
+func newEventBus(size int) *eventBus {
+	return &eventBus{
+		size:   size,
+		notify: make(chan struct{}),
+	}
+}
+
+// Publish records an event of type `t`.
+func (b *eventBus) Publish(t EventType, params map[string]string) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+
+	if len(b.events) == b.size {
+		b.events = b.events[1:]
+	}
+
+	b.events = append(b.events, Event{Seq: b.seq, Time: time.Now().UTC(), Type: t, Params: params})
+
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
+
+// Since returns the retained events with sequence numbers greater than `seq`, of `types` if any are given.
+// If there are none, it waits for them until `ctx` is done.
+func (b *eventBus) Since(ctx context.Context, seq uint64, types []EventType) []Event {
+	if b == nil {
+		return nil
+	}
+
+	for {
+		b.mu.Lock()
+		events := b.since(seq, types)
+		notify := b.notify
+		b.mu.Unlock()
+
+		if len(events) > 0 {
+			return events
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-notify:
+		}
+	}
+}
+
+func (b *eventBus) since(seq uint64, types []EventType) []Event {
+	i := len(b.events)
+	for i > 0 && b.events[i-1].Seq > seq {
+		i--
+	}
+
+	events := make([]Event, 0, len(b.events)-i)
+
+	for _, e := range b.events[i:] {
+		if len(types) == 0 || hasEventType(types, e.Type) {
+			events = append(events, e)
+		}
+	}
+
+	return events
+}
+
+func hasEventType(types []EventType, t EventType) bool {
+	for _, v := range types {
+		if v == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (visor *Visor) publishTransportEvent(tp *transport.ManagedTransport, event transport.Event) {
+	types := map[transport.Event]EventType{
+		transport.EventCreated: EventTransportCreated,
+		transport.EventDeleted: EventTransportDeleted,
+		transport.EventUp:      EventTransportUp,
+		transport.EventDown:    EventTransportDown,
+	}
+
+	visor.events.Publish(types[event], map[string]string{
+		"tp_id":     tp.Entry.ID.String(),
+		"remote_pk": tp.Remote().String(),
+		"type":      tp.Type(),
+	})
+}
+
+func (visor *Visor) publishRouteGroupEvent(t EventType) func(desc routing.RouteDescriptor) {
+	return func(desc routing.RouteDescriptor) {
+		visor.events.Publish(t, map[string]string{
+			"src": desc.Src().String(),
+			"dst": desc.Dst().String(),
+		})
+	}
+}
+
+// publishAppExit publishes the exit of the app of given name, which crashed if it exited with an error
+// without being stopped by the visor.
+func (visor *Visor) publishAppExit(appName string, err error, stopped bool) {
+	if err == nil || stopped {
+		visor.events.Publish(EventAppStopped, map[string]string{"app": appName})
+		return
+	}
+
+	visor.events.Publish(EventAppCrashed, map[string]string{"app": appName, "error": err.Error()})
+}
@@ -0,0 +1,74 @@
+package visor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventBus(t *testing.T) {
+	b := newEventBus(3)
+
+	for _, et := range []EventType{EventAppStarted, EventTransportUp, EventAppStopped, EventTransportDown} {
+		b.Publish(et, nil)
+	}
+
+	seqs := func(events []Event) []uint64 {
+		res := make([]uint64, 0, len(events))
+		for _, e := range events {
+			res = append(res, e.Seq)
+		}
+
+		return res
+	}
+
+	t.Run("only latest events are retained", func(t *testing.T) {
+		assert.Equal(t, []uint64{2, 3, 4}, seqs(b.Since(context.Background(), 0, nil)))
+		assert.Equal(t, []uint64{4}, seqs(b.Since(context.Background(), 3, nil)))
+	})
+
+	t.Run("types filter", func(t *testing.T) {
+		events := b.Since(context.Background(), 0, []EventType{EventTransportUp, EventTransportDown})
+		assert.Equal(t, []uint64{2, 4}, seqs(events))
+	})
+
+	t.Run("waits for new events", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		assert.Empty(t, b.Since(ctx, 4, nil))
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			b.Publish(EventAppStopped, nil)
+			b.Publish(EventAppCrashed, map[string]string{"app": "foo"})
+		}()
+
+		events := b.Since(context.Background(), 4, []EventType{EventAppCrashed})
+		require.Len(t, events, 1)
+		assert.Equal(t, uint64(6), events[0].Seq)
+		assert.Equal(t, "app_crashed app=foo", events[0].String())
+	})
+}
+
+func TestVisor_publishAppExit(t *testing.T) {
+	visor := &Visor{events: newEventBus(eventBufferSize)}
+
+	last := func() Event {
+		events := visor.events.Since(context.Background(), 0, nil)
+		return events[len(events)-1]
+	}
+
+	visor.publishAppExit("foo", nil, false)
+	assert.Equal(t, "app_stopped app=foo", last().String())
+
+	visor.publishAppExit("foo", errors.New("exit status 1"), false)
+	assert.Equal(t, "app_crashed app=foo error=exit status 1", last().String())
+
+	visor.publishAppExit("foo", errors.New("signal: killed"), true)
+	assert.Equal(t, "app_stopped app=foo", last().String())
+}
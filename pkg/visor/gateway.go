@@ -1,414 +1,917 @@
 package visor
 
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/httputil"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/app"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/router"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/routing"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/transport"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/util/buildinfo"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/util/updater"
+)
+
+const (
+	gatewayTimeout = 30 * time.Second
+
+	// addTransportTimeout is the timeout of transports created via the gateway.
+	addTransportTimeout = 30 * time.Second
+)
+
+// App statuses accepted by PUT /api/apps/{app}.
+const (
+	statusStop = iota
+	statusStart
+)
+
+var (
+	// ErrMalformedRequest is returned when the body of a gateway request can't be decoded.
+	ErrMalformedRequest = errors.New("request body is malformed")
+
+	// ErrUnauthorized is returned when a gateway request carries no or an invalid token.
+	ErrUnauthorized = errors.New("missing or invalid token")
+)
+
+// Gateway serves the local HTTP API of the visor.
+// Endpoints mirror the methods of RPC and are described by the OpenAPI document served at /api/openapi.json.
+// Every other endpoint requires the `Authorization: Bearer <token>` header.
+type Gateway struct {
+	rpc     *RPC
+	token   string
+	handler http.Handler
+	log     logrus.FieldLogger
+}
+
+// NewGateway creates a Gateway for the given visor, which only accepts requests carrying token.
+func NewGateway(v *Visor, token string) *Gateway {
+	gw := &Gateway{
+		rpc: &RPC{
+			visor: v,
+			log:   v.Logger.PackageLogger("visor_rpc:HTTP"),
+		},
+		token: token,
+		log:   v.Logger.PackageLogger("visor_gateway"),
+	}
+
+	r := chi.NewRouter()
+	r.Use(middleware.Logger)
+
+	r.Route("/api", func(r chi.Router) {
+		r.Get("/openapi.json", gw.getOpenAPI())
+
+		// Events are long-polled, so requests of them aren't subject to gatewayTimeout.
+		r.With(gw.authorize).Get("/events", gw.getEvents())
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.Timeout(gatewayTimeout))
+			r.Use(gw.authorize)
+
+			r.Get("/health", gw.getHealth())
+			r.Get("/uptime", gw.getUptime())
+			r.Get("/summary", gw.getSummary())
+			r.Get("/apps", gw.getApps())
+			r.Get("/apps/{app}", gw.getApp())
+			r.Put("/apps/{app}", gw.putApp())
+			r.Get("/apps/{app}/logs", gw.appLogsSince())
+			r.Get("/transport-types", gw.getTransportTypes())
+			r.Get("/transports", gw.getTransports())
+			r.Post("/transports", gw.postTransport())
+			r.Get("/transports/{tid}", gw.getTransport())
+			r.Delete("/transports/{tid}", gw.deleteTransport())
+			r.Get("/transports/{tid}/bandwidth", gw.getTransportBandwidth())
+			r.Get("/bandwidth/{remote}", gw.getRemoteBandwidth())
+			r.Get("/bandwidth-limits", gw.getBandwidthLimits())
+			r.Put("/bandwidth-limits", gw.putBandwidthLimits())
+			r.Get("/discovery/edges/{pk}", gw.discoverTransportsByPK())
+			r.Get("/discovery/transports/{tid}", gw.discoverTransportByID())
+			r.Get("/routes", gw.getRoutes())
+			r.Post("/routes", gw.postRoute())
+			r.Get("/routes/{rid}", gw.getRoute())
+			r.Put("/routes/{rid}", gw.putRoute())
+			r.Delete("/routes/{rid}", gw.deleteRoute())
+			r.Get("/routes/{rid}/trace", gw.traceRoute())
+			r.Get("/routegroups", gw.getRouteGroups())
+			r.Get("/ping/{pk}", gw.ping())
+			r.Post("/restart", gw.restart())
+			r.Post("/reload-config", gw.reloadConfig())
+			r.Post("/exec", gw.exec())
+			r.Post("/update", gw.update())
+			r.Get("/update/available", gw.updateAvailable())
+		})
+	})
+
+	gw.handler = r
+
+	return gw
+}
+
+// ServeHTTP implements http.Handler.
+func (gw *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	gw.handler.ServeHTTP(w, r)
+}
+
+// authorize rejects requests which don't carry the gateway token.
+func (gw *Gateway) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const prefix = "Bearer "
+
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, prefix) ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, prefix)), []byte(gw.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			httputil.WriteJSON(w, r, http.StatusUnauthorized, ErrUnauthorized)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (gw *Gateway) getOpenAPI() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if _, err := io.WriteString(w, openAPISpec); err != nil {
+			gw.log.WithError(err).Warn("Failed to write OpenAPI document")
+		}
+	}
+}
+
+func (gw *Gateway) getHealth() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var hi HealthInfo
+		err := gw.rpc.Health(nil, &hi)
+		gw.writeResult(w, r, &hi, err)
+	}
+}
+
+func (gw *Gateway) getUptime() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var uptime float64
+		err := gw.rpc.Uptime(nil, &uptime)
+		gw.writeResult(w, r, uptime, err)
+	}
+}
+
+func (gw *Gateway) getSummary() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var summary Summary
+		err := gw.rpc.Summary(nil, &summary)
+		gw.writeResult(w, r, &summary, err)
+	}
+}
+
+func (gw *Gateway) getApps() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var apps []*AppState
+		err := gw.rpc.Apps(nil, &apps)
+		gw.writeResult(w, r, apps, err)
+	}
+}
+
+func (gw *Gateway) getApp() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if state, ok := gw.app(w, r); ok {
+			httputil.WriteJSON(w, r, http.StatusOK, state)
+		}
+	}
+}
+
+// putApp changes settings of an app and starts (status 1) or stops (status 0) it.
+func (gw *Gateway) putApp() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		state, ok := gw.app(w, r)
+		if !ok {
+			return
+		}
+
+		var reqBody struct {
+			AutoStart *bool          `json:"autostart,omitempty"`
+			Status    *int           `json:"status,omitempty"`
+			Passcode  *string        `json:"passcode,omitempty"`
+			PK        *cipher.PubKey `json:"pk,omitempty"`
+		}
+
+		if !gw.readJSON(w, r, &reqBody) {
+			return
+		}
+
+		if reqBody.Status != nil && *reqBody.Status != statusStop && *reqBody.Status != statusStart {
+			err := fmt.Errorf("value of 'status' field is %d when expecting 0 or 1", *reqBody.Status)
+			httputil.WriteJSON(w, r, http.StatusBadRequest, err)
+
+			return
+		}
+
+		const (
+			skysocksName       = "skysocks"
+			skysocksClientName = "skysocks-client"
+		)
+
+		var err error
+
+		if reqBody.AutoStart != nil && *reqBody.AutoStart != state.AutoStart {
+			err = gw.rpc.SetAutoStart(&SetAutoStartIn{AppName: state.Name, AutoStart: *reqBody.AutoStart}, nil)
+		}
+
+		if err == nil && reqBody.Passcode != nil && state.Name == skysocksName {
+			err = gw.rpc.SetSocksPassword(reqBody.Passcode, nil)
+		}
+
+		if err == nil && reqBody.PK != nil && state.Name == skysocksClientName {
+			err = gw.rpc.SetSocksClientPK(reqBody.PK, nil)
+		}
+
+		if err == nil && reqBody.Status != nil {
+			if *reqBody.Status == statusStart {
+				err = gw.rpc.StartApp(&state.Name, nil)
+			} else {
+				err = gw.rpc.StopApp(&state.Name, nil)
+			}
+		}
+
+		if err != nil {
+			httputil.WriteJSON(w, r, errorStatus(err), err)
+			return
+		}
+
+		state, _ = gw.rpc.visor.App(state.Name)
+		httputil.WriteJSON(w, r, http.StatusOK, state)
+	}
+}
+
+// LogsRes parses logs as json, along with the last obtained timestamp for use on subsequent requests
+type LogsRes struct {
+	LastLogTimestamp string   `json:"last_log_timestamp"`
+	Logs             []string `json:"logs"`
+}
+
+// appLogsSince returns logs of an app since the RFC 3339 timestamp in the `since` query parameter, or all logs.
+func (gw *Gateway) appLogsSince() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		state, ok := gw.app(w, r)
+		if !ok {
+			return
+		}
+
+		since := r.URL.Query().Get("since")
+		since = strings.Replace(since, " ", "+", 1) // we need to put '+' again that was replaced in the query string
+
+		in := AppLogsRequest{AppName: state.Name, TimeStamp: time.Unix(0, 0)}
+		if t, err := time.Parse(time.RFC3339Nano, since); err == nil {
+			in.TimeStamp = t
+		}
+
+		var logs []string
+		if err := gw.rpc.LogsSince(&in, &logs); err != nil {
+			httputil.WriteJSON(w, r, errorStatus(err), err)
+			return
+		}
+
+		res := LogsRes{Logs: logs}
+		if len(logs) > 0 {
+			res.LastLogTimestamp = app.TimestampFromLog(logs[len(logs)-1])
+		} else {
+			res.Logs = []string{}
+		}
+
+		httputil.WriteJSON(w, r, http.StatusOK, &res)
+	}
+}
+
+func (gw *Gateway) getTransportTypes() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var types []string
+		err := gw.rpc.TransportTypes(nil, &types)
+		gw.writeResult(w, r, types, err)
+	}
+}
+
+// getTransports lists transports, filtered by the `type` and `pk` query parameters if present.
+func (gw *Gateway) getTransports() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			in  TransportsIn
+			err error
+		)
+
+		in.FilterTypes = strSliceFromQuery(r, "type", nil)
+
+		if in.FilterPubKeys, err = pkSliceFromQuery(r, "pk", nil); err != nil {
+			httputil.WriteJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		if in.ShowLogs, err = httputil.BoolFromQuery(r, "logs", true); err != nil {
+			httputil.WriteJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		transports := make([]*TransportSummary, 0)
+		err = gw.rpc.Transports(&in, &transports)
+		gw.writeResult(w, r, transports, err)
+	}
+}
+
+func (gw *Gateway) postTransport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var reqBody struct {
+			TpType string        `json:"transport_type"`
+			Remote cipher.PubKey `json:"remote_pk"`
+			Public bool          `json:"public"`
+		}
+
+		if !gw.readJSON(w, r, &reqBody) {
+			return
+		}
+
+		in := AddTransportIn{
+			RemotePK: reqBody.Remote,
+			TpType:   reqBody.TpType,
+			Public:   reqBody.Public,
+			Timeout:  addTransportTimeout,
+		}
+
+		var summary TransportSummary
+		err := gw.rpc.AddTransport(&in, &summary)
+		gw.writeResult(w, r, &summary, err)
+	}
+}
+
+func (gw *Gateway) getTransport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tid, ok := uuidParam(w, r, "tid")
+		if !ok {
+			return
+		}
+
+		var summary TransportSummary
+		err := gw.rpc.Transport(&tid, &summary)
+		gw.writeResult(w, r, &summary, err)
+	}
+}
+
+func (gw *Gateway) deleteTransport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tid, ok := uuidParam(w, r, "tid")
+		if !ok {
+			return
+		}
+
+		var summary TransportSummary
+		if err := gw.rpc.Transport(&tid, &summary); err != nil {
+			httputil.WriteJSON(w, r, errorStatus(err), err)
+			return
+		}
+
+		err := gw.rpc.RemoveTransport(&tid, nil)
+		gw.writeResult(w, r, true, err)
+	}
+}
+
+// getTransportBandwidth returns bandwidth history of a transport. Transports which no longer exist can be queried as well.
+func (gw *Gateway) getTransportBandwidth() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tid, ok := uuidParam(w, r, "tid")
+		if !ok {
+			return
+		}
+
+		in := BandwidthHistoryIn{TpID: tid}
+		if !bandwidthRangeParam(w, r, &in) {
+			return
+		}
+
+		var records []transport.BandwidthRecord
+		err := gw.rpc.TransportBandwidth(&in, &records)
+		gw.writeResult(w, r, records, err)
+	}
+}
+
+// getRemoteBandwidth returns bandwidth history of all transports to a remote visor.
+func (gw *Gateway) getRemoteBandwidth() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		remote, ok := pkParam(w, r, "remote")
+		if !ok {
+			return
+		}
+
+		in := BandwidthHistoryIn{RemotePK: remote}
+		if !bandwidthRangeParam(w, r, &in) {
+			return
+		}
+
+		var records []transport.BandwidthRecord
+		err := gw.rpc.RemoteBandwidth(&in, &records)
+		gw.writeResult(w, r, records, err)
+	}
+}
+
+func (gw *Gateway) getBandwidthLimits() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var limits router.BandwidthLimits
+		err := gw.rpc.BandwidthLimits(nil, &limits)
+		gw.writeResult(w, r, &limits, err)
+	}
+}
+
+func (gw *Gateway) putBandwidthLimits() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var limits router.BandwidthLimits
+		if !gw.readJSON(w, r, &limits) {
+			return
+		}
+
+		err := gw.rpc.SetBandwidthLimits(&limits, nil)
+		gw.writeResult(w, r, &limits, err)
+	}
+}
+
+func (gw *Gateway) discoverTransportsByPK() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pk, ok := pkParam(w, r, "pk")
+		if !ok {
+			return
+		}
+
+		var entries []*transport.EntryWithStatus
+		err := gw.rpc.DiscoverTransportsByPK(&pk, &entries)
+		gw.writeResult(w, r, entries, err)
+	}
+}
+
+func (gw *Gateway) discoverTransportByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tid, ok := uuidParam(w, r, "tid")
+		if !ok {
+			return
+		}
+
+		var entry transport.EntryWithStatus
+		err := gw.rpc.DiscoverTransportByID(&tid, &entry)
+		gw.writeResult(w, r, &entry, err)
+	}
+}
+
+// RoutingRuleResp is a routing rule as returned by the gateway. Rule is hex encoded.
+type RoutingRuleResp struct {
+	Key     routing.RouteID      `json:"key"`
+	Rule    string               `json:"rule"`
+	Summary *routing.RuleSummary `json:"rule_summary,omitempty"`
+}
+
+func makeRoutingRuleResp(key routing.RouteID, rule routing.Rule, summary bool) RoutingRuleResp {
+	resp := RoutingRuleResp{
+		Key:  key,
+		Rule: hex.EncodeToString(rule),
+	}
+
+	if summary {
+		resp.Summary = rule.Summary()
+	}
+
+	return resp
+}
+
+func (gw *Gateway) getRoutes() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		qSummary, err := httputil.BoolFromQuery(r, "summary", false)
+		if err != nil {
+			httputil.WriteJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		var rules []routing.Rule
+		if err := gw.rpc.RoutingRules(nil, &rules); err != nil {
+			httputil.WriteJSON(w, r, errorStatus(err), err)
+			return
+		}
+
+		resp := make([]RoutingRuleResp, len(rules))
+		for i, rule := range rules {
+			resp[i] = makeRoutingRuleResp(rule.KeyRouteID(), rule, qSummary)
+		}
+
+		httputil.WriteJSON(w, r, http.StatusOK, resp)
+	}
+}
+
+func (gw *Gateway) postRoute() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if rule, ok := gw.saveRoute(w, r); ok {
+			httputil.WriteJSON(w, r, http.StatusOK, makeRoutingRuleResp(rule.KeyRouteID(), rule, true))
+		}
+	}
+}
+
+func (gw *Gateway) getRoute() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rid, ok := ridParam(w, r, "rid")
+		if !ok {
+			return
+		}
+
+		qSummary, err := httputil.BoolFromQuery(r, "summary", true)
+		if err != nil {
+			httputil.WriteJSON(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		var rule routing.Rule
+		if err := gw.rpc.RoutingRule(&rid, &rule); err != nil {
+			httputil.WriteJSON(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		httputil.WriteJSON(w, r, http.StatusOK, makeRoutingRuleResp(rid, rule, qSummary))
+	}
+}
+
+func (gw *Gateway) putRoute() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rid, ok := ridParam(w, r, "rid")
+		if !ok {
+			return
+		}
+
+		if rule, ok := gw.saveRoute(w, r); ok {
+			httputil.WriteJSON(w, r, http.StatusOK, makeRoutingRuleResp(rid, rule, true))
+		}
+	}
+}
+
+func (gw *Gateway) deleteRoute() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rid, ok := ridParam(w, r, "rid")
+		if !ok {
+			return
+		}
+
+		err := gw.rpc.RemoveRoutingRule(&rid, nil)
+		gw.writeResult(w, r, true, err)
+	}
+}
+
+func (gw *Gateway) traceRoute() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rid, ok := ridParam(w, r, "rid")
+		if !ok {
+			return
+		}
+
+		var hops []router.HopRTT
+		err := gw.rpc.TraceRoute(&rid, &hops)
+		gw.writeResult(w, r, hops, err)
+	}
+}
+
+// RouteGroupResp is a route group as returned by the gateway.
+type RouteGroupResp struct {
+	ConsumeRule *routing.RuleSummary `json:"consume_rule"`
+	FwdRule     *routing.RuleSummary `json:"fwd_rule"`
+}
+
+func (gw *Gateway) getRouteGroups() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var routegroups []RouteGroupInfo
+		if err := gw.rpc.RouteGroups(nil, &routegroups); err != nil {
+			httputil.WriteJSON(w, r, errorStatus(err), err)
+			return
+		}
+
+		resp := make([]RouteGroupResp, 0, len(routegroups))
+		for _, rg := range routegroups {
+			if len(rg.ConsumeRule) == 0 || len(rg.FwdRule) == 0 {
+				continue
+			}
+
+			resp = append(resp, RouteGroupResp{
+				ConsumeRule: rg.ConsumeRule.Summary(),
+				FwdRule:     rg.FwdRule.Summary(),
+			})
+		}
+
+		httputil.WriteJSON(w, r, http.StatusOK, resp)
+	}
+}
+
+func (gw *Gateway) ping() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pk, ok := pkParam(w, r, "pk")
+		if !ok {
+			return
+		}
+
+		var rtt time.Duration
+		err := gw.rpc.Ping(&pk, &rtt)
+
+		output := struct {
+			RTT Duration `json:"rtt"`
+		}{Duration(rtt)}
+
+		gw.writeResult(w, r, output, err)
+	}
+}
+
+// getEvents returns events after the one of sequence number in the `since` query parameter, of types in `type`
+// parameters if any are given. If there are none, it waits for them for up to the `timeout` query parameter.
+func (gw *Gateway) getEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		var (
+			in  EventsIn
+			err error
+		)
+
+		if v := q.Get("since"); v != "" {
+			if in.Since, err = strconv.ParseUint(v, 10, 64); err != nil {
+				httputil.WriteJSON(w, r, http.StatusBadRequest, fmt.Errorf("invalid 'since' query parameter: %w", err))
+				return
+			}
+		}
+
+		if v := q.Get("timeout"); v != "" {
+			if in.Timeout, err = time.ParseDuration(v); err != nil {
+				httputil.WriteJSON(w, r, http.StatusBadRequest, fmt.Errorf("invalid 'timeout' query parameter: %w", err))
+				return
+			}
+		}
+
+		for _, t := range strSliceFromQuery(r, "type", nil) {
+			in.Types = append(in.Types, EventType(t))
+		}
+
+		var events []Event
+		err = gw.rpc.Events(&in, &events)
+
+		if events == nil {
+			events = []Event{}
+		}
+
+		gw.writeResult(w, r, events, err)
+	}
+}
+
+// NOTE: Reply comes with a delay, because of check if new executable is started successfully.
+func (gw *Gateway) restart() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := gw.rpc.Restart(nil, nil)
+		gw.writeResult(w, r, true, err)
+	}
+}
+
+func (gw *Gateway) reloadConfig() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var res ConfigReload
+		err := gw.rpc.ReloadConfig(nil, &res)
+		gw.writeResult(w, r, &res, err)
+	}
+}
+
+// executes a command and returns its output
+func (gw *Gateway) exec() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var reqBody struct {
+			Command string `json:"command"`
+		}
+
+		if !gw.readJSON(w, r, &reqBody) {
+			return
+		}
+
+		var out []byte
+		err := gw.rpc.Exec(&reqBody.Command, &out)
+
+		output := struct {
+			Output string `json:"output"`
+		}{string(out)}
+
+		gw.writeResult(w, r, output, err)
+	}
+}
+
+func (gw *Gateway) update() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var updated bool
+		err := gw.rpc.Update(nil, &updated)
+
+		output := struct {
+			Updated bool `json:"updated"`
+		}{updated}
+
+		gw.writeResult(w, r, output, err)
+	}
+}
+
+func (gw *Gateway) updateAvailable() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var version updater.Version
+		if err := gw.rpc.UpdateAvailable(nil, &version); err != nil {
+			httputil.WriteJSON(w, r, errorStatus(err), err)
+			return
+		}
+
+		output := struct {
+			Available        bool   `json:"available"`
+			CurrentVersion   string `json:"current_version"`
+			AvailableVersion string `json:"available_version,omitempty"`
+		}{
+			Available:      version != updater.Version{},
+			CurrentVersion: buildinfo.Version(),
+		}
+
+		if output.Available {
+			output.AvailableVersion = version.String()
+		}
+
+		httputil.WriteJSON(w, r, http.StatusOK, output)
+	}
+}
+
 /*
-	!!! DO NOT DELETE !!!
-	TODO(evanlinjin): This is taking far too long, we will leave this to be completed later.
+	<<< Helper functions >>>
 */
 
-//// App constants.
-//const (
-//	statusStop = iota
-//	statusStart
-//)
-//
-//type Gateway struct {
-//	v *Visor
-//}
-//
-///*
-//	<<< VISOR ENDPOINTS >>>
-//*/
-//
-//func handleGetHealth(v *Visor) http.HandlerFunc {
-//	return func(w http.ResponseWriter, r *http.Request) {
-//		hi := HealthInfo{
-//			TransportDiscovery: http.StatusOK,
-//			RouteFinder:        http.StatusOK,
-//			SetupNode:          http.StatusOK,
-//		}
-//		if _, err := v.conf.TransportDiscovery(); err != nil {
-//			hi.TransportDiscovery = http.StatusNotFound
-//		}
-//		if v.conf.Routing.RouteFinder == "" {
-//			hi.RouteFinder = http.StatusNotFound
-//		}
-//		if len(v.conf.Routing.SetupNodes) == 0 {
-//			hi.SetupNode = http.StatusNotFound
-//		}
-//		httputil.WriteJSON(w, r, http.StatusOK, hi)
-//	}
-//}
-//
-//func handleGetUptime(v *Visor) http.HandlerFunc {
-//	return func(w http.ResponseWriter, r *http.Request) {
-//		uptime := time.Since(v.startedAt).Seconds()
-//		httputil.WriteJSON(w, r, http.StatusOK, uptime)
-//	}
-//}
-//
-//func handleGetSummary(v *Visor) http.HandlerFunc {
-//	return func(w http.ResponseWriter, r *http.Request) {
-//		httputil.WriteJSON(w, r, http.StatusOK, makeVisorSummary(v))
-//	}
-//}
-//
-///*
-//	<<< APP ENDPOINTS >>>
-//*/
-//
-//func handleGetApps(v *Visor) http.HandlerFunc {
-//	return func(w http.ResponseWriter, r *http.Request) {
-//		httputil.WriteJSON(w, r, http.StatusOK, v.Apps())
-//	}
-//}
-//
-//func handleGetApp(v *Visor) http.HandlerFunc {
-//	return func(w http.ResponseWriter, r *http.Request) {
-//		appState, ok := httpAppState(v, w, r)
-//		if !ok {
-//			return
-//		}
-//		httputil.WriteJSON(w, r, http.StatusOK, appState)
-//	}
-//}
-//
-//// TODO: simplify
-//// nolint: funlen,gocognit,godox
-//func handlePutApp(v *Visor) http.HandlerFunc {
-//	return func(w http.ResponseWriter, r *http.Request) {
-//		appS, ok := httpAppState(v, w, r)
-//		if !ok {
-//			return
-//		}
-//		var reqBody struct {
-//			AutoStart *bool          `json:"autostart,omitempty"`
-//			Status    *int           `json:"status,omitempty"`
-//			Passcode  *string        `json:"passcode,omitempty"`
-//			PK        *cipher.PubKey `json:"pk,omitempty"`
-//		}
-//		if err := httputil.ReadJSON(r, &reqBody); err != nil {
-//			if err != io.EOF {
-//				log.Warnf("handlePutApp request: %v", err)
-//			}
-//			httputil.WriteJSON(w, r, http.StatusBadRequest,
-//				fmt.Errorf("failed to read JSON from http request body: %v", err))
-//			return
-//		}
-//
-//		if reqBody.AutoStart != nil {
-//			if *reqBody.AutoStart != appS.AutoStart {
-//				if err := v.setAutoStart(appS.Name, *reqBody.AutoStart); err != nil {
-//					httputil.WriteJSON(w, r, http.StatusInternalServerError, err)
-//					return
-//				}
-//			}
-//		}
-//
-//		if reqBody.Status != nil {
-//			switch *reqBody.Status {
-//			case statusStop:
-//				if err := v.StopApp(appS.Name); err != nil {
-//					httputil.WriteJSON(w, r, http.StatusInternalServerError, err)
-//					return
-//				}
-//			case statusStart:
-//				if err := v.StartApp(appS.Name); err != nil {
-//					httputil.WriteJSON(w, r, http.StatusInternalServerError, err)
-//					return
-//				}
-//			default:
-//				errMsg := fmt.Errorf("value of 'status' field is %d when expecting 0 or 1", *reqBody.Status)
-//				httputil.WriteJSON(w, r, http.StatusBadRequest, errMsg)
-//				return
-//			}
-//		}
-//
-//		const (
-//			skysocksName       = "skysocks"
-//			skysocksClientName = "skysocks-client"
-//		)
-//
-//		if reqBody.Passcode != nil && appS.Name == skysocksName {
-//			if err := v.setSocksPassword(*reqBody.Passcode); err != nil {
-//				httputil.WriteJSON(w, r, http.StatusInternalServerError, err)
-//				return
-//			}
-//		}
-//
-//		if reqBody.PK != nil && appS.Name == skysocksClientName {
-//			if err := v.setSocksClientPK(*reqBody.PK); err != nil {
-//				httputil.WriteJSON(w, r, http.StatusInternalServerError, err)
-//				return
-//			}
-//		}
-//
-//		appS, _ = v.App(appS.Name)
-//		httputil.WriteJSON(w, r, http.StatusOK, appS)
-//	}
-//}
-//
-//// AppLogsResp parses logs as json, along with the last obtained timestamp for use on subsequent requests
-//type AppLogsResp struct {
-//	LastLogTimestamp string   `json:"last_log_timestamp"`
-//	Logs             []string `json:"logs"`
-//}
-//
-//func handleGetAppLogsSince(v *Visor) http.HandlerFunc {
-//	return func(w http.ResponseWriter, r *http.Request) {
-//		appS, ok := httpAppState(v, w, r)
-//		if !ok {
-//			return
-//		}
-//
-//		since := r.URL.Query().Get("since")
-//		since = strings.Replace(since, " ", "+", 1) // we need to put '+' again that was replaced in the query string
-//
-//		// if time is not parsable or empty default to return all logs
-//		t, err := time.Parse(time.RFC3339Nano, since)
-//		if err != nil {
-//			t = time.Unix(0, 0)
-//		}
-//
-//		ls, err := app.NewLogStore(filepath.Join(v.dir(), appS.Name), appS.Name, "bbolt")
-//		if err != nil {
-//			httputil.WriteJSON(w, r, http.StatusInternalServerError, err)
-//			return
-//		}
-//		logs, err := ls.LogsSince(t)
-//		if err != nil {
-//			httputil.WriteJSON(w, r, http.StatusInternalServerError, err)
-//			return
-//		}
-//		if len(logs) == 0 {
-//			httputil.WriteJSON(w, r, http.StatusServiceUnavailable, err)
-//			return
-//		}
-//		httputil.WriteJSON(w, r, http.StatusOK, &AppLogsResp{
-//			LastLogTimestamp: app.TimestampFromLog(logs[len(logs)-1]),
-//			Logs:             logs,
-//		})
-//	}
-//}
-//
-///*
-//	<<< TRANSPORT ENDPOINTS >>>
-//*/
-//
-//func handleTransportTypes(v *Visor) http.HandlerFunc {
-//	return func(w http.ResponseWriter, r *http.Request) {
-//		httputil.WriteJSON(w, r, http.StatusOK, v.tm.Networks())
-//	}
-//}
-//
-//func handleGetTransport(v *Visor) http.HandlerFunc {
-//	return func(w http.ResponseWriter, r *http.Request) {
-//		tp, ok := httpTransport(v, w, r)
-//		if !ok {
-//			return
-//		}
-//		httputil.WriteJSON(w, r, http.StatusOK,
-//			newTransportSummary(v.tm, tp, true, v.router.SetupIsTrusted(tp.Remote())))
-//	}
-//}
-//
-//func handleGetTransports(v *Visor) http.HandlerFunc {
-//	return func(w http.ResponseWriter, r *http.Request) {
-//		qTypes := strSliceFromQuery(r, "type", nil)
-//
-//		qPKs, err := pkSliceFromQuery(r, "pk", nil)
-//		if err != nil {
-//			httputil.WriteJSON(w, r, http.StatusBadRequest, err)
-//			return
-//		}
-//
-//		qLogs, err := httputil.BoolFromQuery(r, "logs", true)
-//		if err != nil {
-//			httputil.WriteJSON(w, r, http.StatusBadRequest, err)
-//			return
-//		}
-//
-//		tps, err := listTransports(v, TransportsIn{
-//			FilterTypes:qTypes,
-//			FilterPubKeys:qPKs,
-//			ShowLogs:qLogs,
-//		})
-//		if err != nil {
-//			httputil.WriteJSON(w, r, http.StatusInternalServerError, err)
-//			return
-//		}
-//		httputil.WriteJSON(w, r, http.StatusOK, tps)
-//	}
-//}
-//
-//type PostTransportReq struct {
-//	TpType string        `json:"transport_type"`
-//	Remote cipher.PubKey `json:"remote_pk"`
-//	Public bool          `json:"public"`
-//}
-//
-//func handlePostTransport(v *Visor) http.HandlerFunc {
-//	return func(w http.ResponseWriter, r *http.Request) {
-//		var reqB PostTransportReq
-//		if err := httputil.ReadJSON(r, &reqB); err != nil {
-//			if err != io.EOF {
-//				log.Warnf("handlePostTransport request: %v", err)
-//			}
-//			httputil.WriteJSON(w, r, http.StatusBadRequest,
-//				fmt.Errorf("failed to read JSON from http request body: %v", err))
-//			return
-//		}
-//		mTp, err := v.tm.SaveTransport(r.Context(), reqB.Remote, reqB.TpType)
-//		if err != nil {
-//			httputil.WriteJSON(w, r, http.StatusInternalServerError, err)
-//			return
-//		}
-//		httputil.WriteJSON(w, r, http.StatusOK,
-//			newTransportSummary(v.tm, mTp, false, v.router.SetupIsTrusted(mTp.Remote())))
-//	}
-//}
-//
-//func handleDelTransport(v *Visor) http.HandlerFunc {
-//	return func(w http.ResponseWriter, r *http.Request) {
-//		tp, ok := httpTransport(v, w, r)
-//		if !ok {
-//			return
-//		}
-//		v.tm.DeleteTransport(tp.Entry.ID)
-//	}
-//}
-//
-///*
-//	<<< ROUTER ENDPOINTS >>>
-//*/
-//
-//
-///*
-//	<<< HELPER FUNCTIONS >>>
-//*/
-//
-//func httpAppState(v *Visor, w http.ResponseWriter, r *http.Request) (*AppState, bool) {
-//	appName := chi.URLParam(r, "app")
-//
-//	appState, ok := v.App(appName)
-//	if !ok {
-//		httputil.WriteJSON(w, r, http.StatusNotFound,
-//			fmt.Sprintf("app of name %s is not found in visor", appName))
-//		return nil, false
-//	}
-//	return appState, true
-//}
-//
-//func httpTransport(v *Visor, w http.ResponseWriter, r *http.Request) (*transport.ManagedTransport, bool) {
-//	tid, err := uuidFromParam(r, "tid")
-//	if err != nil {
-//		httputil.WriteJSON(w, r, http.StatusBadRequest, err)
-//		return nil, false
-//	}
-//	tp := v.tm.Transport(tid)
-//	if tp == nil {
-//		httputil.WriteJSON(w, r, http.StatusNotFound,
-//			fmt.Errorf("transport of ID %v is not found", tid))
-//		return nil, false
-//	}
-//	return tp, true
-//}
-//
-//func httpRoute(v *Visor, w http.ResponseWriter, r *http.Request) (routing.RouteID, bool) {
-//	rid, err := ridFromParam(r, "rid")
-//	if err != nil {
-//		httputil.WriteJSON(w, r, http.StatusBadRequest, err)
-//		return rid, false
-//	}
-//	return rid, true
-//}
-//
-//func makeVisorSummary(v *Visor) *Summary {
-//	var tpSums []*TransportSummary
-//	v.tm.WalkTransports(func(tp *transport.ManagedTransport) bool {
-//		isSetup := v.router.SetupIsTrusted(tp.Remote())
-//		tpSums = append(tpSums, newTransportSummary(v.tm, tp, true, isSetup))
-//		return true
-//	})
-//	return &Summary{
-//		PubKey:          v.conf.Visor.PubKey,
-//		BuildInfo:       buildinfo.Get(),
-//		AppProtoVersion: supportedProtocolVersion,
-//		Apps:            v.Apps(),
-//		Transports:      tpSums,
-//		RoutesCount:     v.rt.Count(),
-//	}
-//}
-//
-//func uuidFromParam(r *http.Request, key string) (uuid.UUID, error) {
-//	return uuid.Parse(chi.URLParam(r, key))
-//}
-//
-//func ridFromParam(r *http.Request, key string) (routing.RouteID, error) {
-//	rid, err := strconv.ParseUint(chi.URLParam(r, key), 10, 32)
-//	if err != nil {
-//		return 0, errors.New("invalid route ID provided")
-//	}
-//
-//	return routing.RouteID(rid), nil
-//}
-//
-//func strSliceFromQuery(r *http.Request, key string, defaultVal []string) []string {
-//	slice, ok := r.URL.Query()[key]
-//	if !ok {
-//		return defaultVal
-//	}
-//
-//	return slice
-//}
-//
-//func pkSliceFromQuery(r *http.Request, key string, defaultVal []cipher.PubKey) ([]cipher.PubKey, error) {
-//	qPKs, ok := r.URL.Query()[key]
-//	if !ok {
-//		return defaultVal, nil
-//	}
-//
-//	pks := make([]cipher.PubKey, len(qPKs))
-//
-//	for i, qPK := range qPKs {
-//		pk := cipher.PubKey{}
-//		if err := pk.UnmarshalText([]byte(qPK)); err != nil {
-//			return nil, err
-//		}
-//
-//		pks[i] = pk
-//	}
-//	return pks, nil
-//}
-//
-//func listTransports(v *Visor, in TransportsIn) ([]*TransportSummary, error) {
-//	typeIncluded := func(tType string) bool {
-//		if in.FilterTypes != nil {
-//			for _, ft := range in.FilterTypes {
-//				if tType == ft {
-//					return true
-//				}
-//			}
-//			return false
-//		}
-//		return true
-//	}
-//	pkIncluded := func(localPK, remotePK cipher.PubKey) bool {
-//		if in.FilterPubKeys != nil {
-//			for _, fpk := range in.FilterPubKeys {
-//				if localPK == fpk || remotePK == fpk {
-//					return true
-//				}
-//			}
-//			return false
-//		}
-//		return true
-//	}
-//	var tps []*TransportSummary
-//	v.tm.WalkTransports(func(tp *transport.ManagedTransport) bool {
-//		if typeIncluded(tp.Type()) && pkIncluded(v.tm.Local(), tp.Remote()) {
-//			tps = append(tps, newTransportSummary(v.tm, tp, in.ShowLogs, v.router.SetupIsTrusted(tp.Remote())))
-//		}
-//		return true
-//	})
-//	return tps, nil
-//}
+// writeResult writes v, or err with a matching status code if it's not nil.
+func (gw *Gateway) writeResult(w http.ResponseWriter, r *http.Request, v interface{}, err error) {
+	if err != nil {
+		httputil.WriteJSON(w, r, errorStatus(err), err)
+		return
+	}
+
+	httputil.WriteJSON(w, r, http.StatusOK, v)
+}
+
+// readJSON decodes the request body to v and responds with ErrMalformedRequest if that fails.
+func (gw *Gateway) readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := httputil.ReadJSON(r, v); err != nil {
+		if err != io.EOF {
+			gw.log.Warnf("%s %s request: %v", r.Method, r.URL.Path, err)
+		}
+
+		httputil.WriteJSON(w, r, http.StatusBadRequest, ErrMalformedRequest)
+
+		return false
+	}
+
+	return true
+}
+
+// app returns the state of the app named by the `app` URL parameter.
+func (gw *Gateway) app(w http.ResponseWriter, r *http.Request) (*AppState, bool) {
+	state, ok := gw.rpc.visor.App(chi.URLParam(r, "app"))
+	if !ok {
+		httputil.WriteJSON(w, r, http.StatusNotFound, ErrUnknownApp)
+		return nil, false
+	}
+
+	return state, true
+}
+
+// saveRoute saves the routing rule described by the request body.
+func (gw *Gateway) saveRoute(w http.ResponseWriter, r *http.Request) (routing.Rule, bool) {
+	var summary routing.RuleSummary
+	if !gw.readJSON(w, r, &summary) {
+		return nil, false
+	}
+
+	rule, err := summary.ToRule()
+	if err != nil {
+		httputil.WriteJSON(w, r, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	if err := gw.rpc.SaveRoutingRule(&rule, nil); err != nil {
+		httputil.WriteJSON(w, r, errorStatus(err), err)
+		return nil, false
+	}
+
+	return rule, true
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrUnknownApp), errors.Is(err, transport.ErrNotCached):
+		return http.StatusNotFound
+	case errors.Is(err, ErrNoBandwidthHistory), errors.Is(err, ErrNotImplemented):
+		return http.StatusNotImplemented
+	case errors.Is(err, transport.ErrUnknownGranularity):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func pkParam(w http.ResponseWriter, r *http.Request, key string) (cipher.PubKey, bool) {
+	var pk cipher.PubKey
+	if err := pk.UnmarshalText([]byte(chi.URLParam(r, key))); err != nil {
+		httputil.WriteJSON(w, r, http.StatusBadRequest, err)
+		return pk, false
+	}
+
+	return pk, true
+}
+
+func uuidParam(w http.ResponseWriter, r *http.Request, key string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, key))
+	if err != nil {
+		httputil.WriteJSON(w, r, http.StatusBadRequest, err)
+		return id, false
+	}
+
+	return id, true
+}
+
+func ridParam(w http.ResponseWriter, r *http.Request, key string) (routing.RouteID, bool) {
+	rid, err := strconv.ParseUint(chi.URLParam(r, key), 10, 32)
+	if err != nil {
+		httputil.WriteJSON(w, r, http.StatusBadRequest, errors.New("invalid route ID provided"))
+		return 0, false
+	}
+
+	return routing.RouteID(rid), true
+}
+
+// bandwidthRangeParam parses `from` and `to` (RFC 3339) and `granularity` query parameters to in.
+// History of the last day is queried by default.
+func bandwidthRangeParam(w http.ResponseWriter, r *http.Request, in *BandwidthHistoryIn) bool {
+	q := r.URL.Query()
+
+	fail := func(err error) bool {
+		httputil.WriteJSON(w, r, http.StatusBadRequest, err)
+		return false
+	}
+
+	var err error
+
+	in.To = time.Now()
+	if v := q.Get("to"); v != "" {
+		if in.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return fail(fmt.Errorf("invalid 'to' query parameter: %w", err))
+		}
+	}
+
+	in.From = in.To.Add(-24 * time.Hour)
+	if v := q.Get("from"); v != "" {
+		if in.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return fail(fmt.Errorf("invalid 'from' query parameter: %w", err))
+		}
+	}
+
+	if !in.From.Before(in.To) {
+		return fail(errors.New("'from' should be before 'to'"))
+	}
+
+	in.Granularity = transport.Granularity(q.Get("granularity"))
+	if in.Granularity != "" && in.Granularity.Interval() == 0 {
+		return fail(transport.ErrUnknownGranularity)
+	}
+
+	return true
+}
+
+func strSliceFromQuery(r *http.Request, key string, defaultVal []string) []string {
+	slice, ok := r.URL.Query()[key]
+	if !ok {
+		return defaultVal
+	}
+
+	return slice
+}
+
+func pkSliceFromQuery(r *http.Request, key string, defaultVal []cipher.PubKey) ([]cipher.PubKey, error) {
+	qPKs, ok := r.URL.Query()[key]
+	if !ok {
+		return defaultVal, nil
+	}
+
+	pks := make([]cipher.PubKey, len(qPKs))
+
+	for i, qPK := range qPKs {
+		pk := cipher.PubKey{}
+		if err := pk.UnmarshalText([]byte(qPK)); err != nil {
+			return nil, err
+		}
+
+		pks[i] = pk
+	}
+
+	return pks, nil
+}
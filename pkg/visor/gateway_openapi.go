@@ -0,0 +1,445 @@
+package visor
+
+// openAPISpec is the OpenAPI document describing the endpoints of Gateway. It's served at /api/openapi.json.
+const openAPISpec = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "Skywire visor API",
+    "description": "Local HTTP API of a skywire visor. Endpoints mirror the methods of the visor RPC.",
+    "version": "0.1.0"
+  },
+  "servers": [{"url": "/api"}],
+  "security": [{"token": []}],
+  "paths": {
+    "/openapi.json": {
+      "get": {
+        "summary": "This document.",
+        "security": [],
+        "responses": {"200": {"description": "OpenAPI document.", "content": {"application/json": {}}}}
+      }
+    },
+    "/health": {
+      "get": {
+        "summary": "Health of external services, represented as HTTP status codes.",
+        "responses": {"200": {"$ref": "#/components/responses/HealthInfo"}, "401": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/uptime": {
+      "get": {
+        "summary": "Time the visor has been running for, in seconds.",
+        "responses": {"200": {"description": "Uptime.", "content": {"application/json": {"schema": {"type": "number"}}}}, "401": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/summary": {
+      "get": {
+        "summary": "Summary of the visor.",
+        "responses": {"200": {"description": "Summary.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Summary"}}}}, "401": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/apps": {
+      "get": {
+        "summary": "Apps of the visor.",
+        "responses": {"200": {"description": "Apps.", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/AppState"}}}}}, "401": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/apps/{app}": {
+      "parameters": [{"$ref": "#/components/parameters/app"}],
+      "get": {
+        "summary": "State of an app.",
+        "responses": {"200": {"$ref": "#/components/responses/AppState"}, "404": {"$ref": "#/components/responses/Error"}}
+      },
+      "put": {
+        "summary": "Changes settings of an app, starts or stops it.",
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {
+            "type": "object",
+            "properties": {
+              "autostart": {"type": "boolean"},
+              "status": {"type": "integer", "enum": [0, 1], "description": "0 stops the app, 1 starts it."},
+              "passcode": {"type": "string", "description": "Password of skysocks."},
+              "pk": {"$ref": "#/components/schemas/PubKey", "description": "Server public key of skysocks-client."}
+            }
+          }}}
+        },
+        "responses": {"200": {"$ref": "#/components/responses/AppState"}, "400": {"$ref": "#/components/responses/Error"}, "404": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/apps/{app}/logs": {
+      "parameters": [
+        {"$ref": "#/components/parameters/app"},
+        {"name": "since", "in": "query", "description": "Only return logs since this RFC 3339 timestamp.", "schema": {"type": "string", "format": "date-time"}}
+      ],
+      "get": {
+        "summary": "Logs of an app.",
+        "responses": {
+          "200": {"description": "Logs.", "content": {"application/json": {"schema": {
+            "type": "object",
+            "properties": {"last_log_timestamp": {"type": "string"}, "logs": {"type": "array", "items": {"type": "string"}}}
+          }}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/transport-types": {
+      "get": {
+        "summary": "Supported transport types.",
+        "responses": {"200": {"description": "Transport types.", "content": {"application/json": {"schema": {"type": "array", "items": {"type": "string"}}}}}, "401": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/transports": {
+      "get": {
+        "summary": "Transports of the visor.",
+        "parameters": [
+          {"name": "type", "in": "query", "description": "Only return transports of these types.", "schema": {"type": "array", "items": {"type": "string"}}},
+          {"name": "pk", "in": "query", "description": "Only return transports to these visors.", "schema": {"type": "array", "items": {"$ref": "#/components/schemas/PubKey"}}},
+          {"name": "logs", "in": "query", "description": "Include transport logs.", "schema": {"type": "boolean", "default": true}}
+        ],
+        "responses": {"200": {"description": "Transports.", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/TransportSummary"}}}}}, "400": {"$ref": "#/components/responses/Error"}}
+      },
+      "post": {
+        "summary": "Creates a transport.",
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {
+            "type": "object",
+            "properties": {
+              "transport_type": {"type": "string"},
+              "remote_pk": {"$ref": "#/components/schemas/PubKey"},
+              "public": {"type": "boolean"}
+            }
+          }}}
+        },
+        "responses": {"200": {"$ref": "#/components/responses/TransportSummary"}, "400": {"$ref": "#/components/responses/Error"}, "500": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/transports/{tid}": {
+      "parameters": [{"$ref": "#/components/parameters/tid"}],
+      "get": {
+        "summary": "A transport.",
+        "responses": {"200": {"$ref": "#/components/responses/TransportSummary"}, "404": {"$ref": "#/components/responses/Error"}}
+      },
+      "delete": {
+        "summary": "Removes a transport.",
+        "responses": {"200": {"$ref": "#/components/responses/OK"}, "404": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/transports/{tid}/bandwidth": {
+      "parameters": [
+        {"$ref": "#/components/parameters/tid"},
+        {"$ref": "#/components/parameters/from"},
+        {"$ref": "#/components/parameters/to"},
+        {"$ref": "#/components/parameters/granularity"}
+      ],
+      "get": {
+        "summary": "Bandwidth history of a transport. Transports which no longer exist can be queried as well.",
+        "responses": {"200": {"$ref": "#/components/responses/BandwidthRecords"}, "400": {"$ref": "#/components/responses/Error"}, "501": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/bandwidth/{remote}": {
+      "parameters": [
+        {"name": "remote", "in": "path", "required": true, "schema": {"$ref": "#/components/schemas/PubKey"}},
+        {"$ref": "#/components/parameters/from"},
+        {"$ref": "#/components/parameters/to"},
+        {"$ref": "#/components/parameters/granularity"}
+      ],
+      "get": {
+        "summary": "Bandwidth history of transports of all types to a remote visor, summed up.",
+        "responses": {"200": {"$ref": "#/components/responses/BandwidthRecords"}, "400": {"$ref": "#/components/responses/Error"}, "501": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/bandwidth-limits": {
+      "get": {
+        "summary": "Limits of traffic forwarded by the router.",
+        "responses": {"200": {"$ref": "#/components/responses/BandwidthLimits"}, "401": {"$ref": "#/components/responses/Error"}}
+      },
+      "put": {
+        "summary": "Replaces limits of traffic forwarded by the router and saves them to config.",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/BandwidthLimits"}}}},
+        "responses": {"200": {"$ref": "#/components/responses/BandwidthLimits"}, "400": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/discovery/edges/{pk}": {
+      "parameters": [{"$ref": "#/components/parameters/pk"}],
+      "get": {
+        "summary": "Transports of a visor registered in transport discovery.",
+        "responses": {"200": {"description": "Entries.", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/EntryWithStatus"}}}}}, "500": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/discovery/transports/{tid}": {
+      "parameters": [{"$ref": "#/components/parameters/tid"}],
+      "get": {
+        "summary": "A transport registered in transport discovery.",
+        "responses": {"200": {"description": "Entry.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/EntryWithStatus"}}}}, "404": {"$ref": "#/components/responses/Error"}, "500": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/routes": {
+      "get": {
+        "summary": "Rules of the routing table.",
+        "parameters": [{"name": "summary", "in": "query", "description": "Include rule summaries.", "schema": {"type": "boolean", "default": false}}],
+        "responses": {"200": {"description": "Rules.", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/RoutingRule"}}}}}, "400": {"$ref": "#/components/responses/Error"}}
+      },
+      "post": {
+        "summary": "Saves a routing rule.",
+        "requestBody": {"$ref": "#/components/requestBodies/RuleSummary"},
+        "responses": {"200": {"$ref": "#/components/responses/RoutingRule"}, "400": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/routes/{rid}": {
+      "parameters": [{"$ref": "#/components/parameters/rid"}],
+      "get": {
+        "summary": "A routing rule.",
+        "parameters": [{"name": "summary", "in": "query", "description": "Include the rule summary.", "schema": {"type": "boolean", "default": true}}],
+        "responses": {"200": {"$ref": "#/components/responses/RoutingRule"}, "404": {"$ref": "#/components/responses/Error"}}
+      },
+      "put": {
+        "summary": "Saves a routing rule.",
+        "requestBody": {"$ref": "#/components/requestBodies/RuleSummary"},
+        "responses": {"200": {"$ref": "#/components/responses/RoutingRule"}, "400": {"$ref": "#/components/responses/Error"}}
+      },
+      "delete": {
+        "summary": "Removes a routing rule.",
+        "responses": {"200": {"$ref": "#/components/responses/OK"}, "400": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/routes/{rid}/trace": {
+      "parameters": [{"$ref": "#/components/parameters/rid"}],
+      "get": {
+        "summary": "Round trip times to the visors of the route group with the given edge route.",
+        "responses": {
+          "200": {"description": "Hops.", "content": {"application/json": {"schema": {"type": "array", "items": {
+            "type": "object",
+            "properties": {"pk": {"$ref": "#/components/schemas/PubKey"}, "rtt": {"type": "integer", "description": "Nanoseconds."}}
+          }}}}},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/routegroups": {
+      "get": {
+        "summary": "Route groups of the visor.",
+        "responses": {
+          "200": {"description": "Route groups.", "content": {"application/json": {"schema": {"type": "array", "items": {
+            "type": "object",
+            "properties": {"consume_rule": {"$ref": "#/components/schemas/RuleSummary"}, "fwd_rule": {"$ref": "#/components/schemas/RuleSummary"}}
+          }}}}},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/ping/{pk}": {
+      "parameters": [{"$ref": "#/components/parameters/pk"}],
+      "get": {
+        "summary": "Round trip time to a remote visor via an established route group.",
+        "responses": {
+          "200": {"description": "Round trip time.", "content": {"application/json": {"schema": {"type": "object", "properties": {"rtt": {"type": "string", "example": "12.5ms"}}}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/events": {
+      "get": {
+        "summary": "Retained events which happened after the event of sequence number 'since'. If there are none, waits for them for up to 'timeout'.",
+        "parameters": [
+          {"name": "since", "in": "query", "description": "Sequence number of the last event the caller got.", "schema": {"type": "integer", "default": 0}},
+          {"name": "type", "in": "query", "description": "Only return events of these types.", "schema": {"type": "array", "items": {"$ref": "#/components/schemas/EventType"}}},
+          {"name": "timeout", "in": "query", "description": "Time to wait for events, up to a minute.", "schema": {"type": "string", "example": "30s", "default": "0s"}}
+        ],
+        "responses": {
+          "200": {"description": "Events, oldest first.", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Event"}}}}},
+          "400": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/restart": {
+      "post": {
+        "summary": "Restarts the visor.",
+        "responses": {"200": {"$ref": "#/components/responses/OK"}, "500": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/reload-config": {
+      "post": {
+        "summary": "Reads the config file again and applies changes which don't require a restart.",
+        "responses": {
+          "200": {"description": "Applied changes.", "content": {"application/json": {"schema": {
+            "type": "object",
+            "properties": {
+              "applied": {"type": "array", "items": {"type": "string"}},
+              "restart_required": {"type": "array", "items": {"type": "string"}},
+              "started_apps": {"type": "array", "items": {"type": "string"}},
+              "stopped_apps": {"type": "array", "items": {"type": "string"}},
+              "restarted_apps": {"type": "array", "items": {"type": "string"}},
+              "errors": {"type": "array", "items": {"type": "string"}}
+            }
+          }}}},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/exec": {
+      "post": {
+        "summary": "Executes a command on the visor's host.",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object", "properties": {"command": {"type": "string"}}}}}},
+        "responses": {
+          "200": {"description": "Command output.", "content": {"application/json": {"schema": {"type": "object", "properties": {"output": {"type": "string"}}}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/update": {
+      "post": {
+        "summary": "Updates the visor.",
+        "responses": {
+          "200": {"description": "Whether the visor was updated.", "content": {"application/json": {"schema": {"type": "object", "properties": {"updated": {"type": "boolean"}}}}}},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/update/available": {
+      "get": {
+        "summary": "Checks if a visor update is available.",
+        "responses": {
+          "200": {"description": "Available update.", "content": {"application/json": {"schema": {
+            "type": "object",
+            "properties": {"available": {"type": "boolean"}, "current_version": {"type": "string"}, "available_version": {"type": "string"}}
+          }}}},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    }
+  },
+  "components": {
+    "securitySchemes": {
+      "token": {"type": "http", "scheme": "bearer", "description": "interfaces.http_token of the visor config."}
+    },
+    "parameters": {
+      "app": {"name": "app", "in": "path", "required": true, "schema": {"type": "string"}},
+      "pk": {"name": "pk", "in": "path", "required": true, "schema": {"$ref": "#/components/schemas/PubKey"}},
+      "tid": {"name": "tid", "in": "path", "required": true, "schema": {"type": "string", "format": "uuid"}},
+      "rid": {"name": "rid", "in": "path", "required": true, "schema": {"type": "integer", "format": "uint32"}},
+      "from": {"name": "from", "in": "query", "description": "Defaults to a day before 'to'.", "schema": {"type": "string", "format": "date-time"}},
+      "to": {"name": "to", "in": "query", "description": "Defaults to now.", "schema": {"type": "string", "format": "date-time"}},
+      "granularity": {"name": "granularity", "in": "query", "description": "Defaults to the finest granularity retained since 'from'.", "schema": {"type": "string", "enum": ["minute", "hour", "day"]}}
+    },
+    "requestBodies": {
+      "RuleSummary": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/RuleSummary"}}}}
+    },
+    "responses": {
+      "OK": {"description": "Success.", "content": {"application/json": {"schema": {"type": "boolean"}}}},
+      "Error": {"description": "Error.", "content": {"application/json": {"schema": {"type": "object", "properties": {"error": {"type": "string"}}}}}},
+      "HealthInfo": {"description": "Health.", "content": {"application/json": {"schema": {
+        "type": "object",
+        "properties": {"transport_discovery": {"type": "integer"}, "route_finder": {"type": "integer"}, "setup_node": {"type": "integer"}}
+      }}}},
+      "AppState": {"description": "App state.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/AppState"}}}},
+      "TransportSummary": {"description": "Transport.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/TransportSummary"}}}},
+      "BandwidthRecords": {"description": "Bandwidth history.", "content": {"application/json": {"schema": {"type": "array", "items": {
+        "type": "object",
+        "properties": {"time": {"type": "string", "format": "date-time"}, "recv": {"type": "integer"}, "sent": {"type": "integer"}}
+      }}}}},
+      "BandwidthLimits": {"description": "Bandwidth limits.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/BandwidthLimits"}}}},
+      "RoutingRule": {"description": "Routing rule.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/RoutingRule"}}}}
+    },
+    "schemas": {
+      "PubKey": {"type": "string", "description": "Hex encoded public key.", "pattern": "^[0-9a-f]{66}$"},
+      "EventType": {"type": "string", "enum": [
+        "transport_created", "transport_deleted", "transport_up", "transport_down",
+        "route_group_opened", "route_group_closed",
+        "app_started", "app_stopped", "app_crashed", "app_restarting",
+        "update_started", "update_finished", "update_failed"
+      ]},
+      "Event": {
+        "type": "object",
+        "properties": {
+          "seq": {"type": "integer", "description": "Increases by one with every event."},
+          "time": {"type": "string", "format": "date-time"},
+          "type": {"$ref": "#/components/schemas/EventType"},
+          "params": {"type": "object", "additionalProperties": {"type": "string"}}
+        }
+      },
+      "AppState": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string"},
+          "autostart": {"type": "boolean"},
+          "port": {"type": "integer"},
+          "status": {"type": "integer", "enum": [0, 1], "description": "0 is stopped, 1 is running."},
+          "restarts": {"type": "integer", "description": "Restarts since the app was last started by the visor or a user."},
+          "last_exit_code": {"type": "integer", "description": "Exit code of the last run, -1 if the app was killed by a signal or failed to run."},
+          "usage": {
+            "type": "object",
+            "description": "Resources used by the running app, if supported.",
+            "properties": {
+              "memory": {"type": "integer", "description": "Memory in use in bytes."},
+              "cpu_time": {"type": "integer", "description": "User and system CPU time in nanoseconds."}
+            }
+          }
+        }
+      },
+      "TransportSummary": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "string", "format": "uuid"},
+          "local_pk": {"$ref": "#/components/schemas/PubKey"},
+          "remote_pk": {"$ref": "#/components/schemas/PubKey"},
+          "type": {"type": "string"},
+          "log": {"type": "object", "properties": {"recv": {"type": "integer"}, "sent": {"type": "integer"}}},
+          "link_stats": {"type": "object"},
+          "is_setup": {"type": "boolean"}
+        }
+      },
+      "Summary": {
+        "type": "object",
+        "properties": {
+          "local_pk": {"$ref": "#/components/schemas/PubKey"},
+          "build_info": {"type": "object", "properties": {"version": {"type": "string"}, "commit": {"type": "string"}, "date": {"type": "string"}}},
+          "app_protocol_version": {"type": "string"},
+          "apps": {"type": "array", "items": {"$ref": "#/components/schemas/AppState"}},
+          "transports": {"type": "array", "items": {"$ref": "#/components/schemas/TransportSummary"}},
+          "routes_count": {"type": "integer"}
+        }
+      },
+      "EntryWithStatus": {
+        "type": "object",
+        "properties": {
+          "entry": {"type": "object"},
+          "is_up": {"type": "boolean"},
+          "registered": {"type": "integer"},
+          "statuses": {"type": "array", "items": {"type": "boolean"}},
+          "link_stats": {"type": "object"},
+          "stale": {"type": "boolean", "description": "Taken from the local cache of transport discovery."}
+        }
+      },
+      "BandwidthLimits": {
+        "type": "object",
+        "description": "Limits in bytes per second.",
+        "properties": {
+          "forwarded": {"type": "integer"},
+          "pub_keys": {"type": "object", "additionalProperties": {"type": "integer"}},
+          "routes": {"type": "array", "items": {"type": "object"}}
+        }
+      },
+      "RuleSummary": {
+        "type": "object",
+        "properties": {
+          "keep_alive": {"type": "integer", "description": "Nanoseconds."},
+          "rule_type": {"type": "integer"},
+          "key_route_id": {"type": "integer"},
+          "app_fields": {"type": "object"},
+          "forward_fields": {"type": "object"},
+          "intermediary_forward_fields": {"type": "object"}
+        }
+      },
+      "RoutingRule": {
+        "type": "object",
+        "properties": {
+          "key": {"type": "integer"},
+          "rule": {"type": "string", "description": "Hex encoded rule."},
+          "rule_summary": {"$ref": "#/components/schemas/RuleSummary"}
+        }
+      }
+    }
+  }
+}
+`
@@ -0,0 +1,115 @@
+package visor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/app/appcommon"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/app/appserver"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/router"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/routing"
+)
+
+func TestGateway(t *testing.T) {
+	const token = "secret"
+
+	localPK, _ := cipher.GenerateKeyPair()
+	remotePK, _ := cipher.GenerateKeyPair()
+
+	rule := routing.ConsumeRule(router.DefaultRouteKeepAlive, 3, remotePK, localPK, 2, 1)
+
+	r := &router.MockRouter{}
+	r.On("Rules").Return([]routing.Rule{rule})
+	rtt := 10 * time.Millisecond
+	r.On("TraceRoute", mock.Anything /* context */, routing.RouteID(3)).
+		Return([]router.HopRTT{{PK: remotePK, RTT: &rtt}}, nil)
+
+	pm := &appserver.MockProcManager{}
+	pm.On("Exists", "foo").Return(true)
+	pm.On("Usage", "foo").Return(appcommon.ResourceUsage{Memory: 1 << 20, CPUTime: time.Second}, nil)
+
+	visor := &Visor{
+		router:      r,
+		procManager: pm,
+		appsConf:    map[string]AppConfig{"foo": {App: "foo", AutoStart: true, Port: 10}},
+		Logger:      logging.NewMasterLogger(),
+	}
+
+	gw := NewGateway(visor, token)
+
+	do := func(method, path, auth, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+
+		w := httptest.NewRecorder()
+		gw.ServeHTTP(w, req)
+
+		return w
+	}
+
+	t.Run("openapi document covers all endpoints", func(t *testing.T) {
+		w := do(http.MethodGet, "/api/openapi.json", "", "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var spec struct {
+			Paths map[string]map[string]json.RawMessage `json:"paths"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &spec))
+
+		walk := func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+			path := strings.TrimPrefix(strings.Replace(route, "/*", "", 1), "/api")
+			assert.Contains(t, spec.Paths[path], strings.ToLower(method), "%s %s is not documented", method, route)
+			return nil
+		}
+		require.NoError(t, chi.Walk(gw.handler.(chi.Routes), walk))
+	})
+
+	t.Run("token is required", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/apps", "", "").Code)
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/apps", "Bearer wrong", "").Code)
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/apps", token, "").Code)
+		assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/apps", "Bearer "+token, "").Code)
+	})
+
+	t.Run("apps", func(t *testing.T) {
+		w := do(http.MethodGet, "/api/apps/foo", "Bearer "+token, "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var state AppState
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &state))
+		assert.Equal(t, AppState{
+			Name:      "foo",
+			AutoStart: true,
+			Port:      10,
+			Status:    AppStatusRunning,
+			Usage:     &appcommon.ResourceUsage{Memory: 1 << 20, CPUTime: time.Second},
+		}, state)
+
+		assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/apps/bar", "Bearer "+token, "").Code)
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/api/apps/foo", "Bearer "+token, `{"status":2}`).Code)
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/api/apps/foo", "Bearer "+token, `{"unknown":1}`).Code)
+	})
+
+	t.Run("ping", func(t *testing.T) {
+		w := do(http.MethodGet, "/api/ping/"+remotePK.Hex(), "Bearer "+token, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"rtt":"10ms"}`, w.Body.String())
+
+		otherPK, _ := cipher.GenerateKeyPair()
+		assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/ping/"+otherPK.Hex(), "Bearer "+token, "").Code)
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/api/ping/invalid", "Bearer "+token, "").Code)
+	})
+}
@@ -0,0 +1,422 @@
+package visor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"github.com/google/uuid"
+
+	"github.com/SkycoinProject/skywire-mainnet/pkg/restart"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/router"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/skyenv"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/transport"
+)
+
+// ConfigReload describes what changed on a config reload.
+// Config fields are named after their JSON keys, nested ones are joined with dots.
+type ConfigReload struct {
+	Applied         []string `json:"applied"`          // changed fields which were applied
+	RestartRequired []string `json:"restart_required"` // changed fields which take effect after a restart
+	StartedApps     []string `json:"started_apps,omitempty"`
+	StoppedApps     []string `json:"stopped_apps,omitempty"`
+	RestartedApps   []string `json:"restarted_apps,omitempty"`
+	Errors          []string `json:"errors,omitempty"` // failures to apply changes
+}
+
+func (cr *ConfigReload) applied(field string) {
+	cr.Applied = append(cr.Applied, field)
+}
+
+func (cr *ConfigReload) failed(field string, err error) {
+	cr.Errors = append(cr.Errors, fmt.Sprintf("%s: %v", field, err))
+}
+
+// ReloadConfig reads the config file of the visor again and applies changes which don't require a restart:
+// apps are started, stopped or restarted if their configs changed, the log level, trusted visors, hypervisors,
+// transport discovery, route finder, setup nodes and bandwidth limits are updated.
+// Changes of other fields are reported in ConfigReload.RestartRequired.
+func (visor *Visor) ReloadConfig() (*ConfigReload, error) {
+	path := visor.config().Path
+	if path == nil {
+		return nil, ErrNoConfigPath
+	}
+
+	conf, err := ReadConfig(*path)
+	if err != nil {
+		return nil, err
+	}
+
+	return visor.applyConfig(conf), nil
+}
+
+// applyConfig applies the changes of `conf` against the current config and takes it as the current one,
+// so `conf` must not be modified afterwards. The current config is replaced rather than modified,
+// as it's read concurrently. The key pair, the app server address and the apps cgroup of the running
+// visor are kept.
+func (visor *Visor) applyConfig(conf *Config) *ConfigReload {
+	visor.reloadMu.Lock()
+	defer visor.reloadMu.Unlock()
+
+	if conf.Transport == nil {
+		conf.Transport = DefaultTransportConfig()
+	}
+
+	if conf.Routing == nil {
+		conf.Routing = DefaultRoutingConfig()
+	}
+
+	if conf.Routing.Table == nil {
+		conf.Routing.Table = DefaultRoutingTableConfig()
+	}
+
+	old := visor.config()
+	res := &ConfigReload{}
+
+	oldTp := old.Transport
+	if oldTp == nil {
+		oldTp = DefaultTransportConfig()
+	}
+
+	newTp := conf.Transport
+
+	changed := func(a, b interface{}) bool {
+		return !reflect.DeepEqual(a, b)
+	}
+
+	restartRequired := []struct {
+		field string
+		a, b  interface{}
+	}{
+		{"key_pair", old.KeyPair, conf.KeyPair},
+		{"dmsg", old.Dmsg, conf.Dmsg},
+		{"dmsg_pty", old.DmsgPty, conf.DmsgPty},
+		{"stcp", old.STCP, conf.STCP},
+		{"sudp", old.SUDP, conf.SUDP},
+		{"sudph", old.SUDPH, conf.SUDPH},
+		{"networks", old.Networks, conf.Networks},
+		{"transport.log_store", oldTp.LogStore, newTp.LogStore},
+		{"transport.report_link_stats", oldTp.ReportLinkStats, newTp.ReportLinkStats},
+		{"transport.auto_connect", oldTp.AutoConnect, newTp.AutoConnect},
+		{"routing.table", old.RoutingConfig().Table, conf.Routing.Table},
+		{"routing.disable_encryption", old.RoutingConfig().DisableEncryption, conf.Routing.DisableEncryption},
+		{"uptime_tracker", old.UptimeTracker, conf.UptimeTracker},
+		{"apps_cgroup", old.AppsCgroup, conf.AppsCgroup},
+		{"apps_path", old.AppsPath, conf.AppsPath},
+		{"local_path", old.LocalPath, conf.LocalPath},
+		{"interfaces", old.Interfaces, conf.Interfaces},
+		{"app_server_addr", old.AppServerAddr, conf.AppServerAddr},
+	}
+
+	for _, f := range restartRequired {
+		if changed(f.a, f.b) {
+			res.RestartRequired = append(res.RestartRequired, f.field)
+		}
+	}
+
+	if changed(old.LogLevel, conf.LogLevel) {
+		if lvl, err := logging.LevelFromString(conf.LogLevel); err != nil {
+			res.failed("log_level", err)
+		} else {
+			if visor.Logger != nil {
+				visor.Logger.SetLevel(lvl)
+			}
+
+			res.applied("log_level")
+		}
+	}
+
+	if changed(old.RestartCheckDelay, conf.RestartCheckDelay) {
+		delay := restart.DefaultCheckDelay
+
+		var err error
+		if conf.RestartCheckDelay != "" {
+			delay, err = time.ParseDuration(conf.RestartCheckDelay)
+		}
+
+		if err != nil {
+			res.failed("restart_check_delay", err)
+		} else {
+			if visor.restartCtx != nil {
+				visor.restartCtx.SetCheckDelay(delay)
+			}
+
+			res.applied("restart_check_delay")
+		}
+	}
+
+	if changed(old.ShutdownTimeout, conf.ShutdownTimeout) {
+		res.applied("shutdown_timeout")
+	}
+
+	if changed(old.TrustedVisors, conf.TrustedVisors) {
+		res.applied("trusted_visors")
+	}
+
+	if changed(old.Hypervisors, conf.Hypervisors) {
+		visor.reloadHypervisors(conf.Hypervisors)
+		res.applied("hypervisors")
+	}
+
+	if changed(oldTp.Discovery, newTp.Discovery) || changed(oldTp.Cache, newTp.Cache) {
+		if err := visor.reloadTransportDiscovery(conf); err != nil {
+			res.failed("transport.discovery", err)
+		} else {
+			res.applied("transport.discovery")
+		}
+	}
+
+	oldR, newR := old.RoutingConfig(), conf.Routing
+	if changed(oldR.SetupNodes, newR.SetupNodes) {
+		visor.router.SetSetupNodes(newR.SetupNodes)
+		res.applied("routing.setup_nodes")
+	}
+
+	if changed(oldR.RouteFinder, newR.RouteFinder) ||
+		changed(oldR.RouteFinderTimeout, newR.RouteFinderTimeout) ||
+		changed(oldR.DisableLocalRouteFinder, newR.DisableLocalRouteFinder) {
+		visor.router.SetRouteFinder(conf.RouteFinder(visor.tm))
+		res.applied("routing.route_finder")
+	}
+
+	if changed(oldR.BandwidthLimits, newR.BandwidthLimits) {
+		var limits router.BandwidthLimits
+		if newR.BandwidthLimits != nil {
+			limits = *newR.BandwidthLimits
+		}
+
+		visor.router.SetBandwidthLimits(limits)
+
+		res.applied("routing.bandwidth_limits")
+	}
+
+	if changed(old.Apps, conf.Apps) {
+		if _, err := conf.AppsConfig(); err != nil {
+			res.failed("apps", err)
+			conf.Apps = old.Apps
+		} else {
+			visor.reloadApps(conf.Apps, res)
+			res.applied("apps")
+		}
+	}
+
+	conf.Path = old.Path
+	conf.log = old.log
+	conf.KeyPair = old.KeyPair
+	conf.AppServerAddr = old.AppServerAddr
+	conf.AppsCgroup = old.AppsCgroup
+
+	visor.setConfig(conf)
+
+	visor.logger.
+		WithField("applied", res.Applied).
+		WithField("restart_required", res.RestartRequired).
+		WithField("errors", res.Errors).
+		Info("Reloaded config.")
+
+	return res
+}
+
+// reloadApps starts, stops and restarts apps according to their new configs.
+// Running apps are restarted if their configs changed other than in AutoStart and Restart, and stopped if they were
+// removed. Changed restart policies apply to running apps once they exit.
+// Apps which weren't auto-started before are started if they are now.
+func (visor *Visor) reloadApps(apps []AppConfig, res *ConfigReload) {
+	newConf := make(map[string]AppConfig, len(apps))
+	for _, ac := range apps {
+		newConf[ac.App] = ac
+	}
+
+	visor.appsMu.Lock()
+	oldConf := visor.appsConf
+	visor.appsConf = newConf
+	visor.appsMu.Unlock()
+
+	for _, name := range sortedAppNames(oldConf) {
+		if _, ok := newConf[name]; ok || !visor.procManager.Exists(name) {
+			continue
+		}
+
+		if err := visor.StopApp(name); err != nil {
+			res.failed("apps."+name, err)
+			continue
+		}
+
+		res.StoppedApps = append(res.StoppedApps, name)
+	}
+
+	for _, name := range sortedAppNames(newConf) {
+		ac := newConf[name]
+		prev, existed := oldConf[name]
+		running := visor.procManager.Exists(name)
+
+		prev.AutoStart = ac.AutoStart
+		prev.Restart = ac.Restart
+
+		switch {
+		case running && !reflect.DeepEqual(prev, ac):
+			if err := visor.RestartApp(name); err != nil {
+				res.failed("apps."+name, err)
+				continue
+			}
+
+			res.RestartedApps = append(res.RestartedApps, name)
+
+		case !running && ac.AutoStart && (!existed || !oldConf[name].AutoStart):
+			if err := visor.StartApp(name); err != nil {
+				res.failed("apps."+name, err)
+				continue
+			}
+
+			res.StartedApps = append(res.StartedApps, name)
+		}
+	}
+}
+
+func sortedAppNames(apps map[string]AppConfig) []string {
+	names := make([]string, 0, len(apps))
+	for name := range apps {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// reloadHypervisors stops serving removed hypervisors and starts serving added ones.
+// If the visor is not started yet, added hypervisors are served once it's started.
+func (visor *Visor) reloadHypervisors(hvs []HypervisorConfig) {
+	keep := make(map[cipher.PubKey]struct{}, len(hvs))
+	for _, hv := range hvs {
+		keep[hv.PubKey] = struct{}{}
+	}
+
+	for hvPK := range visor.hvErrs {
+		if _, ok := keep[hvPK]; ok {
+			continue
+		}
+
+		if cancel, ok := visor.hvCancels[hvPK]; ok {
+			cancel()
+			delete(visor.hvCancels, hvPK)
+		}
+
+		delete(visor.hvErrs, hvPK)
+		visor.logger.WithField("hypervisor_pk", hvPK).Info("Stopped serving removed hypervisor.")
+	}
+
+	for hvPK := range keep {
+		if _, ok := visor.hvErrs[hvPK]; ok {
+			continue
+		}
+
+		errCh := make(chan error, 1)
+		visor.hvErrs[hvPK] = errCh
+
+		if visor.rpcCtx != nil {
+			visor.serveHypervisor(visor.rpcCtx, hvPK, errCh)
+		}
+	}
+}
+
+// serveHypervisor serves RPC to the hypervisor of `hvPK` until `ctx` is done or the hypervisor is removed.
+// visor.reloadMu has to be locked.
+func (visor *Visor) serveHypervisor(ctx context.Context, hvPK cipher.PubKey, errCh chan error) {
+	log := visor.Logger.PackageLogger("hypervisor_client").
+		WithField("hypervisor_pk", hvPK)
+
+	addr := dmsg.Addr{PK: hvPK, Port: skyenv.DmsgHypervisorPort}
+
+	rpcS, err := newRPCServer(visor, addr.PK.String()[:shortHashLen])
+	if err != nil {
+		visor.logger.WithError(err).Errorf("Failed to start RPC server")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	visor.hvCancels[hvPK] = cancel
+
+	go ServeRPCClient(ctx, log, visor.n, rpcS, addr, errCh)
+}
+
+// reloadTransportDiscovery replaces the transport discovery client with one made from `conf`.
+func (visor *Visor) reloadTransportDiscovery(conf *Config) error {
+	sd, ok := visor.tm.Conf.DiscoveryClient.(*switchableDiscovery)
+	if !ok {
+		return fmt.Errorf("transport discovery client can't be replaced")
+	}
+
+	dc, err := conf.CachedTransportDiscovery()
+	if err != nil {
+		return err
+	}
+
+	if c, ok := sd.swap(dc).(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			visor.logger.WithError(err).Warn("Failed to close previous transport discovery client.")
+		}
+	}
+
+	return nil
+}
+
+// switchableDiscovery is a transport discovery client which may be replaced while it's in use.
+type switchableDiscovery struct {
+	mu sync.RWMutex
+	dc transport.DiscoveryClient
+}
+
+func (d *switchableDiscovery) get() transport.DiscoveryClient {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.dc
+}
+
+// swap replaces the client and returns the previous one.
+func (d *switchableDiscovery) swap(dc transport.DiscoveryClient) transport.DiscoveryClient {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	prev := d.dc
+	d.dc = dc
+
+	return prev
+}
+
+func (d *switchableDiscovery) RegisterTransports(ctx context.Context, entries ...*transport.SignedEntry) error {
+	return d.get().RegisterTransports(ctx, entries...)
+}
+
+func (d *switchableDiscovery) GetTransportByID(ctx context.Context, id uuid.UUID) (*transport.EntryWithStatus, error) {
+	return d.get().GetTransportByID(ctx, id)
+}
+
+func (d *switchableDiscovery) GetTransportsByEdge(ctx context.Context, pk cipher.PubKey) ([]*transport.EntryWithStatus, error) {
+	return d.get().GetTransportsByEdge(ctx, pk)
+}
+
+func (d *switchableDiscovery) DeleteTransport(ctx context.Context, id uuid.UUID) error {
+	return d.get().DeleteTransport(ctx, id)
+}
+
+func (d *switchableDiscovery) UpdateStatuses(ctx context.Context, statuses ...*transport.Status) ([]*transport.EntryWithStatus, error) {
+	return d.get().UpdateStatuses(ctx, statuses...)
+}
+
+// Close closes the current client if it's an io.Closer.
+func (d *switchableDiscovery) Close() error {
+	if c, ok := d.get().(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
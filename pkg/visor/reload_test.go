@@ -0,0 +1,237 @@
+package visor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/skywire-mainnet/internal/testhelpers"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/app/appcommon"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/app/appserver"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/router"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/transport"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/util/pathutil"
+)
+
+func TestVisor_ReloadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "visor_reload")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+
+	setupPK, _ := cipher.GenerateKeyPair()
+	hvPK, _ := cipher.GenerateKeyPair()
+
+	oldConf := &Config{
+		KeyPair:       NewKeyPair(),
+		AppServerAddr: appcommon.DefaultServerAddr,
+		Transport:     DefaultTransportConfig(),
+		Routing:       DefaultRoutingConfig(),
+		Hypervisors:   []HypervisorConfig{{PubKey: hvPK}},
+		LogLevel:      "info",
+		Apps: []AppConfig{
+			{App: "restarted", AutoStart: true, Port: 10},
+			{App: "removed", AutoStart: true, Port: 11},
+			{App: "started", AutoStart: false, Port: 12},
+			{App: "unchanged", AutoStart: true, Port: 13},
+		},
+	}
+	oldConf.Routing.Table = DefaultRoutingTableConfig()
+	oldConf.Transport.Cache = ""
+
+	path := filepath.Join(dir, "config.json")
+	oldConf.Path = &path
+	oldConf.log = logging.MustGetLogger("test")
+
+	appsConf, err := oldConf.AppsConfig()
+	require.NoError(t, err)
+
+	r := &router.MockRouter{}
+	r.On("SetSetupNodes", []cipher.PubKey{setupPK}).Return()
+	r.On("SetRouteFinder", mock.Anything).Return()
+
+	pm := &appserver.MockProcManager{}
+	for name, running := range map[string]bool{"restarted": true, "removed": true, "started": false, "unchanged": true, "added": false} {
+		pm.On("Exists", name).Return(running)
+	}
+	pm.On("Stop", mock.Anything).Return(testhelpers.NoErr)
+	pm.On("Start", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(appcommon.ProcID(10), testhelpers.NoErr)
+	pm.On("Wait", mock.Anything).Return(testhelpers.NoErr)
+
+	dc := &switchableDiscovery{dc: transport.NewDiscoveryMock()}
+
+	visor := &Visor{
+		conf:        oldConf,
+		router:      r,
+		procManager: pm,
+		appsConf:    appsConf,
+		localPath:   dir,
+		Logger:      logging.NewMasterLogger(),
+		logger:      logging.MustGetLogger("test"),
+		tm:          &transport.Manager{Conf: &transport.ManagerConfig{DiscoveryClient: dc}},
+		hvErrs:      map[cipher.PubKey]chan error{hvPK: make(chan error, 1)},
+	}
+
+	require.NoError(t, pathutil.EnsureDir(visor.dir()))
+
+	defer func() {
+		require.NoError(t, os.RemoveAll(visor.dir()))
+	}()
+
+	newConf := &Config{
+		KeyPair:       NewKeyPair(),
+		AppServerAddr: appcommon.DefaultServerAddr,
+		Transport:     DefaultTransportConfig(),
+		Routing:       DefaultRoutingConfig(),
+		LogLevel:      "debug",
+		Apps: []AppConfig{
+			{App: "restarted", AutoStart: true, Port: 10, Args: []string{"-foo"}},
+			{App: "started", AutoStart: true, Port: 12},
+			{App: "unchanged", AutoStart: false, Port: 13},
+			{App: "added", AutoStart: true, Port: 14},
+		},
+	}
+	newConf.Routing.SetupNodes = []cipher.PubKey{setupPK}
+	newConf.Routing.RouteFinder = "http://localhost:1"
+	newConf.Transport.Discovery = "http://localhost:1"
+	newConf.Transport.Cache = filepath.Join(dir, "transport_discovery.db")
+
+	// applyConfig takes over the config it's passed.
+	reload := func(conf *Config) *ConfigReload {
+		conf, err := conf.clone()
+		require.NoError(t, err)
+
+		return visor.applyConfig(conf)
+	}
+
+	res := reload(newConf)
+	assert.Empty(t, res.Errors)
+
+	assert.ElementsMatch(t, []string{"key_pair"}, res.RestartRequired)
+	assert.ElementsMatch(t, []string{"log_level", "hypervisors", "transport.discovery", "routing.setup_nodes",
+		"routing.route_finder", "apps"}, res.Applied)
+	assert.Equal(t, []string{"removed"}, res.StoppedApps)
+	assert.Equal(t, []string{"restarted"}, res.RestartedApps)
+	assert.Equal(t, []string{"added", "started"}, res.StartedApps)
+
+	r.AssertExpectations(t)
+	pm.AssertCalled(t, "Stop", "removed")
+	pm.AssertCalled(t, "Stop", "restarted")
+	pm.AssertNotCalled(t, "Stop", "unchanged")
+
+	// The running key pair is kept, other fields are taken from the new config.
+	assert.Equal(t, oldConf.KeyPair, visor.config().KeyPair)
+	assert.Equal(t, newConf.Apps, visor.config().Apps)
+	assert.Equal(t, "debug", visor.config().LogLevel)
+	assert.Empty(t, visor.hvErrs)
+	assert.Len(t, visor.appsConf, 4)
+
+	cd, ok := dc.get().(*transport.CachedDiscovery)
+	require.True(t, ok)
+	require.NoError(t, cd.Close())
+
+	// Nothing is applied if nothing changed.
+	res = reload(newConf)
+	assert.Empty(t, res.Applied)
+	assert.Equal(t, []string{"key_pair"}, res.RestartRequired)
+
+	// Apps are kept if the new ones are invalid.
+	apps := newConf.Apps
+	newConf.Apps = []AppConfig{{App: "added", Port: 14, Restart: &AppRestartConfig{Policy: "sometimes"}}}
+
+	res = reload(newConf)
+	assert.Empty(t, res.Applied)
+	assert.Equal(t, []string{`apps: app added: unknown restart policy: "sometimes"`}, res.Errors)
+	assert.Equal(t, apps, visor.config().Apps)
+	assert.Len(t, visor.appsConf, 4)
+}
+
+func TestVisor_ReloadConfig_Concurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "visor_reload")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+
+	conf := func(apps ...AppConfig) *Config {
+		c := &Config{
+			KeyPair:       NewKeyPair(),
+			AppServerAddr: appcommon.DefaultServerAddr,
+			Transport:     DefaultTransportConfig(),
+			Routing:       DefaultRoutingConfig(),
+			LogLevel:      "info",
+			Apps:          apps,
+		}
+		c.Routing.Table = DefaultRoutingTableConfig()
+		c.log = logging.MustGetLogger("test")
+
+		return c
+	}
+
+	oldConf := conf(AppConfig{App: "foo", Port: 10})
+
+	appsConf, err := oldConf.AppsConfig()
+	require.NoError(t, err)
+
+	pm := &appserver.MockProcManager{}
+	pm.On("Exists", mock.Anything).Return(false)
+
+	visor := &Visor{
+		conf:        oldConf,
+		router:      &router.MockRouter{},
+		procManager: pm,
+		appsConf:    appsConf,
+		localPath:   dir,
+		logger:      logging.MustGetLogger("test"),
+		tm:          &transport.Manager{Conf: &transport.ManagerConfig{}},
+	}
+
+	done := make(chan struct{})
+	readerDone := make(chan struct{})
+
+	// Apps and the config are read while the config is reloaded.
+	go func() {
+		defer close(readerDone)
+
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			assert.NotEmpty(t, visor.Apps())
+
+			_, ok := visor.App("foo")
+			assert.True(t, ok)
+
+			_ = visor.config().RoutingConfig().SetupNodes
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		apps := []AppConfig{{App: "foo", Port: 10}}
+		if i%2 == 0 {
+			apps = append(apps, AppConfig{App: "bar", Port: 11})
+		}
+
+		res := visor.applyConfig(conf(apps...))
+		assert.Empty(t, res.Errors)
+	}
+
+	close(done)
+	<-readerDone
+
+	assert.Len(t, visor.Apps(), 1)
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/SkycoinProject/skywire-mainnet/pkg/app"
+	"github.com/SkycoinProject/skywire-mainnet/pkg/router"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/routing"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/transport"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/util/buildinfo"
@@ -25,6 +26,9 @@ import (
 const (
 	// RPCPrefix is the prefix used with all RPC calls.
 	RPCPrefix = "app-visor"
+
+	// routeProbeTimeout is the time to wait for a probe to come back from the remote edge of a route.
+	routeProbeTimeout = 10 * time.Second
 )
 
 var (
@@ -36,6 +40,9 @@ var (
 
 	// ErrMalformedRestartContext is returned when restart context is malformed.
 	ErrMalformedRestartContext = errors.New("restart context is malformed")
+
+	// ErrNoBandwidthHistory is returned when bandwidth history is requested, but the transport log store does not keep it.
+	ErrNoBandwidthHistory = errors.New("transport log store does not keep bandwidth history")
 )
 
 // RPC defines RPC methods for Visor.
@@ -77,15 +84,15 @@ func (r *RPC) Health(_ *struct{}, out *HealthInfo) (err error) {
 	out.RouteFinder = http.StatusOK
 	out.SetupNode = http.StatusOK
 
-	if _, err = r.visor.conf.TransportDiscovery(); err != nil {
+	if _, err = r.visor.config().TransportDiscovery(); err != nil {
 		out.TransportDiscovery = http.StatusNotFound
 	}
 
-	if r.visor.conf.RoutingConfig().RouteFinder == "" {
+	if r.visor.config().RoutingConfig().RouteFinder == "" {
 		out.RouteFinder = http.StatusNotFound
 	}
 
-	if len(r.visor.conf.RoutingConfig().SetupNodes) == 0 {
+	if len(r.visor.config().RoutingConfig().SetupNodes) == 0 {
 		out.SetupNode = http.StatusNotFound
 	}
 
@@ -139,13 +146,15 @@ func (r *RPC) LogsSince(in *AppLogsRequest, out *[]string) (err error) {
 */
 
 // TransportSummary summarizes a Transport.
+// LinkStats are latency and loss of the Transport measured with probes, if any have been answered or lost yet.
 type TransportSummary struct {
-	ID      uuid.UUID           `json:"id"`
-	Local   cipher.PubKey       `json:"local_pk"`
-	Remote  cipher.PubKey       `json:"remote_pk"`
-	Type    string              `json:"type"`
-	Log     *transport.LogEntry `json:"log,omitempty"`
-	IsSetup bool                `json:"is_setup"`
+	ID        uuid.UUID            `json:"id"`
+	Local     cipher.PubKey        `json:"local_pk"`
+	Remote    cipher.PubKey        `json:"remote_pk"`
+	Type      string               `json:"type"`
+	Log       *transport.LogEntry  `json:"log,omitempty"`
+	LinkStats *transport.LinkStats `json:"link_stats,omitempty"`
+	IsSetup   bool                 `json:"is_setup"`
 }
 
 func newTransportSummary(tm *transport.Manager, tp *transport.ManagedTransport, includeLogs, isSetup bool) *TransportSummary {
@@ -160,6 +169,9 @@ func newTransportSummary(tm *transport.Manager, tp *transport.ManagedTransport,
 	if includeLogs {
 		summary.Log = tp.LogEntry
 	}
+	if stats, ok := tp.LinkStats(); ok {
+		summary.LinkStats = &stats
+	}
 	return summary
 }
 
@@ -184,7 +196,7 @@ func (r *RPC) Summary(_ *struct{}, out *Summary) (err error) {
 		return true
 	})
 	*out = Summary{
-		PubKey:          r.visor.conf.Keys().PubKey,
+		PubKey:          r.visor.config().Keys().PubKey,
 		BuildInfo:       buildinfo.Get(),
 		AppProtoVersion: supportedProtocolVersion,
 		Apps:            r.visor.Apps(),
@@ -358,7 +370,7 @@ func (r *RPC) RemoveTransport(tid *uuid.UUID, _ *struct{}) (err error) {
 func (r *RPC) DiscoverTransportsByPK(pk *cipher.PubKey, out *[]*transport.EntryWithStatus) (err error) {
 	defer rpcutil.LogCall(r.log, "DiscoverTransportsByPK", pk)(out, &err)
 
-	tpD, err := r.visor.conf.TransportDiscovery()
+	tpD, err := r.visor.config().TransportDiscovery()
 	if err != nil {
 		return err
 	}
@@ -376,7 +388,7 @@ func (r *RPC) DiscoverTransportsByPK(pk *cipher.PubKey, out *[]*transport.EntryW
 func (r *RPC) DiscoverTransportByID(id *uuid.UUID, out *transport.EntryWithStatus) (err error) {
 	defer rpcutil.LogCall(r.log, "DiscoverTransportByID", id)(out, &err)
 
-	tpD, err := r.visor.conf.TransportDiscovery()
+	tpD, err := r.visor.config().TransportDiscovery()
 	if err != nil {
 		return err
 	}
@@ -464,6 +476,143 @@ func (r *RPC) RouteGroups(_ *struct{}, out *[]RouteGroupInfo) (err error) {
 	return nil
 }
 
+/*
+	<<< ROUTE PROBES >>>
+*/
+
+// TraceRoute sends a probe via the route group with the edge route of the given RouteID
+// and returns round trip times to the visors of the route.
+func (r *RPC) TraceRoute(routeID *routing.RouteID, out *[]router.HopRTT) (err error) {
+	defer rpcutil.LogCall(r.log, "TraceRoute", routeID)(out, &err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), routeProbeTimeout)
+	defer cancel()
+
+	*out, err = r.visor.router.TraceRoute(ctx, *routeID)
+	return err
+}
+
+// Ping returns the round trip time to the remote visor of the given public key
+// via an established route group.
+func (r *RPC) Ping(pk *cipher.PubKey, out *time.Duration) (err error) {
+	defer rpcutil.LogCall(r.log, "Ping", pk)(out, &err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), routeProbeTimeout)
+	defer cancel()
+
+	err = fmt.Errorf("%w: no route group to %s", ErrNotFound, pk)
+
+	for _, rule := range r.visor.router.Rules() {
+		if rule.Type() != routing.RuleConsume {
+			continue
+		}
+
+		// the source of descriptors of consume rules is the remote edge
+		if desc := rule.RouteDescriptor(); desc.SrcPK() != *pk {
+			continue
+		}
+
+		var hops []router.HopRTT
+		if hops, err = r.visor.router.TraceRoute(ctx, rule.KeyRouteID()); err != nil || len(hops) == 0 {
+			continue
+		}
+
+		if rtt := hops[len(hops)-1].RTT; rtt != nil {
+			*out = *rtt
+		}
+
+		return nil
+	}
+
+	return err
+}
+
+/*
+	<<< BANDWIDTH LIMITS >>>
+*/
+
+// BandwidthLimits returns the current limits of traffic forwarded by the router.
+func (r *RPC) BandwidthLimits(_ *struct{}, out *router.BandwidthLimits) (err error) {
+	defer rpcutil.LogCall(r.log, "BandwidthLimits", nil)(out, &err)
+
+	*out = r.visor.router.BandwidthLimits()
+	return nil
+}
+
+// SetBandwidthLimits replaces limits of traffic forwarded by the router and saves them to config.
+func (r *RPC) SetBandwidthLimits(in *router.BandwidthLimits, _ *struct{}) (err error) {
+	defer rpcutil.LogCall(r.log, "SetBandwidthLimits", in)(nil, &err)
+
+	return r.visor.setBandwidthLimits(*in)
+}
+
+/*
+	<<< BANDWIDTH HISTORY >>>
+*/
+
+// BandwidthHistoryIn is input for TransportBandwidth and RemoteBandwidth.
+// If To is not set, the current time is used. If Granularity is not set,
+// the finest granularity of which bandwidth history since From is retained is used.
+type BandwidthHistoryIn struct {
+	TpID        uuid.UUID
+	RemotePK    cipher.PubKey
+	From        time.Time
+	To          time.Time
+	Granularity transport.Granularity
+}
+
+// TransportBandwidth returns bandwidth history of the transport of given ID.
+func (r *RPC) TransportBandwidth(in *BandwidthHistoryIn, out *[]transport.BandwidthRecord) (err error) {
+	defer rpcutil.LogCall(r.log, "TransportBandwidth", in)(out, &err)
+
+	*out, err = r.visor.bandwidthHistory(in.From, in.To, in.Granularity, in.TpID)
+	return err
+}
+
+// RemoteBandwidth returns bandwidth history of transports of all types to the visor of given public key, summed up.
+func (r *RPC) RemoteBandwidth(in *BandwidthHistoryIn, out *[]transport.BandwidthRecord) (err error) {
+	defer rpcutil.LogCall(r.log, "RemoteBandwidth", in)(out, &err)
+
+	var ids []uuid.UUID
+	for _, netName := range r.visor.tm.Networks() {
+		ids = append(ids, transport.MakeTransportID(r.visor.tm.Local(), in.RemotePK, netName))
+	}
+
+	*out, err = r.visor.bandwidthHistory(in.From, in.To, in.Granularity, ids...)
+	return err
+}
+
+/*
+	<<< EVENTS >>>
+*/
+
+// maxEventsTimeout is the maximum time Events waits for events.
+const maxEventsTimeout = time.Minute
+
+// EventsIn is input for Events.
+type EventsIn struct {
+	Since   uint64        // sequence number of the last event the caller got
+	Types   []EventType   // types of events to return, all if empty
+	Timeout time.Duration // time to wait for events if there are none yet, up to a minute
+}
+
+// Events returns the retained events of the visor which happened after the event of sequence number in.Since.
+// If there are none, it waits for up to in.Timeout for them, so subscribers may long-poll it.
+func (r *RPC) Events(in *EventsIn, out *[]Event) (err error) {
+	defer rpcutil.LogCall(r.log, "Events", in)(out, &err)
+
+	timeout := in.Timeout
+	if timeout > maxEventsTimeout {
+		timeout = maxEventsTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	*out = r.visor.events.Since(ctx, in.Since, in.Types)
+	return nil
+}
+
 /*
 	<<< VISOR MANAGEMENT >>>
 */
@@ -491,6 +640,18 @@ func (r *RPC) Restart(_ *struct{}, _ *struct{}) (err error) {
 	return r.visor.restartCtx.Start()
 }
 
+// ReloadConfig reads the config file of the visor again and applies changes which don't require a restart.
+func (r *RPC) ReloadConfig(_ *struct{}, out *ConfigReload) (err error) {
+	defer rpcutil.LogCall(r.log, "ReloadConfig", nil)(out, &err)
+
+	res, err := r.visor.ReloadConfig()
+	if res != nil {
+		*out = *res
+	}
+
+	return err
+}
+
 // Exec executes a given command in cmd and writes its output to out.
 func (r *RPC) Exec(cmd *string, out *[]byte) (err error) {
 	defer rpcutil.LogCall(r.log, "Exec", cmd)(out, &err)
@@ -60,7 +60,19 @@ type RPCClient interface {
 
 	RouteGroups() ([]RouteGroupInfo, error)
 
+	TraceRoute(routeID routing.RouteID) ([]router.HopRTT, error)
+	Ping(pk cipher.PubKey) (time.Duration, error)
+
+	BandwidthLimits() (router.BandwidthLimits, error)
+	SetBandwidthLimits(limits router.BandwidthLimits) error
+
+	TransportBandwidth(tid uuid.UUID, from, to time.Time, g transport.Granularity) ([]transport.BandwidthRecord, error)
+	RemoteBandwidth(pk cipher.PubKey, from, to time.Time, g transport.Granularity) ([]transport.BandwidthRecord, error)
+
+	Events(since uint64, types []EventType, timeout time.Duration) ([]Event, error)
+
 	Restart() error
+	ReloadConfig() (*ConfigReload, error)
 	Exec(command string) ([]byte, error)
 	Update() (bool, error)
 	UpdateAvailable() (*updater.Version, error)
@@ -239,11 +251,79 @@ func (rc *rpcClient) RouteGroups() ([]RouteGroupInfo, error) {
 	return routegroups, err
 }
 
+// TraceRoute calls TraceRoute.
+func (rc *rpcClient) TraceRoute(routeID routing.RouteID) ([]router.HopRTT, error) {
+	var hops []router.HopRTT
+	err := rc.Call("TraceRoute", &routeID, &hops)
+	return hops, err
+}
+
+// Ping calls Ping.
+func (rc *rpcClient) Ping(pk cipher.PubKey) (time.Duration, error) {
+	var rtt time.Duration
+	err := rc.Call("Ping", &pk, &rtt)
+	return rtt, err
+}
+
+// BandwidthLimits calls BandwidthLimits.
+func (rc *rpcClient) BandwidthLimits() (router.BandwidthLimits, error) {
+	var limits router.BandwidthLimits
+	err := rc.Call("BandwidthLimits", &struct{}{}, &limits)
+	return limits, err
+}
+
+// SetBandwidthLimits calls SetBandwidthLimits.
+func (rc *rpcClient) SetBandwidthLimits(limits router.BandwidthLimits) error {
+	return rc.Call("SetBandwidthLimits", &limits, &struct{}{})
+}
+
+// TransportBandwidth calls TransportBandwidth.
+func (rc *rpcClient) TransportBandwidth(tid uuid.UUID, from, to time.Time, g transport.Granularity) ([]transport.BandwidthRecord, error) {
+	var records []transport.BandwidthRecord
+	err := rc.Call("TransportBandwidth", &BandwidthHistoryIn{
+		TpID:        tid,
+		From:        from,
+		To:          to,
+		Granularity: g,
+	}, &records)
+	return records, err
+}
+
+// RemoteBandwidth calls RemoteBandwidth.
+func (rc *rpcClient) RemoteBandwidth(pk cipher.PubKey, from, to time.Time, g transport.Granularity) ([]transport.BandwidthRecord, error) {
+	var records []transport.BandwidthRecord
+	err := rc.Call("RemoteBandwidth", &BandwidthHistoryIn{
+		RemotePK:    pk,
+		From:        from,
+		To:          to,
+		Granularity: g,
+	}, &records)
+	return records, err
+}
+
+// Events calls Events.
+func (rc *rpcClient) Events(since uint64, types []EventType, timeout time.Duration) ([]Event, error) {
+	var events []Event
+	err := rc.Call("Events", &EventsIn{
+		Since:   since,
+		Types:   types,
+		Timeout: timeout,
+	}, &events)
+	return events, err
+}
+
 // Restart calls Restart.
 func (rc *rpcClient) Restart() error {
 	return rc.Call("Restart", &struct{}{}, &struct{}{})
 }
 
+// ReloadConfig calls ReloadConfig.
+func (rc *rpcClient) ReloadConfig() (*ConfigReload, error) {
+	var res ConfigReload
+	err := rc.Call("ReloadConfig", &struct{}{}, &res)
+	return &res, err
+}
+
 // Exec calls Exec.
 func (rc *rpcClient) Exec(command string) ([]byte, error) {
 	output := make([]byte, 0)
@@ -280,6 +360,7 @@ type mockRPCClient struct {
 	tpTypes   []string
 	rt        routing.Table
 	appls     app.LogStore
+	limits    router.BandwidthLimits
 	sync.RWMutex
 }
 
@@ -301,6 +382,11 @@ func NewMockRPCClient(r *rand.Rand, maxTps int, maxRules int) (cipher.PubKey, RP
 			Remote: remotePK,
 			Type:   types[r.Int()%len(types)],
 			Log:    new(transport.LogEntry),
+			LinkStats: &transport.LinkStats{
+				RTT:    time.Duration(r.Intn(200)+1) * time.Millisecond,
+				Jitter: time.Duration(r.Intn(20)) * time.Millisecond,
+				Probes: 30,
+			},
 		}
 		log.Infof("tp[%2d]: %v", i, tps[i])
 	}
@@ -622,11 +708,132 @@ func (mc *mockRPCClient) RouteGroups() ([]RouteGroupInfo, error) {
 	return routeGroups, nil
 }
 
+const mockRTT = 10 * time.Millisecond
+
+// TraceRoute implements RPCClient.
+func (mc *mockRPCClient) TraceRoute(routeID routing.RouteID) ([]router.HopRTT, error) {
+	rule, err := mc.rt.Rule(routeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if rule.Type() != routing.RuleConsume {
+		return nil, fmt.Errorf("%w: %d", router.ErrNoRouteGroup, routeID)
+	}
+
+	desc := rule.RouteDescriptor()
+	rtt := mockRTT
+
+	return []router.HopRTT{{PK: desc.SrcPK(), RTT: &rtt}}, nil
+}
+
+// Ping implements RPCClient.
+func (mc *mockRPCClient) Ping(pk cipher.PubKey) (time.Duration, error) {
+	for _, rule := range mc.rt.AllRules() {
+		if rule.Type() != routing.RuleConsume {
+			continue
+		}
+
+		if desc := rule.RouteDescriptor(); desc.SrcPK() == pk {
+			return mockRTT, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: no route group to %s", ErrNotFound, pk)
+}
+
+// BandwidthLimits implements RPCClient.
+func (mc *mockRPCClient) BandwidthLimits() (router.BandwidthLimits, error) {
+	var limits router.BandwidthLimits
+	err := mc.do(false, func() error {
+		limits = mc.limits
+		return nil
+	})
+
+	return limits, err
+}
+
+// SetBandwidthLimits implements RPCClient.
+func (mc *mockRPCClient) SetBandwidthLimits(limits router.BandwidthLimits) error {
+	return mc.do(true, func() error {
+		mc.limits = limits
+		return nil
+	})
+}
+
+// TransportBandwidth implements RPCClient.
+func (mc *mockRPCClient) TransportBandwidth(tid uuid.UUID, from, to time.Time, g transport.Granularity) ([]transport.BandwidthRecord, error) {
+	return mc.bandwidthHistory(from, to, g, func(tp *TransportSummary) bool {
+		return tp.ID == tid
+	})
+}
+
+// RemoteBandwidth implements RPCClient.
+func (mc *mockRPCClient) RemoteBandwidth(pk cipher.PubKey, from, to time.Time, g transport.Granularity) ([]transport.BandwidthRecord, error) {
+	return mc.bandwidthHistory(from, to, g, func(tp *TransportSummary) bool {
+		return tp.Remote == pk
+	})
+}
+
+// bandwidthHistory reports traffic of matching transports within the current interval.
+func (mc *mockRPCClient) bandwidthHistory(from, to time.Time, g transport.Granularity, match func(tp *TransportSummary) bool) ([]transport.BandwidthRecord, error) {
+	if to.IsZero() {
+		to = time.Now()
+	}
+
+	if g == "" {
+		g = transport.GranularitySince(from)
+	}
+
+	if g.Interval() == 0 {
+		return nil, transport.ErrUnknownGranularity
+	}
+
+	records := make([]transport.BandwidthRecord, 0)
+	current := time.Now().Truncate(g.Interval()).UTC()
+
+	if current.Before(from.Truncate(g.Interval())) || !current.Before(to) {
+		return records, nil
+	}
+
+	err := mc.do(false, func() error {
+		record := transport.BandwidthRecord{Time: current}
+
+		for _, tp := range mc.s.Transports {
+			if tp.Log != nil && match(tp) {
+				record.RecvBytes += tp.Log.RecvBytes
+				record.SentBytes += tp.Log.SentBytes
+			}
+		}
+
+		records = append(records, record)
+		return nil
+	})
+
+	return records, err
+}
+
+// Events implements RPCClient. The mock visor has no events, so it waits for the timeout.
+func (mc *mockRPCClient) Events(_ uint64, _ []EventType, timeout time.Duration) ([]Event, error) {
+	if timeout > maxEventsTimeout {
+		timeout = maxEventsTimeout
+	}
+
+	time.Sleep(timeout)
+
+	return nil, nil
+}
+
 // Restart implements RPCClient.
 func (mc *mockRPCClient) Restart() error {
 	return nil
 }
 
+// ReloadConfig implements RPCClient.
+func (mc *mockRPCClient) ReloadConfig() (*ConfigReload, error) {
+	return &ConfigReload{}, nil
+}
+
 // Exec implements RPCClient.
 func (mc *mockRPCClient) Exec(string) ([]byte, error) {
 	return []byte("mock"), nil
@@ -1,6 +1,7 @@
 package visor
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -96,6 +97,7 @@ func TestListApps(t *testing.T) {
 	pm := &appserver.MockProcManager{}
 	pm.On("Exists", apps["foo"].App).Return(false)
 	pm.On("Exists", apps["bar"].App).Return(true)
+	pm.On("Usage", apps["bar"].App).Return(appcommon.ResourceUsage{}, errors.New("unsupported"))
 
 	n := Visor{
 		appsConf:    apps,
@@ -125,6 +127,7 @@ func TestListApps(t *testing.T) {
 	assert.True(t, app2.AutoStart)
 	assert.Equal(t, routing.Port(11), app2.Port)
 	assert.Equal(t, AppStatusRunning, app2.Status)
+	assert.Nil(t, app2.Usage)
 }
 
 func TestStartStopApp(t *testing.T) {
@@ -416,3 +419,29 @@ These tests have been commented out for the following reasons:
 //	// TODO: Test add/remove transports
 //
 //}
+
+func TestPing(t *testing.T) {
+	localPK, _ := cipher.GenerateKeyPair()
+	remotePK, _ := cipher.GenerateKeyPair()
+	otherPK, _ := cipher.GenerateKeyPair()
+	hopPK, _ := cipher.GenerateKeyPair()
+
+	rule := routing.ConsumeRule(router.DefaultRouteKeepAlive, 3, remotePK, localPK, 2, 1)
+	hopRTT, remoteRTT := 5*time.Millisecond, 10*time.Millisecond
+	hops := []router.HopRTT{
+		{PK: hopPK, RTT: &hopRTT},
+		{PK: remotePK, RTT: &remoteRTT},
+	}
+
+	r := &router.MockRouter{}
+	r.On("Rules").Return([]routing.Rule{rule})
+	r.On("TraceRoute", mock.Anything /* context */, routing.RouteID(3)).Return(hops, nil)
+
+	rpc := &RPC{visor: &Visor{router: r}, log: logrus.New()}
+
+	var rtt time.Duration
+	require.NoError(t, rpc.Ping(&remotePK, &rtt))
+	require.Equal(t, 10*time.Millisecond, rtt)
+
+	require.True(t, errors.Is(rpc.Ping(&otherPK, &rtt), ErrNotFound))
+}
@@ -6,7 +6,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -17,19 +19,17 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/SkycoinProject/dmsg"
 	"github.com/SkycoinProject/dmsg/cipher"
 	"github.com/SkycoinProject/dmsg/dmsgpty"
 	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"github.com/google/uuid"
 
 	"github.com/SkycoinProject/skywire-mainnet/pkg/app/appcommon"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/app/appnet"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/app/appserver"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/restart"
-	"github.com/SkycoinProject/skywire-mainnet/pkg/routefinder/rfclient"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/router"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/routing"
-	"github.com/SkycoinProject/skywire-mainnet/pkg/skyenv"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/snet"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/transport"
 	"github.com/SkycoinProject/skywire-mainnet/pkg/util/pathutil"
@@ -50,6 +50,9 @@ const (
 var (
 	// ErrUnknownApp represents lookup error for App related calls.
 	ErrUnknownApp = errors.New("unknown app")
+
+	// ErrNoHTTPToken is returned when the HTTP API is enabled without a token.
+	ErrNoHTTPToken = errors.New("interfaces.http_token is required if the HTTP API is enabled")
 )
 
 const (
@@ -62,16 +65,21 @@ var reservedPorts = map[routing.Port]string{0: "router", 1: "skychat", 3: "skyso
 
 // AppState defines state parameters for a registered App.
 type AppState struct {
-	Name      string       `json:"name"`
-	AutoStart bool         `json:"autostart"`
-	Port      routing.Port `json:"port"`
-	Status    AppStatus    `json:"status"`
+	Name         string       `json:"name"`
+	AutoStart    bool         `json:"autostart"`
+	Port         routing.Port `json:"port"`
+	Status       AppStatus    `json:"status"`
+	Restarts     int          `json:"restarts"`                 // restarts since the app was last started by the visor or a user
+	LastExitCode *int         `json:"last_exit_code,omitempty"` // -1 if the app was killed by a signal or failed to run
+
+	Usage *appcommon.ResourceUsage `json:"usage,omitempty"` // resources used by the running app, if supported
 }
 
 // Visor provides messaging runtime for Apps by setting up all
 // necessary connections and performing messaging gateway functions.
 type Visor struct {
 	conf   *Config
+	confMu sync.RWMutex // protects conf, which is replaced rather than modified once the visor is created
 	router router.Router
 	n      *snet.Network
 	tm     *transport.Manager
@@ -80,9 +88,11 @@ type Visor struct {
 	Logger *logging.MasterLogger
 	logger *logging.Logger
 
-	appsPath  string
-	localPath string
-	appsConf  map[string]AppConfig
+	appsPath   string
+	localPath  string
+	appsConf   map[string]AppConfig
+	appsMu     sync.RWMutex // protects appsConf against concurrent updates
+	appsCgroup string       // cgroup v2 cgroups of apps are created in, empty if not used
 
 	startedAt  time.Time
 	restartCtx *restart.Context
@@ -90,12 +100,21 @@ type Visor struct {
 
 	pidMu sync.Mutex
 
-	cliLis net.Listener
-	hvErrs map[cipher.PubKey]chan error // errors returned when the associated hypervisor ServeRPCClient returns
+	cliLis    net.Listener
+	httpLis   net.Listener // listener of the local HTTP API
+	httpSrv   *http.Server
+	hvErrs    map[cipher.PubKey]chan error // errors returned when the associated hypervisor ServeRPCClient returns
+	hvCancels map[cipher.PubKey]context.CancelFunc
+	rpcCtx    context.Context // context hypervisors are served with, set once the visor is started
+
+	reloadMu sync.Mutex // serializes config reloads, protects hypervisors
 
 	procManager  appserver.ProcManager
 	appRPCServer *appserver.Server
 
+	events     *eventBus
+	supervisor appSupervisor
+
 	// cancel is to be called when visor.Close is triggered.
 	cancel context.CancelFunc
 }
@@ -105,7 +124,8 @@ func NewVisor(cfg *Config, logger *logging.MasterLogger, restartCtx *restart.Con
 	ctx := context.Background()
 
 	visor := &Visor{
-		conf: cfg,
+		conf:   cfg,
+		events: newEventBus(eventBufferSize),
 	}
 
 	visor.Logger = logger
@@ -127,10 +147,13 @@ func NewVisor(cfg *Config, logger *logging.MasterLogger, restartCtx *restart.Con
 	visor.restartCtx = restartCtx
 
 	visor.n = snet.New(snet.Config{
-		PubKey: pk,
-		SecKey: sk,
-		Dmsg:   cfg.DmsgConfig(),
-		STCP:   cfg.STCP,
+		PubKey:   pk,
+		SecKey:   sk,
+		Dmsg:     cfg.DmsgConfig(),
+		STCP:     cfg.STCP,
+		SUDP:     cfg.SUDP,
+		SUDPH:    cfg.SUDPH,
+		Networks: cfg.Networks,
 	})
 	if err := visor.n.Init(ctx); err != nil {
 		return nil, fmt.Errorf("failed to init network: %v", err)
@@ -146,7 +169,7 @@ func NewVisor(cfg *Config, logger *logging.MasterLogger, restartCtx *restart.Con
 		logger.Info("'dmsgpty' is not configured, skipping...")
 	}
 
-	trDiscovery, err := cfg.TransportDiscovery()
+	trDiscovery, err := cfg.CachedTransportDiscovery()
 	if err != nil {
 		return nil, fmt.Errorf("invalid transport discovery config: %s", err)
 	}
@@ -160,8 +183,11 @@ func NewVisor(cfg *Config, logger *logging.MasterLogger, restartCtx *restart.Con
 		PubKey:          pk,
 		SecKey:          sk,
 		DefaultVisors:   cfg.TrustedVisors,
-		DiscoveryClient: trDiscovery,
+		DiscoveryClient: &switchableDiscovery{dc: trDiscovery},
 		LogStore:        logStore,
+		ReportLinkStats: cfg.Transport.ReportLinkStats,
+		AutoConnect:     cfg.Transport.AutoConnect.Policy(),
+		OnEvent:         visor.publishTransportEvent,
 	}
 
 	visor.tm, err = transport.NewManager(visor.n, tmConfig)
@@ -169,13 +195,26 @@ func NewVisor(cfg *Config, logger *logging.MasterLogger, restartCtx *restart.Con
 		return nil, fmt.Errorf("transport manager: %s", err)
 	}
 
+	routingTable, err := cfg.RoutingTable()
+	if err != nil {
+		return nil, fmt.Errorf("invalid RoutingTable: %s", err)
+	}
+
 	rConfig := &router.Config{
-		Logger:           visor.Logger.PackageLogger("router"),
-		PubKey:           pk,
-		SecKey:           sk,
-		TransportManager: visor.tm,
-		RouteFinder:      rfclient.NewHTTP(cfg.RoutingConfig().RouteFinder, time.Duration(cfg.RoutingConfig().RouteFinderTimeout)),
-		SetupNodes:       cfg.RoutingConfig().SetupNodes,
+		Logger:             visor.Logger.PackageLogger("router"),
+		PubKey:             pk,
+		SecKey:             sk,
+		TransportManager:   visor.tm,
+		RouteFinder:        cfg.RouteFinder(visor.tm),
+		SetupNodes:         cfg.RoutingConfig().SetupNodes,
+		RoutingTable:       routingTable,
+		DisableEncryption:  cfg.RoutingConfig().DisableEncryption,
+		OnRouteGroupOpened: visor.publishRouteGroupEvent(EventRouteGroupOpened),
+		OnRouteGroupClosed: visor.publishRouteGroupEvent(EventRouteGroupClosed),
+	}
+
+	if limits := cfg.RoutingConfig().BandwidthLimits; limits != nil {
+		rConfig.BandwidthLimits = *limits
 	}
 
 	r, err := router.New(visor.n, rConfig)
@@ -210,6 +249,19 @@ func NewVisor(cfg *Config, logger *logging.MasterLogger, restartCtx *restart.Con
 		}
 
 		visor.cliLis = l
+
+		if cfg.Interfaces.HTTPAddress != "" {
+			if cfg.Interfaces.HTTPToken == "" {
+				return nil, ErrNoHTTPToken
+			}
+
+			l, err := net.Listen("tcp", cfg.Interfaces.HTTPAddress)
+			if err != nil {
+				return nil, fmt.Errorf("failed to setup HTTP API listener: %s", err)
+			}
+
+			visor.httpLis = l
+		}
 	}
 
 	visor.hvErrs = make(map[cipher.PubKey]chan error, len(cfg.Hypervisors))
@@ -227,6 +279,15 @@ func NewVisor(cfg *Config, logger *logging.MasterLogger, restartCtx *restart.Con
 
 	visor.procManager = appserver.NewProcManager(logging.MustGetLogger("proc_manager"), visor.appRPCServer)
 
+	if c := cfg.AppsCgroup; c != nil {
+		dir, err := appserver.SetupAppsCgroup(c.Dir, c.MoveVisor)
+		if err != nil {
+			visor.logger.WithError(err).Warn("Failed to set up cgroup of apps, resource limits of apps are set with rlimits.")
+		}
+
+		visor.appsCgroup = dir
+	}
+
 	visor.updater = updater.New(visor.logger, visor.restartCtx, visor.appsPath)
 
 	return visor, err
@@ -273,6 +334,9 @@ func (visor *Visor) startApps() error {
 		return err
 	}
 
+	visor.appsMu.RLock()
+	defer visor.appsMu.RUnlock()
+
 	for _, ac := range visor.appsConf {
 		if !ac.AutoStart {
 			continue
@@ -309,20 +373,22 @@ func (visor *Visor) startDmsgPty(ctx context.Context) error {
 }
 
 func (visor *Visor) serveDmsgPtyCLI(ctx context.Context, log *logging.Logger) error {
-	if visor.conf.DmsgPty.CLINet == "unix" {
-		if err := os.MkdirAll(filepath.Dir(visor.conf.DmsgPty.CLIAddr), ownerRWX); err != nil {
+	conf := visor.config()
+
+	if conf.DmsgPty.CLINet == "unix" {
+		if err := os.MkdirAll(filepath.Dir(conf.DmsgPty.CLIAddr), ownerRWX); err != nil {
 			log.WithError(err).Debug("Failed to prepare unix file dir.")
 		}
 	}
 
-	ptyL, err := net.Listen(visor.conf.DmsgPty.CLINet, visor.conf.DmsgPty.CLIAddr)
+	ptyL, err := net.Listen(conf.DmsgPty.CLINet, conf.DmsgPty.CLIAddr)
 	if err != nil {
 		return fmt.Errorf("failed to start dmsgpty cli listener: %v", err)
 	}
 
 	go func() {
-		log.WithField("net", visor.conf.DmsgPty.CLINet).
-			WithField("addr", visor.conf.DmsgPty.CLIAddr).
+		log.WithField("net", conf.DmsgPty.CLINet).
+			WithField("addr", conf.DmsgPty.CLIAddr).
 			Info("Serving dmsgpty CLI.")
 
 		if err := visor.pty.ServeCLI(ctx, ptyL); err != nil {
@@ -339,10 +405,12 @@ func (visor *Visor) serveDmsgPtyCLI(ctx context.Context, log *logging.Logger) er
 }
 
 func (visor *Visor) serveDmsgPty(ctx context.Context, log *logging.Logger) {
-	log.WithField("dmsg_port", visor.conf.DmsgPty.Port).
+	conf := visor.config()
+
+	log.WithField("dmsg_port", conf.DmsgPty.Port).
 		Info("Serving dmsg.")
 
-	if err := visor.pty.ListenAndServe(ctx, visor.conf.DmsgPty.Port); err != nil {
+	if err := visor.pty.ListenAndServe(ctx, conf.DmsgPty.Port); err != nil {
 		log.WithError(err).
 			WithField("entity", "dmsgpty-host").
 			WithField("func", ".ListenAndServe()").
@@ -365,25 +433,31 @@ func (visor *Visor) startRPC(ctx context.Context) {
 		go srv.Accept(visor.cliLis)
 	}
 
-	if visor.hvErrs != nil {
-		for hvPK, hvErrs := range visor.hvErrs {
-			log := visor.Logger.PackageLogger("hypervisor_client").
-				WithField("hypervisor_pk", hvPK)
+	if visor.httpLis != nil {
+		visor.logger.Info("Starting HTTP API on ", visor.httpLis.Addr())
 
-			addr := dmsg.Addr{PK: hvPK, Port: skyenv.DmsgHypervisorPort}
-			rpcS, err := newRPCServer(visor, addr.PK.String()[:shortHashLen])
-			if err != nil {
-				visor.logger.WithError(err).Errorf("Failed to start RPC server")
-				return
+		visor.httpSrv = &http.Server{Handler: NewGateway(visor, visor.config().Interfaces.HTTPToken)}
+
+		go func() {
+			if err := visor.httpSrv.Serve(visor.httpLis); err != nil && err != http.ErrServerClosed {
+				visor.logger.WithError(err).Error("HTTP API stopped.")
 			}
+		}()
+	}
 
-			go ServeRPCClient(ctx, log, visor.n, rpcS, addr, hvErrs)
-		}
+	visor.reloadMu.Lock()
+	defer visor.reloadMu.Unlock()
+
+	visor.rpcCtx = ctx
+	visor.hvCancels = make(map[cipher.PubKey]context.CancelFunc, len(visor.hvErrs))
+
+	for hvPK, hvErrs := range visor.hvErrs {
+		visor.serveHypervisor(ctx, hvPK, hvErrs)
 	}
 }
 
 func (visor *Visor) dir() string {
-	return pathutil.VisorDir(visor.conf.Keys().PubKey.String())
+	return pathutil.VisorDir(visor.config().Keys().PubKey.String())
 }
 
 func (visor *Visor) pidFile() (*os.File, error) {
@@ -466,8 +540,25 @@ func (visor *Visor) Close() (err error) {
 			visor.logger.Info("CLI listener closed successfully")
 		}
 	}
-	if visor.hvErrs != nil {
-		for hvPK, hvErr := range visor.hvErrs {
+
+	if visor.httpSrv != nil {
+		if err = visor.httpSrv.Close(); err != nil {
+			visor.logger.WithError(err).Error("failed to close HTTP API")
+		} else {
+			visor.logger.Info("HTTP API closed successfully")
+		}
+	} else if visor.httpLis != nil {
+		if err = visor.httpLis.Close(); err != nil {
+			visor.logger.WithError(err).Error("failed to close HTTP API listener")
+		}
+	}
+
+	visor.reloadMu.Lock()
+	hvErrs := visor.hvErrs
+	visor.reloadMu.Unlock()
+
+	if hvErrs != nil {
+		for hvPK, hvErr := range hvErrs {
 			visor.logger.
 				WithError(<-hvErr).
 				WithField("hypervisor_pk", hvPK).
@@ -475,6 +566,7 @@ func (visor *Visor) Close() (err error) {
 		}
 	}
 
+	visor.supervisor.close()
 	visor.procManager.StopAll()
 
 	if err = visor.router.Close(); err != nil {
@@ -487,20 +579,27 @@ func (visor *Visor) Close() (err error) {
 		visor.logger.WithError(err).Error("RPC server closed with error.")
 	}
 
+	if visor.tm != nil {
+		if c, ok := visor.tm.Conf.DiscoveryClient.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				visor.logger.WithError(err).Error("Failed to close transport discovery client.")
+			}
+		}
+	}
+
 	return err
 }
 
 // App returns a single app state of given name.
 func (visor *Visor) App(name string) (*AppState, bool) {
+	visor.appsMu.RLock()
 	app, ok := visor.appsConf[name]
+	visor.appsMu.RUnlock()
+
 	if !ok {
 		return nil, false
 	}
-	state := &AppState{app.App, app.AutoStart, app.Port, AppStatusStopped}
-	if visor.procManager.Exists(app.App) {
-		state.Status = AppStatusRunning
-	}
-	return state, true
+	return visor.appState(app), true
 }
 
 // Apps returns list of AppStates for all registered apps.
@@ -508,43 +607,60 @@ func (visor *Visor) Apps() []*AppState {
 	// TODO: move app states to the app module
 	res := make([]*AppState, 0)
 
+	visor.appsMu.RLock()
+	defer visor.appsMu.RUnlock()
+
 	for _, app := range visor.appsConf {
-		state := &AppState{app.App, app.AutoStart, app.Port, AppStatusStopped}
+		res = append(res, visor.appState(app))
+	}
 
-		if visor.procManager.Exists(app.App) {
-			state.Status = AppStatusRunning
-		}
+	return res
+}
+
+func (visor *Visor) appState(app AppConfig) *AppState {
+	state := &AppState{Name: app.App, AutoStart: app.AutoStart, Port: app.Port, Status: AppStatusStopped}
 
-		res = append(res, state)
+	if visor.procManager.Exists(app.App) {
+		state.Status = AppStatusRunning
+
+		if usage, err := visor.procManager.Usage(app.App); err == nil {
+			state.Usage = &usage
+		}
 	}
 
-	return res
+	state.Restarts, state.LastExitCode = visor.supervisor.state(app.App)
+
+	return state
 }
 
 // StartApp starts registered App.
 func (visor *Visor) StartApp(appName string) error {
-	for _, app := range visor.appsConf {
-		if app.App == appName {
-			startCh := make(chan struct{})
-
-			go func(app AppConfig) {
-				if err := visor.SpawnApp(&app, startCh); err != nil {
-					visor.logger.
-						WithError(err).
-						WithField("app_name", appName).
-						Warn("App stopped.")
-				}
-			}(app)
+	visor.appsMu.RLock()
+	app, ok := visor.appsConf[appName]
+	visor.appsMu.RUnlock()
 
-			<-startCh
-			return nil
-		}
+	if !ok {
+		return ErrUnknownApp
 	}
 
-	return ErrUnknownApp
+	startCh := make(chan struct{})
+
+	go func() {
+		if err := visor.SpawnApp(&app, startCh); err != nil {
+			visor.logger.
+				WithError(err).
+				WithField("app_name", appName).
+				Warn("App stopped.")
+		}
+	}()
+
+	<-startCh
+
+	return nil
 }
 
 // SpawnApp configures and starts new App.
+// It returns once the app exits and isn't restarted according to its restart policy.
 func (visor *Visor) SpawnApp(config *AppConfig, startCh chan<- struct{}) (err error) {
 	visor.logger.
 		WithField("app_name", config.App).
@@ -555,13 +671,14 @@ func (visor *Visor) SpawnApp(config *AppConfig, startCh chan<- struct{}) (err er
 		return fmt.Errorf("can't bind to reserved port %d", config.Port)
 	}
 
-	appCfg := appcommon.Config{
-		Name:       config.App,
-		ServerAddr: visor.conf.AppServerAddr,
-		VisorPK:    visor.conf.Keys().PubKey.Hex(),
-		BinaryDir:  visor.appsPath,
-		WorkDir:    filepath.Join(visor.localPath, config.App),
-	}
+	conf := visor.config()
+
+	appCfg := config.procConfig()
+	appCfg.ServerAddr = conf.AppServerAddr
+	appCfg.VisorPK = conf.Keys().PubKey.Hex()
+	appCfg.BinaryDir = visor.appsPath
+	appCfg.WorkDir = filepath.Join(visor.localPath, config.App)
+	appCfg.Cgroup = visor.appsCgroup
 
 	if _, err := ensureDir(appCfg.WorkDir); err != nil {
 		return err
@@ -584,27 +701,77 @@ func (visor *Visor) SpawnApp(config *AppConfig, startCh chan<- struct{}) (err er
 	appLogger := logging.MustGetLogger(fmt.Sprintf("app_%s", config.App))
 	appArgs := append([]string{filepath.Join(visor.dir(), config.App)}, config.Args...)
 
-	pid, err := visor.procManager.Start(appLogger, appCfg, appArgs, logger, errLogger)
-	if err != nil {
-		return fmt.Errorf("error running app %s: %v", config.App, err)
-	}
+	visor.supervisor.started(config.App)
 
-	if startCh != nil {
-		startCh <- struct{}{}
-	}
+	for {
+		pid, startErr := visor.procManager.Start(appLogger, appCfg, appArgs, logger, errLogger)
+		if startErr != nil {
+			return fmt.Errorf("error running app %s: %v", config.App, startErr)
+		}
 
-	visor.pidMu.Lock()
+		visor.supervisor.running(config.App)
+		visor.events.Publish(EventAppStarted, map[string]string{"app": config.App})
 
-	visor.logger.Infof("storing app %s pid %d", config.App, pid)
+		if startCh != nil {
+			startCh <- struct{}{}
+			startCh = nil
+		}
+
+		visor.pidMu.Lock()
+
+		visor.logger.Infof("storing app %s pid %d", config.App, pid)
+
+		if err := visor.persistPID(config.App, pid); err != nil {
+			visor.pidMu.Unlock()
+			return err
+		}
 
-	if err := visor.persistPID(config.App, pid); err != nil {
 		visor.pidMu.Unlock()
-		return err
+
+		err = visor.procManager.Wait(config.App)
+
+		exit := visor.supervisor.exited(config.App, err, visor.restartConfig(config))
+		visor.publishAppExit(config.App, err, exit.stopped)
+
+		if !exit.restart {
+			return err
+		}
+
+		visor.logger.
+			WithError(err).
+			WithField("app_name", config.App).
+			WithField("restarts", exit.restarts).
+			Warnf("App exited, restarting it in %s.", exit.delay)
+
+		visor.events.Publish(EventAppRestarting, map[string]string{
+			"app":      config.App,
+			"restarts": strconv.Itoa(exit.restarts),
+			"delay":    exit.delay.String(),
+		})
+
+		select {
+		case <-time.After(exit.delay):
+		case <-exit.cancel:
+		}
+
+		if !visor.supervisor.restarting(config.App, exit.cancel) {
+			visor.logger.WithField("app_name", config.App).Info("Restart of app cancelled.")
+			return err
+		}
 	}
+}
+
+// restartConfig returns the restart policy of the app spawned with `config`.
+// The policy is taken from the current config of the app, so that reloaded policies apply to running apps.
+func (visor *Visor) restartConfig(config *AppConfig) *AppRestartConfig {
+	visor.appsMu.RLock()
+	defer visor.appsMu.RUnlock()
 
-	visor.pidMu.Unlock()
+	if current, ok := visor.appsConf[config.App]; ok {
+		return current.Restart
+	}
 
-	return visor.procManager.Wait(config.App)
+	return config.Restart
 }
 
 func (visor *Visor) persistPID(name string, pid appcommon.ProcID) error {
@@ -628,14 +795,23 @@ func (visor *Visor) persistPID(name string, pid appcommon.ProcID) error {
 
 // StopApp stops running App.
 func (visor *Visor) StopApp(appName string) error {
+	if visor.supervisor.cancelRestart(appName) {
+		visor.logger.Infof("Cancelled pending restart of app %s", appName)
+		return nil
+	}
+
 	if !visor.procManager.Exists(appName) {
 		return ErrUnknownApp
 	}
 
 	visor.logger.Infof("Stopping app %s and closing ports", appName)
 
+	visor.supervisor.setStopping(appName, true)
+
 	if err := visor.procManager.Stop(appName); err != nil {
 		visor.logger.Warn("Failed to stop app: ", err)
+		visor.supervisor.setStopping(appName, false)
+
 		return err
 	}
 
@@ -668,12 +844,18 @@ func (visor *Visor) Exec(command string) ([]byte, error) {
 // It checks if visor update is available.
 // If it is, the method downloads a new visor versions, starts it and kills the current process.
 func (visor *Visor) Update() (bool, error) {
+	visor.events.Publish(EventUpdateStarted, nil)
+
 	updated, err := visor.updater.Update()
 	if err != nil {
 		visor.logger.Errorf("Failed to update visor: %v", err)
+		visor.events.Publish(EventUpdateFailed, map[string]string{"error": err.Error()})
+
 		return false, err
 	}
 
+	visor.events.Publish(EventUpdateFinished, map[string]string{"updated": strconv.FormatBool(updated)})
+
 	return updated, nil
 }
 
@@ -689,14 +871,18 @@ func (visor *Visor) UpdateAvailable() (*updater.Version, error) {
 }
 
 func (visor *Visor) setAutoStart(appName string, autoStart bool) error {
+	visor.appsMu.Lock()
 	appConf, ok := visor.appsConf[appName]
+	if ok {
+		appConf.AutoStart = autoStart
+		visor.appsConf[appName] = appConf
+	}
+	visor.appsMu.Unlock()
+
 	if !ok {
 		return ErrUnknownApp
 	}
 
-	appConf.AutoStart = autoStart
-	visor.appsConf[appName] = appConf
-
 	visor.logger.Infof("Saving auto start = %v for app %v to config", autoStart, appName)
 
 	return visor.updateAppAutoStart(appName, autoStart)
@@ -746,61 +932,124 @@ func (visor *Visor) setSocksClientPK(pk cipher.PubKey) error {
 	return nil
 }
 
-func (visor *Visor) updateAppAutoStart(appName string, autoStart bool) error {
-	changed := false
+func (visor *Visor) setBandwidthLimits(limits router.BandwidthLimits) error {
+	visor.router.SetBandwidthLimits(limits)
 
-	for i := range visor.conf.Apps {
-		if visor.conf.Apps[i].App == appName {
-			visor.conf.Apps[i].AutoStart = autoStart
-			if v, ok := visor.appsConf[appName]; ok {
-				v.AutoStart = autoStart
-				visor.appsConf[appName] = v
-			}
+	visor.logger.Infof("Saving bandwidth limits %+v to config", limits)
 
-			changed = true
-			break
-		}
+	return visor.updateConfig(func(conf *Config) {
+		conf.RoutingConfig().BandwidthLimits = &limits
+	})
+}
+
+// bandwidthHistory returns bandwidth history of transports of given IDs, summed up.
+func (visor *Visor) bandwidthHistory(from, to time.Time, g transport.Granularity, ids ...uuid.UUID) ([]transport.BandwidthRecord, error) {
+	ls, ok := visor.tm.Conf.LogStore.(transport.HistoryLogStore)
+	if !ok {
+		return nil, ErrNoBandwidthHistory
 	}
 
-	if !changed {
-		return nil
+	if to.IsZero() {
+		to = time.Now()
+	}
+
+	if g == "" {
+		g = transport.GranularitySince(from)
 	}
 
-	return visor.conf.flush()
+	records := make([][]transport.BandwidthRecord, 0, len(ids))
+
+	for _, id := range ids {
+		rs, err := ls.History(id, g, from, to)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, rs)
+	}
+
+	return transport.MergeBandwidthRecords(records...), nil
+}
+
+func (visor *Visor) updateAppAutoStart(appName string, autoStart bool) error {
+	visor.appsMu.Lock()
+	if v, ok := visor.appsConf[appName]; ok {
+		v.AutoStart = autoStart
+		visor.appsConf[appName] = v
+	}
+	visor.appsMu.Unlock()
+
+	return visor.updateConfig(func(conf *Config) {
+		for i := range conf.Apps {
+			if conf.Apps[i].App == appName {
+				conf.Apps[i].AutoStart = autoStart
+				break
+			}
+		}
+	})
 }
 
 func (visor *Visor) updateAppArg(appName, argName, value string) error {
-	configChanged := true
+	return visor.updateConfig(func(conf *Config) {
+		for i := range conf.Apps {
+			if conf.Apps[i].App != appName {
+				continue
+			}
 
-	for i := range visor.conf.Apps {
-		argChanged := false
-		if visor.conf.Apps[i].App == appName {
-			configChanged = true
+			argChanged := false
 
-			for j := range visor.conf.Apps[i].Args {
-				if visor.conf.Apps[i].Args[j] == argName && j+1 < len(visor.conf.Apps[i].Args) {
-					visor.conf.Apps[i].Args[j+1] = value
+			for j := range conf.Apps[i].Args {
+				if conf.Apps[i].Args[j] == argName && j+1 < len(conf.Apps[i].Args) {
+					conf.Apps[i].Args[j+1] = value
 					argChanged = true
 					break
 				}
 			}
 
 			if !argChanged {
-				visor.conf.Apps[i].Args = append(visor.conf.Apps[i].Args, argName, value)
+				conf.Apps[i].Args = append(conf.Apps[i].Args, argName, value)
 			}
 
+			visor.appsMu.Lock()
 			if v, ok := visor.appsConf[appName]; ok {
-				v.Args = visor.conf.Apps[i].Args
+				v.Args = append([]string(nil), conf.Apps[i].Args...)
 				visor.appsConf[appName] = v
 			}
+			visor.appsMu.Unlock()
 		}
-	}
+	})
+}
 
-	if configChanged {
-		return visor.conf.flush()
+// config returns the current config. It must not be modified, use updateConfig instead.
+func (visor *Visor) config() *Config {
+	visor.confMu.RLock()
+	defer visor.confMu.RUnlock()
+
+	return visor.conf
+}
+
+// setConfig takes `conf` as the current config.
+func (visor *Visor) setConfig(conf *Config) {
+	visor.confMu.Lock()
+	visor.conf = conf
+	visor.confMu.Unlock()
+}
+
+// updateConfig applies `update` to a copy of the current config, takes the copy as the current config
+// and flushes it to the config file.
+func (visor *Visor) updateConfig(update func(conf *Config)) error {
+	visor.reloadMu.Lock()
+	defer visor.reloadMu.Unlock()
+
+	conf, err := visor.config().clone()
+	if err != nil {
+		return err
 	}
 
-	return nil
+	update(conf)
+	visor.setConfig(conf)
+
+	return conf.flush()
 }
 
 // UnlinkSocketFiles removes unix socketFiles from file system
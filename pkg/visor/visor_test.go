@@ -1,6 +1,7 @@
 package visor
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -140,7 +141,7 @@ func TestVisorStartClose(t *testing.T) {
 
 	var netConf snet.Config
 
-	network := snet.NewRaw(netConf, dmsgC, nil)
+	network := snet.NewRaw(netConf, dmsgC, nil, nil, nil)
 	tmConf := &transport.ManagerConfig{
 		PubKey:          cipher.PubKey{},
 		DiscoveryClient: transport.NewDiscoveryMock(),
@@ -224,6 +225,85 @@ func TestVisorSpawnApp(t *testing.T) {
 	require.NoError(t, visor.StopApp(app.App))
 }
 
+func TestVisorSpawnAppRestart(t *testing.T) {
+	defer func() {
+		require.NoError(t, os.RemoveAll("skychat"))
+	}()
+
+	app := AppConfig{
+		App:  "skychat",
+		Port: 10,
+		Restart: &AppRestartConfig{
+			Policy:     AppRestartOnFailure,
+			MaxRetries: 2,
+			Backoff:    Duration(time.Millisecond),
+		},
+	}
+
+	visorCfg := Config{
+		KeyPair:       NewKeyPair(),
+		AppServerAddr: appcommon.DefaultServerAddr,
+	}
+
+	visor := &Visor{
+		appsConf: map[string]AppConfig{app.App: app},
+		logger:   logging.MustGetLogger("test"),
+		conf:     &visorCfg,
+	}
+
+	require.NoError(t, pathutil.EnsureDir(visor.dir()))
+
+	defer func() {
+		require.NoError(t, os.RemoveAll(visor.dir()))
+	}()
+
+	appErr := errors.New("failed")
+
+	pm := &appserver.MockProcManager{}
+	pm.On("Start", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(appcommon.ProcID(10), testhelpers.NoErr)
+	pm.On("Wait", app.App).Return(appErr)
+	pm.On("Exists", app.App).Return(false)
+
+	visor.procManager = pm
+
+	t.Run("app is restarted up to max retries", func(t *testing.T) {
+		require.Equal(t, appErr, visor.SpawnApp(&app, nil))
+		pm.AssertNumberOfCalls(t, "Start", 3)
+
+		state, ok := visor.App(app.App)
+		require.True(t, ok)
+		assert.Equal(t, 2, state.Restarts)
+		require.NotNil(t, state.LastExitCode)
+		assert.Equal(t, -1, *state.LastExitCode)
+	})
+
+	t.Run("stopping app cancels pending restart", func(t *testing.T) {
+		app.Restart.Backoff = Duration(time.Hour)
+
+		errCh := make(chan error)
+		go func() {
+			errCh <- visor.SpawnApp(&app, nil)
+		}()
+
+		require.Eventually(t, func() bool {
+			return visor.StopApp(app.App) == nil
+		}, time.Second, 10*time.Millisecond)
+
+		assert.Equal(t, appErr, <-errCh)
+		pm.AssertNumberOfCalls(t, "Start", 4)
+	})
+
+	t.Run("reloaded policy applies to running app", func(t *testing.T) {
+		reloaded := app
+		reloaded.Restart = &AppRestartConfig{Policy: AppRestartNever}
+		visor.appsConf[app.App] = reloaded
+
+		require.Equal(t, appErr, visor.SpawnApp(&app, nil))
+		pm.AssertNumberOfCalls(t, "Start", 5)
+	})
+}
+
 func TestVisorSpawnAppValidations(t *testing.T) {
 	r := &router.MockRouter{}
 	r.On("Serve", mock.Anything /* context */).Return(testhelpers.NoErr)